@@ -0,0 +1,375 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package appcheck contains functions for verifying Firebase App Check tokens.
+package appcheck // import "firebase.google.com/go/appcheck"
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"firebase.google.com/go/internal"
+)
+
+const (
+	appCheckIssuer   = "https://firebaseappcheck.googleapis.com/"
+	jwksURL          = "https://firebaseappcheck.googleapis.com/v1/jwks"
+	appCheckEndpoint = "https://firebaseappcheck.googleapis.com/v1beta"
+
+	// The App Check JWKS are rotated infrequently, and the service recommends caching them for
+	// no more than 6 hours.
+	jwksCacheDuration = 6 * time.Hour
+
+	invalidToken = "invalid-app-check-token"
+	tokenExpired = "app-check-token-expired"
+)
+
+// DecodedAppCheckToken represents a verified App Check token.
+//
+// Subject and AppID both contain the ID of the Firebase App the token was issued to. Claims
+// contains all the claims of the token, including the ones parsed into the other fields.
+type DecodedAppCheckToken struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	IssuedAt  time.Time
+	AppID     string
+	Claims    map[string]interface{}
+
+	// AlreadyConsumed indicates whether the token had already been consumed before the call to
+	// VerifyTokenAndConsume that returned it. It is always false for tokens returned by
+	// VerifyToken.
+	AlreadyConsumed bool
+}
+
+// Client is the interface for the Firebase App Check service.
+type Client struct {
+	// To enable testing against arbitrary endpoints.
+	endpoint string
+	jwksURL  string
+
+	client     *internal.HTTPClient
+	jwksClient *internal.HTTPClient
+	project    string
+	version    string
+	now        func() time.Time
+
+	mu         sync.Mutex
+	keys       map[string]*rsa.PublicKey
+	keysExpiry time.Time
+}
+
+// NewClient creates a new instance of the Firebase App Check Client.
+//
+// This function can only be invoked from within the SDK. Client applications should access the
+// App Check service through firebase.App.
+func NewClient(ctx context.Context, c *internal.AppCheckConfig) (*Client, error) {
+	if c.ProjectID == "" {
+		return nil, errors.New("project id is required to access app check client")
+	}
+
+	hc, err := internal.NewHTTPClient(ctx, c.Transport, c.Opts...)
+	if err != nil {
+		return nil, err
+	}
+	hc = internal.WithHeaders(hc, c.Headers, c.UserAgentSuffix)
+	hc = internal.Instrument(hc, c.Instrumentation, "appcheck")
+	hc = internal.WithGuard(hc, c.RequestGuard)
+
+	jwksClient := internal.Instrument(http.DefaultClient, c.Instrumentation, "appcheck")
+	jwksClient = internal.WithGuard(jwksClient, c.RequestGuard)
+	retry := internal.NewRetryConfig(c.MaxRetries)
+	return &Client{
+		endpoint: appCheckEndpoint,
+		jwksURL:  jwksURL,
+		client: &internal.HTTPClient{
+			Client:      hc,
+			MaxBodySize: c.MaxResponseBodySize,
+			RetryConfig: retry,
+			Timeout:     c.RequestTimeout,
+		},
+		jwksClient: &internal.HTTPClient{
+			Client:      jwksClient,
+			MaxBodySize: c.MaxResponseBodySize,
+			RetryConfig: retry,
+			Timeout:     c.RequestTimeout,
+		},
+		project: c.ProjectID,
+		version: "Go/Admin/" + c.Version,
+		now:     time.Now,
+	}, nil
+}
+
+// IsInvalidToken checks if the given error was due to an App Check token that is malformed, has
+// an invalid signature, or was not issued for the project of the Client.
+func IsInvalidToken(err error) bool {
+	return internal.HasErrorCode(err, invalidToken)
+}
+
+// IsTokenExpired checks if the given error was due to an expired App Check token.
+func IsTokenExpired(err error) bool {
+	return internal.HasErrorCode(err, tokenExpired)
+}
+
+// VerifyToken verifies the given App Check token, and returns its decoded claims.
+//
+// VerifyToken checks that the token is signed by the App Check service, has not expired, and was
+// issued for the project of the Client. The public keys used to verify the signatures are fetched
+// from the App Check service, and cached for up to 6 hours.
+func (c *Client) VerifyToken(ctx context.Context, token string) (t *DecodedAppCheckToken, err error) {
+	defer internal.WrapOpError(&err, "VerifyToken", "")
+	return c.verifyToken(ctx, token)
+}
+
+// VerifyTokenAndConsume verifies the given App Check token like VerifyToken, and then marks it as
+// consumed with the App Check service.
+//
+// Each token can be consumed only once. The AlreadyConsumed field of the returned token indicates
+// whether the token had been consumed before, in which case the request that presented it is
+// likely a replay, and should be rejected.
+func (c *Client) VerifyTokenAndConsume(
+	ctx context.Context, token string) (t *DecodedAppCheckToken, err error) {
+
+	defer internal.WrapOpError(&err, "VerifyTokenAndConsume", "")
+	t, err = c.verifyToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// The request is not idempotent, and is therefore not retried after network errors or 5xx
+	// responses: a retry of a request the server has processed would report the token as consumed.
+	body := map[string]string{"app_check_token": token}
+	resp, err := c.client.Do(ctx, &internal.Request{
+		Method: http.MethodPost,
+		URL:    fmt.Sprintf("%s/projects/%s:verifyAppCheckToken", c.endpoint, c.project),
+		Body:   internal.NewJSONEntity(body),
+		Opts:   []internal.HTTPOption{internal.WithHeader("X-Client-Version", c.version)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		AlreadyConsumed bool `json:"alreadyConsumed"`
+	}
+	if err := resp.Unmarshal(http.StatusOK, &result); err != nil {
+		return nil, err
+	}
+	t.AlreadyConsumed = result.AlreadyConsumed
+	return t, nil
+}
+
+func (c *Client) verifyToken(ctx context.Context, token string) (*DecodedAppCheckToken, error) {
+	if token == "" {
+		return nil, internal.Error(invalidToken, "app check token must be a non-empty string")
+	}
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, internal.Error(invalidToken, "incorrect number of segments in app check token")
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		Type      string `json:"typ"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeSegment(segments[0], &header); err != nil {
+		return nil, internal.Errorf(invalidToken, "failed to decode app check token header: %v", err)
+	}
+	if header.Algorithm != "RS256" {
+		return nil, internal.Errorf(invalidToken,
+			"app check token has invalid algorithm; expected %q but got %q", "RS256", header.Algorithm)
+	}
+	if header.Type != "JWT" {
+		return nil, internal.Errorf(invalidToken,
+			"app check token has invalid type; expected %q but got %q", "JWT", header.Type)
+	}
+	if header.KeyID == "" {
+		return nil, internal.Error(invalidToken, "app check token has no 'kid' header")
+	}
+
+	key, err := c.publicKey(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(segments, key); err != nil {
+		return nil, internal.Errorf(invalidToken, "failed to verify app check token signature: %v", err)
+	}
+
+	t, err := decodeClaims(segments[1])
+	if err != nil {
+		return nil, internal.Errorf(invalidToken, "failed to decode app check token claims: %v", err)
+	}
+	if err := c.checkClaims(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (c *Client) checkClaims(t *DecodedAppCheckToken) error {
+	if !strings.HasPrefix(t.Issuer, appCheckIssuer) {
+		return internal.Errorf(invalidToken,
+			"app check token has invalid issuer; expected prefix %q but got %q", appCheckIssuer, t.Issuer)
+	}
+	want := "projects/" + c.project
+	found := false
+	for _, aud := range t.Audience {
+		if aud == want {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return internal.Errorf(invalidToken,
+			"app check token has invalid audience; expected %q in %q", want, t.Audience)
+	}
+	if t.Subject == "" {
+		return internal.Error(invalidToken, "app check token has empty 'sub' (subject) claim")
+	}
+	if now := c.now(); !now.Before(t.ExpiresAt) {
+		return internal.Errorf(tokenExpired, "app check token has expired at: %v", t.ExpiresAt)
+	}
+	return nil
+}
+
+// publicKey returns the App Check public key with the given key ID, fetching the keys from the
+// App Check service if the cached keys have expired or do not contain the key.
+func (c *Client) publicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys == nil || !c.now().Before(c.keysExpiry) {
+		if err := c.refreshKeys(ctx); err != nil {
+			return nil, err
+		}
+	}
+	key, ok := c.keys[kid]
+	if !ok {
+		return nil, internal.Errorf(invalidToken, "no app check public key found for kid: %q", kid)
+	}
+	return key, nil
+}
+
+func (c *Client) refreshKeys(ctx context.Context) error {
+	resp, err := c.jwksClient.Do(ctx, &internal.Request{Method: http.MethodGet, URL: c.jwksURL})
+	if err != nil {
+		return err
+	}
+
+	var jwks struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := resp.Unmarshal(http.StatusOK, &jwks); err != nil {
+		return fmt.Errorf("failed to fetch app check public keys: %v", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.KeyType != "RSA" || k.KeyID == "" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return fmt.Errorf("invalid modulus in app check public key %q: %v", k.KeyID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return fmt.Errorf("invalid exponent in app check public key %q: %v", k.KeyID, err)
+		}
+		keys[k.KeyID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return errors.New("no app check public keys found")
+	}
+	c.keys = keys
+	c.keysExpiry = c.now().Add(jwksCacheDuration)
+	return nil
+}
+
+func verifySignature(segments []string, key *rsa.PublicKey) error {
+	signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	h.Write([]byte(segments[0] + "." + segments[1]))
+	return rsa.VerifyPKCS1v15(key, crypto.SHA256, h.Sum(nil), signature)
+}
+
+func decodeClaims(s string) (*DecodedAppCheckToken, error) {
+	var claims map[string]interface{}
+	if err := decodeSegment(s, &claims); err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		Issuer    string          `json:"iss"`
+		Subject   string          `json:"sub"`
+		Audience  json.RawMessage `json:"aud"`
+		ExpiresAt int64           `json:"exp"`
+		IssuedAt  int64           `json:"iat"`
+	}
+	if err := decodeSegment(s, &payload); err != nil {
+		return nil, err
+	}
+
+	// The audience may be a single string or a list of strings.
+	var aud []string
+	if len(payload.Audience) > 0 {
+		var single string
+		if err := json.Unmarshal(payload.Audience, &single); err == nil {
+			aud = []string{single}
+		} else if err := json.Unmarshal(payload.Audience, &aud); err != nil {
+			return nil, fmt.Errorf("invalid 'aud' claim: %v", err)
+		}
+	}
+
+	return &DecodedAppCheckToken{
+		Issuer:    payload.Issuer,
+		Subject:   payload.Subject,
+		Audience:  aud,
+		ExpiresAt: time.Unix(payload.ExpiresAt, 0),
+		IssuedAt:  time.Unix(payload.IssuedAt, 0),
+		AppID:     payload.Subject,
+		Claims:    claims,
+	}, nil
+}
+
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,374 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appcheck
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/api/option"
+
+	"firebase.google.com/go/internal"
+)
+
+const (
+	testProjectID     = "test-project"
+	testProjectNumber = "123456789"
+	testAppID         = "1:123456789:web:abcdef"
+	testKeyID         = "test-key"
+)
+
+var testAppCheckConfig = &internal.AppCheckConfig{
+	ProjectID: testProjectID,
+	Opts: []option.ClientOption{
+		option.WithTokenSource(&internal.MockTokenSource{AccessToken: "test-token"}),
+	},
+	Version: "test-version",
+}
+
+var (
+	testKey  *rsa.PrivateKey
+	testNow  = time.Unix(1500000000, 0)
+	testJWKS string
+)
+
+func init() {
+	var err error
+	testKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": testKeyID,
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(testKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(testKey.E)).Bytes()),
+			},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	testJWKS = string(b)
+}
+
+type mockServer struct {
+	jwksRequests int
+	consumed     bool
+
+	req  *http.Request
+	body []byte
+}
+
+func (s *mockServer) start(t *testing.T) (*Client, *httptest.Server) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		s.jwksRequests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(testJWKS))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		s.req = r
+		s.body, _ = ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		resp, _ := json.Marshal(map[string]bool{"alreadyConsumed": s.consumed})
+		w.Write(resp)
+	})
+	ts := httptest.NewServer(mux)
+
+	client, err := NewClient(context.Background(), testAppCheckConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.endpoint = ts.URL
+	client.jwksURL = ts.URL + "/jwks"
+	client.now = func() time.Time { return testNow }
+	return client, ts
+}
+
+func testClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss": appCheckIssuer + testProjectNumber,
+		"sub": testAppID,
+		"aud": []string{"projects/" + testProjectNumber, "projects/" + testProjectID},
+		"exp": testNow.Add(time.Hour).Unix(),
+		"iat": testNow.Add(-time.Minute).Unix(),
+	}
+}
+
+func signToken(t *testing.T, header, claims map[string]interface{}) string {
+	encode := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	content := encode(header) + "." + encode(claims)
+	h := sha256.Sum256([]byte(content))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, testKey, crypto.SHA256, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func testHeader() map[string]interface{} {
+	return map[string]interface{}{"alg": "RS256", "typ": "JWT", "kid": testKeyID}
+}
+
+func TestNoProjectID(t *testing.T) {
+	client, err := NewClient(context.Background(), &internal.AppCheckConfig{})
+	if client != nil || err == nil {
+		t.Errorf("NewClient() = (%v, %v); want = (nil, error)", client, err)
+	}
+}
+
+func TestVerifyToken(t *testing.T) {
+	s := &mockServer{}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	token := signToken(t, testHeader(), testClaims())
+	got, err := client.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &DecodedAppCheckToken{
+		Issuer:    appCheckIssuer + testProjectNumber,
+		Subject:   testAppID,
+		Audience:  []string{"projects/" + testProjectNumber, "projects/" + testProjectID},
+		ExpiresAt: time.Unix(testNow.Add(time.Hour).Unix(), 0),
+		IssuedAt:  time.Unix(testNow.Add(-time.Minute).Unix(), 0),
+		AppID:     testAppID,
+	}
+	claims := got.Claims
+	got.Claims = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("VerifyToken() = %#v; want = %#v", got, want)
+	}
+	if claims["sub"] != testAppID {
+		t.Errorf("Claims[sub] = %v; want = %q", claims["sub"], testAppID)
+	}
+	if s.req != nil {
+		t.Errorf("VerifyToken() made a request to %q; want no requests", s.req.URL.Path)
+	}
+
+	// The public keys are cached until they expire.
+	if _, err := client.VerifyToken(context.Background(), token); err != nil {
+		t.Fatal(err)
+	}
+	if s.jwksRequests != 1 {
+		t.Errorf("JWKS requests = %d; want = 1", s.jwksRequests)
+	}
+	client.now = func() time.Time { return testNow.Add(jwksCacheDuration) }
+	client.VerifyToken(context.Background(), token)
+	if s.jwksRequests != 2 {
+		t.Errorf("JWKS requests = %d; want = 2", s.jwksRequests)
+	}
+}
+
+func TestVerifyTokenSingleAudience(t *testing.T) {
+	s := &mockServer{}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	claims := testClaims()
+	claims["aud"] = "projects/" + testProjectID
+	got, err := client.VerifyToken(context.Background(), signToken(t, testHeader(), claims))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"projects/" + testProjectID}; !reflect.DeepEqual(got.Audience, want) {
+		t.Errorf("Audience = %v; want = %v", got.Audience, want)
+	}
+}
+
+func TestVerifyTokenError(t *testing.T) {
+	s := &mockServer{}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	withHeader := func(k string, v interface{}) string {
+		h := testHeader()
+		h[k] = v
+		return signToken(t, h, testClaims())
+	}
+	withClaim := func(k string, v interface{}) string {
+		c := testClaims()
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+		return signToken(t, testHeader(), c)
+	}
+	valid := signToken(t, testHeader(), testClaims())
+	parts := strings.Split(valid, ".")
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	badSig, err := rsa.SignPKCS1v15(rand.Reader, otherKey, crypto.SHA256, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name  string
+		token string
+		check func(error) bool
+	}{
+		{"Empty", "", IsInvalidToken},
+		{"Malformed", "not.a.token", IsInvalidToken},
+		{"TwoSegments", parts[0] + "." + parts[1], IsInvalidToken},
+		{"Algorithm", withHeader("alg", "HS256"), IsInvalidToken},
+		{"Type", withHeader("typ", "JWS"), IsInvalidToken},
+		{"NoKeyID", withHeader("kid", ""), IsInvalidToken},
+		{"UnknownKeyID", withHeader("kid", "other-key"), IsInvalidToken},
+		{"Signature", parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString(badSig),
+			IsInvalidToken},
+		{"Issuer", withClaim("iss", "https://example.com/"), IsInvalidToken},
+		{"Audience", withClaim("aud", []string{"projects/other-project"}), IsInvalidToken},
+		{"NoAudience", withClaim("aud", nil), IsInvalidToken},
+		{"Subject", withClaim("sub", ""), IsInvalidToken},
+		{"Expired", withClaim("exp", testNow.Unix()), IsTokenExpired},
+	}
+	for _, tc := range cases {
+		got, err := client.VerifyToken(context.Background(), tc.token)
+		if got != nil || err == nil || !tc.check(err) {
+			t.Errorf("VerifyToken(%s) = (%v, %v); want = (nil, error)", tc.name, got, err)
+		}
+		if err != nil && !strings.HasPrefix(err.Error(), "VerifyToken: ") {
+			t.Errorf("VerifyToken(%s) = %q; want = prefix %q", tc.name, err.Error(), "VerifyToken: ")
+		}
+	}
+}
+
+func TestVerifyTokenKeyFetchError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(context.Background(), testAppCheckConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.jwksURL = ts.URL
+	client.now = func() time.Time { return testNow }
+
+	got, err := client.VerifyToken(context.Background(), signToken(t, testHeader(), testClaims()))
+	if got != nil || err == nil || IsInvalidToken(err) {
+		t.Errorf("VerifyToken() = (%v, %v); want = (nil, key fetch error)", got, err)
+	}
+}
+
+func TestVerifyTokenAndConsume(t *testing.T) {
+	for _, consumed := range []bool{false, true} {
+		s := &mockServer{consumed: consumed}
+		client, ts := s.start(t)
+
+		token := signToken(t, testHeader(), testClaims())
+		got, err := client.VerifyTokenAndConsume(context.Background(), token)
+		ts.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.AppID != testAppID || got.AlreadyConsumed != consumed {
+			t.Errorf("VerifyTokenAndConsume() = (%q, %v); want = (%q, %v)",
+				got.AppID, got.AlreadyConsumed, testAppID, consumed)
+		}
+
+		wantPath := "/projects/" + testProjectID + ":verifyAppCheckToken"
+		if s.req.Method != http.MethodPost || s.req.URL.Path != wantPath {
+			t.Errorf("Request = %s %s; want = POST %s", s.req.Method, s.req.URL.Path, wantPath)
+		}
+		if h := s.req.Header.Get("Authorization"); h != "Bearer test-token" {
+			t.Errorf("Authorization = %q; want = %q", h, "Bearer test-token")
+		}
+		if h := s.req.Header.Get("X-Client-Version"); h != "Go/Admin/test-version" {
+			t.Errorf("X-Client-Version = %q; want = %q", h, "Go/Admin/test-version")
+		}
+		var body map[string]string
+		if err := json.Unmarshal(s.body, &body); err != nil {
+			t.Fatal(err)
+		}
+		if want := map[string]string{"app_check_token": token}; !reflect.DeepEqual(body, want) {
+			t.Errorf("Body = %v; want = %v", body, want)
+		}
+	}
+}
+
+func TestVerifyTokenAndConsumeInvalidToken(t *testing.T) {
+	s := &mockServer{}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	claims := testClaims()
+	claims["exp"] = testNow.Add(-time.Minute).Unix()
+	got, err := client.VerifyTokenAndConsume(context.Background(), signToken(t, testHeader(), claims))
+	if got != nil || !IsTokenExpired(err) {
+		t.Errorf("VerifyTokenAndConsume() = (%v, %v); want = (nil, expired error)", got, err)
+	}
+	if s.req != nil {
+		t.Errorf("VerifyTokenAndConsume() consumed an invalid token")
+	}
+}
+
+func TestVerifyTokenAndConsumeError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/jwks" {
+			w.Write([]byte(testJWKS))
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error": {"message": "permission denied"}}`))
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(context.Background(), testAppCheckConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.endpoint = ts.URL
+	client.jwksURL = ts.URL + "/jwks"
+	client.now = func() time.Time { return testNow }
+
+	got, err := client.VerifyTokenAndConsume(context.Background(), signToken(t, testHeader(), testClaims()))
+	want := `VerifyTokenAndConsume: http error status: 403; reason: {"error": {"message": "permission denied"}}`
+	if got != nil || err == nil || err.Error() != want {
+		t.Errorf("VerifyTokenAndConsume() = (%v, %v); want = (nil, %q)", got, err, want)
+	}
+}
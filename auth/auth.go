@@ -16,26 +16,45 @@
 package auth
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/net/context"
 
 	"firebase.google.com/go/internal"
+	"golang.org/x/oauth2"
 	"google.golang.org/api/identitytoolkit/v3"
-	"google.golang.org/api/transport"
+	"google.golang.org/api/option"
 )
 
+const emulatorAccessToken = "owner"
+const emulatorEmail = "firebase-auth-emulator@example.com"
+const emulatorHostEnvVar = "FIREBASE_AUTH_EMULATOR_HOST"
 const firebaseAudience = "https://identitytoolkit.googleapis.com/google.identity.identitytoolkit.v1.IdentityToolkit"
 const googleCertURL = "https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com"
+const idToolkitV1URL = "https://identitytoolkit.googleapis.com/v1"
 const issuerPrefix = "https://securetoken.google.com/"
+const projectMgtURL = "https://identitytoolkit.googleapis.com/admin/v2"
+const tokenExchangeURL = "https://www.googleapis.com/identitytoolkit/v3/relyingparty/verifyCustomToken"
 const tokenExpSeconds = 3600
 
+var errVerifyOnly = errors.New("auth client is not configured for this operation; " +
+	"use a client initialized with credentials instead of a verify-only client")
+
 var reservedClaims = []string{
 	"acr", "amr", "at_hash", "aud", "auth_time", "azp", "cnf", "c_hash",
 	"exp", "firebase", "iat", "iss", "jti", "nbf", "nonce", "sub",
@@ -47,15 +66,36 @@ var clk clock = &systemClock{}
 //
 // Token provides typed accessors to the common JWT fields such as Audience (aud) and Expiry (exp).
 // Additionally it provides a UID field, which indicates the user ID of the account to which this token
-// belongs. Any additional JWT claims can be accessed via the Claims map of Token.
+// belongs. SecondFactorIdentifier holds the type of the second factor (e.g. "phone") the user signed
+// in with, as recorded in the firebase.sign_in_second_factor claim. It is empty for single-factor
+// sign-ins. TenantID holds the tenant the user belongs to, as recorded in the firebase.tenant claim,
+// and is empty for users outside of any tenant. SignInProvider holds the provider the user signed
+// in with (e.g. "phone" or "password"), as recorded in the firebase.sign_in_provider claim.
+// PhoneNumber holds the phone number of the user, as recorded in the phone_number claim, and is
+// empty for users without one. Any additional JWT claims can be accessed via the Claims map of
+// Token.
 type Token struct {
-	Issuer   string                 `json:"iss"`
-	Audience string                 `json:"aud"`
-	Expires  int64                  `json:"exp"`
-	IssuedAt int64                  `json:"iat"`
-	Subject  string                 `json:"sub,omitempty"`
-	UID      string                 `json:"uid,omitempty"`
-	Claims   map[string]interface{} `json:"-"`
+	Issuer                 string                 `json:"iss"`
+	Audience               string                 `json:"aud"`
+	Expires                int64                  `json:"exp"`
+	IssuedAt               int64                  `json:"iat"`
+	AuthTime               int64                  `json:"auth_time,omitempty"`
+	Subject                string                 `json:"sub,omitempty"`
+	UID                    string                 `json:"uid,omitempty"`
+	SecondFactorIdentifier string                 `json:"-"`
+	TenantID               string                 `json:"-"`
+	SignInProvider         string                 `json:"-"`
+	PhoneNumber            string                 `json:"-"`
+	Claims                 map[string]interface{} `json:"-"`
+
+	hasSubject bool // whether the decoded token had a non-null 'sub' claim
+}
+
+// TimeUntilExpiry returns the time remaining until the token expires, relative to now. The result
+// is negative if the token has already expired. Since the 'exp' claim has a resolution of seconds,
+// so does the result when now is a whole number of seconds.
+func (t *Token) TimeUntilExpiry(now time.Time) time.Duration {
+	return time.Unix(t.Expires, 0).Sub(now)
 }
 
 // Client is the interface for the Firebase auth service.
@@ -64,26 +104,59 @@ type Token struct {
 // by Firebase backend services.
 type Client struct {
 	is        *identitytoolkit.Service
-	ks        keySource
+	ks        KeySource
+	cks       KeySource
+	cookieKS  KeySource
+	sv        SignatureVerifier
 	projectID string
 	snr       signer
 	version   string
+	limiter   *rateLimiter
+	tracer    Tracer
+	skew      *CustomTokenSkew
+	clockSkew time.Duration
+	emulator  bool // if set, token signatures are not verified
+
+	keyPassphrase string   // if empty, the passphrase is read from the environment
+	tenantID      string   // if set, custom tokens are minted for, and tokens must belong to, the tenant
+	clock         clock    // if nil, clk is used
+	projects      []string // if empty, only tokens of projectID are accepted
+	audiences     []string // if empty, the audience must be one of the accepted projects
+
+	cookieClockSkew *time.Duration       // if nil, clockSkew applies to session cookies
+	providerCache   *providerConfigCache // if nil, provider configs are not cached
+	decoder         jsonDecoder
+
+	apiKey           string
+	hc               *internal.HTTPClient
+	exchangeEndpoint string // to enable testing against arbitrary endpoints
+
+	adminClient         *internal.HTTPClient
+	projectEndpoint     string // to enable testing against arbitrary endpoints
+	idToolkitV1Endpoint string // to enable testing against arbitrary endpoints
 }
 
+// ClientOption is an option that configures a Client at construction time.
+type ClientOption func(*Client) error
+
 type signer interface {
-	Email() (string, error)
-	Sign(b []byte) ([]byte, error)
+	Email(ctx context.Context) (string, error)
+	Sign(ctx context.Context, b []byte) ([]byte, error)
 }
 
 // NewClient creates a new instance of the Firebase Auth Client.
 //
 // This function can only be invoked from within the SDK. Client applications should access the
 // Auth service through firebase.App.
-func NewClient(ctx context.Context, c *internal.AuthConfig) (*Client, error) {
+func NewClient(ctx context.Context, c *internal.AuthConfig, opts ...ClientOption) (*Client, error) {
+	if c.VerifyOnly {
+		return newVerifyOnlyClient(c, opts...)
+	}
+
 	var (
-		err   error
-		email string
-		pk    *rsa.PrivateKey
+		err    error
+		email  string
+		rawKey string
 	)
 	if c.Creds != nil && len(c.Creds.JSON) > 0 {
 		var svcAcct struct {
@@ -93,28 +166,48 @@ func NewClient(ctx context.Context, c *internal.AuthConfig) (*Client, error) {
 		if err := json.Unmarshal(c.Creds.JSON, &svcAcct); err != nil {
 			return nil, err
 		}
-		if svcAcct.PrivateKey != "" {
-			pk, err = parseKey(svcAcct.PrivateKey)
-			if err != nil {
-				return nil, err
-			}
-		}
 		email = svcAcct.ClientEmail
+		rawKey = svcAcct.PrivateKey
 	}
 
+	emulatorHost := os.Getenv(emulatorHostEnvVar)
+	transportOpts := c.Opts
+	if emulatorHost != "" {
+		// The emulator accepts any request authorized with the "owner" access token.
+		ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: emulatorAccessToken})
+		transportOpts = append(append([]option.ClientOption(nil), c.Opts...), option.WithTokenSource(ts))
+	}
+	hc, err := internal.NewHTTPClient(ctx, c.Transport, transportOpts...)
+	if err != nil {
+		return nil, err
+	}
+	hc = internal.WithHeaders(hc, c.Headers, c.UserAgentSuffix)
+	hc = internal.Instrument(hc, c.Instrumentation, "auth")
+	hc = internal.WithGuard(hc, c.RequestGuard)
+
+	// The private key is parsed once the options are applied, since they may carry the passphrase
+	// of an encrypted key.
 	var snr signer
-	if email != "" && pk != nil {
-		snr = serviceAcctSigner{email: email, pk: pk}
-	} else {
-		snr, err = newSigner(ctx)
+	if emulatorHost != "" {
+		snr = emulatorSigner{}
+		rawKey = ""
+	} else if email == "" || rawKey == "" {
+		// Only the signBlob calls of the signer require the cloud-platform scope, so they are made
+		// with a separate client that requests it.
+		signerOpts := c.SignerOpts
+		if signerOpts == nil {
+			signerOpts = c.Opts
+		}
+		shc, err := internal.NewHTTPClient(ctx, c.Transport, signerOpts...)
 		if err != nil {
 			return nil, err
 		}
-	}
-
-	hc, _, err := transport.NewHTTPClient(ctx, c.Opts...)
-	if err != nil {
-		return nil, err
+		shc = internal.WithHeaders(shc, c.Headers, c.UserAgentSuffix)
+		shc = internal.Instrument(shc, c.Instrumentation, "auth")
+		shc = internal.WithGuard(shc, c.RequestGuard)
+		if snr, err = newSigner(ctx, email, shc, c); err != nil {
+			return nil, err
+		}
 	}
 
 	is, err := identitytoolkit.New(hc)
@@ -122,30 +215,575 @@ func NewClient(ctx context.Context, c *internal.AuthConfig) (*Client, error) {
 		return nil, err
 	}
 
-	return &Client{
+	ks, cookieKS := newKeySources(hc, c)
+	retry := internal.NewRetryConfig(c.MaxRetries)
+	exchangeClient := internal.Instrument(unauthorizedClient(c.Transport), c.Instrumentation, "auth")
+	exchangeClient = internal.WithGuard(exchangeClient, c.RequestGuard)
+	client := &Client{
 		is:        is,
-		ks:        newHTTPKeySource(googleCertURL, hc),
+		ks:        ks,
+		cookieKS:  cookieKS,
+		sv:        stdSignatureVerifier{},
 		projectID: c.ProjectID,
 		snr:       snr,
 		version:   "Go/Admin/" + c.Version,
-	}, nil
+		emulator:  emulatorHost != "",
+
+		hc: &internal.HTTPClient{
+			Client:      exchangeClient,
+			MaxBodySize: c.MaxResponseBodySize,
+			RetryConfig: retry,
+			Timeout:     c.RequestTimeout,
+		},
+		exchangeEndpoint: tokenExchangeURL,
+
+		adminClient: &internal.HTTPClient{
+			Client:      hc,
+			MaxBodySize: c.MaxResponseBodySize,
+			RetryConfig: retry,
+			Timeout:     c.RequestTimeout,
+		},
+		projectEndpoint:     projectMgtURL,
+		idToolkitV1Endpoint: idToolkitV1URL,
+	}
+	if emulatorHost != "" {
+		is.BasePath = emulatorURL(emulatorHost, is.BasePath)
+		client.exchangeEndpoint = emulatorURL(emulatorHost, tokenExchangeURL)
+		client.projectEndpoint = emulatorURL(emulatorHost, projectMgtURL)
+		client.idToolkitV1Endpoint = emulatorURL(emulatorHost, idToolkitV1URL)
+	}
+	for _, opt := range opts {
+		if err := opt(client); err != nil {
+			return nil, err
+		}
+	}
+
+	if rawKey != "" {
+		pk, err := parseKey(rawKey, client.privateKeyPassphrase())
+		if err != nil {
+			return nil, err
+		}
+		if email != "" {
+			client.snr = serviceAcctSigner{email: email, pk: pk}
+			client.cks = &staticKeySource{keys: []*PublicKey{{Key: pk.Public()}}}
+		}
+	}
+	return client, nil
+}
+
+// unauthorizedClient returns an http.Client for requests that are not authorized with the
+// credentials of the App, which sends the requests through base if it is not nil.
+func unauthorizedClient(base http.RoundTripper) *http.Client {
+	if base == nil {
+		return http.DefaultClient
+	}
+	return &http.Client{Transport: base}
+}
+
+// newKeySources creates the sources of the public keys used to verify ID tokens and session
+// cookies, which fetch the keys with hc as specified by c.
+func newKeySources(hc *http.Client, c *internal.AuthConfig) (*httpKeySource, *httpKeySource) {
+	ks := newHTTPKeySource(googleCertURL, hc)
+	ks.MaxBodySize = c.MaxResponseBodySize
+	cookieKS := newHTTPKeySource(sessionCookieCertURL, hc)
+	cookieKS.MaxBodySize = c.MaxResponseBodySize
+	if c.MaxRetries > 0 {
+		ks.RetryConfig.MaxRetries = c.MaxRetries
+		cookieKS.RetryConfig.MaxRetries = c.MaxRetries
+	}
+	return ks, cookieKS
+}
+
+// NewVerifyOnlyClient creates a Client that only verifies ID tokens, and does not require any
+// credentials.
+//
+// The returned Client fetches the Google public keys used to verify ID tokens without
+// authentication. It is meant for services that only validate ID tokens, such as API gateways.
+// Minting custom tokens and calling the user management APIs on the returned Client fail with an
+// error stating that the Client is not configured for the operation.
+//
+// The returned Client makes its requests with the default HTTP settings. Use
+// firebase.App.VerifyOnlyAuth() to create a verify-only Client that honors the HTTP settings of an
+// App, such as its Transport and MaxResponseBodySize.
+func NewVerifyOnlyClient(ctx context.Context, projectID string, opts ...ClientOption) (*Client, error) {
+	return newVerifyOnlyClient(&internal.AuthConfig{ProjectID: projectID}, opts...)
+}
+
+// newVerifyOnlyClient creates a verify-only Client, which fetches the public keys with an
+// unauthorized HTTP client built as specified by c.
+func newVerifyOnlyClient(c *internal.AuthConfig, opts ...ClientOption) (*Client, error) {
+	if c.ProjectID == "" {
+		return nil, errors.New("project id must be a non-empty string")
+	}
+	hc := internal.WithHeaders(unauthorizedClient(c.Transport), c.Headers, c.UserAgentSuffix)
+	hc = internal.Instrument(hc, c.Instrumentation, "auth")
+	hc = internal.WithGuard(hc, c.RequestGuard)
+	ks, cookieKS := newKeySources(hc, c)
+	client := &Client{
+		ks:        ks,
+		cookieKS:  cookieKS,
+		sv:        stdSignatureVerifier{},
+		projectID: c.ProjectID,
+		snr:       verifyOnlySigner{},
+		emulator:  os.Getenv(emulatorHostEnvVar) != "",
+	}
+	if c.Version != "" {
+		client.version = "Go/Admin/" + c.Version
+	}
+	for _, opt := range opts {
+		if err := opt(client); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// verifyOnlySigner is the signer of a verify-only Client, which cannot sign anything.
+type verifyOnlySigner struct{}
+
+func (s verifyOnlySigner) Email(ctx context.Context) (string, error) {
+	return "", errVerifyOnly
+}
+
+func (s verifyOnlySigner) Sign(ctx context.Context, b []byte) ([]byte, error) {
+	return nil, errVerifyOnly
+}
+
+// emulatorSigner is the signer of a Client connected to the Auth emulator, which accepts unsigned
+// custom tokens.
+type emulatorSigner struct{}
+
+func (s emulatorSigner) Email(ctx context.Context) (string, error) {
+	return emulatorEmail, nil
+}
+
+func (s emulatorSigner) Sign(ctx context.Context, b []byte) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (s emulatorSigner) algorithm() string {
+	return "none"
+}
+
+// emulatorURL returns the URL at which the Auth emulator running at host serves the given URL of
+// the Firebase Auth backend services.
+func emulatorURL(host, url string) string {
+	return "http://" + host + "/" + strings.TrimPrefix(url, "https://")
+}
+
+// EffectiveConfig is a snapshot of the configuration of a Client, meant for debugging.
+//
+// EffectiveConfig never contains any credential material. Secrets like the API key are only
+// reported as being set or not.
+type EffectiveConfig struct {
+	ProjectID             string
+	Version               string
+	SignerType            SignerType
+	SignatureVerifierType SignatureVerifierType
+	PublicKeyURL          string // URL of the public keys used to verify ID tokens, if fetched over HTTP.
+	PublicKeyFile         string // Path of the public keys used to verify ID tokens, if loaded from a file.
+	KeySourceType         KeySourceType
+	SessionCookieKeyURL   string // URL of the public keys used to verify session cookies.
+	MaxResponseBodySize   int64
+	KeyFetchTimeout       time.Duration // Bound on key fetches made without a context deadline.
+	TenantID              string
+	AllowedProjects       []string // Nil if only tokens issued by ProjectID are accepted.
+	AllowedAudiences      []string // Nil if the audience must be one of the accepted projects.
+	UserManagement        bool     // Whether the user management APIs are available.
+	CustomTokenVerify     bool     // Whether VerifyCustomToken() is available.
+	APIKeySet             bool
+	TokenExchangeURL      string
+	RateLimit             *RateLimit       // Nil if requests are not rate limited.
+	Tracing               bool             // Whether spans are reported to a Tracer.
+	CustomTokenSkew       *CustomTokenSkew // Nil if custom token times are not adjusted.
+	ClockSkew             time.Duration    // Clock skew tolerated when verifying tokens.
+	SessionCookieSkew     time.Duration    // Clock skew tolerated when verifying session cookies.
+	Emulator              bool             // Whether token signatures are skipped for the Auth emulator.
+	ProviderConfigTTL     time.Duration    // Zero if provider configs are not cached.
+	StrictDecoding        bool             // Whether responses and tokens with unknown fields are rejected.
+}
+
+// EffectiveConfig returns a snapshot of the configuration of the Client.
+func (c *Client) EffectiveConfig() *EffectiveConfig {
+	conf := &EffectiveConfig{
+		ProjectID:             c.projectID,
+		Version:               c.version,
+		SignerType:            signerType(c.snr),
+		SignatureVerifierType: signatureVerifierType(c.sv),
+		KeySourceType:         keySourceType(c.ks),
+		UserManagement:        c.is != nil,
+		CustomTokenVerify:     c.cks != nil,
+		APIKeySet:             c.apiKey != "",
+		TokenExchangeURL:      c.exchangeEndpoint,
+		Tracing:               c.tracer != nil,
+		ClockSkew:             c.clockSkew,
+		SessionCookieSkew:     c.sessionCookieClockSkew(),
+		Emulator:              c.emulator,
+		StrictDecoding:        c.decoder.strict,
+		TenantID:              c.tenantID,
+		AllowedProjects:       append([]string(nil), c.projects...),
+		AllowedAudiences:      append([]string(nil), c.audiences...),
+	}
+	switch ks := c.ks.(type) {
+	case *httpKeySource:
+		conf.PublicKeyURL = ks.KeyURI
+		conf.MaxResponseBodySize = ks.MaxBodySize
+		conf.KeyFetchTimeout = ks.FetchTimeout
+	case *fileKeySource:
+		conf.PublicKeyFile = ks.FilePath
+	}
+	if ks, ok := c.cookieKS.(*httpKeySource); ok {
+		conf.SessionCookieKeyURL = ks.KeyURI
+	}
+	if conf.MaxResponseBodySize <= 0 {
+		conf.MaxResponseBodySize = internal.DefaultMaxResponseBodySize
+	}
+	if l := c.limiter; l != nil {
+		conf.RateLimit = &RateLimit{Rate: l.rate, Burst: int(l.burst), FailFast: l.failFast}
+	}
+	if c.skew != nil {
+		skew := *c.skew
+		conf.CustomTokenSkew = &skew
+	}
+	if c.providerCache != nil {
+		conf.ProviderConfigTTL = c.providerCache.ttl
+	}
+	return conf
+}
+
+// SignerType identifies how a Client signs custom tokens.
+type SignerType string
+
+const (
+	SignerServiceAccount SignerType = "service_account" // Signed with the private key of the service account.
+	SignerIAM            SignerType = "iam"             // Signed by the IAM service.
+	SignerAppEngine      SignerType = "app_engine"      // Signed by the App Engine app identity service.
+	SignerEmulator       SignerType = "emulator"        // Left unsigned for the Auth emulator.
+	SignerNone           SignerType = "none"            // Custom tokens cannot be minted.
+)
+
+// SignatureVerifierType identifies how a Client verifies token signatures.
+type SignatureVerifierType string
+
+const (
+	SignatureVerifierDefault SignatureVerifierType = "default"
+	SignatureVerifierCustom  SignatureVerifierType = "custom" // Set with WithSignatureVerifier().
+)
+
+// KeySourceType identifies where a Client gets the public keys used to verify ID tokens.
+type KeySourceType string
+
+const (
+	KeySourceHTTP   KeySourceType = "http"   // Fetched from PublicKeyURL.
+	KeySourceFile   KeySourceType = "file"   // Loaded from PublicKeyFile.
+	KeySourceCustom KeySourceType = "custom" // Set with WithKeySource().
+)
+
+func signerType(s signer) SignerType {
+	switch s.(type) {
+	case nil:
+		return ""
+	case serviceAcctSigner:
+		return SignerServiceAccount
+	case *iamSigner:
+		return SignerIAM
+	case emulatorSigner:
+		return SignerEmulator
+	case verifyOnlySigner:
+		return SignerNone
+	}
+	return platformSignerType(s)
+}
+
+func signatureVerifierType(sv SignatureVerifier) SignatureVerifierType {
+	switch sv.(type) {
+	case nil:
+		return ""
+	case stdSignatureVerifier:
+		return SignatureVerifierDefault
+	}
+	return SignatureVerifierCustom
+}
+
+func keySourceType(ks KeySource) KeySourceType {
+	switch ks.(type) {
+	case nil:
+		return ""
+	case *httpKeySource:
+		return KeySourceHTTP
+	case *fileKeySource:
+		return KeySourceFile
+	}
+	return KeySourceCustom
 }
 
 // CustomToken creates a signed custom authentication token with the specified user ID. The resulting
 // JWT can be used in a Firebase client SDK to trigger an authentication flow. See
 // https://firebase.google.com/docs/auth/admin/create-custom-tokens#sign_in_using_custom_tokens_on_clients
 // for more details on how to use custom tokens for client authentication.
-func (c *Client) CustomToken(uid string) (string, error) {
-	return c.CustomTokenWithClaims(uid, nil)
+func (c *Client) CustomToken(uid string) (token string, err error) {
+	defer internal.WrapOpError(&err, "CustomToken", uid)
+	return c.customTokenWithClaims(context.Background(), uid, nil)
 }
 
 // CustomTokenWithClaims is similar to CustomToken, but in addition to the user ID, it also encodes
 // all the key-value pairs in the provided map as claims in the resulting JWT.
-func (c *Client) CustomTokenWithClaims(uid string, devClaims map[string]interface{}) (string, error) {
-	iss, err := c.snr.Email()
+func (c *Client) CustomTokenWithClaims(uid string, devClaims map[string]interface{}) (token string, err error) {
+	defer internal.WrapOpError(&err, "CustomTokenWithClaims", uid)
+	return c.customTokenWithClaims(context.Background(), uid, devClaims)
+}
+
+func (c *Client) customTokenWithClaims(
+	ctx context.Context, uid string, devClaims map[string]interface{}) (string, error) {
+
+	iss, err := c.snr.Email(ctx)
+	if err != nil {
+		return "", err
+	}
+	iat, exp := c.customTokenTimes()
+	return c.customToken(ctx, iss, iat, exp, uid, devClaims)
+}
+
+// CustomTokenSkew adjusts the issued-at and expiration times of custom tokens to accommodate
+// client devices with inaccurate clocks.
+//
+// Backdate moves the validity period of the tokens into the past, so that clients with clocks
+// running behind do not reject the tokens as issued in the future. ExpiryMargin shortens the
+// validity period of the tokens, which otherwise ends one hour after they are issued.
+type CustomTokenSkew struct {
+	Backdate     time.Duration
+	ExpiryMargin time.Duration
+}
+
+// WithCustomTokenSkew returns a ClientOption that applies the specified adjustments to the custom
+// tokens minted by the Client. Custom tokens minted with CustomTokenWithTimes() are not affected.
+//
+// By default the tokens are valid for exactly one hour from the time they are minted. The
+// adjustments are truncated to whole seconds, and must leave the tokens valid for some time after
+// they are minted.
+func WithCustomTokenSkew(skew *CustomTokenSkew) ClientOption {
+	return func(c *Client) error {
+		if skew == nil {
+			return errors.New("custom token skew must not be nil")
+		}
+		if skew.Backdate < 0 || skew.ExpiryMargin < 0 {
+			return errors.New("custom token skew must not be negative")
+		}
+		if skew.Backdate+skew.ExpiryMargin >= tokenExpSeconds*time.Second {
+			return fmt.Errorf("custom token skew must be less than %d seconds in total", tokenExpSeconds)
+		}
+		c.skew = &CustomTokenSkew{
+			Backdate:     skew.Backdate / time.Second * time.Second,
+			ExpiryMargin: skew.ExpiryMargin / time.Second * time.Second,
+		}
+		return nil
+	}
+}
+
+// withClock returns a ClientOption that makes the Client use the specified clock for evaluating
+// and minting tokens, and for expiring the cached public keys.
+func withClock(cl clock) ClientOption {
+	return func(c *Client) error {
+		c.clock = cl
+		for _, ks := range []KeySource{c.ks, c.cookieKS} {
+			if ks, ok := ks.(*httpKeySource); ok {
+				ks.Clock = cl
+			}
+		}
+		return nil
+	}
+}
+
+// Clock is a source of the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// WithClock returns a ClientOption that makes the Client use the specified clock instead of the
+// system clock.
+//
+// The clock is used to check the timestamps of ID tokens and session cookies, to set the times of
+// minted custom tokens, and to expire the cached public keys. This lets tests assert exact token
+// and cookie lifetimes, and lets services use a trusted time source of their own.
+func WithClock(cl Clock) ClientOption {
+	return func(c *Client) error {
+		if cl == nil {
+			return errors.New("clock must not be nil")
+		}
+		return withClock(cl)(c)
+	}
+}
+
+// now returns the current time according to the clock of the Client.
+func (c *Client) now() time.Time {
+	if c.clock != nil {
+		return c.clock.Now()
+	}
+	return clk.Now()
+}
+
+// customTokenTimes returns the issued-at and expiration times of a custom token minted now.
+func (c *Client) customTokenTimes() (iat, exp int64) {
+	iat = c.now().Unix()
+	exp = iat + tokenExpSeconds
+	if c.skew != nil {
+		iat -= int64(c.skew.Backdate / time.Second)
+		exp = iat + tokenExpSeconds - int64(c.skew.ExpiryMargin/time.Second)
+	}
+	return iat, exp
+}
+
+// CustomTokenWithTimes is similar to CustomTokenWithClaims, but sets the issued-at and expiration
+// times of the token to the specified values instead of deriving them from the current time.
+//
+// CustomTokenWithTimes is meant for tests that need reproducible tokens. The times are truncated to
+// whole seconds. The same arguments always produce the same header and payload. The whole token is
+// only byte-stable when the Client signs with an RSA key, since RSA PKCS #1 v1.5 signatures are
+// deterministic; ECDSA signatures (ES256) are randomized, and differ on each call. The expiration
+// time must be after the issued-at time, and at most one hour later.
+func (c *Client) CustomTokenWithTimes(
+	uid string, devClaims map[string]interface{}, issuedAt, expires time.Time) (token string, err error) {
+
+	defer internal.WrapOpError(&err, "CustomTokenWithTimes", uid)
+	iat, exp := issuedAt.Unix(), expires.Unix()
+	if exp <= iat {
+		return "", errors.New("expiration time must be after the issued-at time")
+	}
+	if exp-iat > tokenExpSeconds {
+		return "", fmt.Errorf("token lifetime must not exceed %d seconds", tokenExpSeconds)
+	}
+	ctx := context.Background()
+	iss, err := c.snr.Email(ctx)
+	if err != nil {
+		return "", err
+	}
+	return c.customToken(ctx, iss, iat, exp, uid, devClaims)
+}
+
+// CustomTokenWithExpiry is similar to CustomTokenWithClaims, but the resulting token expires after
+// the specified duration instead of one hour after it is issued.
+//
+// The duration is truncated to whole seconds, and must be between one second and one hour. It is
+// measured from the issued-at time of the token, so the Backdate of a CustomTokenSkew configured on
+// the Client still applies, while its ExpiryMargin does not.
+func (c *Client) CustomTokenWithExpiry(
+	uid string, devClaims map[string]interface{}, expiresIn time.Duration) (token string, err error) {
+
+	defer internal.WrapOpError(&err, "CustomTokenWithExpiry", uid)
+	ttl := int64(expiresIn / time.Second)
+	if ttl < 1 {
+		return "", errors.New("token lifetime must be at least 1 second")
+	}
+	if ttl > tokenExpSeconds {
+		return "", fmt.Errorf("token lifetime must not exceed %d seconds", tokenExpSeconds)
+	}
+	ctx := context.Background()
+	iss, err := c.snr.Email(ctx)
 	if err != nil {
 		return "", err
 	}
+	iat, _ := c.customTokenTimes()
+	return c.customToken(ctx, iss, iat, iat+ttl, uid, devClaims)
+}
+
+// CustomTokenResult is the outcome of minting a single custom token in a batch operation.
+//
+// Exactly one of Token and Err is set.
+type CustomTokenResult struct {
+	UID   string
+	Token string
+	Err   error
+}
+
+// CustomTokenResults is the outcome of minting custom tokens in a batch operation.
+type CustomTokenResults []*CustomTokenResult
+
+// AggregateError returns a single error combining the errors of all the failed results, or nil if
+// all the tokens were minted successfully.
+//
+// The error of each failed result is identified by the corresponding user ID. Error checking
+// functions like IsUnknown() report whether any of the combined errors matches. In Go 1.20 and
+// higher, errors.Is() and errors.As() also look through the combined errors.
+func (r CustomTokenResults) AggregateError() error {
+	var errs []error
+	for _, res := range r {
+		if res.Err != nil {
+			errs = append(errs, &internal.OpError{Op: "CustomToken", Arg: res.UID, Err: res.Err})
+		}
+	}
+	return internal.NewAggregateError(errs)
+}
+
+// CustomTokens creates signed custom authentication tokens for all the specified user IDs.
+//
+// CustomTokens is equivalent to calling CustomToken for each user ID, but it resolves the signer
+// identity and the current time only once, and signs the tokens concurrently. Results are returned
+// in the same order as the input user IDs. An invalid user ID does not abort the operation.
+// Instead the corresponding CustomTokenResult carries the error. An error is returned only if the
+// signer is not usable, or if ctx is cancelled before all the tokens are minted.
+func (c *Client) CustomTokens(ctx context.Context, uids []string) (results CustomTokenResults, err error) {
+	defer internal.WrapOpError(&err, "CustomTokens", "")
+	return c.customTokensWithClaims(ctx, uids, nil)
+}
+
+// CustomTokensWithClaims is similar to CustomTokens, but in addition to the user IDs, it also
+// encodes the developer claims mapped to each user ID in devClaims into the corresponding JWT.
+// User IDs without an entry in devClaims get a token without developer claims.
+func (c *Client) CustomTokensWithClaims(
+	ctx context.Context, uids []string,
+	devClaims map[string]map[string]interface{}) (results CustomTokenResults, err error) {
+
+	defer internal.WrapOpError(&err, "CustomTokensWithClaims", "")
+	return c.customTokensWithClaims(ctx, uids, devClaims)
+}
+
+func (c *Client) customTokensWithClaims(
+	ctx context.Context, uids []string, devClaims map[string]map[string]interface{}) (CustomTokenResults, error) {
+
+	iss, err := c.snr.Email(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	iat, exp := c.customTokenTimes()
+	results := make(CustomTokenResults, len(uids))
+	workers := runtime.NumCPU()
+	if workers > len(uids) {
+		workers = len(uids)
+	}
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indices {
+				uid := uids[idx]
+				token, err := c.customToken(ctx, iss, iat, exp, uid, devClaims[uid])
+				results[idx] = &CustomTokenResult{UID: uid, Token: token, Err: err}
+			}
+		}()
+	}
+
+	err = nil
+	for idx := 0; idx < len(uids) && err == nil; idx++ {
+		select {
+		case indices <- idx:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	close(indices)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (c *Client) customToken(
+	ctx context.Context, iss string, iat, exp int64, uid string, devClaims map[string]interface{}) (string, error) {
 
 	if len(uid) == 0 || len(uid) > 128 {
 		return "", errors.New("uid must be non-empty, and not longer than 128 characters")
@@ -163,17 +801,185 @@ func (c *Client) CustomTokenWithClaims(uid string, devClaims map[string]interfac
 		return "", fmt.Errorf("developer claims %q are reserved and cannot be specified", strings.Join(disallowed, ", "))
 	}
 
-	now := clk.Now().Unix()
 	payload := &customToken{
 		Iss:    iss,
 		Sub:    iss,
 		Aud:    firebaseAudience,
 		UID:    uid,
-		Iat:    now,
-		Exp:    now + tokenExpSeconds,
+		Iat:    iat,
+		Exp:    exp,
 		Claims: devClaims,
+		// Omitted when empty, so that tokens without a tenant are minted as before.
+		TenantID: c.tenantID,
 	}
-	return encodeToken(c.snr, defaultHeader(), payload)
+	h := defaultHeader()
+	h.Algorithm = signingAlgorithm(c.snr)
+	return encodeToken(ctx, c.snr, h, payload)
+}
+
+// VerifyCustomToken verifies the signature and payload of a custom token minted by this Client.
+//
+// VerifyCustomToken can be used to check whether a previously minted custom token is still valid,
+// without exchanging it for an ID token. The signature is verified using the public key of the
+// service account credential used to initialize the SDK. Therefore VerifyCustomToken is only
+// supported when the SDK is initialized with a service account private key. The returned Token
+// contains the user ID in its UID field, and the developer claims in its Claims map.
+func (c *Client) VerifyCustomToken(ctx context.Context, token string) (ct *Token, err error) {
+	defer internal.WrapOpError(&err, "VerifyCustomToken", "")
+	if c.cks == nil {
+		return nil, errors.New("verifying custom tokens requires a service account private key")
+	}
+	if token == "" {
+		return nil, errors.New("custom token must be a non-empty string")
+	}
+
+	h := &jwtHeader{}
+	p := &customToken{}
+	if err := decodeToken(ctx, token, c.cks, c.sv, c.decoder, h, p); err != nil {
+		return nil, err
+	}
+
+	iss, err := c.snr.Email(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.now().Unix()
+	skew := int64(c.clockSkew / time.Second)
+	if alg := signingAlgorithm(c.snr); h.Algorithm != alg {
+		err = fmt.Errorf("custom token has invalid algorithm. Expected '%s' but got %q", alg, h.Algorithm)
+	} else if p.Aud != firebaseAudience {
+		err = fmt.Errorf("custom token has invalid 'aud' (audience) claim. Expected %q but got %q",
+			firebaseAudience, p.Aud)
+	} else if p.Iss != iss {
+		err = fmt.Errorf("custom token has invalid 'iss' (issuer) claim. Expected %q but got %q", iss, p.Iss)
+	} else if p.Iat > now+skew {
+		err = fmt.Errorf("custom token issued at future timestamp: %d", p.Iat)
+	} else if p.Exp < now-skew {
+		err = fmt.Errorf("custom token has expired. Expired at: %d", p.Exp)
+	} else if p.UID == "" {
+		err = errors.New("custom token has empty 'uid' claim")
+	} else if p.TenantID != c.tenantID {
+		err = internal.Errorf(tenantIDMismatch, "custom token has invalid 'tenant_id' claim. Expected %q but got %q",
+			c.tenantID, p.TenantID)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return &Token{
+		Issuer:   p.Iss,
+		Audience: p.Aud,
+		Expires:  p.Exp,
+		IssuedAt: p.Iat,
+		Subject:  p.Sub,
+		UID:      p.UID,
+		TenantID: p.TenantID,
+		Claims:   p.Claims,
+	}, nil
+}
+
+// WithAPIKey returns a ClientOption that sets the Web API key of the Firebase project. The API key
+// is required by ImpersonateUser().
+func WithAPIKey(apiKey string) ClientOption {
+	return func(c *Client) error {
+		if apiKey == "" {
+			return errors.New("api key must be a non-empty string")
+		}
+		c.apiKey = apiKey
+		return nil
+	}
+}
+
+// UserTokens contains the tokens issued to a user when signing in.
+type UserTokens struct {
+	IDToken      string
+	RefreshToken string
+	ExpiresIn    time.Duration // Lifetime of the ID token.
+}
+
+// ImpersonateUser signs in as the user with the specified user ID, and returns the resulting ID
+// and refresh tokens.
+//
+// ImpersonateUser mints a custom token with the given developer claims (see
+// CustomTokenWithClaims()), and exchanges it for an ID token. The exchange uses the same
+// client-facing endpoint that the Firebase client SDKs use to sign in with custom tokens. Hence the
+// Client must be initialized with the Web API key of the project (see WithAPIKey()), and the sign in
+// is subject to the same checks and quotas as client sign ins. For example, it fails for disabled
+// user accounts.
+func (c *Client) ImpersonateUser(
+	ctx context.Context, uid string, devClaims map[string]interface{}) (tokens *UserTokens, err error) {
+
+	defer internal.WrapOpError(&err, "ImpersonateUser", uid)
+	if c.apiKey == "" {
+		return nil, errors.New("impersonating users requires an api key; see WithAPIKey()")
+	}
+	token, err := c.customTokenWithClaims(ctx, uid, devClaims)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.beforeRequest(ctx); err != nil {
+		return nil, err
+	}
+
+	request := &internal.Request{
+		Method: http.MethodPost,
+		URL:    c.exchangeEndpoint,
+		Body: internal.NewJSONEntity(map[string]interface{}{
+			"token":             token,
+			"returnSecureToken": true,
+		}),
+		Opts: []internal.HTTPOption{
+			internal.WithQueryParam("key", c.apiKey),
+			internal.WithHeader("X-Client-Version", c.version),
+		},
+	}
+	resp, err := c.hc.Do(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != http.StatusOK {
+		return nil, handleHTTPError(resp)
+	}
+
+	var result struct {
+		IDToken      string `json:"idToken"`
+		RefreshToken string `json:"refreshToken"`
+		ExpiresIn    string `json:"expiresIn"`
+	}
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		return nil, err
+	}
+	expiresIn, err := strconv.ParseInt(result.ExpiresIn, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expiresIn value in response: %q", result.ExpiresIn)
+	}
+	return &UserTokens{
+		IDToken:      result.IDToken,
+		RefreshToken: result.RefreshToken,
+		ExpiresIn:    time.Duration(expiresIn) * time.Second,
+	}, nil
+}
+
+func handleHTTPError(resp *internal.Response) error {
+	clientCode, ok := serverError[serverErrorCode(resp)]
+	if !ok {
+		clientCode = unknown
+	}
+	return internal.Errorf(clientCode, "http error status: %d; reason: %s", resp.Status, string(resp.Body))
+}
+
+// serverErrorCode returns the error code in the body of an error response from the Firebase Auth
+// backend services, or an empty string if the body does not contain one.
+func serverErrorCode(resp *internal.Response) string {
+	var re struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.Unmarshal(resp.Body, &re) // ignore any json parse errors at this level
+	// Messages may carry details after the error code (e.g. "INVALID_CONFIG : details").
+	return strings.SplitN(re.Error.Message, " ", 2)[0]
 }
 
 // RevokeRefreshTokens revokes all refresh tokens issued to a user.
@@ -184,10 +990,24 @@ func (c *Client) CustomTokenWithClaims(uid string, devClaims map[string]interfac
 // While this revokes all sessions for a specified user and disables any new ID tokens for existing sessions
 // from getting minted, existing ID tokens may remain active until their natural expiration (one hour).
 // To verify that ID tokens are revoked, use `verifyIdTokenAndCheckRevoked(ctx, idToken)`.
-func (c *Client) RevokeRefreshTokens(ctx context.Context, uid string) error {
+func (c *Client) RevokeRefreshTokens(ctx context.Context, uid string) (err error) {
+	defer internal.WrapOpError(&err, "RevokeRefreshTokens", uid)
 	return c.updateUser(ctx, uid, (&UserToUpdate{}).revokeRefreshTokens())
 }
 
+// PrefetchPublicKeys loads the public keys used to verify ID tokens into the cache of the Client.
+//
+// Call PrefetchPublicKeys during startup, or from a readiness check, so that the first ID token
+// verification does not pay the latency of fetching the keys. It does nothing if the cached keys
+// are still fresh, and is safe to call concurrently with token verifications. An error is only
+// returned if no keys are available. The keys used to verify session cookies are still fetched on
+// first use.
+func (c *Client) PrefetchPublicKeys(ctx context.Context) (err error) {
+	defer internal.WrapOpError(&err, "PrefetchPublicKeys", "")
+	_, err = c.ks.Keys(ctx)
+	return err
+}
+
 // VerifyIDToken verifies the signature	and payload of the provided ID token.
 //
 // VerifyIDToken accepts a signed JWT token string, and verifies that it is current, issued for the
@@ -196,50 +1016,483 @@ func (c *Client) RevokeRefreshTokens(ctx context.Context, uid string) error {
 // https://firebase.google.com/docs/auth/admin/verify-id-tokens#retrieve_id_tokens_on_clients for
 // more details on how to obtain an ID token in a client app.
 // This does not check whether or not the token has been revoked. See `VerifyIDTokenAndCheckRevoked` below.
-func (c *Client) VerifyIDToken(idToken string) (*Token, error) {
+func (c *Client) VerifyIDToken(idToken string) (token *Token, err error) {
+	defer internal.WrapOpError(&err, "VerifyIDToken", "")
+	return c.verifyIDToken(context.Background(), idToken, &verifyConfig{})
+}
+
+// VerifyOption configures the optional checks performed by VerifyIDTokenWithOptions.
+type VerifyOption func(*verifyConfig)
+
+type verifyConfig struct {
+	requireAuthTime     bool
+	requireSecondFactor bool
+	tenantID            string
+	checkRevoked        bool
+	checkDisabled       bool
+	now                 time.Time
+	pinnedKeys          []*PublicKey
+}
+
+// keySource returns the key source to verify the token with, which tries the pinned keys, if any,
+// before the keys of ks.
+func (vc *verifyConfig) keySource(ks KeySource) KeySource {
+	if len(vc.pinnedKeys) == 0 {
+		return ks
+	}
+	return &pinnedKeySource{pinned: vc.pinnedKeys, fallback: ks}
+}
+
+// currentTime returns the time at which the token should be evaluated, which defaults to the
+// current time of c.
+func (vc *verifyConfig) currentTime(c *Client) time.Time {
+	if vc.now.IsZero() {
+		return c.now()
+	}
+	return vc.now
+}
+
+// WithClockSkew returns a ClientOption that makes the Client tolerate the specified clock skew when
+// checking the timestamps of tokens.
+//
+// Tokens are accepted up to skew before their issued-at ('iat'), not-before ('nbf') and
+// 'auth_time' times, and up to skew after their expiration ('exp') time. The default is no
+// tolerance. The skew is truncated to whole seconds, and must not be negative.
+func WithClockSkew(skew time.Duration) ClientOption {
+	return func(c *Client) error {
+		if skew < 0 {
+			return fmt.Errorf("clock skew must not be negative: %v", skew)
+		}
+		c.clockSkew = skew / time.Second * time.Second
+		return nil
+	}
+}
+
+// WithTenantID returns a ClientOption that scopes the Client to the specified tenant of a
+// multi-tenant project.
+//
+// Custom tokens minted by the Client carry the tenant ID in their 'tenant_id' claim, and are signed
+// the same way as other custom tokens. ID tokens and session cookies are only accepted if their
+// firebase.tenant claim names the tenant. Use IsTenantIDMismatch() to check whether verification
+// failed for this reason. The user management functions of the Client operate on the users of the
+// tenant. See also TenantManager.AuthForTenant().
+func WithTenantID(tenantID string) ClientOption {
+	return func(c *Client) error {
+		if tenantID == "" {
+			return errors.New("tenant id must be a non-empty string")
+		}
+		c.tenantID = tenantID
+		return nil
+	}
+}
+
+// WithAllowedProjects returns a ClientOption that makes the Client accept ID tokens and session
+// cookies issued by any of the specified Firebase projects.
+//
+// By default only tokens issued by the project of the Client are accepted. With this option the
+// 'iss' (issuer) claim of a token must name one of the specified projects, and unless
+// WithAllowedAudiences() is also used, so must its 'aud' (audience) claim. Revocation and disabled
+// user checks still look the user up in the project of the Client.
+func WithAllowedProjects(projectIDs ...string) ClientOption {
+	return func(c *Client) error {
+		if err := validateNonEmpty("project id", projectIDs); err != nil {
+			return err
+		}
+		c.projects = append([]string(nil), projectIDs...)
+		return nil
+	}
+}
+
+// WithAllowedAudiences returns a ClientOption that sets the values accepted in the 'aud'
+// (audience) claim of ID tokens and session cookies.
+//
+// By default the audience must be the ID of a project accepted by the Client. Use this option
+// when tokens are issued for a different audience, such as a downstream service identifier. The
+// 'iss' (issuer) claim is still checked against the accepted projects.
+func WithAllowedAudiences(audiences ...string) ClientOption {
+	return func(c *Client) error {
+		if err := validateNonEmpty("audience", audiences); err != nil {
+			return err
+		}
+		c.audiences = append([]string(nil), audiences...)
+		return nil
+	}
+}
+
+func validateNonEmpty(name string, values []string) error {
+	if len(values) == 0 {
+		return fmt.Errorf("at least one %s must be specified", name)
+	}
+	for _, v := range values {
+		if v == "" {
+			return fmt.Errorf("%s must be a non-empty string", name)
+		}
+	}
+	return nil
+}
+
+// allowedProjects returns the IDs of the projects whose tokens are accepted by the Client.
+func (c *Client) allowedProjects() []string {
+	if len(c.projects) > 0 {
+		return c.projects
+	}
+	return []string{c.projectID}
+}
+
+// allowedAudiences returns the audiences of the tokens accepted by the Client.
+func (c *Client) allowedAudiences() []string {
+	if len(c.audiences) > 0 {
+		return c.audiences
+	}
+	return c.allowedProjects()
+}
+
+func containsString(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedValues formats the expected values of a claim for error messages.
+func expectedValues(values []string) string {
+	if len(values) == 1 {
+		return strconv.Quote(values[0])
+	}
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	return "one of " + strings.Join(quoted, ", ")
+}
+
+// WithEmulator returns a ClientOption that makes the Client accept tokens issued by the Firebase
+// Auth emulator.
+//
+// The emulator does not sign tokens with the Google private keys, so the Client skips the
+// signature check of ID tokens and session cookies, and accepts tokens without a 'kid' header or
+// with any algorithm. All other claims, such as the audience, the issuer, the subject and the
+// expiration time, are still checked. Never use this option in production.
+//
+// The same mode is enabled when the FIREBASE_AUTH_EMULATOR_HOST environment variable is set to the
+// host and port of the emulator (e.g. "localhost:9099"). In that case NewClient also sends all the
+// Identity Toolkit requests of the Client to the emulator, and the Client mints unsigned custom
+// tokens, which only the emulator accepts.
+func WithEmulator() ClientOption {
+	return func(c *Client) error {
+		c.emulator = true
+		return nil
+	}
+}
+
+// RequireAuthTime returns a VerifyOption that rejects ID tokens without an 'auth_time' claim.
+//
+// By default tokens without an 'auth_time' claim are accepted. Use IsAuthTimeMissing() to check
+// whether verification failed due to this option.
+func RequireAuthTime() VerifyOption {
+	return func(vc *verifyConfig) {
+		vc.requireAuthTime = true
+	}
+}
+
+// RequireSecondFactor returns a VerifyOption that rejects ID tokens of users who did not sign in
+// with a second factor.
+//
+// By default single-factor ID tokens are accepted. Use IsSecondFactorMissing() to check whether
+// verification failed due to this option.
+func RequireSecondFactor() VerifyOption {
+	return func(vc *verifyConfig) {
+		vc.requireSecondFactor = true
+	}
+}
+
+// RequireTenant returns a VerifyOption that rejects ID tokens and session cookies of users who do
+// not belong to the specified tenant.
+//
+// This overrides the tenant set with WithTenantID() for a single verification. Use
+// IsTenantIDMismatch() to check whether verification failed due to this option.
+func RequireTenant(tenantID string) VerifyOption {
+	return func(vc *verifyConfig) {
+		vc.tenantID = tenantID
+	}
+}
+
+// VerifyAt returns a VerifyOption that evaluates the time-based claims of an ID token ('iat' and
+// 'exp') as of the specified time instead of the current time. This is useful for checking whether
+// a token was valid at some point in the past, e.g. when replaying request logs.
+//
+// Only the time-based claims are affected. The token signature is always verified against the
+// currently published public keys. Since Google rotates these keys regularly, sufficiently old
+// tokens may fail verification even if they were valid at the specified time.
+func VerifyAt(t time.Time) VerifyOption {
+	return func(vc *verifyConfig) {
+		vc.now = t
+	}
+}
+
+// WithPinnedKeys returns a VerifyOption that tries the specified public keys before the Google
+// public keys cached by the Client when verifying the signature of an ID token. Each key must be an
+// *rsa.PublicKey or an *ecdsa.PublicKey, and is only tried for tokens with a matching key ID.
+//
+// WithPinnedKeys is an operational escape hatch, e.g. for pinning verification to a known-good set
+// of keys during a key rotation incident. Tokens signed by a pinned key are verified without
+// refreshing the cached keys. Verification only falls back to the cached keys, and refreshes them
+// if necessary, when the token is not signed by any of the pinned keys.
+func WithPinnedKeys(keys ...*PublicKey) VerifyOption {
+	return func(vc *verifyConfig) {
+		vc.pinnedKeys = nil
+		for _, k := range keys {
+			if k != nil {
+				vc.pinnedKeys = append(vc.pinnedKeys, k)
+			}
+		}
+	}
+}
+
+// CheckRevoked returns a VerifyOption that rejects ID tokens that have been revoked.
+//
+// Checking for revocation requires looking up the user account of the token, which makes an
+// additional RPC call. Use IsIDTokenRevoked() to check whether verification failed due to this
+// option.
+func CheckRevoked() VerifyOption {
+	return func(vc *verifyConfig) {
+		vc.checkRevoked = true
+	}
+}
+
+// CheckDisabled returns a VerifyOption that rejects ID tokens of disabled user accounts.
+//
+// Like CheckRevoked, this requires looking up the user account of the token. Use IsUserDisabled()
+// to check whether verification failed due to this option.
+func CheckDisabled() VerifyOption {
+	return func(vc *verifyConfig) {
+		vc.checkDisabled = true
+	}
+}
+
+// VerifyIDTokenWithOptions verifies the signature and payload of the provided ID token, applying
+// the additional checks specified by opts.
+//
+// Without any options VerifyIDTokenWithOptions is equivalent to VerifyIDToken.
+func (c *Client) VerifyIDTokenWithOptions(
+	ctx context.Context, idToken string, opts ...VerifyOption) (token *Token, err error) {
+
+	defer internal.WrapOpError(&err, "VerifyIDTokenWithOptions", "")
+	vc := newVerifyConfig(opts)
+	p, err := c.verifyIDToken(ctx, idToken, vc)
+	if err != nil {
+		return nil, err
+	}
+	if vc.checkRevoked || vc.checkDisabled {
+		if _, err := c.checkUser(ctx, p, idTokenInfo, vc); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// VerifyIDTokenAndGetUser verifies the provided ID token, and returns it along with the user record
+// of the user the token was issued to.
+//
+// This combines VerifyIDTokenWithOptions() and GetUser() into a single call. The CheckRevoked()
+// and CheckDisabled() options are evaluated against the same user record, so that no additional
+// RPC calls are made for them.
+func (c *Client) VerifyIDTokenAndGetUser(
+	ctx context.Context, idToken string, opts ...VerifyOption) (token *Token, user *UserRecord, err error) {
+
+	defer internal.WrapOpError(&err, "VerifyIDTokenAndGetUser", "")
+	vc := newVerifyConfig(opts)
+	p, err := c.verifyIDToken(ctx, idToken, vc)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err = c.checkUser(ctx, p, idTokenInfo, vc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, user, nil
+}
+
+func newVerifyConfig(opts []VerifyOption) *verifyConfig {
+	vc := &verifyConfig{}
+	for _, o := range opts {
+		o(vc)
+	}
+	return vc
+}
+
+// checkUser looks up the user account of a verified ID token, and applies the revocation and
+// disabled checks of vc to it.
+func (c *Client) checkUser(ctx context.Context, p *Token, ti *tokenInfo, vc *verifyConfig) (*UserRecord, error) {
+	user, err := c.getUserByUID(ctx, p.UID)
+	if err != nil {
+		return nil, err
+	}
+	if vc.checkRevoked && p.IssuedAt*1000 < user.TokensValidAfterMillis {
+		return nil, internal.Errorf(ti.revokedCode, "%s has been revoked", ti.title())
+	}
+	if vc.checkDisabled && user.Disabled {
+		return nil, internal.Error(userDisabled, "user account has been disabled")
+	}
+	return user, nil
+}
+
+// tokenInfo describes a type of token verified by the Client.
+type tokenInfo struct {
+	name         string // e.g. "ID token"
+	article      string // indefinite article of name
+	verifyFunc   string // name of the function that verifies the token
+	spanName     string
+	issuerPrefix string
+	docURL       string // URL of the documentation on verifying the token
+	revokedCode  string // error code reported for revoked tokens
+	expiredCode  string // error code reported for expired tokens
+	invalidCode  string // error code reported for malformed tokens, and tokens with invalid signatures or claims
+}
+
+var idTokenInfo = &tokenInfo{
+	name:         "ID token",
+	article:      "an",
+	verifyFunc:   "VerifyIDToken()",
+	spanName:     "firebase.auth.VerifyIDToken",
+	issuerPrefix: issuerPrefix,
+	docURL:       "https://firebase.google.com/docs/auth/admin/verify-id-tokens",
+	revokedCode:  idTokenRevoked,
+	expiredCode:  idTokenExpired,
+	invalidCode:  idTokenInvalid,
+}
+
+// tokenError is a token verification error with a specific cause, such as an invalid audience.
+//
+// It carries both the error code of the token type (e.g. idTokenInvalid) and the code of the cause,
+// so that internal.HasErrorCode reports either of them.
+type tokenError struct {
+	err   *internal.FirebaseError
+	cause *internal.FirebaseError
+}
+
+func newTokenError(code, cause, msg string) *tokenError {
+	return &tokenError{
+		err:   internal.Error(code, msg),
+		cause: internal.Error(cause, msg),
+	}
+}
+
+func (e *tokenError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the errors carrying the code of the token type and the code of the cause.
+func (e *tokenError) Unwrap() []error {
+	return []error{e.err, e.cause}
+}
+
+// title returns the name of the token, capitalized for the start of a sentence.
+func (ti *tokenInfo) title() string {
+	return strings.ToUpper(ti.name[:1]) + ti.name[1:]
+}
+
+func (c *Client) verifyIDToken(ctx context.Context, idToken string, vc *verifyConfig) (*Token, error) {
+	return c.verifyToken(ctx, idToken, idTokenInfo, vc.keySource(c.ks), c.clockSkew, vc)
+}
+
+// verifyToken verifies the signature and the claims of a token of the type described by ti, using the
+// keys of ks to verify the signature.
+func (c *Client) verifyToken(
+	ctx context.Context, token string, ti *tokenInfo, ks KeySource,
+	clockSkew time.Duration, vc *verifyConfig) (_ *Token, err error) {
+
+	h := &jwtHeader{}
+	ctx, span := c.startSpan(ctx, ti.spanName)
+	defer func() {
+		span.SetAttribute("kid", h.KeyID)
+		span.SetAttribute("outcome", outcome(err))
+		span.End(err)
+	}()
+
 	if c.projectID == "" {
 		return nil, errors.New("project id not available")
 	}
-	if idToken == "" {
-		return nil, fmt.Errorf("ID token must be a non-empty string")
+	if token == "" {
+		return nil, fmt.Errorf("%s must be a non-empty string", ti.title())
 	}
 
-	h := &jwtHeader{}
 	p := &Token{}
-	if err := decodeToken(idToken, c.ks, h, p); err != nil {
-		return nil, err
+	s, err := decodeUnverifiedToken(token, c.decoder, h, p)
+	if err != nil {
+		return nil, internal.Error(ti.invalidCode, err.Error())
+	}
+	if !c.emulator {
+		if err := verifyTokenSignature(ctx, s, ks, c.sv, h); err == errTokenSignature {
+			return nil, newTokenError(ti.invalidCode, invalidSignature, err.Error())
+		} else if err != nil {
+			return nil, err
+		}
 	}
 
-	projectIDMsg := "Make sure the ID token comes from the same Firebase project as the credential used to" +
-		" authenticate this SDK."
-	verifyTokenMsg := "See https://firebase.google.com/docs/auth/admin/verify-id-tokens for details on how to " +
-		"retrieve a valid ID token."
-	issuer := issuerPrefix + c.projectID
+	projectIDMsg := fmt.Sprintf("Make sure the %s comes from the same Firebase project as the credential used to"+
+		" authenticate this SDK.", ti.name)
+	verifyTokenMsg := fmt.Sprintf("See %s for details on how to retrieve a valid %s.", ti.docURL, ti.name)
+	audiences, projects := c.allowedAudiences(), c.allowedProjects()
+	issuers := make([]string, len(projects))
+	for i, pid := range projects {
+		issuers[i] = ti.issuerPrefix + pid
+	}
+	now := vc.currentTime(c).Unix()
+	skew := int64(clockSkew / time.Second)
+	nbf, _ := p.Claims["nbf"].(float64)
+	name := ti.title()
+	tenantID := c.tenantID
+	if vc.tenantID != "" {
+		tenantID = vc.tenantID
+	}
 
-	var err error
-	if h.KeyID == "" {
+	if h.KeyID == "" && (!c.emulator || p.Audience == firebaseAudience) {
 		if p.Audience == firebaseAudience {
-			err = fmt.Errorf("VerifyIDToken() expects an ID token, but was given a custom token")
+			err = internal.Errorf(ti.invalidCode, "%s expects %s %s, but was given a custom token",
+				ti.verifyFunc, ti.article, ti.name)
 		} else {
-			err = fmt.Errorf("ID token has no 'kid' header")
-		}
-	} else if h.Algorithm != "RS256" {
-		err = fmt.Errorf("ID token has invalid incorrect algorithm. Expected 'RS256' but got %q. %s",
-			h.Algorithm, verifyTokenMsg)
-	} else if p.Audience != c.projectID {
-		err = fmt.Errorf("ID token has invalid 'aud' (audience) claim. Expected %q but got %q. %s %s",
-			c.projectID, p.Audience, projectIDMsg, verifyTokenMsg)
-	} else if p.Issuer != issuer {
-		err = fmt.Errorf("ID token has invalid 'iss' (issuer) claim. Expected %q but got %q. %s %s",
-			issuer, p.Issuer, projectIDMsg, verifyTokenMsg)
-	} else if p.IssuedAt > clk.Now().Unix() {
-		err = fmt.Errorf("ID token issued at future timestamp: %d", p.IssuedAt)
-	} else if p.Expires < clk.Now().Unix() {
-		err = fmt.Errorf("ID token has expired. Expired at: %d", p.Expires)
+			err = internal.Errorf(ti.invalidCode, "%s has no 'kid' header", name)
+		}
+	} else if _, isRSA := rsaHashes[h.Algorithm]; !c.emulator && !isRSA && h.Algorithm != "ES256" {
+		err = internal.Errorf(ti.invalidCode, "%s has incorrect algorithm. "+
+			"Expected 'RS256', 'RS384', 'RS512' or 'ES256' but got %q. %s",
+			name, h.Algorithm, verifyTokenMsg)
+	} else if !containsString(audiences, p.Audience) {
+		err = newTokenError(ti.invalidCode, invalidAudience, fmt.Sprintf(
+			"%s has invalid 'aud' (audience) claim. Expected %s but got %q. %s %s",
+			name, expectedValues(audiences), p.Audience, projectIDMsg, verifyTokenMsg))
+	} else if !containsString(issuers, p.Issuer) {
+		err = newTokenError(ti.invalidCode, invalidIssuer, fmt.Sprintf(
+			"%s has invalid 'iss' (issuer) claim. Expected %s but got %q. %s %s",
+			name, expectedValues(issuers), p.Issuer, projectIDMsg, verifyTokenMsg))
+	} else if p.IssuedAt > now+skew {
+		err = newTokenError(ti.invalidCode, issuedInFuture,
+			fmt.Sprintf("%s issued at future timestamp: %d", name, p.IssuedAt))
+	} else if int64(nbf) > now+skew {
+		err = newTokenError(ti.invalidCode, issuedInFuture,
+			fmt.Sprintf("%s is not valid before timestamp: %d", name, int64(nbf)))
+	} else if p.AuthTime > now+skew {
+		err = newTokenError(ti.invalidCode, issuedInFuture,
+			fmt.Sprintf("%s has 'auth_time' claim in the future: %d", name, p.AuthTime))
+	} else if p.Expires < now-skew {
+		err = internal.Errorf(ti.expiredCode, "%s has expired. Expired at: %d", name, p.Expires)
+	} else if !p.hasSubject {
+		err = internal.Errorf(ti.invalidCode, "%s has no 'sub' (subject) claim. %s", name, verifyTokenMsg)
 	} else if p.Subject == "" {
-		err = fmt.Errorf("ID token has empty 'sub' (subject) claim. %s", verifyTokenMsg)
+		err = internal.Errorf(ti.invalidCode, "%s has empty 'sub' (subject) claim. %s", name, verifyTokenMsg)
 	} else if len(p.Subject) > 128 {
-		err = fmt.Errorf("ID token has a 'sub' (subject) claim longer than 128 characters. %s", verifyTokenMsg)
+		err = internal.Errorf(ti.invalidCode, "%s has a 'sub' (subject) claim longer than 128 characters. %s",
+			name, verifyTokenMsg)
+	} else if vc.requireAuthTime && p.AuthTime == 0 {
+		err = internal.Errorf(authTimeMissing, "%s has no 'auth_time' claim", name)
+	} else if vc.requireSecondFactor && p.SecondFactorIdentifier == "" {
+		err = internal.Errorf(secondFactorMissing, "%s was not issued for a multi-factor sign-in", name)
+	} else if tenantID != "" && p.TenantID != tenantID {
+		err = internal.Errorf(tenantIDMismatch, "%s has invalid 'firebase.tenant' claim. Expected %q but got %q",
+			name, tenantID, p.TenantID)
 	}
 
 	if err != nil {
@@ -253,39 +1506,84 @@ func (c *Client) VerifyIDToken(idToken string) (*Token, error) {
 //
 // VerifyIDTokenAndCheckRevoked verifies the signature and payload of the provided ID token and
 // checks that it wasn't revoked. Uses VerifyIDToken() internally to verify the ID token JWT.
-func (c *Client) VerifyIDTokenAndCheckRevoked(ctx context.Context, idToken string) (*Token, error) {
-	p, err := c.VerifyIDToken(idToken)
+func (c *Client) VerifyIDTokenAndCheckRevoked(ctx context.Context, idToken string) (token *Token, err error) {
+	defer internal.WrapOpError(&err, "VerifyIDTokenAndCheckRevoked", "")
+	vc := &verifyConfig{checkRevoked: true}
+	p, err := c.verifyIDToken(ctx, idToken, vc)
 	if err != nil {
 		return nil, err
 	}
+	if _, err := c.checkUser(ctx, p, idTokenInfo, vc); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
 
-	user, err := c.GetUser(ctx, p.UID)
+// VerifyIDTokenWithDeadline verifies the provided ID token, and returns a child context of ctx that
+// expires along with the token.
+//
+// The deadline of the returned context is set to the expiry time (exp) of the ID token minus the
+// specified margin. This can be used to bound any work performed on behalf of the user to the
+// validity period of the token. The margin must not be negative. An error is returned if the token
+// expires within the margin. Callers must call the returned CancelFunc to release the resources
+// associated with the context, as is the case with context.WithDeadline().
+func (c *Client) VerifyIDTokenWithDeadline(
+	ctx context.Context, idToken string,
+	margin time.Duration) (dctx context.Context, cancel context.CancelFunc, token *Token, err error) {
+
+	defer internal.WrapOpError(&err, "VerifyIDTokenWithDeadline", "")
+	if margin < 0 {
+		return nil, nil, nil, fmt.Errorf("margin must not be negative: %v", margin)
+	}
+	p, err := c.verifyIDToken(ctx, idToken, &verifyConfig{})
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
-	if p.IssuedAt*1000 < user.TokensValidAfterMillis {
-		return nil, internal.Error(idTokenRevoked, "ID token has been revoked")
+	remaining := p.TimeUntilExpiry(c.now()) - margin
+	if remaining <= 0 {
+		return nil, nil, nil, fmt.Errorf("ID token expires within the margin of %v. Expires at: %d", margin, p.Expires)
 	}
-	return p, nil
+	// Use a timeout relative to the clock of c rather than an absolute deadline, so that the deadline is
+	// consistent with the clock used to verify the token.
+	dctx, cancel = context.WithTimeout(ctx, remaining)
+	return dctx, cancel, p, nil
 }
 
-func parseKey(key string) (*rsa.PrivateKey, error) {
+func parseKey(key, passphrase string) (crypto.Signer, error) {
 	block, _ := pem.Decode([]byte(key))
 	if block == nil {
 		return nil, fmt.Errorf("no private key data found in: %v", key)
 	}
 	k := block.Bytes
+	if block.Type == encryptedPKCS8BlockType {
+		if passphrase == "" {
+			return nil, fmt.Errorf("private key is encrypted, and requires a passphrase; set it with "+
+				"auth.WithPrivateKeyPassphrase() or the %s environment variable", keyPassphraseEnvVar)
+		}
+		var err error
+		if k, err = decryptPKCS8(k, []byte(passphrase)); err != nil {
+			return nil, err
+		}
+	}
 	parsedKey, err := x509.ParsePKCS8PrivateKey(k)
 	if err != nil {
 		parsedKey, err = x509.ParsePKCS1PrivateKey(k)
 		if err != nil {
-			return nil, fmt.Errorf("private key should be a PEM or plain PKSC1 or PKCS8; parse error: %v", err)
+			parsedKey, err = x509.ParseECPrivateKey(k)
+			if err != nil {
+				return nil, fmt.Errorf("private key should be a PEM or plain PKCS1, PKCS8 or SEC1 (EC); "+
+					"parse error: %v", err)
+			}
 		}
 	}
-	parsed, ok := parsedKey.(*rsa.PrivateKey)
-	if !ok {
-		return nil, errors.New("private key is not an RSA key")
+	switch parsed := parsedKey.(type) {
+	case *rsa.PrivateKey:
+		return parsed, nil
+	case *ecdsa.PrivateKey:
+		if parsed.Curve == elliptic.P256() {
+			return parsed, nil
+		}
 	}
-	return parsed, nil
+	return nil, errors.New("private key must be an RSA key or an EC key on the P-256 curve")
 }
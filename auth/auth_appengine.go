@@ -17,24 +17,38 @@
 package auth
 
 import (
+	"net/http"
+
 	"golang.org/x/net/context"
 
 	"google.golang.org/appengine"
+
+	"firebase.google.com/go/internal"
 )
 
+// aeSigner signs custom tokens with the App Engine APIs. These APIs require an App Engine context,
+// which the contexts of ctx-less functions like CustomToken are not, so aeSigner makes all of its
+// calls with the context the Client was created with.
 type aeSigner struct {
 	ctx context.Context
 }
 
-func newSigner(ctx context.Context) (signer, error) {
+func newSigner(ctx context.Context, email string, hc *http.Client, conf *internal.AuthConfig) (signer, error) {
 	return aeSigner{ctx}, nil
 }
 
-func (s aeSigner) Email() (string, error) {
+func platformSignerType(s signer) SignerType {
+	if _, ok := s.(aeSigner); ok {
+		return SignerAppEngine
+	}
+	return ""
+}
+
+func (s aeSigner) Email(ctx context.Context) (string, error) {
 	return appengine.ServiceAccount(s.ctx)
 }
 
-func (s aeSigner) Sign(ss []byte) ([]byte, error) {
+func (s aeSigner) Sign(ctx context.Context, ss []byte) ([]byte, error) {
 	_, sig, err := appengine.SignBytes(s.ctx, ss)
 	return sig, err
 }
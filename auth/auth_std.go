@@ -16,8 +16,18 @@
 
 package auth // import "firebase.google.com/go/auth"
 
-import "golang.org/x/net/context"
+import (
+	"net/http"
 
-func newSigner(ctx context.Context) (signer, error) {
-	return serviceAcctSigner{}, nil
+	"golang.org/x/net/context"
+
+	"firebase.google.com/go/internal"
+)
+
+func newSigner(ctx context.Context, email string, hc *http.Client, conf *internal.AuthConfig) (signer, error) {
+	return newIAMSigner(email, hc, conf), nil
+}
+
+func platformSignerType(s signer) SignerType {
+	return ""
 }
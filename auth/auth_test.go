@@ -15,12 +15,23 @@
 package auth
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -49,7 +60,7 @@ var defaultTestOpts = []option.ClientOption{
 func TestMain(m *testing.M) {
 	var (
 		err   error
-		ks    keySource
+		ks    KeySource
 		creds *google.DefaultCredentials
 		opts  []option.ClientOption
 	)
@@ -73,7 +84,10 @@ func TestMain(m *testing.M) {
 			log.Fatalln(err)
 		}
 
-		ks = &fileKeySource{FilePath: "../testdata/public_certs.json"}
+		ks, err = newFileKeySource("../testdata/public_certs.json", false)
+		if err != nil {
+			log.Fatalln(err)
+		}
 	}
 	client, err = NewClient(ctx, &internal.AuthConfig{
 		Creds:     creds,
@@ -84,6 +98,7 @@ func TestMain(m *testing.M) {
 		log.Fatalln(err)
 	}
 	client.ks = ks
+	client.cookieKS = ks
 
 	testGetUserResponse, err = ioutil.ReadFile("../testdata/get_user.json")
 	if err != nil {
@@ -109,6 +124,118 @@ func TestNewClientInvalidCredentials(t *testing.T) {
 	}
 }
 
+func TestNewClientECPrivateKey(t *testing.T) {
+	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sa := map[string]interface{}{
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})),
+		"client_email": "bar@test.com",
+	}
+	b, err := json.Marshal(sa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &internal.AuthConfig{
+		Creds:     &google.DefaultCredentials{JSON: b},
+		Opts:      defaultTestOpts,
+		ProjectID: "mock-project-id",
+	}
+	c, err := NewClient(context.Background(), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := c.CustomToken("user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &jwtHeader{}
+	if err := decode(jsonDecoder{}, strings.Split(token, ".")[0], h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Algorithm != "ES256" {
+		t.Errorf("Algorithm = %q; want = %q", h.Algorithm, "ES256")
+	}
+	ct, err := c.VerifyCustomToken(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct.UID != "user1" || ct.Issuer != "bar@test.com" {
+		t.Errorf("VerifyCustomToken() = (%q, %q); want = (%q, %q)", ct.UID, ct.Issuer, "user1", "bar@test.com")
+	}
+
+	// An RS256 custom token must not be accepted by a Client with an EC key.
+	rsaToken, err := client.CustomToken("user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct, err := c.VerifyCustomToken(ctx, rsaToken); ct != nil || err == nil {
+		t.Errorf("VerifyCustomToken(RS256) = (%v, %v); want = (nil, error)", ct, err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec1, err := x509.MarshalECPrivateKey(p256Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec1P384, err := x509.MarshalECPrivateKey(p384Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toPEM := func(typ string, der []byte) string {
+		return string(pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}))
+	}
+
+	valid := []struct {
+		name string
+		key  string
+		want interface{}
+	}{
+		{"PKCS1", toPEM("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)), rsaKey.Public()},
+		{"SEC1", toPEM("EC PRIVATE KEY", sec1), p256Key.Public()},
+	}
+	for _, tc := range valid {
+		pk, err := parseKey(tc.key, "")
+		if err != nil || !reflect.DeepEqual(pk.Public(), tc.want) {
+			t.Errorf("parseKey(%s) = (%v, %v); want = (%v, nil)", tc.name, pk, err, tc.want)
+		}
+	}
+
+	invalid := []struct {
+		name string
+		key  string
+		want string
+	}{
+		{"NotPEM", "foo", "no private key data found"},
+		{"Garbage", toPEM("PRIVATE KEY", []byte("foo")), "private key should be a PEM or plain PKCS1, PKCS8 or SEC1"},
+		{"P384", toPEM("EC PRIVATE KEY", sec1P384), "private key must be an RSA key or an EC key on the P-256 curve"},
+	}
+	for _, tc := range invalid {
+		if pk, err := parseKey(tc.key, ""); pk != nil || err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+			t.Errorf("parseKey(%s) = (%v, %v); want = (nil, %q)", tc.name, pk, err, tc.want)
+		}
+	}
+}
+
 func TestNewClientInvalidPrivateKey(t *testing.T) {
 	sa := map[string]interface{}{
 		"private_key":  "foo",
@@ -125,6 +252,211 @@ func TestNewClientInvalidPrivateKey(t *testing.T) {
 	}
 }
 
+func TestNewVerifyOnlyClient(t *testing.T) {
+	c, err := NewVerifyOnlyClient(context.Background(), client.projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ks = client.ks
+
+	ft, err := c.VerifyIDToken(testIDToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.UID != "1234567890" {
+		t.Errorf("UID = %q; want = %q", ft.UID, "1234567890")
+	}
+
+	if tok, err := c.CustomToken("user1"); tok != "" || !strings.Contains(fmt.Sprint(err), "not configured") {
+		t.Errorf("CustomToken() = (%q, %v); want = (\"\", not configured error)", tok, err)
+	}
+	if u, err := c.GetUser(context.Background(), "user1"); u != nil || !strings.Contains(fmt.Sprint(err), "not configured") {
+		t.Errorf("GetUser() = (%v, %v); want = (nil, not configured error)", u, err)
+	}
+	if ft, err := c.VerifyIDTokenAndCheckRevoked(context.Background(), testIDToken); ft != nil || err == nil {
+		t.Errorf("VerifyIDTokenAndCheckRevoked() = (%v, %v); want = (nil, error)", ft, err)
+	}
+}
+
+// recordingKeyTransport records each request, and responds with the public keys in data.
+type recordingKeyTransport struct {
+	data []byte
+	reqs []*http.Request
+}
+
+func (r *recordingKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.reqs = append(r.reqs, req)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Cache-Control": {"public, max-age=100"}},
+		Body:       ioutil.NopCloser(bytes.NewReader(r.data)),
+	}, nil
+}
+
+func TestNewVerifyOnlyClientFromConfig(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/public_certs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := &recordingKeyTransport{data: data}
+	guardErr := errors.New("app deleted")
+	var deleted bool
+	conf := &internal.AuthConfig{
+		ProjectID:           "mock-project-id",
+		Version:             "1.2.3",
+		MaxResponseBodySize: 1024 * 1024,
+		Headers:             http.Header{"X-Custom-Header": []string{"custom-value"}},
+		UserAgentSuffix:     "my-app/1.0",
+		Transport:           rt,
+		RequestGuard: func() error {
+			if deleted {
+				return guardErr
+			}
+			return nil
+		},
+		VerifyOnly: true,
+	}
+	c, err := NewClient(context.Background(), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.EffectiveConfig(); got.SignerType != SignerNone || got.UserManagement ||
+		got.MaxResponseBodySize != conf.MaxResponseBodySize || got.Version != "Go/Admin/1.2.3" {
+		t.Errorf("EffectiveConfig() = %#v; want = verify-only config", got)
+	}
+
+	if err := c.PrefetchPublicKeys(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.reqs) != 1 {
+		t.Fatalf("Requests = %d; want = 1", len(rt.reqs))
+	}
+	for _, req := range rt.reqs {
+		if h := req.Header.Get("X-Custom-Header"); h != "custom-value" {
+			t.Errorf("X-Custom-Header = %q; want = %q", h, "custom-value")
+		}
+		if ua := req.Header.Get("User-Agent"); !strings.HasSuffix(ua, "my-app/1.0") {
+			t.Errorf("User-Agent = %q; want suffix = %q", ua, "my-app/1.0")
+		}
+		if h := req.Header.Get("Authorization"); h != "" {
+			t.Errorf("Authorization = %q; want = empty", h)
+		}
+	}
+
+	deleted = true
+	c, err = NewClient(context.Background(), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PrefetchPublicKeys(context.Background()); err == nil || !strings.Contains(err.Error(), "app deleted") {
+		t.Errorf("PrefetchPublicKeys() = %v; want = guard error", err)
+	}
+	if len(rt.reqs) != 1 {
+		t.Errorf("Requests = %d; want = 1", len(rt.reqs))
+	}
+}
+
+func TestNewVerifyOnlyClientNoProjectID(t *testing.T) {
+	if c, err := NewVerifyOnlyClient(context.Background(), ""); c != nil || err == nil {
+		t.Errorf("NewVerifyOnlyClient() = (%v,%v); want = (nil, error)", c, err)
+	}
+}
+
+func TestWithSignatureVerifier(t *testing.T) {
+	sv := &mockSignatureVerifier{}
+	c := *client
+	if err := WithSignatureVerifier(sv)(&c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.VerifyIDToken(testIDToken); err != nil {
+		t.Fatal(err)
+	}
+	if sv.calls == 0 || sv.alg != "RS256" {
+		t.Errorf("VerifySignature() = (%d calls, %q); want = (> 0 calls, %q)", sv.calls, sv.alg, "RS256")
+	}
+	if got := c.EffectiveConfig().SignatureVerifierType; got != SignatureVerifierCustom {
+		t.Errorf("SignatureVerifierType = %q; want = %q", got, SignatureVerifierCustom)
+	}
+
+	sv.err = errors.New("rejected")
+	if ft, err := c.VerifyIDToken(testIDToken); ft != nil || err == nil {
+		t.Errorf("VerifyIDToken() = (%v, %v); want = (nil, error)", ft, err)
+	}
+
+	if err := WithSignatureVerifier(nil)(&c); err == nil {
+		t.Errorf("WithSignatureVerifier(nil) = nil; want = error")
+	}
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	creds, err := transport.Creds(context.Background(), defaultTestOpts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &internal.AuthConfig{
+		Creds:               creds,
+		Opts:                defaultTestOpts,
+		ProjectID:           "mock-project-id",
+		Version:             "test.version",
+		MaxResponseBodySize: 1024,
+	}
+	c, err := NewClient(context.Background(), conf, WithAPIKey("secret-api-key"),
+		WithRateLimit(&RateLimit{Rate: 5, Burst: 10}),
+		WithCustomTokenSkew(&CustomTokenSkew{Backdate: 30 * time.Second}),
+		WithClockSkew(10*time.Second+500*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &EffectiveConfig{
+		ProjectID:             "mock-project-id",
+		Version:               "Go/Admin/test.version",
+		SignerType:            SignerServiceAccount,
+		SignatureVerifierType: SignatureVerifierDefault,
+		PublicKeyURL:          googleCertURL,
+		KeySourceType:         KeySourceHTTP,
+		SessionCookieKeyURL:   sessionCookieCertURL,
+		MaxResponseBodySize:   1024,
+		KeyFetchTimeout:       defaultKeyFetchTimeout,
+		UserManagement:        true,
+		CustomTokenVerify:     true,
+		APIKeySet:             true,
+		TokenExchangeURL:      tokenExchangeURL,
+		RateLimit:             &RateLimit{Rate: 5, Burst: 10},
+		CustomTokenSkew:       &CustomTokenSkew{Backdate: 30 * time.Second},
+		ClockSkew:             10 * time.Second,
+		SessionCookieSkew:     10 * time.Second,
+	}
+	got := c.EffectiveConfig()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EffectiveConfig() = %#v; want = %#v", got, want)
+	}
+	if b, err := json.Marshal(got); err != nil || strings.Contains(string(b), "secret-api-key") ||
+		strings.Contains(string(b), "PRIVATE KEY") {
+		t.Errorf("EffectiveConfig() = (%s, %v); want no secrets", string(b), err)
+	}
+}
+
+func TestEffectiveConfigVerifyOnly(t *testing.T) {
+	c, err := NewVerifyOnlyClient(context.Background(), "mock-project-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &EffectiveConfig{
+		ProjectID:             "mock-project-id",
+		SignerType:            SignerNone,
+		SignatureVerifierType: SignatureVerifierDefault,
+		PublicKeyURL:          googleCertURL,
+		KeySourceType:         KeySourceHTTP,
+		SessionCookieKeyURL:   sessionCookieCertURL,
+		MaxResponseBodySize:   internal.DefaultMaxResponseBodySize,
+		KeyFetchTimeout:       defaultKeyFetchTimeout,
+	}
+	if got := c.EffectiveConfig(); !reflect.DeepEqual(got, want) {
+		t.Errorf("EffectiveConfig() = %#v; want = %#v", got, want)
+	}
+}
+
 func TestCustomToken(t *testing.T) {
 	token, err := client.CustomToken("user1")
 	if err != nil {
@@ -146,6 +478,133 @@ func TestCustomTokenWithClaims(t *testing.T) {
 	verifyCustomToken(t, token, claims)
 }
 
+func TestCustomTokenWithTimes(t *testing.T) {
+	claims := map[string]interface{}{"premium": true}
+	iat := time.Unix(1500000000, 0)
+	exp := iat.Add(30 * time.Minute)
+	token, err := client.CustomTokenWithTimes("user1", claims, iat, exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyCustomToken(t, token, claims)
+
+	p := &customToken{}
+	if err := p.decode(jsonDecoder{}, strings.Split(token, ".")[1]); err != nil {
+		t.Fatal(err)
+	}
+	if p.Iat != iat.Unix() || p.Exp != exp.Unix() {
+		t.Errorf("CustomTokenWithTimes() = (iat: %d, exp: %d); want = (%d, %d)", p.Iat, p.Exp, iat.Unix(), exp.Unix())
+	}
+
+	again, err := client.CustomTokenWithTimes("user1", claims, iat, exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != token {
+		t.Errorf("CustomTokenWithTimes() = %q; want = %q", again, token)
+	}
+}
+
+func TestCustomTokenWithTimesECKey(t *testing.T) {
+	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := *client
+	c.snr = serviceAcctSigner{email: "bar@test.com", pk: pk}
+	c.cks = &staticKeySource{keys: []*PublicKey{{Key: pk.Public()}}}
+
+	iat := time.Unix(1500000000, 0)
+	exp := iat.Add(30 * time.Minute)
+	token, err := c.CustomTokenWithTimes("user1", nil, iat, exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := c.CustomTokenWithTimes("user1", nil, iat, exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The header and the payload are stable, but ECDSA signatures are randomized.
+	segs, againSegs := strings.Split(token, "."), strings.Split(again, ".")
+	if segs[0] != againSegs[0] || segs[1] != againSegs[1] {
+		t.Errorf("CustomTokenWithTimes() = %q; want same header and payload as %q", again, token)
+	}
+	if segs[2] == againSegs[2] {
+		t.Errorf("CustomTokenWithTimes() signature = %q; want a different ECDSA signature", againSegs[2])
+	}
+	for _, tok := range []string{token, again} {
+		h := &jwtHeader{}
+		var p customToken
+		if err := decodeToken(ctx, tok, c.cks, c.sv, c.decoder, h, &p); err != nil {
+			t.Errorf("decodeToken() = %v; want = nil", err)
+		}
+		if h.Algorithm != "ES256" {
+			t.Errorf("Algorithm = %q; want = %q", h.Algorithm, "ES256")
+		}
+	}
+}
+
+func TestCustomTokenWithInvalidTimes(t *testing.T) {
+	iat := time.Unix(1500000000, 0)
+	cases := []struct {
+		name string
+		exp  time.Time
+	}{
+		{"ExpiresAtIssue", iat},
+		{"ExpiresBeforeIssue", iat.Add(-time.Second)},
+		{"TooLong", iat.Add(time.Hour + time.Second)},
+	}
+	for _, tc := range cases {
+		if token, err := client.CustomTokenWithTimes("user1", nil, iat, tc.exp); token != "" || err == nil {
+			t.Errorf("CustomTokenWithTimes(%s) = (%q, %v); want = (\"\", error)", tc.name, token, err)
+		}
+	}
+	if _, err := client.CustomTokenWithTimes("user1", nil, iat, iat.Add(time.Hour)); err != nil {
+		t.Errorf("CustomTokenWithTimes(OneHour) = %v; want = nil", err)
+	}
+}
+
+func TestCustomTokenWithExpiry(t *testing.T) {
+	claims := map[string]interface{}{"premium": true}
+	token, err := client.CustomTokenWithExpiry("user1", claims, 10*time.Minute+500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyCustomToken(t, token, claims)
+
+	p := &customToken{}
+	if err := p.decode(jsonDecoder{}, strings.Split(token, ".")[1]); err != nil {
+		t.Fatal(err)
+	}
+	if lifetime := p.Exp - p.Iat; lifetime != 600 {
+		t.Errorf("CustomTokenWithExpiry() lifetime = %d; want = 600", lifetime)
+	}
+}
+
+func TestCustomTokenWithInvalidExpiry(t *testing.T) {
+	cases := []struct {
+		name      string
+		expiresIn time.Duration
+	}{
+		{"Zero", 0},
+		{"Negative", -time.Minute},
+		{"SubSecond", 500 * time.Millisecond},
+		{"TooLong", time.Hour + time.Second},
+	}
+	for _, tc := range cases {
+		if token, err := client.CustomTokenWithExpiry("user1", nil, tc.expiresIn); token != "" || err == nil {
+			t.Errorf("CustomTokenWithExpiry(%s) = (%q, %v); want = (\"\", error)", tc.name, token, err)
+		}
+	}
+	if _, err := client.CustomTokenWithExpiry("user1", nil, time.Hour); err != nil {
+		t.Errorf("CustomTokenWithExpiry(OneHour) = %v; want = nil", err)
+	}
+	if _, err := client.CustomTokenWithExpiry("user1", map[string]interface{}{"exp": 1}, time.Minute); err == nil {
+		t.Errorf("CustomTokenWithExpiry(ReservedClaim) = nil; want = error")
+	}
+}
+
 func TestCustomTokenWithNilClaims(t *testing.T) {
 	token, err := client.CustomTokenWithClaims("user1", nil)
 	if err != nil {
@@ -193,62 +652,1029 @@ func TestCustomTokenInvalidCredential(t *testing.T) {
 	}
 }
 
-func TestVerifyIDTokenAndCheckRevokedValid(t *testing.T) {
-	s := echoServer(testGetUserResponse, t)
-	defer s.Close()
+func TestVerifyCustomToken(t *testing.T) {
+	claims := map[string]interface{}{"premium": true}
+	token, err := client.CustomTokenWithClaims("user1", claims)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	ft, err := s.Client.VerifyIDTokenAndCheckRevoked(ctx, testIDToken)
+	ct, err := client.VerifyCustomToken(ctx, token)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
-	if ft.Claims["admin"] != true {
-		t.Errorf("Claims['admin'] = %v; want = true", ft.Claims["admin"])
+	email, err := client.snr.Email(ctx)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if ft.UID != ft.Subject {
-		t.Errorf("UID = %q; Sub = %q; want UID = Sub", ft.UID, ft.Subject)
+	if ct.UID != "user1" {
+		t.Errorf("UID = %q; want = %q", ct.UID, "user1")
+	}
+	if ct.Issuer != email {
+		t.Errorf("Issuer = %q; want = %q", ct.Issuer, email)
+	}
+	if ct.Audience != firebaseAudience {
+		t.Errorf("Audience = %q; want = %q", ct.Audience, firebaseAudience)
+	}
+	if ct.Expires-ct.IssuedAt != tokenExpSeconds {
+		t.Errorf("Expires - IssuedAt = %d; want = %d", ct.Expires-ct.IssuedAt, tokenExpSeconds)
+	}
+	if ct.Claims["premium"] != true {
+		t.Errorf("Claims['premium'] = %v; want = true", ct.Claims["premium"])
 	}
 }
 
-func TestVerifyIDTokenAndCheckRevokedDoNotCheck(t *testing.T) {
-	s := echoServer(testGetUserResponse, t)
-	defer s.Close()
-	tok := getIDToken(mockIDTokenPayload{"uid": "uid", "iat": 1970}) // old token
+func TestCustomTokenSkew(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	clk = &mockClock{now: now}
+	defer func() { clk = &systemClock{} }()
 
-	ft, err := s.Client.VerifyIDToken(tok)
+	cases := []struct {
+		skew     *CustomTokenSkew
+		iat, exp time.Time
+	}{
+		{
+			&CustomTokenSkew{},
+			now, now.Add(time.Hour),
+		},
+		{
+			&CustomTokenSkew{Backdate: 5 * time.Minute},
+			now.Add(-5 * time.Minute), now.Add(55 * time.Minute),
+		},
+		{
+			&CustomTokenSkew{ExpiryMargin: 2*time.Minute + 500*time.Millisecond},
+			now, now.Add(58 * time.Minute),
+		},
+		{
+			&CustomTokenSkew{Backdate: time.Minute, ExpiryMargin: time.Minute},
+			now.Add(-time.Minute), now.Add(58 * time.Minute),
+		},
+	}
+	for _, tc := range cases {
+		c := *client
+		if err := WithCustomTokenSkew(tc.skew)(&c); err != nil {
+			t.Fatal(err)
+		}
+		token, err := c.CustomToken("user1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ct, err := c.VerifyCustomToken(ctx, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct.IssuedAt != tc.iat.Unix() || ct.Expires != tc.exp.Unix() {
+			t.Errorf("CustomToken(%#v) = (iat: %d, exp: %d); want = (iat: %d, exp: %d)",
+				tc.skew, ct.IssuedAt, ct.Expires, tc.iat.Unix(), tc.exp.Unix())
+		}
+
+		results, err := c.CustomTokens(ctx, []string{"user2"})
+		if err != nil || results[0].Err != nil {
+			t.Fatalf("CustomTokens() = (%v, %v)", results, err)
+		}
+		if ct, err = c.VerifyCustomToken(ctx, results[0].Token); err != nil {
+			t.Fatal(err)
+		}
+		if ct.IssuedAt != tc.iat.Unix() || ct.Expires != tc.exp.Unix() {
+			t.Errorf("CustomTokens(%#v) = (iat: %d, exp: %d); want = (iat: %d, exp: %d)",
+				tc.skew, ct.IssuedAt, ct.Expires, tc.iat.Unix(), tc.exp.Unix())
+		}
+	}
+}
+
+func TestInvalidCustomTokenSkew(t *testing.T) {
+	cases := []*CustomTokenSkew{
+		nil,
+		{Backdate: -time.Second},
+		{ExpiryMargin: -time.Second},
+		{Backdate: time.Hour},
+		{Backdate: 30 * time.Minute, ExpiryMargin: 30 * time.Minute},
+	}
+	for _, skew := range cases {
+		c := *client
+		if err := WithCustomTokenSkew(skew)(&c); err == nil {
+			t.Errorf("WithCustomTokenSkew(%#v) = nil; want = error", skew)
+		}
+	}
+}
+
+func TestVerifyCustomTokenExpired(t *testing.T) {
+	clk = &mockClock{now: time.Now().Add(-2 * time.Hour)}
+	token, err := client.CustomToken("user1")
+	clk = &systemClock{}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ct, err := client.VerifyCustomToken(ctx, token); ct != nil || err == nil {
+		t.Errorf("VerifyCustomToken(expired) = (%v, %v); want = (nil, error)", ct, err)
+	}
+}
+
+func TestVerifyCustomTokenError(t *testing.T) {
+	token, err := client.CustomToken("user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+
+	cases := []struct {
+		name  string
+		token string
+	}{
+		{"EmptyToken", ""},
+		{"MalformedToken", "foo.bar"},
+		{"InvalidSignature", fmt.Sprintf("%s.%s.invalidsignature", parts[0], parts[1])},
+		{"IDToken", testIDToken},
+	}
+
+	for _, tc := range cases {
+		if ct, err := client.VerifyCustomToken(ctx, tc.token); ct != nil || err == nil {
+			t.Errorf("VerifyCustomToken(%s) = (%v, %v); want = (nil, error)", tc.name, ct, err)
+		}
+	}
+}
+
+func TestVerifyCustomTokenNoPrivateKey(t *testing.T) {
+	token, err := client.CustomToken("user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Client{snr: client.snr}
+	if ct, err := c.VerifyCustomToken(ctx, token); ct != nil || err == nil {
+		t.Errorf("VerifyCustomToken() = (%v, %v); want = (nil, error)", ct, err)
+	}
+}
+
+func TestCustomTokens(t *testing.T) {
+	uids := []string{"user1", "", "user2", strings.Repeat("a", 129), "user3"}
+	results, err := client.CustomTokens(ctx, uids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(uids) {
+		t.Fatalf("CustomTokens() = %d results; want = %d", len(results), len(uids))
+	}
+
+	for i, r := range results {
+		if r.UID != uids[i] {
+			t.Errorf("CustomTokens()[%d].UID = %q; want = %q", i, r.UID, uids[i])
+		}
+		if i == 1 || i == 3 {
+			if r.Token != "" || r.Err == nil {
+				t.Errorf("CustomTokens()[%d] = (%q, %v); want = (\"\", error)", i, r.Token, r.Err)
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Fatalf("CustomTokens()[%d] = %v", i, r.Err)
+		}
+		verifyCustomToken(t, r.Token, nil)
+	}
+}
+
+func TestCustomTokensWithClaims(t *testing.T) {
+	claims := map[string]map[string]interface{}{
+		"user1": {"foo": "bar", "premium": true},
+		"user2": {"sub": "1234"},
+	}
+	results, err := client.CustomTokensWithClaims(ctx, []string{"user1", "user2", "user3"}, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil {
+		t.Fatal(results[0].Err)
+	}
+	verifyCustomToken(t, results[0].Token, claims["user1"])
+
+	if results[1].Token != "" || results[1].Err == nil {
+		t.Errorf("CustomTokensWithClaims(reserved) = (%q, %v); want = (\"\", error)", results[1].Token, results[1].Err)
+	}
+
+	if results[2].Err != nil {
+		t.Fatal(results[2].Err)
+	}
+	verifyCustomToken(t, results[2].Token, nil)
+}
+
+func TestCustomTokensAggregateError(t *testing.T) {
+	results, err := client.CustomTokens(ctx, []string{"user1", "user2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := results.AggregateError(); err != nil {
+		t.Errorf("AggregateError() = %v; want = nil", err)
+	}
+
+	results, err = client.CustomTokens(ctx, []string{"user1", "", "user2", strings.Repeat("a", 129)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = results.AggregateError()
+	ae, ok := err.(*internal.AggregateError)
+	if !ok {
+		t.Fatalf("AggregateError() = %T; want = *internal.AggregateError", err)
+	}
+	if len(ae.Errors) != 2 {
+		t.Fatalf("AggregateError() = %d errors; want = 2", len(ae.Errors))
+	}
+	for i, idx := range []int{1, 3} {
+		oe, ok := ae.Errors[i].(*internal.OpError)
+		if !ok || oe.Arg != results[idx].UID || oe.Err != results[idx].Err {
+			t.Errorf("AggregateError()[%d] = %v; want = CustomToken(%q): %v", i, ae.Errors[i], results[idx].UID, results[idx].Err)
+		}
+	}
+	if !strings.HasPrefix(err.Error(), "2 errors occurred: CustomToken: ") {
+		t.Errorf("AggregateError().Error() = %q; want = 2 errors", err.Error())
+	}
+}
+
+func TestCustomTokensEmpty(t *testing.T) {
+	results, err := client.CustomTokens(ctx, nil)
+	if len(results) != 0 || err != nil {
+		t.Errorf("CustomTokens(nil) = (%v, %v); want = ([], nil)", results, err)
+	}
+}
+
+func TestCustomTokensCancelledContext(t *testing.T) {
+	cctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	uids := make([]string, 100)
+	for i := range uids {
+		uids[i] = fmt.Sprintf("user%d", i)
+	}
+	results, err := client.CustomTokens(cctx, uids)
+	if oe, ok := err.(*internal.OpError); results != nil || !ok || oe.Err != context.Canceled {
+		t.Errorf("CustomTokens() = (%v, %v); want = (nil, %v)", results, err, context.Canceled)
+	}
+}
+
+func TestCustomTokensInvalidCredential(t *testing.T) {
+	s, err := NewClient(context.Background(), &internal.AuthConfig{Opts: defaultTestOpts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results, err := s.CustomTokens(ctx, []string{"user1"}); results != nil || err == nil {
+		t.Errorf("CustomTokens() = (%v, %v); want = (nil, error)", results, err)
+	}
+}
+
+func TestImpersonateUser(t *testing.T) {
+	var req map[string]interface{}
+	var query, version string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		query = r.URL.RawQuery
+		version = r.Header.Get("X-Client-Version")
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"idToken": "id-token", "refreshToken": "refresh-token", "expiresIn": "3600"}`))
+	}))
+	defer srv.Close()
+
+	c := *client
+	c.exchangeEndpoint = srv.URL
+	c.version = "Go/Admin/test.version"
+	if err := WithAPIKey("test-api-key")(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	claims := map[string]interface{}{"premium": true}
+	tokens, err := c.ImpersonateUser(ctx, "user1", claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &UserTokens{IDToken: "id-token", RefreshToken: "refresh-token", ExpiresIn: time.Hour}
+	if *tokens != *want {
+		t.Errorf("ImpersonateUser() = %#v; want = %#v", tokens, want)
+	}
+	if query != "key=test-api-key" {
+		t.Errorf("Query = %q; want = %q", query, "key=test-api-key")
+	}
+	if version != "Go/Admin/test.version" {
+		t.Errorf("X-Client-Version = %q; want = %q", version, "Go/Admin/test.version")
+	}
+	if req["returnSecureToken"] != true {
+		t.Errorf("returnSecureToken = %v; want = true", req["returnSecureToken"])
+	}
+	token, _ := req["token"].(string)
+	verifyCustomToken(t, token, claims)
+}
+
+func TestImpersonateUserError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": {"code": 400, "message": "USER_DISABLED"}}`))
+	}))
+	defer srv.Close()
+
+	c := *client
+	c.exchangeEndpoint = srv.URL
+	c.apiKey = "test-api-key"
+	tokens, err := c.ImpersonateUser(ctx, "user1", nil)
+	if tokens != nil || !IsUnknown(err) {
+		t.Errorf("ImpersonateUser() = (%v, %v); want = (nil, unknown error)", tokens, err)
+	}
+	if err != nil && !strings.Contains(err.Error(), "USER_DISABLED") {
+		t.Errorf("ImpersonateUser() = %v; want error containing %q", err, "USER_DISABLED")
+	}
+}
+
+func TestImpersonateUserNoAPIKey(t *testing.T) {
+	if tokens, err := client.ImpersonateUser(ctx, "user1", nil); tokens != nil || err == nil {
+		t.Errorf("ImpersonateUser() = (%v, %v); want = (nil, error)", tokens, err)
+	}
+	if err := WithAPIKey("")(&Client{}); err == nil {
+		t.Errorf("WithAPIKey('') = nil; want = error")
+	}
+}
+
+func TestImpersonateUserInvalidUID(t *testing.T) {
+	c := *client
+	c.apiKey = "test-api-key"
+	c.exchangeEndpoint = "http://localhost:0"
+	if tokens, err := c.ImpersonateUser(ctx, "", nil); tokens != nil || err == nil {
+		t.Errorf("ImpersonateUser('') = (%v, %v); want = (nil, error)", tokens, err)
+	}
+}
+
+func TestVerifyIDTokenAndCheckRevokedValid(t *testing.T) {
+	s := echoServer(testGetUserResponse, t)
+	defer s.Close()
+
+	ft, err := s.Client.VerifyIDTokenAndCheckRevoked(ctx, testIDToken)
+	if err != nil {
+		t.Error(err)
+	}
+	if ft.Claims["admin"] != true {
+		t.Errorf("Claims['admin'] = %v; want = true", ft.Claims["admin"])
+	}
+	if ft.UID != ft.Subject {
+		t.Errorf("UID = %q; Sub = %q; want UID = Sub", ft.UID, ft.Subject)
+	}
+}
+
+func TestVerifyIDTokenAndCheckRevokedDoNotCheck(t *testing.T) {
+	s := echoServer(testGetUserResponse, t)
+	defer s.Close()
+	tok := getIDToken(mockIDTokenPayload{"uid": "uid", "iat": 1970}) // old token
+
+	ft, err := s.Client.VerifyIDToken(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.Claims["admin"] != true {
+		t.Errorf("Claims['admin'] = %v; want = true", ft.Claims["admin"])
+	}
+	if ft.UID != ft.Subject {
+		t.Errorf("UID = %q; Sub = %q; want UID = Sub", ft.UID, ft.Subject)
+	}
+}
+
+func TestVerifyIDTokenAndCheckRevokedInvalidated(t *testing.T) {
+	s := echoServer(testGetUserResponse, t)
+	defer s.Close()
+	tok := getIDToken(mockIDTokenPayload{"uid": "uid", "iat": 1970}) // old token
+
+	p, err := s.Client.VerifyIDTokenAndCheckRevoked(ctx, tok)
+	we := "VerifyIDTokenAndCheckRevoked: ID token has been revoked"
+	if p != nil || err == nil || err.Error() != we || !IsIDTokenRevoked(err) {
+		t.Errorf("VerifyIDTokenAndCheckRevoked(ctx, token) =(%v, %v); want = (%v, %v)",
+			p, err, nil, we)
+	}
+}
+
+func TestVerifyIDTokenAndGetUser(t *testing.T) {
+	s := echoServer(testGetUserResponse, t)
+	defer s.Close()
+
+	ft, user, err := s.Client.VerifyIDTokenAndGetUser(ctx, testIDToken, CheckRevoked(), CheckDisabled())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.Claims["admin"] != true {
+		t.Errorf("Claims['admin'] = %v; want = true", ft.Claims["admin"])
+	}
+	if user.UID != "testuser" {
+		t.Errorf("UID = %q; want = %q", user.UID, "testuser")
+	}
+	if len(s.Req) != 1 {
+		t.Errorf("VerifyIDTokenAndGetUser() made %d requests; want = 1", len(s.Req))
+	}
+}
+
+func TestVerifyIDTokenAndGetUserRevoked(t *testing.T) {
+	s := echoServer(testGetUserResponse, t)
+	defer s.Close()
+	tok := getIDToken(mockIDTokenPayload{"uid": "uid", "iat": 1970}) // old token
+
+	// Revocation is only checked when requested.
+	if _, _, err := s.Client.VerifyIDTokenAndGetUser(ctx, tok); err != nil {
+		t.Fatal(err)
+	}
+	ft, user, err := s.Client.VerifyIDTokenAndGetUser(ctx, tok, CheckRevoked())
+	we := "VerifyIDTokenAndGetUser: ID token has been revoked"
+	if ft != nil || user != nil || err == nil || err.Error() != we || !IsIDTokenRevoked(err) {
+		t.Errorf("VerifyIDTokenAndGetUser() = (%v, %v, %v); want = (nil, nil, %q)", ft, user, err, we)
+	}
+}
+
+func TestVerifyIDTokenDisabledUser(t *testing.T) {
+	resp := bytes.Replace(testGetUserResponse, []byte(`"disabled": false`), []byte(`"disabled": true`), 1)
+	s := echoServer(resp, t)
+	defer s.Close()
+
+	if _, user, err := s.Client.VerifyIDTokenAndGetUser(ctx, testIDToken); err != nil || !user.Disabled {
+		t.Fatalf("VerifyIDTokenAndGetUser() = (%v, %v); want = (disabled user, nil)", user, err)
+	}
+	ft, user, err := s.Client.VerifyIDTokenAndGetUser(ctx, testIDToken, CheckDisabled())
+	if ft != nil || user != nil || !IsUserDisabled(err) {
+		t.Errorf("VerifyIDTokenAndGetUser() = (%v, %v, %v); want = (nil, nil, user disabled error)", ft, user, err)
+	}
+	ft, err = s.Client.VerifyIDTokenWithOptions(ctx, testIDToken, CheckDisabled())
+	if ft != nil || !IsUserDisabled(err) {
+		t.Errorf("VerifyIDTokenWithOptions() = (%v, %v); want = (nil, user disabled error)", ft, err)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	ft, err := client.VerifyIDToken(testIDToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.Claims["admin"] != true {
+		t.Errorf("Claims['admin'] = %v; want = true", ft.Claims["admin"])
+	}
+	if ft.UID != ft.Subject {
+		t.Errorf("UID = %q; Sub = %q; want UID = Sub", ft.UID, ft.Subject)
+	}
+}
+
+func TestVerifyIDTokenWithOptions(t *testing.T) {
+	authTime := time.Now().Unix() - 200
+	tok := getIDToken(mockIDTokenPayload{"auth_time": authTime})
+	cases := []struct {
+		name string
+		opts []VerifyOption
+	}{
+		{"NoOptions", nil},
+		{"RequireAuthTime", []VerifyOption{RequireAuthTime()}},
+	}
+
+	for _, tc := range cases {
+		ft, err := client.VerifyIDTokenWithOptions(ctx, tok, tc.opts...)
+		if err != nil {
+			t.Fatalf("VerifyIDTokenWithOptions(%s) = %v", tc.name, err)
+		}
+		if ft.AuthTime != authTime {
+			t.Errorf("VerifyIDTokenWithOptions(%s).AuthTime = %d; want = %d", tc.name, ft.AuthTime, authTime)
+		}
+		if ft.UID != ft.Subject {
+			t.Errorf("UID = %q; Sub = %q; want UID = Sub", ft.UID, ft.Subject)
+		}
+	}
+}
+
+func TestVerifyIDTokenWithoutAuthTime(t *testing.T) {
+	ft, err := client.VerifyIDTokenWithOptions(ctx, testIDToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.AuthTime != 0 {
+		t.Errorf("AuthTime = %d; want = 0", ft.AuthTime)
+	}
+
+	ft, err = client.VerifyIDTokenWithOptions(ctx, testIDToken, RequireAuthTime())
+	if ft != nil || err == nil || !IsAuthTimeMissing(err) {
+		t.Errorf("VerifyIDTokenWithOptions(RequireAuthTime) = (%v, %v); want = (nil, AuthTimeMissing)", ft, err)
+	}
+}
+
+func TestTokenTimeUntilExpiry(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	cases := []struct {
+		name    string
+		expires int64
+		now     time.Time
+		want    time.Duration
+	}{
+		{"OneHour", now.Unix() + 3600, now, time.Hour},
+		{"Expired", now.Unix() - 90, now, -90 * time.Second},
+		{"AtExpiry", now.Unix(), now, 0},
+		{"SubSecond", now.Unix() + 10, now.Add(250 * time.Millisecond), 9750 * time.Millisecond},
+	}
+	for _, tc := range cases {
+		tok := &Token{Expires: tc.expires}
+		if got := tok.TimeUntilExpiry(tc.now); got != tc.want {
+			t.Errorf("TimeUntilExpiry(%s) = %v; want = %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestVerifyIDTokenTimeUntilExpiry(t *testing.T) {
+	now := time.Now()
+	tok := getIDToken(mockIDTokenPayload{"exp": now.Unix() + 600})
+	ft, err := client.VerifyIDToken(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ft.TimeUntilExpiry(time.Unix(now.Unix(), 0)), 10*time.Minute; got != want {
+		t.Errorf("TimeUntilExpiry() = %v; want = %v", got, want)
+	}
+}
+
+func TestVerifyIDTokenAt(t *testing.T) {
+	past := time.Now().Add(-48 * time.Hour)
+	tok := getIDToken(mockIDTokenPayload{
+		"iat": past.Unix() - 100,
+		"exp": past.Unix() + 3600,
+	})
+	if _, err := client.VerifyIDToken(tok); err == nil {
+		t.Fatalf("VerifyIDToken() = nil; want = error")
+	}
+
+	ft, err := client.VerifyIDTokenWithOptions(ctx, tok, VerifyAt(past))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.Expires != past.Unix()+3600 {
+		t.Errorf("Expires = %d; want = %d", ft.Expires, past.Unix()+3600)
+	}
+
+	cases := []struct {
+		name string
+		at   time.Time
+	}{
+		{"BeforeIssued", past.Add(-time.Hour)},
+		{"AfterExpiry", past.Add(2 * time.Hour)},
+		{"Now", time.Now()},
+	}
+	for _, tc := range cases {
+		if ft, err := client.VerifyIDTokenWithOptions(ctx, tok, VerifyAt(tc.at)); ft != nil || err == nil {
+			t.Errorf("VerifyIDTokenWithOptions(%s) = (%v, %v); want = (nil, error)", tc.name, ft, err)
+		}
+	}
+}
+
+func TestVerifyIDTokenClockSkew(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name    string
+		payload mockIDTokenPayload
+	}{
+		{"IssuedInFuture", mockIDTokenPayload{"iat": now.Unix() + 5}},
+		{"NotYetValid", mockIDTokenPayload{"nbf": now.Unix() + 5}},
+		{"Expired", mockIDTokenPayload{"iat": now.Unix() - 3600, "exp": now.Unix() - 5}},
+	}
+	for _, tc := range cases {
+		tok := getIDToken(tc.payload)
+		if ft, err := client.VerifyIDTokenWithOptions(ctx, tok, VerifyAt(now)); ft != nil || err == nil {
+			t.Errorf("VerifyIDToken(%s) = (%v, %v); want = (nil, error)", tc.name, ft, err)
+		}
+
+		c := *client
+		if err := WithClockSkew(3 * time.Second)(&c); err != nil {
+			t.Fatal(err)
+		}
+		if ft, err := c.VerifyIDTokenWithOptions(ctx, tok, VerifyAt(now)); ft != nil || err == nil {
+			t.Errorf("VerifyIDToken(%s, skew = 3s) = (%v, %v); want = (nil, error)", tc.name, ft, err)
+		}
+		if err := WithClockSkew(10 * time.Second)(&c); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.VerifyIDTokenWithOptions(ctx, tok, VerifyAt(now)); err != nil {
+			t.Errorf("VerifyIDToken(%s, skew = 10s) = %v; want = nil", tc.name, err)
+		}
+	}
+
+	if err := WithClockSkew(-time.Second)(&Client{}); err == nil {
+		t.Errorf("WithClockSkew(-1s) = nil; want = error")
+	}
+}
+
+func TestVerifyCustomTokenClockSkew(t *testing.T) {
+	clk = &mockClock{now: time.Now().Add(10 * time.Second)}
+	token, err := client.CustomToken("user1")
+	clk = &systemClock{}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct, err := client.VerifyCustomToken(ctx, token); ct != nil || err == nil {
+		t.Errorf("VerifyCustomToken() = (%v, %v); want = (nil, error)", ct, err)
+	}
+
+	c := *client
+	if err := WithClockSkew(time.Minute)(&c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.VerifyCustomToken(ctx, token); err != nil {
+		t.Errorf("VerifyCustomToken(skew = 1m) = %v; want = nil", err)
+	}
+}
+
+func TestVerifyIDTokenWithPinnedKeys(t *testing.T) {
+	keys, err := client.ks.Keys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pinned, other *PublicKey
+	for _, k := range keys {
+		if k.Kid == "mock-key-id-1" {
+			pinned = k
+		} else {
+			other = k
+		}
+	}
+
+	c := *client
+	fetchErr := errors.New("key fetch failed")
+	ks := &countingKeySource{mockKeySource: mockKeySource{err: fetchErr}}
+	c.ks = ks
+	if ft, err := c.VerifyIDToken(testIDToken); ft != nil || err == nil {
+		t.Errorf("VerifyIDToken() = (%v, %v); want = (nil, error)", ft, err)
+	}
+	ks.calls = 0
+	if _, err := c.VerifyIDTokenWithOptions(ctx, testIDToken, WithPinnedKeys(pinned)); err != nil {
+		t.Errorf("VerifyIDTokenWithOptions(WithPinnedKeys) = %v; want = nil", err)
+	}
+	if ks.calls != 0 {
+		t.Errorf("Key source calls = %d; want = 0", ks.calls)
+	}
+
+	// The error of the fallback key source is reported when the pinned keys do not match.
+	wrong := WithPinnedKeys(&PublicKey{Kid: "mock-key-id-1", Key: other.Key})
+	ft, err := c.VerifyIDTokenWithOptions(ctx, testIDToken, wrong)
+	if ft != nil || err == nil || !strings.Contains(err.Error(), fetchErr.Error()) {
+		t.Errorf("VerifyIDTokenWithOptions(wrong pinned key) = (%v, %v); want = (nil, %q)", ft, err, fetchErr)
+	}
+	if ks.calls != 1 {
+		t.Errorf("Key source calls = %d; want = 1", ks.calls)
+	}
+
+	// Falls back to the cached keys when the pinned keys do not match.
+	if _, err := client.VerifyIDTokenWithOptions(ctx, testIDToken, wrong); err != nil {
+		t.Errorf("VerifyIDTokenWithOptions(fallback) = %v; want = nil", err)
+	}
+}
+
+func TestVerifyIDTokenWithPinnedECKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := mockIDTokenPayload{
+		"aud": client.projectID,
+		"iss": "https://securetoken.google.com/" + client.projectID,
+		"iat": time.Now().Unix() - 100,
+		"exp": time.Now().Unix() + 3600,
+		"sub": "1234567890",
+	}
+	tok, err := encodeToken(ctx, ecdsaSigner{ecKey}, jwtHeader{Algorithm: "ES256", Type: "JWT", KeyID: "ec-key-id"}, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := *client
+	c.ks = &countingKeySource{mockKeySource: mockKeySource{err: errors.New("key fetch failed")}}
+	pinned := WithPinnedKeys(&PublicKey{Kid: "ec-key-id", Key: &ecKey.PublicKey})
+	ft, err := c.VerifyIDTokenWithOptions(ctx, tok, pinned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.UID != "1234567890" {
+		t.Errorf("UID = %q; want = %q", ft.UID, "1234567890")
+	}
+}
+
+func TestVerifyIDTokenRSAHashes(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := *client
+	c.ks = &staticKeySource{keys: []*PublicKey{{Kid: "rsa-key-id", Key: &pk.PublicKey}}}
+	payload := mockIDTokenPayload{
+		"aud": client.projectID,
+		"iss": "https://securetoken.google.com/" + client.projectID,
+		"iat": time.Now().Unix() - 100,
+		"exp": time.Now().Unix() + 3600,
+		"sub": "1234567890",
+	}
+	for _, alg := range []string{"RS256", "RS384", "RS512"} {
+		h := jwtHeader{Algorithm: alg, Type: "JWT", KeyID: "rsa-key-id"}
+		tok, err := encodeToken(ctx, rsaSigner{pk, rsaHashes[alg]}, h, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ft, err := c.VerifyIDToken(tok); err != nil || ft.UID != "1234567890" {
+			t.Errorf("VerifyIDToken(%s) = (%v, %v); want = (token, nil)", alg, ft, err)
+		}
+	}
+
+	// The header algorithm must match the hash the token was signed with.
+	h := jwtHeader{Algorithm: "RS512", Type: "JWT", KeyID: "rsa-key-id"}
+	tok, err := encodeToken(ctx, rsaSigner{pk, crypto.SHA256}, h, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft, err := c.VerifyIDToken(tok); ft != nil || err == nil {
+		t.Errorf("VerifyIDToken(RS256 signed as RS512) = (%v, %v); want = (nil, error)", ft, err)
+	}
+
+	// Other algorithms are rejected even if the SignatureVerifier accepts them.
+	h = jwtHeader{Algorithm: "PS256", Type: "JWT", KeyID: "rsa-key-id"}
+	tok, err = encodeToken(ctx, rsaSigner{pk, crypto.SHA256}, h, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sv = acceptingSignatureVerifier{}
+	want := "ID token has incorrect algorithm. Expected 'RS256', 'RS384', 'RS512' or 'ES256' but got \"PS256\"."
+	if ft, err := c.VerifyIDToken(tok); ft != nil || err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("VerifyIDToken(PS256) = (%v, %v); want = (nil, %q)", ft, err, want)
+	}
+}
+
+func TestVerifyIDTokenES256(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := client.ks.Keys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := *client
+	c.ks = &staticKeySource{keys: append([]*PublicKey{{Kid: "ec-key-id", Key: &ecKey.PublicKey}}, keys...)}
+
+	payload := mockIDTokenPayload{
+		"aud": client.projectID,
+		"iss": "https://securetoken.google.com/" + client.projectID,
+		"iat": time.Now().Unix() - 100,
+		"exp": time.Now().Unix() + 3600,
+		"sub": "1234567890",
+	}
+	tok, err := encodeToken(ctx, ecdsaSigner{ecKey}, jwtHeader{Algorithm: "ES256", Type: "JWT", KeyID: "ec-key-id"}, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft, err := c.VerifyIDToken(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.UID != "1234567890" {
+		t.Errorf("UID = %q; want = %q", ft.UID, "1234567890")
+	}
+
+	// The header algorithm must match the type of the key.
+	cases := []struct {
+		name string
+		h    jwtHeader
+		snr  signer
+	}{
+		{"RS256WithECKey", jwtHeader{Algorithm: "RS256", Type: "JWT", KeyID: "ec-key-id"}, client.snr},
+		{"ES256WithRSAKey", jwtHeader{Algorithm: "ES256", Type: "JWT", KeyID: "mock-key-id-1"}, ecdsaSigner{ecKey}},
+		{"ES256SignedAsRS256", jwtHeader{Algorithm: "RS256", Type: "JWT", KeyID: "ec-key-id"}, ecdsaSigner{ecKey}},
+	}
+	for _, tc := range cases {
+		tok, err := encodeToken(ctx, tc.snr, tc.h, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ft, err := c.VerifyIDToken(tok); ft != nil || err == nil {
+			t.Errorf("VerifyIDToken(%s) = (%v, %v); want = (nil, error)", tc.name, ft, err)
+		}
+	}
+}
+
+func TestVerifyIDTokenSecondFactor(t *testing.T) {
+	tok := getIDToken(mockIDTokenPayload{
+		"firebase": map[string]interface{}{
+			"sign_in_provider":      "password",
+			"sign_in_second_factor": "phone",
+		},
+	})
+	cases := []struct {
+		name string
+		opts []VerifyOption
+	}{
+		{"NoOptions", nil},
+		{"RequireSecondFactor", []VerifyOption{RequireSecondFactor()}},
+	}
+
+	for _, tc := range cases {
+		ft, err := client.VerifyIDTokenWithOptions(ctx, tok, tc.opts...)
+		if err != nil {
+			t.Fatalf("VerifyIDTokenWithOptions(%s) = %v", tc.name, err)
+		}
+		if ft.SecondFactorIdentifier != "phone" {
+			t.Errorf("VerifyIDTokenWithOptions(%s).SecondFactorIdentifier = %q; want = %q",
+				tc.name, ft.SecondFactorIdentifier, "phone")
+		}
+	}
+}
+
+func TestVerifyIDTokenWithoutSecondFactor(t *testing.T) {
+	tok := getIDToken(mockIDTokenPayload{
+		"firebase": map[string]interface{}{"sign_in_provider": "password"},
+	})
+	ft, err := client.VerifyIDToken(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.SecondFactorIdentifier != "" {
+		t.Errorf("SecondFactorIdentifier = %q; want = %q", ft.SecondFactorIdentifier, "")
+	}
+
+	for _, tok := range []string{tok, testIDToken} {
+		ft, err := client.VerifyIDTokenWithOptions(ctx, tok, RequireSecondFactor())
+		if ft != nil || err == nil || !IsSecondFactorMissing(err) {
+			t.Errorf("VerifyIDTokenWithOptions(RequireSecondFactor) = (%v, %v); want = (nil, SecondFactorMissing)",
+				ft, err)
+		}
+	}
+}
+
+func TestVerifyIDTokenPhoneNumber(t *testing.T) {
+	tok := getIDToken(mockIDTokenPayload{
+		"phone_number": "+11234567890",
+		"firebase":     map[string]interface{}{"sign_in_provider": "phone"},
+	})
+	ft, err := client.VerifyIDToken(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.PhoneNumber != "+11234567890" || ft.SignInProvider != "phone" {
+		t.Errorf("VerifyIDToken() = (%q, %q); want = (%q, %q)",
+			ft.PhoneNumber, ft.SignInProvider, "+11234567890", "phone")
+	}
+	if ft.Claims["phone_number"] != "+11234567890" {
+		t.Errorf("Claims[phone_number] = %v; want = %q", ft.Claims["phone_number"], "+11234567890")
+	}
+
+	ft, err = client.VerifyIDToken(testIDToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.PhoneNumber != "" || ft.SignInProvider != "" {
+		t.Errorf("VerifyIDToken() = (%q, %q); want = (%q, %q)", ft.PhoneNumber, ft.SignInProvider, "", "")
+	}
+}
+
+func TestVerifyIDTokenTenant(t *testing.T) {
+	tok := getIDToken(mockIDTokenPayload{
+		"firebase": map[string]interface{}{"sign_in_provider": "password", "tenant": "tenant1"},
+	})
+	ft, err := client.VerifyIDToken(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.TenantID != "tenant1" {
+		t.Errorf("TenantID = %q; want = %q", ft.TenantID, "tenant1")
+	}
+	if _, err := client.VerifyIDTokenWithOptions(ctx, tok, RequireTenant("tenant1")); err != nil {
+		t.Errorf("VerifyIDTokenWithOptions(RequireTenant) = %v; want = nil", err)
+	}
+	for _, tok := range []string{tok, testIDToken} {
+		ft, err := client.VerifyIDTokenWithOptions(ctx, tok, RequireTenant("tenant2"))
+		if ft != nil || err == nil || !IsTenantIDMismatch(err) {
+			t.Errorf("VerifyIDTokenWithOptions(RequireTenant) = (%v, %v); want = (nil, TenantIDMismatch)", ft, err)
+		}
+	}
+
+	c := *client
+	if err := WithTenantID("tenant1")(&c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.VerifyIDToken(tok); err != nil {
+		t.Errorf("VerifyIDToken(tenant client) = %v; want = nil", err)
+	}
+	if ft, err := c.VerifyIDToken(testIDToken); ft != nil || !IsTenantIDMismatch(err) {
+		t.Errorf("VerifyIDToken(tenant client) = (%v, %v); want = (nil, TenantIDMismatch)", ft, err)
+	}
+	if ft, err := c.VerifyIDTokenWithOptions(ctx, tok, RequireTenant("tenant2")); ft != nil || !IsTenantIDMismatch(err) {
+		t.Errorf("VerifyIDTokenWithOptions(RequireTenant) = (%v, %v); want = (nil, TenantIDMismatch)", ft, err)
+	}
+	if got := c.EffectiveConfig().TenantID; got != "tenant1" {
+		t.Errorf("TenantID = %q; want = %q", got, "tenant1")
+	}
+}
+
+func TestCustomTokenTenant(t *testing.T) {
+	c := *client
+	if err := WithTenantID("tenant1")(&c); err != nil {
+		t.Fatal(err)
+	}
+	token, err := c.CustomTokenWithClaims("user1", map[string]interface{}{"premium": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyCustomToken(t, token, map[string]interface{}{"premium": true})
+	payload := make(map[string]interface{})
+	if err := decode(jsonDecoder{}, strings.Split(token, ".")[1], &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload["tenant_id"] != "tenant1" {
+		t.Errorf("tenant_id = %v; want = %q", payload["tenant_id"], "tenant1")
+	}
+	ct, err := c.VerifyCustomToken(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct.TenantID != "tenant1" {
+		t.Errorf("TenantID = %q; want = %q", ct.TenantID, "tenant1")
+	}
+	if ct, err := client.VerifyCustomToken(ctx, token); ct != nil || !IsTenantIDMismatch(err) {
+		t.Errorf("VerifyCustomToken(no tenant) = (%v, %v); want = (nil, TenantIDMismatch)", ct, err)
+	}
+
+	// Tokens minted without a tenant do not have a tenant_id claim at all.
+	token, err = client.CustomToken("user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload = make(map[string]interface{})
+	if err := decode(jsonDecoder{}, strings.Split(token, ".")[1], &payload); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := payload["tenant_id"]; ok {
+		t.Errorf("tenant_id = %v; want = none", payload["tenant_id"])
+	}
+	if ct, err := c.VerifyCustomToken(ctx, token); ct != nil || !IsTenantIDMismatch(err) {
+		t.Errorf("VerifyCustomToken(tenant client) = (%v, %v); want = (nil, TenantIDMismatch)", ct, err)
+	}
+
+	if err := WithTenantID("")(&c); err == nil {
+		t.Errorf("WithTenantID('') = nil; want = error")
+	}
+}
+
+func TestVerifyIDTokenWithDeadline(t *testing.T) {
+	exp := time.Now().Unix() + 3600
+	tok := getIDToken(mockIDTokenPayload{"exp": exp})
+	dctx, cancel, ft, err := client.VerifyIDTokenWithDeadline(ctx, tok, 5*time.Minute)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if ft.Claims["admin"] != true {
-		t.Errorf("Claims['admin'] = %v; want = true", ft.Claims["admin"])
-	}
+	defer cancel()
+
 	if ft.UID != ft.Subject {
 		t.Errorf("UID = %q; Sub = %q; want UID = Sub", ft.UID, ft.Subject)
 	}
-}
-
-func TestVerifyIDTokenAndCheckRevokedInvalidated(t *testing.T) {
-	s := echoServer(testGetUserResponse, t)
-	defer s.Close()
-	tok := getIDToken(mockIDTokenPayload{"uid": "uid", "iat": 1970}) // old token
+	deadline, ok := dctx.Deadline()
+	if !ok {
+		t.Fatal("Deadline() = (_, false); want = (_, true)")
+	}
+	want := time.Unix(exp, 0).Add(-5 * time.Minute)
+	if diff := deadline.Sub(want); diff < -time.Second || diff > time.Second {
+		t.Errorf("Deadline() = %v; want = %v", deadline, want)
+	}
+	if dctx.Err() != nil {
+		t.Errorf("Err() = %v; want = nil", dctx.Err())
+	}
 
-	p, err := s.Client.VerifyIDTokenAndCheckRevoked(ctx, tok)
-	we := "ID token has been revoked"
-	if p != nil || err == nil || err.Error() != we || !IsIDTokenRevoked(err) {
-		t.Errorf("VerifyIDTokenAndCheckRevoked(ctx, token) =(%v, %v); want = (%v, %v)",
-			p, err, nil, we)
+	cancel()
+	if dctx.Err() != context.Canceled {
+		t.Errorf("Err() = %v; want = %v", dctx.Err(), context.Canceled)
 	}
 }
 
-func TestVerifyIDToken(t *testing.T) {
-	ft, err := client.VerifyIDToken(testIDToken)
+func TestVerifyIDTokenWithDeadlineParent(t *testing.T) {
+	parent, cancelParent := context.WithCancel(ctx)
+	dctx, cancel, _, err := client.VerifyIDTokenWithDeadline(parent, testIDToken, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if ft.Claims["admin"] != true {
-		t.Errorf("Claims['admin'] = %v; want = true", ft.Claims["admin"])
+	defer cancel()
+
+	cancelParent()
+	if dctx.Err() != context.Canceled {
+		t.Errorf("Err() = %v; want = %v", dctx.Err(), context.Canceled)
 	}
-	if ft.UID != ft.Subject {
-		t.Errorf("UID = %q; Sub = %q; want UID = Sub", ft.UID, ft.Subject)
+}
+
+func TestVerifyIDTokenWithDeadlineError(t *testing.T) {
+	now := time.Now().Unix()
+	cases := []struct {
+		name   string
+		token  string
+		margin time.Duration
+	}{
+		{"NegativeMargin", testIDToken, -time.Second},
+		{"ExpiresWithinMargin", getIDToken(mockIDTokenPayload{"exp": now + 60}), 5 * time.Minute},
+		{"ExpiredToken", getIDToken(mockIDTokenPayload{"exp": now - 10}), 0},
+		{"EmptyToken", "", 0},
+	}
+
+	for _, tc := range cases {
+		dctx, cancel, ft, err := client.VerifyIDTokenWithDeadline(ctx, tc.token, tc.margin)
+		if dctx != nil || cancel != nil || ft != nil || err == nil {
+			t.Errorf("VerifyIDTokenWithDeadline(%s) = (%v, %v, %v); want = (nil, nil, nil, error)",
+				tc.name, dctx, ft, err)
+		}
 	}
 }
 
@@ -289,6 +1715,178 @@ func TestVerifyIDTokenError(t *testing.T) {
 	}
 }
 
+func TestVerifyIDTokenErrorCode(t *testing.T) {
+	now := time.Now().Unix()
+	parts := strings.Split(testIDToken, ".")
+	cases := []struct {
+		name    string
+		token   string
+		expired bool
+	}{
+		{"NoKid", getIDTokenWithKid("", nil), false},
+		{"WrongKid", getIDTokenWithKid("foo", nil), false},
+		{"InvalidSignature", fmt.Sprintf("%s.%s.invalidsignature", parts[0], parts[1]), false},
+		{"BadAudience", getIDToken(mockIDTokenPayload{"aud": "bad-audience"}), false},
+		{"FutureToken", getIDToken(mockIDTokenPayload{"iat": now + 1000}), false},
+		{"BadFormatToken", "foobar", false},
+		{"ExpiredToken", getIDToken(mockIDTokenPayload{"iat": now - 1000, "exp": now - 100}), true},
+	}
+	for _, tc := range cases {
+		_, err := client.VerifyIDToken(tc.token)
+		if IsIDTokenExpired(err) != tc.expired || IsIDTokenInvalid(err) == tc.expired {
+			t.Errorf("VerifyIDToken(%s) = %v; want expired = %v", tc.name, err, tc.expired)
+		}
+		if IsSessionCookieExpired(err) || IsSessionCookieInvalid(err) {
+			t.Errorf("VerifyIDToken(%s) = %v; want = ID token error", tc.name, err)
+		}
+	}
+
+	// Failing to fetch the public keys does not make the token invalid.
+	c := *client
+	c.ks = &mockKeySource{err: errors.New("key fetch failed")}
+	if _, err := c.VerifyIDToken(testIDToken); err == nil || IsIDTokenInvalid(err) {
+		t.Errorf("VerifyIDToken(key fetch failure) = %v; want = non-invalid error", err)
+	}
+}
+
+func TestVerifyIDTokenErrorCause(t *testing.T) {
+	now := time.Now().Unix()
+	parts := strings.Split(testIDToken, ".")
+	cases := []struct {
+		name  string
+		token string
+		check func(error) bool
+	}{
+		{"InvalidSignature", fmt.Sprintf("%s.%s.invalidsignature", parts[0], parts[1]), IsInvalidSignature},
+		{"BadAudience", getIDToken(mockIDTokenPayload{"aud": "bad-audience"}), IsInvalidAudience},
+		{"BadIssuer", getIDToken(mockIDTokenPayload{"iss": "bad-issuer"}), IsInvalidIssuer},
+		{"FutureToken", getIDToken(mockIDTokenPayload{"iat": now + 1000}), IsIssuedInFuture},
+		{"FutureNotBefore", getIDToken(mockIDTokenPayload{"nbf": now + 1000}), IsIssuedInFuture},
+		{"FutureAuthTime", getIDToken(mockIDTokenPayload{"auth_time": now + 1000}), IsIssuedInFuture},
+	}
+	checks := []func(error) bool{IsInvalidSignature, IsInvalidAudience, IsInvalidIssuer, IsIssuedInFuture}
+	for _, tc := range cases {
+		_, err := client.VerifyIDToken(tc.token)
+		if !IsIDTokenInvalid(err) || IsIDTokenExpired(err) {
+			t.Errorf("VerifyIDToken(%s) = %v; want = invalid ID token error", tc.name, err)
+		}
+		matches := 0
+		for _, check := range checks {
+			if check(err) {
+				matches++
+			}
+		}
+		if !tc.check(err) || matches != 1 {
+			t.Errorf("VerifyIDToken(%s) = %v; want = exactly one matching cause", tc.name, err)
+		}
+	}
+
+	_, err := client.VerifyIDToken(getIDToken(mockIDTokenPayload{"iat": now - 1000, "exp": now - 100}))
+	for _, check := range checks {
+		if check(err) {
+			t.Errorf("VerifyIDToken(ExpiredToken) = %v; want = no specific cause", err)
+		}
+	}
+}
+
+func TestVerifyIDTokenFutureAuthTimeWithClockSkew(t *testing.T) {
+	c := *client
+	c.clockSkew = 5 * time.Minute
+	token := getIDToken(mockIDTokenPayload{"auth_time": time.Now().Unix() + 60})
+	if _, err := c.VerifyIDToken(token); err != nil {
+		t.Errorf("VerifyIDToken() = %v; want = nil", err)
+	}
+}
+
+func TestVerifyIDTokenSubject(t *testing.T) {
+	cases := []struct {
+		name string
+		sub  interface{}
+		want string
+	}{
+		{"Valid", "1234567890", ""},
+		{"SingleCharacter", "a", ""},
+		{"MaxLength", strings.Repeat("a", 128), ""},
+		{"Missing", nil, "ID token has no 'sub' (subject) claim"},
+		{"Empty", "", "ID token has empty 'sub' (subject) claim"},
+		{"Oversized", strings.Repeat("a", 129), "ID token has a 'sub' (subject) claim longer than 128 characters"},
+	}
+	for _, tc := range cases {
+		ft, err := client.VerifyIDToken(getIDToken(mockIDTokenPayload{"sub": tc.sub}))
+		if tc.want == "" {
+			if err != nil || ft.UID != tc.sub {
+				t.Errorf("VerifyIDToken(%s) = (%v, %v); want = (token, nil)", tc.name, ft, err)
+			}
+		} else if ft != nil || err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("VerifyIDToken(%s) = (%v, %v); want = (nil, %q)", tc.name, ft, err, tc.want)
+		}
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	mc := &mockClock{now: now}
+	c, err := NewVerifyOnlyClient(ctx, client.projectID, withClock(mc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ks := range []KeySource{c.ks, c.cookieKS} {
+		if got := ks.(*httpKeySource).Clock; got != mc {
+			t.Errorf("Clock = %v; want = %v", got, mc)
+		}
+	}
+	c.ks = client.ks
+
+	token := getIDToken(mockIDTokenPayload{
+		"iat": now.Unix() - 100,
+		"nbf": now.Unix() - 50,
+		"exp": now.Unix() + 100,
+	})
+	cases := []struct {
+		name string
+		now  time.Time
+		want string
+	}{
+		{"BeforeIssuedAt", now.Add(-101 * time.Second), "ID token issued at future timestamp"},
+		{"BeforeNotBefore", now.Add(-51 * time.Second), "ID token is not valid before timestamp"},
+		{"Valid", now, ""},
+		{"JustBeforeExpiry", now.Add(100 * time.Second), ""},
+		{"JustExpired", now.Add(101 * time.Second), "ID token has expired"},
+	}
+	for _, tc := range cases {
+		mc.now = tc.now
+		ft, err := c.VerifyIDToken(token)
+		if tc.want == "" {
+			if err != nil {
+				t.Errorf("VerifyIDToken(%s) = %v; want = nil", tc.name, err)
+			}
+		} else if ft != nil || err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("VerifyIDToken(%s) = (%v, %v); want = (nil, %q)", tc.name, ft, err, tc.want)
+		}
+	}
+
+	// The same clock governs the times of minted custom tokens.
+	sc := *client
+	mc.now = now.Add(-2 * time.Hour)
+	if err := withClock(mc)(&sc); err != nil {
+		t.Fatal(err)
+	}
+	token, err = sc.CustomToken("user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct, err := sc.VerifyCustomToken(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct.IssuedAt != mc.now.Unix() {
+		t.Errorf("IssuedAt = %d; want = %d", ct.IssuedAt, mc.now.Unix())
+	}
+	if ct, err := client.VerifyCustomToken(ctx, token); ct != nil || err == nil {
+		t.Errorf("VerifyCustomToken(system clock) = (%v, %v); want = (nil, expired)", ct, err)
+	}
+}
+
 func TestNoProjectID(t *testing.T) {
 	// AuthConfig with empty ProjectID
 	conf := &internal.AuthConfig{Opts: defaultTestOpts}
@@ -327,11 +1925,11 @@ func TestCertificateRequestError(t *testing.T) {
 func verifyCustomToken(t *testing.T, token string, expected map[string]interface{}) {
 	h := &jwtHeader{}
 	p := &customToken{}
-	if err := decodeToken(token, client.ks, h, p); err != nil {
+	if err := decodeToken(ctx, token, client.ks, client.sv, client.decoder, h, p); err != nil {
 		t.Fatal(err)
 	}
 
-	email, err := client.snr.Email()
+	email, err := client.snr.Email(ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -355,6 +1953,318 @@ func verifyCustomToken(t *testing.T, token string, expected map[string]interface
 	}
 }
 
+func TestVerifyIDTokenAllowedProjects(t *testing.T) {
+	c := *client
+	if err := WithAllowedProjects(client.projectID, "other-project")(&c); err != nil {
+		t.Fatal(err)
+	}
+	otherToken := getIDToken(mockIDTokenPayload{
+		"aud": "other-project",
+		"iss": "https://securetoken.google.com/other-project",
+	})
+	for _, token := range []string{testIDToken, otherToken} {
+		if _, err := c.VerifyIDToken(token); err != nil {
+			t.Errorf("VerifyIDToken() = %v; want = nil", err)
+		}
+	}
+	if _, err := client.VerifyIDToken(otherToken); err == nil {
+		t.Errorf("VerifyIDToken(default client) = nil; want = error")
+	}
+
+	cases := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{
+			"UnknownProject",
+			getIDToken(mockIDTokenPayload{"aud": "third-project", "iss": "https://securetoken.google.com/third-project"}),
+			`ID token has invalid 'aud' (audience) claim. Expected one of "mock-project-id", "other-project" but got "third-project"`,
+		},
+		{
+			"UnknownIssuer",
+			getIDToken(mockIDTokenPayload{"aud": "other-project", "iss": "https://securetoken.google.com/third-project"}),
+			`ID token has invalid 'iss' (issuer) claim. Expected one of "https://securetoken.google.com/mock-project-id", ` +
+				`"https://securetoken.google.com/other-project" but got "https://securetoken.google.com/third-project"`,
+		},
+	}
+	for _, tc := range cases {
+		if ft, err := c.VerifyIDToken(tc.token); ft != nil || err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("VerifyIDToken(%s) = (%v, %v); want = (nil, %q)", tc.name, ft, err, tc.want)
+		}
+	}
+
+	want := []string{client.projectID, "other-project"}
+	if got := c.EffectiveConfig().AllowedProjects; !reflect.DeepEqual(got, want) {
+		t.Errorf("AllowedProjects = %v; want = %v", got, want)
+	}
+}
+
+func TestVerifyIDTokenAllowedAudiences(t *testing.T) {
+	c := *client
+	if err := WithAllowedAudiences("downstream-service", "other-service")(&c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.VerifyIDToken(getIDToken(mockIDTokenPayload{"aud": "downstream-service"})); err != nil {
+		t.Errorf("VerifyIDToken() = %v; want = nil", err)
+	}
+
+	// The project ID is no longer accepted as an audience, but the issuer is still checked.
+	cases := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"ProjectAudience", testIDToken, "ID token has invalid 'aud' (audience) claim"},
+		{
+			"WrongIssuer",
+			getIDToken(mockIDTokenPayload{"aud": "downstream-service", "iss": "https://securetoken.google.com/other"}),
+			"ID token has invalid 'iss' (issuer) claim",
+		},
+	}
+	for _, tc := range cases {
+		if ft, err := c.VerifyIDToken(tc.token); ft != nil || err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("VerifyIDToken(%s) = (%v, %v); want = (nil, %q)", tc.name, ft, err, tc.want)
+		}
+	}
+
+	// Session cookies are checked against the same audiences.
+	if _, err := c.VerifySessionCookie(ctx, getSessionCookie(mockIDTokenPayload{"aud": "other-service"})); err != nil {
+		t.Errorf("VerifySessionCookie() = %v; want = nil", err)
+	}
+}
+
+func TestAllowedProjectsAndAudiencesError(t *testing.T) {
+	opts := []ClientOption{
+		WithAllowedProjects(),
+		WithAllowedProjects("p1", ""),
+		WithAllowedAudiences(),
+		WithAllowedAudiences(""),
+	}
+	for i, opt := range opts {
+		if err := opt(&Client{}); err == nil {
+			t.Errorf("[%d] option = nil; want = error", i)
+		}
+	}
+}
+
+func TestVerifyIDTokenEmulator(t *testing.T) {
+	now := time.Now().Unix()
+	token := getEmulatorIDToken(nil)
+	if ft, err := client.VerifyIDToken(token); ft != nil || err == nil {
+		t.Errorf("VerifyIDToken(emulator token) = (%v, %v); want = (nil, error)", ft, err)
+	}
+
+	c, err := NewVerifyOnlyClient(ctx, client.projectID, WithEmulator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ks = &mockKeySource{err: errors.New("keys must not be fetched in emulator mode")}
+	if !c.EffectiveConfig().Emulator {
+		t.Errorf("Emulator = false; want = true")
+	}
+	ft, err := c.VerifyIDToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.UID != "1234567890" {
+		t.Errorf("UID = %q; want = %q", ft.UID, "1234567890")
+	}
+	if _, err := c.VerifyIDToken(testIDToken); err != nil {
+		t.Errorf("VerifyIDToken(signed token) = %v; want = nil", err)
+	}
+
+	cases := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"Expired", getEmulatorIDToken(mockIDTokenPayload{"iat": now - 7200, "exp": now - 3600}),
+			"ID token has expired"},
+		{"WrongAudience", getEmulatorIDToken(mockIDTokenPayload{"aud": "other-project"}),
+			"ID token has invalid 'aud' (audience) claim"},
+		{"WrongIssuer", getEmulatorIDToken(mockIDTokenPayload{"iss": "other-issuer"}),
+			"ID token has invalid 'iss' (issuer) claim"},
+		{"EmptySubject", getEmulatorIDToken(mockIDTokenPayload{"sub": ""}),
+			"ID token has empty 'sub' (subject) claim"},
+		{"CustomToken", getEmulatorIDToken(mockIDTokenPayload{"aud": firebaseAudience}),
+			"VerifyIDToken() expects an ID token, but was given a custom token"},
+		{"Malformed", "not.a.token", "invalid character"},
+	}
+	for _, tc := range cases {
+		ft, err := c.VerifyIDToken(tc.token)
+		if ft != nil || err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("VerifyIDToken(%s) = (%v, %v); want = (nil, %q)", tc.name, ft, err, tc.want)
+		}
+	}
+}
+
+func TestEmulatorEnvVar(t *testing.T) {
+	current := os.Getenv(emulatorHostEnvVar)
+	defer os.Setenv(emulatorHostEnvVar, current)
+
+	if err := os.Setenv(emulatorHostEnvVar, ""); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewVerifyOnlyClient(ctx, client.projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.EffectiveConfig().Emulator {
+		t.Errorf("Emulator = true; want = false")
+	}
+
+	if err := os.Setenv(emulatorHostEnvVar, "localhost:9099"); err != nil {
+		t.Fatal(err)
+	}
+	c, err = NewVerifyOnlyClient(ctx, client.projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.EffectiveConfig().Emulator {
+		t.Errorf("Emulator = false; want = true")
+	}
+	if _, err := c.VerifyIDToken(getEmulatorIDToken(nil)); err != nil {
+		t.Errorf("VerifyIDToken(emulator token) = %v; want = nil", err)
+	}
+}
+
+func TestClientHeaders(t *testing.T) {
+	var headers []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(testGetUserResponse)
+	}))
+	defer srv.Close()
+
+	conf := &internal.AuthConfig{
+		Opts:            []option.ClientOption{option.WithTokenSource(&mockTokenSource{"test.token"})},
+		ProjectID:       "mock-project-id",
+		Version:         "test",
+		Headers:         http.Header{"X-Custom-Header": []string{"custom-value"}},
+		UserAgentSuffix: "my-app/1.0",
+	}
+	c, err := NewClient(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.idToolkitV1Endpoint = srv.URL
+	c.ks.(*httpKeySource).KeyURI = srv.URL
+
+	if _, err := c.GetUser(ctx, "testuser"); err != nil {
+		t.Fatal(err)
+	}
+	// The response is not a valid key set. Only the request headers matter here.
+	c.ks.Keys(ctx)
+
+	if len(headers) != 2 {
+		t.Fatalf("Requests = %d; want = 2", len(headers))
+	}
+	for i, h := range headers {
+		if got := h.Get("X-Custom-Header"); got != "custom-value" {
+			t.Errorf("Request[%d] X-Custom-Header = %q; want = %q", i, got, "custom-value")
+		}
+		if got := h.Get("User-Agent"); !strings.HasSuffix(got, " my-app/1.0") && got != "my-app/1.0" {
+			t.Errorf("Request[%d] User-Agent = %q; want suffix = %q", i, got, "my-app/1.0")
+		}
+	}
+}
+
+func TestEmulatorClient(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if got, want := r.Header.Get("Authorization"), "Bearer "+emulatorAccessToken; got != want {
+			t.Errorf("Authorization = %q; want = %q", got, want)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(testGetUserResponse)
+	}))
+	defer srv.Close()
+
+	current := os.Getenv(emulatorHostEnvVar)
+	defer os.Setenv(emulatorHostEnvVar, current)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	if err := os.Setenv(emulatorHostEnvVar, host); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient(ctx, &internal.AuthConfig{ProjectID: "mock-project-id", Version: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.EffectiveConfig().TokenExchangeURL, "http://"+host+"/"+strings.TrimPrefix(tokenExchangeURL, "https://"); got != want {
+		t.Errorf("TokenExchangeURL = %q; want = %q", got, want)
+	}
+	if got := c.EffectiveConfig().SignerType; got != SignerEmulator {
+		t.Errorf("SignerType = %q; want = %q", got, SignerEmulator)
+	}
+
+	if _, err := c.GetUser(ctx, "testuser"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteUser(ctx, "testuser"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.EmailVerificationLink(ctx, "user@example.com"); err == nil {
+		t.Errorf("EmailVerificationLink() = nil; want = error")
+	}
+	want := []string{
+		"/identitytoolkit.googleapis.com/v1/projects/mock-project-id/accounts:lookup",
+		"/www.googleapis.com/identitytoolkit/v3/relyingparty/deleteAccount",
+		"/identitytoolkit.googleapis.com/v1/projects/mock-project-id/accounts:sendOobCode",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("Paths = %v; want = %v", paths, want)
+	}
+
+	token, err := c.CustomToken("user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	segs := strings.Split(token, ".")
+	if len(segs) != 3 || segs[2] != "" {
+		t.Fatalf("CustomToken() = %q; want = unsigned token", token)
+	}
+	var h jwtHeader
+	if err := decode(jsonDecoder{}, segs[0], &h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Algorithm != "none" {
+		t.Errorf("Algorithm = %q; want = %q", h.Algorithm, "none")
+	}
+	var p customToken
+	if err := decode(jsonDecoder{}, segs[1], &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Iss != emulatorEmail || p.UID != "user1" {
+		t.Errorf("CustomToken() = {iss: %q, uid: %q}; want = {iss: %q, uid: %q}", p.Iss, p.UID, emulatorEmail, "user1")
+	}
+}
+
+// getEmulatorIDToken returns an unsigned ID token, like the ones issued by the Auth emulator.
+func getEmulatorIDToken(p mockIDTokenPayload) string {
+	pCopy := mockIDTokenPayload{
+		"aud": client.projectID,
+		"iss": "https://securetoken.google.com/" + client.projectID,
+		"iat": time.Now().Unix() - 100,
+		"exp": time.Now().Unix() + 3600,
+		"sub": "1234567890",
+	}
+	for k, v := range p {
+		pCopy[k] = v
+	}
+	header, err := encode(jwtHeader{Algorithm: "none", Type: "JWT"})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	payload, err := encode(pCopy)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return header + "." + payload + "."
+}
+
 func getIDToken(p mockIDTokenPayload) string {
 	return getIDTokenWithKid("mock-key-id-1", p)
 }
@@ -373,62 +2283,77 @@ func getIDTokenWithKid(kid string, p mockIDTokenPayload) string {
 	}
 	h := defaultHeader()
 	h.KeyID = kid
-	token, err := encodeToken(client.snr, h, pCopy)
+	token, err := encodeToken(ctx, client.snr, h, pCopy)
 	if err != nil {
 		log.Fatalln(err)
 	}
 	return token
 }
 
+// mockSignatureVerifier records the signature verifications, and delegates them to the default
+// verifier unless err is set.
+type mockSignatureVerifier struct {
+	calls int
+	alg   string
+	err   error
+}
+
+func (m *mockSignatureVerifier) VerifySignature(alg string, key crypto.PublicKey, content, signature []byte) error {
+	m.calls++
+	m.alg = alg
+	if m.err != nil {
+		return m.err
+	}
+	return stdSignatureVerifier{}.VerifySignature(alg, key, content, signature)
+}
+
+// acceptingSignatureVerifier accepts all signatures.
+type acceptingSignatureVerifier struct{}
+
+func (acceptingSignatureVerifier) VerifySignature(alg string, key crypto.PublicKey, content, signature []byte) error {
+	return nil
+}
+
 type mockIDTokenPayload map[string]interface{}
 
-func (p mockIDTokenPayload) decode(s string) error {
-	return decode(s, &p)
+func (p mockIDTokenPayload) decode(d jsonDecoder, s string) error {
+	return decode(d, s, &p)
 }
 
 // mockKeySource provides access to a set of in-memory public keys.
 type mockKeySource struct {
-	keys []*publicKey
+	keys []*PublicKey
 	err  error
 }
 
-func (k *mockKeySource) Keys() ([]*publicKey, error) {
+func (k *mockKeySource) Keys(ctx context.Context) ([]*PublicKey, error) {
 	return k.keys, k.err
 }
 
-// fileKeySource loads a set of public keys from the local file system.
-type fileKeySource struct {
-	FilePath   string
-	CachedKeys []*publicKey
+// countingKeySource is a mockKeySource that counts the calls to Keys().
+type countingKeySource struct {
+	mockKeySource
+	calls int
 }
 
-func (f *fileKeySource) Keys() ([]*publicKey, error) {
-	if f.CachedKeys == nil {
-		certs, err := ioutil.ReadFile(f.FilePath)
-		if err != nil {
-			return nil, err
-		}
-		f.CachedKeys, err = parsePublicKeys(certs)
-		if err != nil {
-			return nil, err
-		}
-	}
-	return f.CachedKeys, nil
+func (k *countingKeySource) Keys(ctx context.Context) ([]*PublicKey, error) {
+	k.calls++
+	return k.mockKeySource.Keys(ctx)
 }
 
 // aeKeySource provides access to the public keys associated with App Engine apps. This
 // is used in tests to verify custom tokens and mock ID tokens when they are signed with
 // App Engine private keys.
 type aeKeySource struct {
-	keys []*publicKey
+	keys []*PublicKey
 }
 
-func newAEKeySource(ctx context.Context) (keySource, error) {
+func newAEKeySource(ctx context.Context) (KeySource, error) {
 	certs, err := appengine.PublicCertificates(ctx)
 	if err != nil {
 		return nil, err
 	}
-	keys := make([]*publicKey, len(certs))
+	keys := make([]*PublicKey, len(certs))
 	for i, cert := range certs {
 		pk, err := parsePublicKey("mock-key-id-1", cert.Data)
 		if err != nil {
@@ -440,6 +2365,6 @@ func newAEKeySource(ctx context.Context) (keySource, error) {
 }
 
 // Keys returns the RSA Public Keys managed by App Engine.
-func (k aeKeySource) Keys() ([]*publicKey, error) {
+func (k aeKeySource) Keys(ctx context.Context) ([]*PublicKey, error) {
 	return k.keys, nil
 }
@@ -0,0 +1,108 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"fmt"
+)
+
+// Requirement is a condition that a verified Token must satisfy to be authorized. It returns nil if
+// the Token satisfies the condition, and an error describing the reason otherwise.
+type Requirement func(*Token) error
+
+// Decision is the outcome of authorizing a Token.
+type Decision struct {
+	Allowed bool
+	Reason  string // Why the Token was denied. Empty if Allowed is true.
+}
+
+// Authorize evaluates the given requirements against a verified Token.
+//
+// The Token is allowed only if it satisfies all the requirements. Otherwise the returned Decision
+// carries the reason reported by the first unsatisfied requirement. Authorize does not verify the
+// Token itself; pass it a Token returned by one of the verification functions of Client.
+func Authorize(token *Token, reqs ...Requirement) Decision {
+	if token == nil {
+		return Decision{Reason: "no token provided"}
+	}
+	for _, r := range reqs {
+		if err := r(token); err != nil {
+			return Decision{Reason: err.Error()}
+		}
+	}
+	return Decision{Allowed: true}
+}
+
+// ClaimEquals returns a Requirement that the named claim is present and equal to value.
+//
+// Values are compared by their JSON representation, so that for example an int value matches a
+// numeric claim decoded as float64.
+func ClaimEquals(name string, value interface{}) Requirement {
+	return func(t *Token) error {
+		claim, ok := t.Claims[name]
+		if !ok {
+			return fmt.Errorf("claim %q is missing", name)
+		}
+		if ok, _ := sameJSON(claim, value); !ok {
+			return fmt.Errorf("claim %q is %v; want %v", name, claim, value)
+		}
+		return nil
+	}
+}
+
+// ClaimContains returns a Requirement that the named claim is a list that contains value (e.g. a
+// list of roles). Values are compared as in ClaimEquals().
+func ClaimContains(name string, value interface{}) Requirement {
+	return func(t *Token) error {
+		claim, ok := t.Claims[name]
+		if !ok {
+			return fmt.Errorf("claim %q is missing", name)
+		}
+		list, ok := claim.([]interface{})
+		if !ok {
+			return fmt.Errorf("claim %q is not a list", name)
+		}
+		for _, v := range list {
+			if ok, _ := sameJSON(v, value); ok {
+				return nil
+			}
+		}
+		return fmt.Errorf("claim %q does not contain %v", name, value)
+	}
+}
+
+// EmailVerified returns a Requirement that the email address of the user is verified.
+func EmailVerified() Requirement {
+	return func(t *Token) error {
+		if v, _ := t.Claims["email_verified"].(bool); !v {
+			return fmt.Errorf("email address is not verified")
+		}
+		return nil
+	}
+}
+
+// NotAnonymous returns a Requirement that the user did not sign in anonymously. Tokens that do not
+// name a sign-in provider are denied too, since they cannot be shown to be non-anonymous.
+func NotAnonymous() Requirement {
+	return func(t *Token) error {
+		switch t.SignInProvider {
+		case "":
+			return fmt.Errorf("sign-in provider is unknown")
+		case "anonymous":
+			return fmt.Errorf("user signed in anonymously")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	token := &Token{
+		UID:            "user1",
+		SignInProvider: "password",
+		Claims: map[string]interface{}{
+			"admin":          true,
+			"level":          float64(3),
+			"roles":          []interface{}{"editor", "viewer"},
+			"tenant":         "acme",
+			"email_verified": true,
+			"firebase": map[string]interface{}{
+				"sign_in_provider": "password",
+			},
+		},
+	}
+	cases := []struct {
+		name string
+		reqs []Requirement
+	}{
+		{"NoRequirements", nil},
+		{"ClaimEqualsBool", []Requirement{ClaimEquals("admin", true)}},
+		{"ClaimEqualsString", []Requirement{ClaimEquals("tenant", "acme")}},
+		{"ClaimEqualsInt", []Requirement{ClaimEquals("level", 3)}},
+		{"ClaimContains", []Requirement{ClaimContains("roles", "editor")}},
+		{"EmailVerified", []Requirement{EmailVerified()}},
+		{"NotAnonymous", []Requirement{NotAnonymous()}},
+		{"All", []Requirement{
+			ClaimEquals("tenant", "acme"), ClaimContains("roles", "viewer"), EmailVerified(), NotAnonymous(),
+		}},
+	}
+	for _, tc := range cases {
+		if d := Authorize(token, tc.reqs...); !d.Allowed || d.Reason != "" {
+			t.Errorf("Authorize(%s) = %#v; want = allowed", tc.name, d)
+		}
+	}
+}
+
+func TestAuthorizeDenied(t *testing.T) {
+	token := &Token{
+		UID:            "user1",
+		SignInProvider: "anonymous",
+		Claims: map[string]interface{}{
+			"admin":          false,
+			"roles":          []interface{}{"viewer"},
+			"tenant":         "acme",
+			"email_verified": false,
+			"firebase": map[string]interface{}{
+				"sign_in_provider": "anonymous",
+			},
+		},
+	}
+	cases := []struct {
+		name   string
+		reqs   []Requirement
+		reason string
+	}{
+		{"ClaimMissing", []Requirement{ClaimEquals("level", 3)}, `claim "level" is missing`},
+		{"ClaimNotEqual", []Requirement{ClaimEquals("admin", true)}, `claim "admin" is false; want true`},
+		{"ListClaimMissing", []Requirement{ClaimContains("groups", "a")}, `claim "groups" is missing`},
+		{"NotAList", []Requirement{ClaimContains("tenant", "acme")}, `claim "tenant" is not a list`},
+		{"NotContained", []Requirement{ClaimContains("roles", "editor")}, `claim "roles" does not contain editor`},
+		{"EmailNotVerified", []Requirement{EmailVerified()}, "email address is not verified"},
+		{"Anonymous", []Requirement{NotAnonymous()}, "user signed in anonymously"},
+		{"FirstFailure", []Requirement{
+			ClaimEquals("tenant", "acme"), EmailVerified(), NotAnonymous(),
+		}, "email address is not verified"},
+		{"CustomRequirement", []Requirement{func(t *Token) error {
+			return errors.New("custom reason")
+		}}, "custom reason"},
+	}
+	for _, tc := range cases {
+		if d := Authorize(token, tc.reqs...); d.Allowed || d.Reason != tc.reason {
+			t.Errorf("Authorize(%s) = %#v; want = denied with %q", tc.name, d, tc.reason)
+		}
+	}
+}
+
+func TestAuthorizeNoClaims(t *testing.T) {
+	token := &Token{UID: "user1"}
+	if d := Authorize(token, EmailVerified()); d.Allowed {
+		t.Errorf("Authorize(EmailVerified) = %#v; want = denied", d)
+	}
+	want := "sign-in provider is unknown"
+	if d := Authorize(token, NotAnonymous()); d.Allowed || d.Reason != want {
+		t.Errorf("Authorize(NotAnonymous) = %#v; want = denied with %q", d, want)
+	}
+	if d := Authorize(nil); d.Allowed || d.Reason == "" {
+		t.Errorf("Authorize(nil) = %#v; want = denied", d)
+	}
+}
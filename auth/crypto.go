@@ -16,26 +16,39 @@ package auth
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	_ "crypto/sha512" // registers SHA-384 and SHA-512 for RS384 and RS512
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"math/big"
+	"mime"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/net/context"
+
+	"firebase.google.com/go/internal"
 )
 
-// publicKey represents a parsed RSA public key along with its unique key ID.
-type publicKey struct {
+// PublicKey represents a parsed RSA or ECDSA public key along with its unique key ID.
+//
+// Kid is matched against the 'kid' header of the tokens verified with the key.
+type PublicKey struct {
 	Kid string
-	Key *rsa.PublicKey
+	Key crypto.PublicKey // Either an *rsa.PublicKey or an *ecdsa.PublicKey.
 }
 
 // clock is used to query the current local time.
@@ -57,105 +70,502 @@ func (m *mockClock) Now() time.Time {
 	return m.now
 }
 
-// keySource is used to obtain a set of public keys, which can be used to verify cryptographic
+// KeySource is used to obtain a set of public keys, which can be used to verify cryptographic
 // signatures.
-type keySource interface {
-	Keys() ([]*publicKey, error)
+//
+// By default the Client fetches the public keys used to verify ID tokens from Google, and caches
+// them for as long as the Cache-Control header of the response allows. A custom KeySource can be
+// provided via the WithKeySource() option, for instance to share the cached keys among several
+// instances of a service. Keys is called on every token verification, and it may be called
+// concurrently. Implementations are therefore expected to cache the keys, and to honor the
+// following contract:
+//
+//   - Cached keys must not be served after the expiry time advertised by the Google endpoint they
+//     were obtained from.
+//   - Keys should respect the deadline and the cancellation of ctx.
+//   - If a refresh fails, implementations may keep serving the previously cached keys, and should
+//     only return an error when no keys are available.
+//   - The returned slice and the keys in it must not be modified once returned.
+type KeySource interface {
+	// Keys returns the current set of public keys.
+	Keys(ctx context.Context) ([]*PublicKey, error)
+}
+
+// WithKeySource returns a ClientOption that makes the Client verify ID tokens using the public keys
+// provided by ks, instead of fetching them from Google.
+//
+// Session cookies are still verified with the keys fetched from Google.
+func WithKeySource(ks KeySource) ClientOption {
+	return func(c *Client) error {
+		if ks == nil {
+			return errors.New("key source must not be nil")
+		}
+		c.ks = ks
+		return nil
+	}
+}
+
+// staticKeySource provides access to a fixed set of public keys.
+type staticKeySource struct {
+	keys []*PublicKey
+}
+
+// Keys returns the public keys held by this key source.
+func (s *staticKeySource) Keys(ctx context.Context) ([]*PublicKey, error) {
+	return s.keys, nil
+}
+
+// pinnedKeySource provides access to a fixed set of public keys, followed by the keys of a fallback
+// key source.
+type pinnedKeySource struct {
+	pinned   []*PublicKey
+	fallback KeySource
+}
+
+// Keys returns the pinned keys followed by the keys of the fallback key source. Token verification
+// does not call it, and only consults the fallback key source when no pinned key verifies the
+// token (see verifyTokenSignature).
+func (s *pinnedKeySource) Keys(ctx context.Context) ([]*PublicKey, error) {
+	keys, err := s.fallback.Keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]*PublicKey(nil), s.pinned...), keys...), nil
+}
+
+// fileKeySource loads a set of public keys from a JSON file on the local file system. The file has
+// the same format as the responses of the public key endpoints: a JSON object that maps key IDs to
+// PEM-encoded X.509 certificates.
+//
+// If Watch is set, the file is checked for modifications on each call to Keys(), and the keys are
+// reloaded when it has changed. Otherwise the keys are loaded only once.
+type fileKeySource struct {
+	FilePath   string
+	CachedKeys []*PublicKey
+	Watch      bool
+	Mutex      *sync.Mutex
+
+	modTime time.Time
 }
 
-// httpKeySource fetches RSA public keys from a remote HTTP server, and caches them in
+// newFileKeySource creates a fileKeySource, and loads the keys from the file at path. It returns an
+// error if the file does not contain at least one public key.
+func newFileKeySource(path string, watch bool) (*fileKeySource, error) {
+	f := &fileKeySource{
+		FilePath: path,
+		Watch:    watch,
+		Mutex:    &sync.Mutex{},
+	}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Keys returns the public keys loaded from the file. If the file has been modified but can no
+// longer be loaded (e.g. because it is being written), the previously loaded keys are returned.
+func (f *fileKeySource) Keys(ctx context.Context) ([]*PublicKey, error) {
+	f.Mutex.Lock()
+	defer f.Mutex.Unlock()
+	if f.Watch {
+		if info, err := os.Stat(f.FilePath); err == nil && !info.ModTime().Equal(f.modTime) {
+			f.load()
+		}
+	}
+	return f.CachedKeys, nil
+}
+
+func (f *fileKeySource) load() error {
+	info, err := os.Stat(f.FilePath)
+	if err != nil {
+		return err
+	}
+	certs, err := ioutil.ReadFile(f.FilePath)
+	if err != nil {
+		return err
+	}
+	keys, err := parsePublicKeys(certs)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no public keys found in %q", f.FilePath)
+	}
+	f.CachedKeys = keys
+	f.modTime = info.ModTime()
+	return nil
+}
+
+// WithPublicKeyFile returns a ClientOption that makes the Client verify ID tokens using the public
+// keys in the specified JSON file, instead of fetching them from Google's servers.
+//
+// The file must have the same format as the public key endpoint
+// (https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com), and
+// contain at least one key. This allows verifying ID tokens in environments without network
+// access, or against a known set of keys in tests. If watch is set, the keys are reloaded whenever
+// the file is modified, so that they can be rotated without restarting the process.
+func WithPublicKeyFile(path string, watch bool) ClientOption {
+	return func(c *Client) error {
+		ks, err := newFileKeySource(path, watch)
+		if err != nil {
+			return err
+		}
+		c.ks = ks
+		return nil
+	}
+}
+
+// httpKeySource fetches public keys from a remote HTTP server, and caches them in
 // memory. It also handles cache! invalidation and refresh based on the standard HTTP
 // cache-control headers.
+//
+// Concurrent callers read the cached keys without blocking each other. When the cache is stale,
+// only one refresh is made at a time, and all the callers waiting for the keys share its outcome.
+// To avoid blocking callers on a refresh, the keys are refreshed in the background when they are
+// about to expire, and keys that have only just expired are served while they are refreshed.
 type httpKeySource struct {
-	KeyURI     string
-	HTTPClient *http.Client
-	CachedKeys []*publicKey
-	ExpiryTime time.Time
-	Clock      clock
-	Mutex      *sync.Mutex
+	KeyURI      string
+	HTTPClient  *http.Client
+	CachedKeys  []*PublicKey
+	ExpiryTime  time.Time
+	Clock       clock
+	Mutex       *sync.RWMutex // Guards CachedKeys, ExpiryTime and the in-flight refresh.
+	MaxBodySize int64
+	Tracer      Tracer
+	Observer    KeyCacheObserver
+
+	// RetryConfig specifies how requests that fail due to network errors, 429 and 5xx responses or
+	// an unexpected content type are retried. By default they are retried twice, with a delay
+	// starting at defaultKeyFetchRetryDelay. When the App is configured with MaxRetries, that many
+	// retries are made instead. If nil, the keys are only requested once.
+	RetryConfig *internal.RetryConfig
+
+	// FetchTimeout bounds a refresh of the keys, including any retries, when the context of the
+	// caller has no deadline. Zero means no bound.
+	FetchTimeout time.Duration
+
+	// RefreshAhead is how long before the cached keys expire a refresh is started in the
+	// background. Callers are served the cached keys without waiting for the refresh.
+	RefreshAhead time.Duration
+
+	// MaxStale is how long after the cached keys expire they are still served, while a refresh
+	// is made in the background. Callers wait for the refresh once the keys are staler than that.
+	// Both RefreshAhead and MaxStale are capped at half the lifetime of the cached keys, so keys
+	// that are not cacheable are never served stale.
+	MaxStale time.Duration
+
+	refresh *keyRefresh
+	maxAge  time.Duration // Lifetime of the cached keys, as of the last refresh.
+
+	// nextBackgroundRefresh is the earliest time at which a background refresh may be started
+	// after the previous one failed, so that failing refreshes are not repeated on every call.
+	nextBackgroundRefresh time.Time
 }
 
+// keyRefresh is a refresh of the public keys that is in progress. done is closed when the refresh
+// completes, after which err holds its outcome.
+type keyRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+const (
+	defaultKeyFetchRetries    = 2
+	defaultKeyFetchRetryDelay = 200 * time.Millisecond
+	maxKeyFetchRetryDelay     = 2 * time.Second
+	defaultKeyFetchTimeout    = 10 * time.Second
+	defaultKeyRefreshAhead    = 5 * time.Minute
+	defaultKeyMaxStale        = time.Minute
+)
+
 func newHTTPKeySource(uri string, hc *http.Client) *httpKeySource {
 	return &httpKeySource{
 		KeyURI:     uri,
 		HTTPClient: hc,
 		Clock:      systemClock{},
-		Mutex:      &sync.Mutex{},
+		Mutex:      &sync.RWMutex{},
+		RetryConfig: &internal.RetryConfig{
+			MaxRetries: defaultKeyFetchRetries,
+			MinDelay:   defaultKeyFetchRetryDelay,
+			MaxDelay:   maxKeyFetchRetryDelay,
+		},
+		FetchTimeout: defaultKeyFetchTimeout,
+		RefreshAhead: defaultKeyRefreshAhead,
+		MaxStale:     defaultKeyMaxStale,
+	}
+}
+
+// WithKeyFetchTimeout returns a ClientOption that bounds the time spent fetching the Google public
+// keys, when the context passed to the verification has no deadline.
+//
+// The default is 10 seconds. Contexts with a deadline are always honored as they are. A timeout of
+// zero leaves fetches unbounded. When a fetch times out, the previously cached keys are used if
+// available.
+func WithKeyFetchTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) error {
+		if timeout < 0 {
+			return fmt.Errorf("key fetch timeout must not be negative: %v", timeout)
+		}
+		for _, ks := range []KeySource{c.ks, c.cookieKS} {
+			if ks, ok := ks.(*httpKeySource); ok {
+				ks.FetchTimeout = timeout
+			}
+		}
+		return nil
 	}
 }
 
-// Keys returns the RSA Public Keys hosted at this key source's URI. Refreshes the data if
-// the cache is stale.
-func (k *httpKeySource) Keys() ([]*publicKey, error) {
+// Keys returns the public keys hosted at this key source's URI. Refreshes the data if
+// the cache is stale. If the refresh fails, the stale keys are returned when available.
+func (k *httpKeySource) Keys(ctx context.Context) ([]*PublicKey, error) {
+	k.Mutex.RLock()
+	keys, expiry, maxAge := k.CachedKeys, k.ExpiryTime, k.maxAge
+	k.Mutex.RUnlock()
+	now := k.Clock.Now()
+	stale := len(keys) == 0 || now.After(expiry)
+	if o := k.Observer; o != nil {
+		if stale {
+			o.CacheMiss(k.KeyURI)
+		} else {
+			o.CacheHit(k.KeyURI)
+		}
+	}
+	if !stale {
+		ahead := capDuration(k.RefreshAhead, maxAge/2)
+		if ahead > 0 && now.After(expiry.Add(-ahead)) {
+			k.refreshInBackground()
+		}
+		return keys, nil
+	}
+	grace := capDuration(k.MaxStale, maxAge/2)
+	if len(keys) > 0 && grace > 0 && !now.After(expiry.Add(grace)) {
+		k.refreshInBackground()
+		return keys, nil
+	}
+
+	err := k.awaitRefresh(ctx)
+	k.Mutex.RLock()
+	keys = k.CachedKeys
+	k.Mutex.RUnlock()
+	if err != nil && len(keys) == 0 {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// awaitRefresh refreshes the keys, or waits for the refresh already in progress to complete. The
+// refresh is made with the context of the caller that started it, but each caller stops waiting
+// when its own context is done.
+func (k *httpKeySource) awaitRefresh(ctx context.Context) error {
+	r, started := k.beginRefresh(false)
+	if started {
+		k.runRefresh(ctx, r)
+		return r.err
+	}
+	select {
+	case <-r.done:
+		return r.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func capDuration(d, max time.Duration) time.Duration {
+	if d > max {
+		return max
+	}
+	return d
+}
+
+// refreshInBackground starts a refresh of the keys without waiting for it to complete, unless a
+// refresh is already in progress or the previous background refresh failed only recently.
+func (k *httpKeySource) refreshInBackground() {
+	if r, started := k.beginRefresh(true); started {
+		go func() {
+			k.runRefresh(context.Background(), r)
+			if r.err != nil {
+				k.Mutex.Lock()
+				k.nextBackgroundRefresh = k.Clock.Now().Add(maxKeyFetchRetryDelay)
+				k.Mutex.Unlock()
+			}
+		}()
+	}
+}
+
+// beginRefresh returns the refresh in progress, or registers a new one if there is none. The
+// returned bool is true if a new refresh was registered, in which case the caller must run it.
+// If background is true, no new refresh is registered while background refreshes are held off,
+// and the returned refresh may be nil.
+func (k *httpKeySource) beginRefresh(background bool) (*keyRefresh, bool) {
 	k.Mutex.Lock()
 	defer k.Mutex.Unlock()
-	if len(k.CachedKeys) == 0 || k.hasExpired() {
-		err := k.refreshKeys()
-		if err != nil && len(k.CachedKeys) == 0 {
-			return nil, err
-		}
+	if k.refresh != nil {
+		return k.refresh, false
 	}
-	return k.CachedKeys, nil
+	if background && k.Clock.Now().Before(k.nextBackgroundRefresh) {
+		return nil, false
+	}
+	k.refresh = &keyRefresh{done: make(chan struct{})}
+	return k.refresh, true
 }
 
-// hasExpired indicates whether the cache has expired.
-func (k *httpKeySource) hasExpired() bool {
-	return k.Clock.Now().After(k.ExpiryTime)
+// runRefresh refreshes the keys, and completes r with the outcome.
+func (k *httpKeySource) runRefresh(ctx context.Context, r *keyRefresh) {
+	o := k.Observer
+	var start time.Time
+	if o != nil {
+		o.RefreshStarted(k.KeyURI)
+		start = time.Now()
+	}
+	r.err = k.refreshKeys(ctx)
+	k.Mutex.Lock()
+	k.refresh = nil
+	k.Mutex.Unlock()
+	close(r.done)
+	if o != nil {
+		o.RefreshCompleted(k.KeyURI, time.Since(start), r.err)
+	}
 }
 
-func (k *httpKeySource) refreshKeys() error {
-	k.CachedKeys = nil
-	resp, err := k.HTTPClient.Get(k.KeyURI)
-	if err != nil {
-		return err
+func (k *httpKeySource) refreshKeys(ctx context.Context) (err error) {
+	var newKeys []*PublicKey
+	ctx, span := startSpan(ctx, k.Tracer, "firebase.auth.RefreshKeys")
+	ctx = internal.WithOperation(ctx, "RefreshKeys")
+	span.SetAttribute("url", k.KeyURI)
+	defer func() {
+		span.SetAttribute("keys", len(newKeys))
+		span.SetAttribute("outcome", outcome(err))
+		span.End(err)
+	}()
+
+	hc := &internal.HTTPClient{
+		Client:      k.HTTPClient,
+		MaxBodySize: k.MaxBodySize,
+		RetryConfig: k.RetryConfig,
+		Timeout:     k.FetchTimeout,
 	}
-	defer resp.Body.Close()
-	contents, err := ioutil.ReadAll(resp.Body)
+	resp, err := hc.Do(ctx, &internal.Request{
+		Method:   http.MethodGet,
+		URL:      k.KeyURI,
+		Validate: checkContentType,
+	})
 	if err != nil {
 		return err
 	}
+	if resp.Status != http.StatusOK {
+		return fmt.Errorf("public key endpoint responded with status: %d", resp.Status)
+	}
 
-	newKeys, err := parsePublicKeys(contents)
+	keys, err := parsePublicKeys(resp.Body)
 	if err != nil {
 		return err
 	}
 
-	maxAge, err := findMaxAge(resp)
+	maxAge, err := findMaxAge(&http.Response{Header: resp.Header}, k.Clock.Now())
 	if err != nil {
 		return err
 	}
 
-	k.CachedKeys = append([]*publicKey(nil), newKeys...)
+	newKeys = keys
+	k.Mutex.Lock()
+	defer k.Mutex.Unlock()
+	k.CachedKeys = append([]*PublicKey(nil), newKeys...)
 	k.ExpiryTime = k.Clock.Now().Add(*maxAge)
+	k.maxAge = *maxAge
 	return nil
 }
 
-func findMaxAge(resp *http.Response) (*time.Duration, error) {
+// checkContentType checks that the public key response has a JSON content type. Proxies and
+// captive portals often respond with an HTML page instead, which would otherwise surface as a
+// cryptic JSON parse error. A missing content type, and responses with an error status, are
+// tolerated. A proxy or captive portal may only intercept some requests, so the error is retried.
+func checkContentType(resp *http.Response) error {
+	ct := resp.Header.Get("Content-Type")
+	if ct == "" || resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err == nil && (mt == "application/json" || mt == "text/json" || strings.HasSuffix(mt, "+json")) {
+		return nil
+	}
+	return fmt.Errorf("public key endpoint responded with unexpected content type %q instead of JSON; "+
+		"the response may have been served by a proxy or captive portal", ct)
+}
+
+// defaultKeyCacheTTL is how long the public keys are cached when the response carries an Expires
+// header that cannot be used to determine the expiry time.
+const defaultKeyCacheTTL = time.Hour
+
+// findMaxAge determines how long the public keys in resp can be cached.
+//
+// The no-cache and no-store directives of the Cache-Control header result in a zero duration, so
+// that the keys are refreshed on the next use. Otherwise the max-age directive is used, minus the
+// time the response has already spent in intermediary caches, as indicated by the Age header. If
+// there is no max-age directive, the duration is derived from the Expires header, relative to the
+// Date header of the response, or to now if it has none. An error is returned if the max-age
+// directive cannot be parsed, or if neither header is present.
+func findMaxAge(resp *http.Response, now time.Time) (*time.Duration, error) {
+	var maxAge *time.Duration
 	cc := resp.Header.Get("cache-control")
 	for _, value := range strings.Split(cc, ",") {
-		value = strings.TrimSpace(value)
-		if strings.HasPrefix(value, "max-age=") {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "no-cache" || value == "no-store" {
+			var zero time.Duration
+			return &zero, nil
+		}
+		if strings.HasPrefix(value, "max-age=") && maxAge == nil {
 			sep := strings.Index(value, "=")
 			seconds, err := strconv.ParseInt(value[sep+1:], 10, 64)
 			if err != nil {
 				return nil, err
 			}
 			duration := time.Duration(seconds) * time.Second
-			return &duration, nil
+			maxAge = &duration
+		}
+	}
+
+	if maxAge != nil {
+		if age, err := strconv.ParseInt(resp.Header.Get("age"), 10, 64); err == nil && age > 0 {
+			*maxAge -= time.Duration(age) * time.Second
+		}
+		if *maxAge < 0 {
+			*maxAge = 0
+		}
+		return maxAge, nil
+	}
+	if expires := resp.Header.Get("expires"); expires != "" {
+		duration := defaultKeyCacheTTL
+		if exp, err := http.ParseTime(expires); err == nil {
+			if date, err := http.ParseTime(resp.Header.Get("date")); err == nil {
+				now = date
+			}
+			if duration = exp.Sub(now); duration < 0 {
+				duration = 0
+			}
 		}
+		return &duration, nil
 	}
 	return nil, errors.New("Could not find expiry time from HTTP headers")
 }
 
-func parsePublicKeys(keys []byte) ([]*publicKey, error) {
-	m := make(map[string]string)
+// parsePublicKeys parses a set of public keys, which are either formatted as a JSON object that
+// maps key IDs to PEM-encoded X.509 certificates, or as a JSON Web Key Set (RFC 7517).
+func parsePublicKeys(keys []byte) ([]*PublicKey, error) {
+	m := make(map[string]json.RawMessage)
 	err := json.Unmarshal(keys, &m)
 	if err != nil {
 		return nil, err
 	}
+	if jwks, ok := m["keys"]; ok && strings.HasPrefix(strings.TrimSpace(string(jwks)), "[") {
+		return parseJWKS(jwks)
+	}
 
-	var result []*publicKey
-	for kid, key := range m {
+	var result []*PublicKey
+	for kid, raw := range m {
+		var key string
+		if err := json.Unmarshal(raw, &key); err != nil {
+			return nil, err
+		}
 		pubKey, err := parsePublicKey(kid, []byte(key))
 		if err != nil {
 			return nil, err
@@ -165,48 +575,237 @@ func parsePublicKeys(keys []byte) ([]*publicKey, error) {
 	return result, nil
 }
 
-func parsePublicKey(kid string, key []byte) (*publicKey, error) {
+// jsonWebKey is a public key in the JSON Web Key format. Only the parameters of RSA and EC keys
+// are included.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func parseJWKS(b []byte) ([]*PublicKey, error) {
+	var jwks []*jsonWebKey
+	if err := json.Unmarshal(b, &jwks); err != nil {
+		return nil, err
+	}
+
+	var result []*PublicKey
+	for _, jwk := range jwks {
+		pubKey, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON web key %q: %v", jwk.Kid, err)
+		}
+		result = append(result, pubKey)
+	}
+	return result, nil
+}
+
+func (k *jsonWebKey) publicKey() (*PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeKeyParam("n", k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeKeyParam("e", k.E)
+		if err != nil {
+			return nil, err
+		}
+		// The exponent is an unsigned big-endian integer, which must fit in an int.
+		if len(e) > 4 {
+			return nil, errors.New("RSA exponent is too large")
+		}
+		var exp int
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+		if exp < 2 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &PublicKey{k.Kid, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve: %q", k.Crv)
+		}
+		x, err := decodeKeyParam("x", k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeKeyParam("y", k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pk := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pk.Curve.IsOnCurve(pk.X, pk.Y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &PublicKey{k.Kid, pk}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %q", k.Kty)
+	}
+}
+
+// decodeKeyParam decodes a base64url-encoded JSON web key parameter.
+func decodeKeyParam(name, value string) ([]byte, error) {
+	if value == "" {
+		return nil, fmt.Errorf("missing %q parameter", name)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %q parameter: %v", name, err)
+	}
+	return b, nil
+}
+
+func parsePublicKey(kid string, key []byte) (*PublicKey, error) {
 	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, errors.New("Certificate is not PEM encoded")
+	}
 	cert, err := x509.ParseCertificate(block.Bytes)
 	if err != nil {
 		return nil, err
 	}
-	pk, ok := cert.PublicKey.(*rsa.PublicKey)
-	if !ok {
-		return nil, errors.New("Certificate is not a RSA key")
+	switch pk := cert.PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return &PublicKey{kid, pk}, nil
+	default:
+		return nil, errors.New("Certificate is not a RSA or ECDSA key")
+	}
+}
+
+// SignatureVerifier verifies the cryptographic signatures of JWTs.
+//
+// The SDK verifies signatures using the Go standard library by default. Environments that must route
+// all cryptographic operations through a specific module (e.g. a FIPS-validated one) can provide
+// their own SignatureVerifier via the WithSignatureVerifier() option.
+type SignatureVerifier interface {
+	// VerifySignature checks that signature is a valid signature of content, made by the private
+	// key corresponding to key using the JWT signing algorithm alg (e.g. "RS256" or "ES256"). It
+	// returns nil if the signature is valid, and an error otherwise. Implementations must reject
+	// keys that cannot be used with alg.
+	VerifySignature(alg string, key crypto.PublicKey, content, signature []byte) error
+}
+
+// WithSignatureVerifier returns a ClientOption that makes the Client verify the signatures of all
+// tokens using the specified SignatureVerifier.
+func WithSignatureVerifier(sv SignatureVerifier) ClientOption {
+	return func(c *Client) error {
+		if sv == nil {
+			return errors.New("signature verifier must not be nil")
+		}
+		c.sv = sv
+		return nil
 	}
-	return &publicKey{kid, pk}, nil
 }
 
-func verifySignature(parts []string, k *publicKey) error {
+// stdSignatureVerifier verifies signatures using the crypto packages of the standard library.
+//
+// It supports the RS256, RS384 and RS512 (RSASSA-PKCS1-v1_5 using SHA-256, SHA-384 and SHA-512)
+// and ES256 (ECDSA using P-256 and SHA-256) algorithms. Any other algorithm is rejected.
+type stdSignatureVerifier struct{}
+
+// rsaHashes maps the supported RSASSA-PKCS1-v1_5 algorithms to their hash functions.
+var rsaHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+}
+
+func (v stdSignatureVerifier) VerifySignature(alg string, key crypto.PublicKey, content, signature []byte) error {
+	if hash, ok := rsaHashes[alg]; ok {
+		pk, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%s requires an RSA public key", alg)
+		}
+		h := hash.New()
+		h.Write(content)
+		return rsa.VerifyPKCS1v15(pk, hash, h.Sum(nil), signature)
+	}
+	if alg != "ES256" {
+		return fmt.Errorf("unsupported signing algorithm: %q", alg)
+	}
+
+	pk, ok := key.(*ecdsa.PublicKey)
+	if !ok || pk.Curve.Params().BitSize != 256 {
+		return fmt.Errorf("%s requires a P-256 ECDSA public key", alg)
+	}
+	// JWS encodes ECDSA signatures as the concatenation of the fixed-size R and S values.
+	if len(signature) != 64 {
+		return errors.New("invalid ES256 signature length")
+	}
+	digest := sha256.Sum256(content)
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(pk, digest[:], r, s) {
+		return errors.New("ecdsa: verification error")
+	}
+	return nil
+}
+
+func verifySignature(sv SignatureVerifier, alg string, parts []string, k *PublicKey) error {
 	content := parts[0] + "." + parts[1]
 	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
 	if err != nil {
 		return err
 	}
-
-	h := sha256.New()
-	h.Write([]byte(content))
-	return rsa.VerifyPKCS1v15(k.Key, crypto.SHA256, h.Sum(nil), []byte(signature))
+	return sv.VerifySignature(alg, k.Key, []byte(content), signature)
 }
 
+// serviceAcctSigner signs content with the private key of a service account. RSA keys produce
+// RS256 signatures, and EC keys on the P-256 curve produce ES256 signatures.
 type serviceAcctSigner struct {
 	email string
-	pk    *rsa.PrivateKey
+	pk    crypto.Signer
 }
 
-func (s serviceAcctSigner) Email() (string, error) {
+func (s serviceAcctSigner) Email(ctx context.Context) (string, error) {
 	if s.email == "" {
 		return "", errors.New("service account email not available")
 	}
 	return s.email, nil
 }
 
-func (s serviceAcctSigner) Sign(ss []byte) ([]byte, error) {
-	if s.pk == nil {
-		return nil, errors.New("private key not available")
-	}
+func (s serviceAcctSigner) Sign(ctx context.Context, ss []byte) ([]byte, error) {
 	hash := sha256.New()
 	hash.Write([]byte(ss))
-	return rsa.SignPKCS1v15(rand.Reader, s.pk, crypto.SHA256, hash.Sum(nil))
+	switch pk := s.pk.(type) {
+	case *rsa.PrivateKey:
+		return rsa.SignPKCS1v15(rand.Reader, pk, crypto.SHA256, hash.Sum(nil))
+	case *ecdsa.PrivateKey:
+		r, sv, err := ecdsa.Sign(rand.Reader, pk, hash.Sum(nil))
+		if err != nil {
+			return nil, err
+		}
+		// ES256 signatures are the concatenation of the two 32-byte integers r and s.
+		sig := make([]byte, 64)
+		rb, sb := r.Bytes(), sv.Bytes()
+		copy(sig[32-len(rb):32], rb)
+		copy(sig[64-len(sb):], sb)
+		return sig, nil
+	default:
+		return nil, errors.New("private key not available")
+	}
+}
+
+func (s serviceAcctSigner) algorithm() string {
+	if _, ok := s.pk.(*ecdsa.PrivateKey); ok {
+		return "ES256"
+	}
+	return "RS256"
+}
+
+// signingAlgorithm returns the JWT algorithm of the signatures produced by s. Signers are assumed
+// to produce RS256 signatures unless they report otherwise.
+func signingAlgorithm(s signer) string {
+	if as, ok := s.(interface {
+		algorithm() string
+	}); ok {
+		return as.algorithm()
+	}
+	return "RS256"
 }
@@ -15,13 +15,32 @@
 package auth
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/big"
 	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"firebase.google.com/go/internal"
+	"golang.org/x/net/context"
 )
 
 type mockHTTPResponse struct {
@@ -51,6 +70,7 @@ func newTestHTTPClient(data []byte) (*http.Client, *mockReadCloser) {
 				StatusCode: http.StatusOK,
 				Header: http.Header{
 					"Cache-Control": {"public, max-age=100"},
+					"Content-Type":  {"application/json; charset=UTF-8"},
 				},
 				Body: rc,
 			},
@@ -114,7 +134,7 @@ func TestHTTPKeySourceWithClient(t *testing.T) {
 func TestHTTPKeySourceEmptyResponse(t *testing.T) {
 	hc, _ := newTestHTTPClient([]byte(""))
 	ks := newHTTPKeySource("http://mock.url", hc)
-	if keys, err := ks.Keys(); keys != nil || err == nil {
+	if keys, err := ks.Keys(ctx); keys != nil || err == nil {
 		t.Errorf("Keys() = (%v, %v); want = (nil, error)", keys, err)
 	}
 }
@@ -122,11 +142,62 @@ func TestHTTPKeySourceEmptyResponse(t *testing.T) {
 func TestHTTPKeySourceIncorrectResponse(t *testing.T) {
 	hc, _ := newTestHTTPClient([]byte("{\"foo\": 1}"))
 	ks := newHTTPKeySource("http://mock.url", hc)
-	if keys, err := ks.Keys(); keys != nil || err == nil {
+	if keys, err := ks.Keys(ctx); keys != nil || err == nil {
+		t.Errorf("Keys() = (%v, %v); want = (nil, error)", keys, err)
+	}
+}
+
+func TestHTTPKeySourceResponseTooLarge(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/public_certs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hc, _ := newTestHTTPClient(data)
+	ks := newHTTPKeySource("http://mock.url", hc)
+	ks.MaxBodySize = int64(len(data) - 1)
+	if keys, err := ks.Keys(ctx); keys != nil || err == nil {
 		t.Errorf("Keys() = (%v, %v); want = (nil, error)", keys, err)
 	}
 }
 
+func TestHTTPKeySourceContentType(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/public_certs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ct := range []string{"", "application/json", "text/json", "application/jwk-set+json"} {
+		hc, _ := newTestHTTPClient(data)
+		hc.Transport.(*mockHTTPResponse).Response.Header.Set("Content-Type", ct)
+		ks := newHTTPKeySource("http://mock.url", hc)
+		if keys, err := ks.Keys(ctx); len(keys) != 3 || err != nil {
+			t.Errorf("Keys(%q) = (%d keys, %v); want = (3 keys, nil)", ct, len(keys), err)
+		}
+	}
+}
+
+func TestHTTPKeySourceUnexpectedContentType(t *testing.T) {
+	for _, ct := range []string{"text/html; charset=UTF-8", "text/plain", "invalid;;"} {
+		hc, rc := newTestHTTPClient([]byte("<html>Sign in to the network</html>"))
+		hc.Transport.(*mockHTTPResponse).Response.Header.Set("Content-Type", ct)
+		ks := newHTTPKeySource("http://mock.url", hc)
+		ks.RetryConfig.MinDelay = time.Millisecond
+		keys, err := ks.Keys(ctx)
+		if keys != nil || err == nil || !strings.Contains(err.Error(), "unexpected content type") {
+			t.Errorf("Keys(%q) = (%v, %v); want = (nil, content type error)", ct, keys, err)
+		}
+		if rc.closeCount != defaultKeyFetchRetries+1 {
+			t.Errorf("Keys(%q) made %d calls; want = %d", ct, rc.closeCount, defaultKeyFetchRetries+1)
+		}
+
+		// The error is not cached, and the keys are fetched again on the next call.
+		want := 2 * (defaultKeyFetchRetries + 1)
+		if _, err := ks.Keys(ctx); err == nil || rc.closeCount != want {
+			t.Errorf("Keys(%q) = %v after %d calls; want = error after %d calls", ct, err, rc.closeCount, want)
+		}
+	}
+}
+
 func TestHTTPKeySourceTransportError(t *testing.T) {
 	hc := &http.Client{
 		Transport: &mockHTTPResponse{
@@ -134,9 +205,566 @@ func TestHTTPKeySourceTransportError(t *testing.T) {
 		},
 	}
 	ks := newHTTPKeySource("http://mock.url", hc)
-	if keys, err := ks.Keys(); keys != nil || err == nil {
+	ks.RetryConfig.MinDelay = time.Millisecond
+	if keys, err := ks.Keys(ctx); keys != nil || err == nil {
+		t.Errorf("Keys() = (%v, %v); want = (nil, error)", keys, err)
+	}
+}
+
+// sequenceTransport responds to each request with the next status in statuses, or with a transport
+// error if the status is zero. Successful responses carry the public keys, unless the call is
+// listed in html, in which case they carry an HTML page.
+type sequenceTransport struct {
+	data     []byte
+	statuses []int
+	html     map[int]bool
+	calls    int
+}
+
+func (s *sequenceTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	status := s.statuses[s.calls]
+	html := s.html[s.calls]
+	s.calls++
+	if status == 0 {
+		return nil, errors.New("connection reset")
+	}
+	header := http.Header{"Cache-Control": {"public, max-age=100"}}
+	body := s.data
+	if html {
+		header.Set("Content-Type", "text/html; charset=UTF-8")
+		body = []byte("<html><body>Sign in to the network</body></html>")
+	}
+	return &http.Response{
+		Status:     http.StatusText(status),
+		StatusCode: status,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+	}, nil
+}
+
+func TestHTTPKeySourceRetry(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/public_certs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name     string
+		statuses []int
+		html     map[int]bool
+		calls    int
+		success  bool
+	}{
+		{"Success", []int{200}, nil, 1, true},
+		{"RetryOn503", []int{503, 200}, nil, 2, true},
+		{"RetryOnNetworkError", []int{0, 500, 200}, nil, 3, true},
+		{"RetryOnHTML", []int{200, 200}, map[int]bool{0: true}, 2, true},
+		{"AttemptsExhausted", []int{503, 0, 502, 200}, nil, 3, false},
+		{"NoRetryOn400", []int{400, 200}, nil, 1, false},
+		{"NoRetryOn404", []int{404, 200}, nil, 1, false},
+	}
+	for _, tc := range cases {
+		st := &sequenceTransport{data: data, statuses: tc.statuses, html: tc.html}
+		ks := newHTTPKeySource("http://mock.url", &http.Client{Transport: st})
+		ks.RetryConfig.MinDelay = time.Millisecond
+		keys, err := ks.Keys(ctx)
+		if tc.success != (err == nil) || tc.success != (len(keys) == 3) {
+			t.Errorf("Keys(%s) = (%d keys, %v); want success = %v", tc.name, len(keys), err, tc.success)
+		}
+		if st.calls != tc.calls {
+			t.Errorf("Keys(%s) made %d HTTP calls; want = %d", tc.name, st.calls, tc.calls)
+		}
+	}
+}
+
+func TestHTTPKeySourceRetryDeadline(t *testing.T) {
+	st := &sequenceTransport{statuses: []int{503, 503, 503}}
+	ks := newHTTPKeySource("http://mock.url", &http.Client{Transport: st})
+	ks.RetryConfig = &internal.RetryConfig{MaxRetries: 2, MinDelay: time.Hour, MaxDelay: time.Hour}
+	dctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	// Does not wait for the next attempt past the deadline of the context.
+	if keys, err := ks.Keys(dctx); keys != nil || err == nil || st.calls != 1 {
+		t.Errorf("Keys() = (%v, %v) after %d calls; want = (nil, error) after 1 call", keys, err, st.calls)
+	}
+}
+
+// deadlineTransport records the deadline of each request, and fails it once its context is done.
+type deadlineTransport struct {
+	mutex     sync.Mutex
+	deadlines []time.Time
+}
+
+func (d *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	deadline, _ := req.Context().Deadline()
+	d.mutex.Lock()
+	d.deadlines = append(d.deadlines, deadline)
+	d.mutex.Unlock()
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestHTTPKeySourceFetchTimeout(t *testing.T) {
+	dt := &deadlineTransport{}
+	ks := newHTTPKeySource("http://mock.url", &http.Client{Transport: dt})
+	ks.FetchTimeout = 10 * time.Millisecond
+
+	// A context without a deadline gets the default timeout, instead of blocking forever.
+	start := time.Now()
+	if keys, err := ks.Keys(context.Background()); keys != nil || err == nil {
+		t.Errorf("Keys() = (%v, %v); want = (nil, error)", keys, err)
+	}
+	if len(dt.deadlines) != 1 || dt.deadlines[0].IsZero() || dt.deadlines[0].After(start.Add(time.Second)) {
+		t.Errorf("deadlines = %v; want = [%v + 10ms]", dt.deadlines, start)
+	}
+
+	// A deadline set by the caller is honored as it is.
+	dt.deadlines = nil
+	want := time.Now().Add(50 * time.Millisecond)
+	dctx, cancel := context.WithDeadline(context.Background(), want)
+	defer cancel()
+	if keys, err := ks.Keys(dctx); keys != nil || err == nil {
 		t.Errorf("Keys() = (%v, %v); want = (nil, error)", keys, err)
 	}
+	if len(dt.deadlines) != 1 || !dt.deadlines[0].Equal(want) {
+		t.Errorf("deadlines = %v; want = [%v]", dt.deadlines, want)
+	}
+}
+
+func TestHTTPKeySourceFetchTimeoutStaleKeys(t *testing.T) {
+	dt := &deadlineTransport{}
+	mc := &mockClock{now: time.Unix(100, 0)}
+	ks := newHTTPKeySource("http://mock.url", &http.Client{Transport: dt})
+	ks.Clock = mc
+	ks.FetchTimeout = 10 * time.Millisecond
+	stale := []*PublicKey{{Kid: "stale"}}
+	ks.CachedKeys = stale
+	ks.ExpiryTime = time.Unix(0, 0)
+
+	if keys, err := ks.Keys(context.Background()); !reflect.DeepEqual(keys, stale) || err != nil {
+		t.Errorf("Keys() = (%v, %v); want = (%v, nil)", keys, err, stale)
+	}
+}
+
+func TestWithKeyFetchTimeout(t *testing.T) {
+	c, err := NewVerifyOnlyClient(ctx, "mock-project-id", WithKeyFetchTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ks := range []KeySource{c.ks, c.cookieKS} {
+		if got := ks.(*httpKeySource).FetchTimeout; got != time.Second {
+			t.Errorf("FetchTimeout = %v; want = %v", got, time.Second)
+		}
+	}
+	if got := c.EffectiveConfig().KeyFetchTimeout; got != time.Second {
+		t.Errorf("KeyFetchTimeout = %v; want = %v", got, time.Second)
+	}
+
+	if _, err := NewVerifyOnlyClient(ctx, "mock-project-id", WithKeyFetchTimeout(-time.Second)); err == nil {
+		t.Errorf("WithKeyFetchTimeout(-1s) = nil; want = error")
+	}
+}
+
+// blockingTransport serves the public keys once release is closed, and counts the requests.
+type blockingTransport struct {
+	data    []byte
+	release chan struct{}
+	err     error
+
+	mutex sync.Mutex
+	calls int
+}
+
+func (b *blockingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	b.mutex.Lock()
+	b.calls++
+	b.mutex.Unlock()
+	<-b.release
+	if b.err != nil {
+		return nil, b.err
+	}
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Cache-Control": {"public, max-age=100"}},
+		Body:       ioutil.NopCloser(bytes.NewReader(b.data)),
+	}, nil
+}
+
+func TestHTTPKeySourceConcurrentRefresh(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/public_certs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bt := &blockingTransport{data: data, release: make(chan struct{})}
+	ks := newHTTPKeySource("http://mock.url", &http.Client{Transport: bt})
+
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys, err := ks.Keys(ctx)
+			if err == nil && len(keys) != 3 {
+				err = fmt.Errorf("Keys() = %d keys; want = 3", len(keys))
+			}
+			errs <- err
+		}()
+	}
+	// Give the callers a chance to queue up behind the first refresh.
+	time.Sleep(10 * time.Millisecond)
+	close(bt.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if bt.calls != 1 {
+		t.Errorf("HTTP calls = %d; want = 1", bt.calls)
+	}
+}
+
+func TestWithKeySource(t *testing.T) {
+	keys, err := client.ks.Keys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := &mockKeySource{keys: keys}
+	c, err := NewVerifyOnlyClient(ctx, client.projectID, WithKeySource(ks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ks != ks {
+		t.Errorf("KeySource = %v; want = %v", c.ks, ks)
+	}
+	if ft, err := c.VerifyIDToken(testIDToken); err != nil || ft.UID != "1234567890" {
+		t.Errorf("VerifyIDToken() = (%v, %v); want = (token, nil)", ft, err)
+	}
+	conf := c.EffectiveConfig()
+	if conf.KeySourceType != KeySourceCustom || conf.PublicKeyURL != "" {
+		t.Errorf("EffectiveConfig() = (%q, %q); want = (%q, '')", conf.KeySourceType, conf.PublicKeyURL, KeySourceCustom)
+	}
+
+	ks.keys, ks.err = nil, errors.New("key fetch failed")
+	if ft, err := c.VerifyIDToken(testIDToken); ft != nil || err == nil || !strings.Contains(err.Error(), "key fetch failed") {
+		t.Errorf("VerifyIDToken() = (%v, %v); want = (nil, key fetch failed)", ft, err)
+	}
+
+	if _, err := NewVerifyOnlyClient(ctx, client.projectID, WithKeySource(nil)); err == nil {
+		t.Errorf("WithKeySource(nil) = nil; want = error")
+	}
+}
+
+func TestPrefetchPublicKeys(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/public_certs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bt := &blockingTransport{data: data, release: make(chan struct{})}
+	close(bt.release)
+	mc := &mockClock{now: time.Unix(0, 0)}
+	ks := newHTTPKeySource("http://mock.url", &http.Client{Transport: bt})
+	ks.Clock = mc
+	// Refresh synchronously, only once the keys have expired.
+	ks.RefreshAhead, ks.MaxStale = 0, 0
+	c := &Client{ks: ks}
+
+	if err := c.PrefetchPublicKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if bt.calls != 1 || len(ks.CachedKeys) != 3 {
+		t.Errorf("PrefetchPublicKeys() = (%d calls, %d keys); want = (1 call, 3 keys)", bt.calls, len(ks.CachedKeys))
+	}
+
+	// Fresh keys are neither fetched by another prefetch, nor by a verification.
+	if err := c.PrefetchPublicKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Keys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if bt.calls != 1 {
+		t.Errorf("HTTP calls = %d; want = 1", bt.calls)
+	}
+
+	mc.now = ks.ExpiryTime.Add(time.Second)
+	if err := c.PrefetchPublicKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if bt.calls != 2 {
+		t.Errorf("HTTP calls = %d; want = 2", bt.calls)
+	}
+}
+
+func TestPrefetchPublicKeysError(t *testing.T) {
+	c := &Client{ks: &mockKeySource{err: errors.New("key fetch failed")}}
+	want := "PrefetchPublicKeys: key fetch failed"
+	if err := c.PrefetchPublicKeys(ctx); err == nil || err.Error() != want {
+		t.Errorf("PrefetchPublicKeys() = %v; want = %q", err, want)
+	}
+}
+
+func TestHTTPKeySourceStaleKeys(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/public_certs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bt := &blockingTransport{data: data, release: make(chan struct{})}
+	close(bt.release)
+	mc := &mockClock{now: time.Unix(0, 0)}
+	ks := newHTTPKeySource("http://mock.url", &http.Client{Transport: bt})
+	ks.Clock = mc
+	ks.RetryConfig = nil
+	// Refresh synchronously, only once the keys have expired.
+	ks.RefreshAhead, ks.MaxStale = 0, 0
+	if keys, err := ks.Keys(ctx); len(keys) != 3 || err != nil {
+		t.Fatalf("Keys() = (%d keys, %v); want = (3 keys, nil)", len(keys), err)
+	}
+
+	// The stale keys are returned when the refresh fails, and the refresh is retried on the next call.
+	mc.now = time.Unix(101, 0)
+	bt.err = errors.New("transport error")
+	for i := 0; i < 2; i++ {
+		if keys, err := ks.Keys(ctx); len(keys) != 3 || err != nil {
+			t.Errorf("Keys() = (%d keys, %v); want = (3 keys, nil)", len(keys), err)
+		}
+	}
+	if bt.calls != 3 {
+		t.Errorf("HTTP calls = %d; want = 3", bt.calls)
+	}
+}
+
+func TestHTTPKeySourceRefreshAhead(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/public_certs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bt := &blockingTransport{data: data, release: make(chan struct{})}
+	close(bt.release)
+	mc := &mockClock{now: time.Unix(0, 0)}
+	ks := newHTTPKeySource("http://mock.url", &http.Client{Transport: bt})
+	ks.Clock = mc
+	ks.RefreshAhead = 10 * time.Second
+	if _, err := ks.Keys(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys that are not about to expire are served from the cache.
+	mc.now = time.Unix(89, 0)
+	if keys, err := ks.Keys(ctx); len(keys) != 3 || err != nil {
+		t.Fatalf("Keys() = (%d keys, %v); want = (3 keys, nil)", len(keys), err)
+	}
+	if bt.calls != 1 {
+		t.Errorf("HTTP calls = %d; want = 1", bt.calls)
+	}
+
+	// Keys that are about to expire are served from the cache, and refreshed in the background.
+	mc.now = time.Unix(95, 0)
+	if keys, err := ks.Keys(ctx); len(keys) != 3 || err != nil {
+		t.Fatalf("Keys() = (%d keys, %v); want = (3 keys, nil)", len(keys), err)
+	}
+	waitForRefresh(t, ks, time.Unix(195, 0))
+	if bt.calls != 2 {
+		t.Errorf("HTTP calls = %d; want = 2", bt.calls)
+	}
+}
+
+func TestHTTPKeySourceServeStale(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/public_certs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bt := &blockingTransport{data: data, release: make(chan struct{})}
+	close(bt.release)
+	mc := &mockClock{now: time.Unix(0, 0)}
+	ks := newHTTPKeySource("http://mock.url", &http.Client{Transport: bt})
+	ks.Clock = mc
+	ks.RefreshAhead = 0
+	ks.MaxStale = 10 * time.Second
+	if _, err := ks.Keys(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys that have only just expired are served while they are refreshed in the background.
+	bt.release = make(chan struct{})
+	mc.now = time.Unix(105, 0)
+	for i := 0; i < 2; i++ {
+		if keys, err := ks.Keys(ctx); len(keys) != 3 || err != nil {
+			t.Fatalf("Keys() = (%d keys, %v); want = (3 keys, nil)", len(keys), err)
+		}
+	}
+	close(bt.release)
+	waitForRefresh(t, ks, time.Unix(205, 0))
+	if bt.calls != 2 {
+		t.Errorf("HTTP calls = %d; want = 2", bt.calls)
+	}
+
+	// Keys that are staler than MaxStale are refreshed before they are served.
+	mc.now = time.Unix(216, 0)
+	if keys, err := ks.Keys(ctx); len(keys) != 3 || err != nil {
+		t.Fatalf("Keys() = (%d keys, %v); want = (3 keys, nil)", len(keys), err)
+	}
+	if bt.calls != 3 || ks.ExpiryTime != time.Unix(316, 0) {
+		t.Errorf("Keys() = (%d calls, expiry %v); want = (3 calls, expiry %v)",
+			bt.calls, ks.ExpiryTime, time.Unix(316, 0))
+	}
+}
+
+func TestHTTPKeySourceNoCacheNotStale(t *testing.T) {
+	ks := newHTTPKeySource("http://mock.url", http.DefaultClient)
+	ks.Clock = &mockClock{now: time.Unix(0, 0)}
+	ks.CachedKeys = []*PublicKey{{Kid: "kid"}}
+	ks.ExpiryTime = time.Unix(0, 0).Add(-time.Second)
+	bt := &blockingTransport{err: errors.New("transport error"), release: make(chan struct{})}
+	close(bt.release)
+	ks.HTTPClient = &http.Client{Transport: bt}
+	ks.RetryConfig = nil
+
+	// Keys without a known lifetime are never served stale, and are refreshed synchronously.
+	// The refresh fails, and the cached keys are returned as a fallback.
+	if keys, err := ks.Keys(ctx); len(keys) != 1 || err != nil {
+		t.Fatalf("Keys() = (%d keys, %v); want = (1 key, nil)", len(keys), err)
+	}
+	if bt.calls != 1 {
+		t.Errorf("HTTP calls = %d; want = 1", bt.calls)
+	}
+}
+
+// waitForRefresh waits for a background refresh of ks to update the expiry time of the keys.
+func waitForRefresh(t *testing.T, ks *httpKeySource, expiry time.Time) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		ks.Mutex.RLock()
+		got := ks.ExpiryTime
+		ks.Mutex.RUnlock()
+		if got.Equal(expiry) {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("ExpiryTime not updated to %v by background refresh", expiry)
+}
+
+func TestFileKeySource(t *testing.T) {
+	ks, err := newFileKeySource("../testdata/public_certs.json", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ks.Keys(ctx)
+	if len(keys) != 3 || err != nil {
+		t.Errorf("Keys() = (%d keys, %v); want = (3 keys, nil)", len(keys), err)
+	}
+}
+
+func TestFileKeySourceError(t *testing.T) {
+	cases := []string{"../testdata/no_such_file.json", "../testdata/plain_text.txt"}
+	for _, tc := range cases {
+		if ks, err := newFileKeySource(tc, false); ks != nil || err == nil {
+			t.Errorf("newFileKeySource(%q) = (%v, %v); want = (nil, error)", tc, ks, err)
+		}
+	}
+
+	f := writeTempFile(t, []byte("{}"))
+	defer os.Remove(f)
+	if ks, err := newFileKeySource(f, false); ks != nil || err == nil {
+		t.Errorf("newFileKeySource({}) = (%v, %v); want = (nil, error)", ks, err)
+	}
+}
+
+func TestFileKeySourceWatch(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/public_certs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var certs map[string]string
+	if err := json.Unmarshal(data, &certs); err != nil {
+		t.Fatal(err)
+	}
+	var kid string
+	for k := range certs {
+		kid = k
+		break
+	}
+	one, err := json.Marshal(map[string]string{kid: certs[kid]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := writeTempFile(t, data)
+	defer os.Remove(f)
+	for _, watch := range []bool{false, true} {
+		if err := ioutil.WriteFile(f, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		ks, err := newFileKeySource(f, watch)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Changes the contents and the modification time of the file.
+		if err := ioutil.WriteFile(f, one, 0600); err != nil {
+			t.Fatal(err)
+		}
+		mt := time.Now().Add(time.Minute)
+		if err := os.Chtimes(f, mt, mt); err != nil {
+			t.Fatal(err)
+		}
+		want := 3
+		if watch {
+			want = 1
+		}
+		if keys, err := ks.Keys(ctx); len(keys) != want || err != nil {
+			t.Errorf("Keys(watch = %v) = (%d keys, %v); want = (%d keys, nil)", watch, len(keys), err, want)
+		}
+
+		// The loaded keys are retained when the file becomes invalid.
+		if err := ioutil.WriteFile(f, []byte("not-json"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		mt = mt.Add(time.Minute)
+		if err := os.Chtimes(f, mt, mt); err != nil {
+			t.Fatal(err)
+		}
+		if keys, err := ks.Keys(ctx); len(keys) != want || err != nil {
+			t.Errorf("Keys(watch = %v) = (%d keys, %v); want = (%d keys, nil)", watch, len(keys), err, want)
+		}
+	}
+}
+
+func TestWithPublicKeyFile(t *testing.T) {
+	c := *client
+	if err := WithPublicKeyFile("../testdata/public_certs.json", true)(&c); err != nil {
+		t.Fatal(err)
+	}
+	if ft, err := c.VerifyIDToken(testIDToken); ft == nil || err != nil {
+		t.Errorf("VerifyIDToken() = (%v, %v); want = (token, nil)", ft, err)
+	}
+	if got := c.EffectiveConfig().PublicKeyFile; got != "../testdata/public_certs.json" {
+		t.Errorf("PublicKeyFile = %q; want = %q", got, "../testdata/public_certs.json")
+	}
+	if got := c.EffectiveConfig().KeySourceType; got != KeySourceFile {
+		t.Errorf("KeySourceType = %q; want = %q", got, KeySourceFile)
+	}
+	if err := WithPublicKeyFile("../testdata/no_such_file.json", false)(&c); err == nil {
+		t.Errorf("WithPublicKeyFile(no_such_file) = nil; want = error")
+	}
+}
+
+func writeTempFile(t *testing.T, data []byte) string {
+	f, err := ioutil.TempFile("", "public_certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
 }
 
 func TestFindMaxAge(t *testing.T) {
@@ -152,7 +780,7 @@ func TestFindMaxAge(t *testing.T) {
 		resp := &http.Response{
 			Header: http.Header{"Cache-Control": {tc.cc}},
 		}
-		age, err := findMaxAge(resp)
+		age, err := findMaxAge(resp, time.Now())
 		if err != nil {
 			t.Errorf("findMaxAge(%q) = %v", tc.cc, err)
 		} else if *age != (time.Duration(tc.want) * time.Second) {
@@ -161,6 +789,59 @@ func TestFindMaxAge(t *testing.T) {
 	}
 }
 
+func TestFindMaxAgeHeaders(t *testing.T) {
+	date := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"NoCache", http.Header{"Cache-Control": {"no-cache"}}, 0},
+		{"NoStore", http.Header{"Cache-Control": {"public, max-age=100, no-store"}}, 0},
+		{"MustRevalidate", http.Header{"Cache-Control": {"max-age=100, must-revalidate"}}, 100 * time.Second},
+		{"Age", http.Header{"Cache-Control": {"max-age=100"}, "Age": {"30"}}, 70 * time.Second},
+		{"AgeExceedsMaxAge", http.Header{"Cache-Control": {"max-age=100"}, "Age": {"300"}}, 0},
+		{"InvalidAge", http.Header{"Cache-Control": {"max-age=100"}, "Age": {"foo"}}, 100 * time.Second},
+		{
+			"Expires",
+			http.Header{
+				"Date":    {date.Format(http.TimeFormat)},
+				"Expires": {date.Add(time.Hour).Format(http.TimeFormat)},
+			},
+			time.Hour,
+		},
+		{
+			"MaxAgeOverridesExpires",
+			http.Header{
+				"Cache-Control": {"max-age=100"},
+				"Date":          {date.Format(http.TimeFormat)},
+				"Expires":       {date.Add(time.Hour).Format(http.TimeFormat)},
+			},
+			100 * time.Second,
+		},
+		{
+			"ExpiresInPast",
+			http.Header{
+				"Date":    {date.Format(http.TimeFormat)},
+				"Expires": {date.Add(-time.Hour).Format(http.TimeFormat)},
+			},
+			0,
+		},
+		{"InvalidExpires", http.Header{"Expires": {"0"}}, defaultKeyCacheTTL},
+		{
+			"ExpiresWithoutDate",
+			http.Header{"Expires": {date.Add(30 * time.Minute).Format(http.TimeFormat)}},
+			30 * time.Minute,
+		},
+	}
+	for _, tc := range cases {
+		age, err := findMaxAge(&http.Response{Header: tc.header}, date)
+		if err != nil || *age != tc.want {
+			t.Errorf("findMaxAge(%s) = (%v, %v); want = (%v, nil)", tc.name, age, err, tc.want)
+		}
+	}
+}
+
 func TestFindMaxAgeError(t *testing.T) {
 	cases := []string{
 		"",
@@ -168,12 +849,13 @@ func TestFindMaxAgeError(t *testing.T) {
 		"max-age: 100",
 		"max-age2=100",
 		"max-age=foo",
+		"no-transform, max-age=-",
 	}
 	for _, tc := range cases {
 		resp := &http.Response{
 			Header: http.Header{"Cache-Control": []string{tc}},
 		}
-		if age, err := findMaxAge(resp); age != nil || err == nil {
+		if age, err := findMaxAge(resp, time.Now()); age != nil || err == nil {
 			t.Errorf("findMaxAge(%q) = (%v, %v); want = (nil, err)", tc, age, err)
 		}
 	}
@@ -193,10 +875,122 @@ func TestParsePublicKeys(t *testing.T) {
 	}
 }
 
+func TestParsePublicKeysECDSA(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &ecKey.PublicKey, ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	b, err := json.Marshal(map[string]string{"ec-key-id": string(cert)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := parsePublicKeys(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Kid != "ec-key-id" {
+		t.Fatalf("parsePublicKeys() = %v; want = [ec-key-id]", keys)
+	}
+	if pk, ok := keys[0].Key.(*ecdsa.PublicKey); !ok || pk.X.Cmp(ecKey.X) != 0 || pk.Y.Cmp(ecKey.Y) != 0 {
+		t.Errorf("parsePublicKeys() = %v; want = %v", keys[0].Key, &ecKey.PublicKey)
+	}
+}
+
+func TestParsePublicKeysJWKS(t *testing.T) {
+	b, err := ioutil.ReadFile("../testdata/public_certs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := parsePublicKeys(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var jwks []map[string]string
+	for _, k := range certs {
+		pk := k.Key.(*rsa.PublicKey)
+		jwks = append(jwks, map[string]string{
+			"kty": "RSA",
+			"kid": k.Kid,
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pk.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pk.E)).Bytes()),
+		})
+	}
+	jwks = append(jwks, map[string]string{
+		"kty": "EC",
+		"kid": "ec-key-id",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(ecKey.X.Bytes()),
+		"y":   base64.RawURLEncoding.EncodeToString(ecKey.Y.Bytes()),
+	})
+	b, err = json.Marshal(map[string]interface{}{"keys": jwks})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := parsePublicKeys(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != len(certs)+1 {
+		t.Fatalf("parsePublicKeys() = %d keys; want = %d", len(keys), len(certs)+1)
+	}
+	for i, k := range certs {
+		if keys[i].Kid != k.Kid || !reflect.DeepEqual(keys[i].Key, k.Key) {
+			t.Errorf("parsePublicKeys()[%d] = %v; want = %v", i, keys[i], k)
+		}
+	}
+	if pk, ok := keys[len(certs)].Key.(*ecdsa.PublicKey); !ok || pk.X.Cmp(ecKey.X) != 0 || pk.Y.Cmp(ecKey.Y) != 0 {
+		t.Errorf("parsePublicKeys() = %v; want = %v", keys[len(certs)].Key, &ecKey.PublicKey)
+	}
+
+	c := *client
+	c.ks = &staticKeySource{keys: keys}
+	if _, err := c.VerifyIDToken(testIDToken); err != nil {
+		t.Errorf("VerifyIDToken() = %v; want = nil", err)
+	}
+}
+
+func TestParsePublicKeysJWKSError(t *testing.T) {
+	cases := []string{
+		`{"keys": [{"kty": "oct", "kid": "k", "k": "c2VjcmV0"}]}`,
+		`{"keys": [{"kty": "RSA", "kid": "k", "e": "AQAB"}]}`,
+		`{"keys": [{"kty": "RSA", "kid": "k", "n": "AQAB"}]}`,
+		`{"keys": [{"kty": "RSA", "kid": "k", "n": "not base64!", "e": "AQAB"}]}`,
+		`{"keys": [{"kty": "RSA", "kid": "k", "n": "AQAB", "e": "AQABAQAB"}]}`,
+		`{"keys": [{"kty": "RSA", "kid": "k", "n": "AQAB", "e": "AQ"}]}`,
+		`{"keys": [{"kty": "EC", "kid": "k", "crv": "P-384", "x": "AQAB", "y": "AQAB"}]}`,
+		`{"keys": [{"kty": "EC", "kid": "k", "crv": "P-256", "x": "AQAB", "y": "AQAB"}]}`,
+		`{"keys": [1]}`,
+	}
+	for _, tc := range cases {
+		if keys, err := parsePublicKeys([]byte(tc)); keys != nil || err == nil {
+			t.Errorf("parsePublicKeys(%q) = (%v, %v); want: (nil, err)", tc, keys, err)
+		}
+	}
+}
+
 func TestParsePublicKeysError(t *testing.T) {
 	cases := []string{
 		"",
 		"not-json",
+		`{"kid": "not-pem"}`,
 	}
 	for _, tc := range cases {
 		if keys, err := parsePublicKeys([]byte(tc)); keys != nil || err == nil {
@@ -207,21 +1001,151 @@ func TestParsePublicKeysError(t *testing.T) {
 
 func TestDefaultServiceAcctSigner(t *testing.T) {
 	signer := &serviceAcctSigner{}
-	if email, err := signer.Email(); email != "" || err == nil {
+	if email, err := signer.Email(ctx); email != "" || err == nil {
 		t.Errorf("Email() = (%v, %v); want = ('', error)", email, err)
 	}
-	if sig, err := signer.Sign([]byte("")); sig != nil || err == nil {
+	if sig, err := signer.Sign(ctx, []byte("")); sig != nil || err == nil {
 		t.Errorf("Sign() = (%v, %v); want = ('', error)", sig, err)
 	}
 }
 
+func TestStdSignatureVerifier(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("header.payload")
+	sig, err := serviceAcctSigner{email: "test@example.com", pk: pk}.Sign(ctx, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sv := stdSignatureVerifier{}
+	if err := sv.VerifySignature("RS256", &pk.PublicKey, content, sig); err != nil {
+		t.Errorf("VerifySignature() = %v; want = nil", err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecSig, err := ecdsaSigner{ecKey}.Sign(ctx, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sv.VerifySignature("ES256", &ecKey.PublicKey, content, ecSig); err != nil {
+		t.Errorf("VerifySignature(ES256) = %v; want = nil", err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		alg     string
+		key     interface{}
+		content []byte
+		sig     []byte
+	}{
+		{"TamperedContent", "RS256", &pk.PublicKey, []byte("header.tampered"), sig},
+		{"UnsupportedAlgorithm", "HS256", &pk.PublicKey, content, sig},
+		{"NonRSAKey", "RS256", &ecKey.PublicKey, content, sig},
+		{"TamperedECContent", "ES256", &ecKey.PublicKey, []byte("header.tampered"), ecSig},
+		{"NonECKey", "ES256", &pk.PublicKey, content, ecSig},
+		{"NonP256Key", "ES256", &p384Key.PublicKey, content, ecSig},
+		{"InvalidECSignatureLength", "ES256", &ecKey.PublicKey, content, ecSig[:63]},
+		{"RSASignatureWithECKey", "ES256", &ecKey.PublicKey, content, sig},
+	}
+	for _, tc := range cases {
+		if err := sv.VerifySignature(tc.alg, tc.key, tc.content, tc.sig); err == nil {
+			t.Errorf("VerifySignature(%s) = nil; want = error", tc.name)
+		}
+	}
+}
+
+func TestStdSignatureVerifierRSAHashes(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("header.payload")
+	sv := stdSignatureVerifier{}
+	sigs := make(map[string][]byte)
+	for _, alg := range []string{"RS256", "RS384", "RS512"} {
+		sig, err := rsaSigner{pk, rsaHashes[alg]}.Sign(ctx, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sv.VerifySignature(alg, &pk.PublicKey, content, sig); err != nil {
+			t.Errorf("VerifySignature(%s) = %v; want = nil", alg, err)
+		}
+		sigs[alg] = sig
+	}
+
+	// A signature must only verify with the hash it was made with.
+	mismatched := [][2]string{{"RS256", "RS512"}, {"RS384", "RS256"}, {"RS512", "RS384"}}
+	for _, m := range mismatched {
+		if err := sv.VerifySignature(m[0], &pk.PublicKey, content, sigs[m[1]]); err == nil {
+			t.Errorf("VerifySignature(%s, %s signature) = nil; want = error", m[0], m[1])
+		}
+	}
+
+	for _, alg := range []string{"", "none", "RS1", "PS256", "HS512", "rs256"} {
+		err := sv.VerifySignature(alg, &pk.PublicKey, content, sigs["RS256"])
+		if err == nil || !strings.HasPrefix(err.Error(), "unsupported signing algorithm") {
+			t.Errorf("VerifySignature(%q) = %v; want = unsupported signing algorithm", alg, err)
+		}
+	}
+}
+
+// rsaSigner signs content using RSASSA-PKCS1-v1_5 with the specified hash.
+type rsaSigner struct {
+	pk   *rsa.PrivateKey
+	hash crypto.Hash
+}
+
+func (s rsaSigner) Email(ctx context.Context) (string, error) {
+	return "test@example.com", nil
+}
+
+func (s rsaSigner) Sign(ctx context.Context, b []byte) ([]byte, error) {
+	h := s.hash.New()
+	h.Write(b)
+	return rsa.SignPKCS1v15(rand.Reader, s.pk, s.hash, h.Sum(nil))
+}
+
+// ecdsaSigner signs content using the ES256 algorithm.
+type ecdsaSigner struct {
+	pk *ecdsa.PrivateKey
+}
+
+func (s ecdsaSigner) Email(ctx context.Context) (string, error) {
+	return "test@example.com", nil
+}
+
+func (s ecdsaSigner) Sign(ctx context.Context, b []byte) ([]byte, error) {
+	h := sha256.Sum256(b)
+	r, ss, err := ecdsa.Sign(rand.Reader, s.pk, h[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	rb, sb := r.Bytes(), ss.Bytes()
+	copy(sig[32-len(rb):32], rb)
+	copy(sig[64-len(sb):], sb)
+	return sig, nil
+}
+
 func verifyHTTPKeySource(ks *httpKeySource, rc *mockReadCloser) error {
 	mc := &mockClock{now: time.Unix(0, 0)}
 	ks.Clock = mc
+	// Refresh synchronously, only once the keys have expired.
+	ks.RefreshAhead, ks.MaxStale = 0, 0
 
 	exp := time.Unix(100, 0)
 	for i := 0; i <= 100; i++ {
-		keys, err := ks.Keys()
+		keys, err := ks.Keys(ctx)
 		if err != nil {
 			return err
 		}
@@ -236,7 +1160,7 @@ func verifyHTTPKeySource(ks *httpKeySource, rc *mockReadCloser) error {
 	}
 
 	mc.now = time.Unix(101, 0)
-	keys, err := ks.Keys()
+	keys, err := ks.Keys(ctx)
 	if err != nil {
 		return err
 	}
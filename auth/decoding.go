@@ -0,0 +1,54 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// WithStrictDecoding returns a ClientOption that makes the Client reject the responses of the
+// Firebase Auth backend services and the tokens that contain fields the SDK does not know about.
+//
+// By default unknown fields are ignored, so that the Client keeps working as Firebase adds new
+// fields to user records, provider configs and tokens. Strict decoding is meant for tests that need
+// to notice such additions. It applies to user records, provider configs, tenants, token headers
+// and custom token payloads. The claims of ID tokens and session cookies are never rejected, since
+// the ones the SDK does not know about are reported in Token.Claims.
+//
+// Strict decoding requires Go 1.10 or later. On older versions the option returns an error.
+func WithStrictDecoding() ClientOption {
+	return func(c *Client) error {
+		if !strictDecodingSupported {
+			return errors.New("strict decoding requires Go 1.10 or later")
+		}
+		c.decoder.strict = true
+		return nil
+	}
+}
+
+// jsonDecoder decodes the JSON responses of the backend services and the segments of tokens.
+type jsonDecoder struct {
+	strict bool // if set, object fields unknown to the target type are rejected
+}
+
+func (d jsonDecoder) unmarshal(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if d.strict {
+		disallowUnknownFields(dec)
+	}
+	return dec.Decode(v)
+}
@@ -0,0 +1,129 @@
+// +build go1.10
+
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStrictDecoding(t *testing.T) {
+	s := echoServer(testGetUserResponse, t)
+	defer s.Close()
+	if err := WithStrictDecoding()(s.Client); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Client.EffectiveConfig().StrictDecoding {
+		t.Errorf("StrictDecoding = false; want = true")
+	}
+
+	if _, err := s.Client.GetUser(ctx, "testuser"); err != nil {
+		t.Errorf("GetUser() = %v; want = nil", err)
+	}
+
+	s.Resp = bytes.Replace(
+		testGetUserResponse, []byte(`"rawId": "testuid"`), []byte(`"rawId": "testuid", "newField": 1`), 1)
+	want := `unknown field "newField"`
+	if _, err := s.Client.GetUser(ctx, "testuser"); err == nil || !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("GetUser() = %v; want = %q", err, want)
+	}
+}
+
+func TestLenientDecoding(t *testing.T) {
+	resp := bytes.Replace(testGetUserResponse, []byte(`"localId"`), []byte(`"newField": {"a": 1}, "localId"`), 1)
+	s := echoServer(resp, t)
+	defer s.Close()
+	if s.Client.EffectiveConfig().StrictDecoding {
+		t.Errorf("StrictDecoding = true; want = false")
+	}
+
+	user, err := s.Client.GetUser(ctx, "testuser")
+	if err != nil || user.UID != "testuser" {
+		t.Errorf("GetUser() = (%v, %v); want = (testuser, nil)", user, err)
+	}
+}
+
+func TestStrictDecodingProviderConfig(t *testing.T) {
+	s := providerConfigServer(testOIDCConfigJSON, t)
+	defer s.Close()
+	if err := WithStrictDecoding()(s.Client); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Client.OIDCProviderConfig(ctx, "oidc.provider"); err != nil {
+		t.Errorf("OIDCProviderConfig() = %v; want = nil", err)
+	}
+
+	s.Resp = []byte(`{"name": "projects/mock-project-id/oauthIdpConfigs/oidc.provider", "newField": true}`)
+	want := `unknown field "newField"`
+	if _, err := s.Client.OIDCProviderConfig(ctx, "oidc.provider"); err == nil || !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("OIDCProviderConfig() = %v; want = %q", err, want)
+	}
+}
+
+func TestStrictDecodingTenant(t *testing.T) {
+	s := echoServer([]byte(testTenantJSON), t)
+	defer s.Close()
+	s.Client.projectEndpoint = s.Srv.URL
+	if err := WithStrictDecoding()(s.Client); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Client.TenantManager().GetTenant(ctx, "tenant1"); err != nil {
+		t.Errorf("GetTenant() = %v; want = nil", err)
+	}
+
+	s.Resp = []byte(`{"name": "projects/mock-project-id/tenants/tenant1", "newField": true}`)
+	want := `unknown field "newField"`
+	if _, err := s.Client.TenantManager().GetTenant(ctx, "tenant1"); err == nil || !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("GetTenant() = %v; want = %q", err, want)
+	}
+}
+
+func TestStrictDecodingTokens(t *testing.T) {
+	c := *client
+	if err := WithStrictDecoding()(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	// Claims that Token does not define are still accepted.
+	if _, err := c.VerifyIDToken(getIDToken(mockIDTokenPayload{"newClaim": true})); err != nil {
+		t.Errorf("VerifyIDToken() = %v; want = nil", err)
+	}
+
+	token, err := c.CustomToken("user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.VerifyCustomToken(ctx, token); err != nil {
+		t.Errorf("VerifyCustomToken() = %v; want = nil", err)
+	}
+
+	header, err := encode(map[string]interface{}{"alg": "RS256", "typ": "JWT", "newParam": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	token = header + "." + parts[1] + "." + parts[2]
+	if _, err := decodeUnverifiedToken(token, jsonDecoder{}, &jwtHeader{}, &customToken{}); err != nil {
+		t.Errorf("decodeUnverifiedToken(lenient) = %v; want = nil", err)
+	}
+	want := `unknown field "newParam"`
+	_, err = decodeUnverifiedToken(token, c.decoder, &jwtHeader{}, &customToken{})
+	if err == nil || !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("decodeUnverifiedToken(strict) = %v; want = %q", err, want)
+	}
+}
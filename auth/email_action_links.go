@@ -0,0 +1,164 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"firebase.google.com/go/internal"
+	"golang.org/x/net/context"
+)
+
+type linkType string
+
+const (
+	emailLinkSignIn   linkType = "EMAIL_SIGNIN"
+	emailVerification linkType = "VERIFY_EMAIL"
+	passwordReset     linkType = "PASSWORD_RESET"
+)
+
+// ActionCodeSettings specifies the required continue/state URL with optional Android and iOS
+// settings. Used when invoking the email action link generation APIs.
+type ActionCodeSettings struct {
+	URL                   string `json:"continueUrl"`
+	HandleCodeInApp       bool   `json:"canHandleCodeInApp"`
+	IOSBundleID           string `json:"iOSBundleId,omitempty"`
+	AndroidPackageName    string `json:"androidPackageName,omitempty"`
+	AndroidMinimumVersion string `json:"androidMinimumVersion,omitempty"`
+	AndroidInstallApp     bool   `json:"androidInstallApp,omitempty"`
+	DynamicLinkDomain     string `json:"dynamicLinkDomain,omitempty"`
+}
+
+func (settings *ActionCodeSettings) validate() error {
+	if settings.URL == "" {
+		return errors.New("URL must not be empty")
+	}
+	if u, err := url.Parse(settings.URL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("malformed url string: %q", settings.URL)
+	}
+	if settings.AndroidPackageName == "" && (settings.AndroidMinimumVersion != "" || settings.AndroidInstallApp) {
+		return errors.New("Android package name is required when specifying other Android settings")
+	}
+	return nil
+}
+
+// EmailVerificationLink generates the out-of-band email action link for email verification flows
+// for the specified email address.
+func (c *Client) EmailVerificationLink(ctx context.Context, email string) (link string, err error) {
+	defer internal.WrapOpError(&err, "EmailVerificationLink", email)
+	return c.generateEmailActionLink(ctx, emailVerification, email, nil)
+}
+
+// EmailVerificationLinkWithSettings generates the out-of-band email action link for email
+// verification flows for the specified email address, using the action code settings provided.
+func (c *Client) EmailVerificationLinkWithSettings(
+	ctx context.Context, email string, settings *ActionCodeSettings) (link string, err error) {
+
+	defer internal.WrapOpError(&err, "EmailVerificationLinkWithSettings", email)
+	return c.generateEmailActionLink(ctx, emailVerification, email, settings)
+}
+
+// PasswordResetLink generates the out-of-band email action link for password reset flows for the
+// specified email address.
+func (c *Client) PasswordResetLink(ctx context.Context, email string) (link string, err error) {
+	defer internal.WrapOpError(&err, "PasswordResetLink", email)
+	return c.generateEmailActionLink(ctx, passwordReset, email, nil)
+}
+
+// PasswordResetLinkWithSettings generates the out-of-band email action link for password reset
+// flows for the specified email address, using the action code settings provided.
+func (c *Client) PasswordResetLinkWithSettings(
+	ctx context.Context, email string, settings *ActionCodeSettings) (link string, err error) {
+
+	defer internal.WrapOpError(&err, "PasswordResetLinkWithSettings", email)
+	return c.generateEmailActionLink(ctx, passwordReset, email, settings)
+}
+
+// EmailSignInLink generates the sign-in with email link for the specified email address, using
+// the action code settings provided. The settings must not be nil, and HandleCodeInApp must be
+// true, since the sign-in is always completed in the app.
+func (c *Client) EmailSignInLink(
+	ctx context.Context, email string, settings *ActionCodeSettings) (link string, err error) {
+
+	defer internal.WrapOpError(&err, "EmailSignInLink", email)
+	if settings == nil {
+		return "", errors.New("action code settings must not be nil")
+	}
+	if !settings.HandleCodeInApp {
+		return "", errors.New("HandleCodeInApp must be true when generating email sign-in links")
+	}
+	return c.generateEmailActionLink(ctx, emailLinkSignIn, email, settings)
+}
+
+func (c *Client) generateEmailActionLink(
+	ctx context.Context, lt linkType, email string, settings *ActionCodeSettings) (string, error) {
+
+	if err := validateEmail(email); err != nil {
+		return "", err
+	}
+	if settings != nil {
+		if err := settings.validate(); err != nil {
+			return "", err
+		}
+	}
+	if c.projectID == "" {
+		return "", errors.New("project id not available")
+	}
+	if err := c.beforeRequest(ctx); err != nil {
+		return "", err
+	}
+
+	payload := &struct {
+		RequestType   linkType `json:"requestType"`
+		Email         string   `json:"email"`
+		ReturnOobLink bool     `json:"returnOobLink"`
+		TenantID      string   `json:"tenantId,omitempty"`
+		*ActionCodeSettings
+	}{
+		RequestType:        lt,
+		Email:              email,
+		ReturnOobLink:      true,
+		TenantID:           c.tenantID,
+		ActionCodeSettings: settings,
+	}
+	request := &internal.Request{
+		Method: http.MethodPost,
+		URL:    fmt.Sprintf("%s/projects/%s/accounts:sendOobCode", c.idToolkitV1Endpoint, c.projectID),
+		Body:   internal.NewJSONEntity(payload),
+		Opts:   []internal.HTTPOption{internal.WithHeader("X-Client-Version", c.version)},
+	}
+	resp, err := c.adminClient.Do(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	if resp.Status != http.StatusOK {
+		return "", handleHTTPError(resp)
+	}
+
+	var result struct {
+		OOBLink string `json:"oobLink"`
+	}
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		return "", err
+	}
+	if result.OOBLink == "" {
+		return "", errors.New("failed to generate email action link")
+	}
+	return result.OOBLink, nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const (
+	testActionLink = "https://test.link"
+	testEmail      = "user@domain.com"
+)
+
+var testActionCodeSettings = &ActionCodeSettings{
+	URL:                   "https://example.dynamic.link",
+	HandleCodeInApp:       true,
+	DynamicLinkDomain:     "custom.page.link",
+	IOSBundleID:           "com.example.ios",
+	AndroidPackageName:    "com.example.android",
+	AndroidInstallApp:     true,
+	AndroidMinimumVersion: "6",
+}
+
+var testActionCodeSettingsMap = map[string]interface{}{
+	"continueUrl":           "https://example.dynamic.link",
+	"canHandleCodeInApp":    true,
+	"dynamicLinkDomain":     "custom.page.link",
+	"iOSBundleId":           "com.example.ios",
+	"androidPackageName":    "com.example.android",
+	"androidInstallApp":     true,
+	"androidMinimumVersion": "6",
+}
+
+func TestEmailActionLinks(t *testing.T) {
+	s := echoServer(map[string]interface{}{"oobLink": testActionLink}, t)
+	defer s.Close()
+	s.Client.idToolkitV1Endpoint = s.Srv.URL
+
+	cases := []struct {
+		name     string
+		generate func() (string, error)
+		want     map[string]interface{}
+	}{
+		{
+			"EmailVerificationLink",
+			func() (string, error) { return s.Client.EmailVerificationLink(ctx, testEmail) },
+			map[string]interface{}{"requestType": "VERIFY_EMAIL"},
+		},
+		{
+			"EmailVerificationLinkWithSettings",
+			func() (string, error) {
+				return s.Client.EmailVerificationLinkWithSettings(ctx, testEmail, testActionCodeSettings)
+			},
+			withSettings("VERIFY_EMAIL"),
+		},
+		{
+			"PasswordResetLink",
+			func() (string, error) { return s.Client.PasswordResetLink(ctx, testEmail) },
+			map[string]interface{}{"requestType": "PASSWORD_RESET"},
+		},
+		{
+			"PasswordResetLinkWithSettings",
+			func() (string, error) {
+				return s.Client.PasswordResetLinkWithSettings(ctx, testEmail, testActionCodeSettings)
+			},
+			withSettings("PASSWORD_RESET"),
+		},
+		{
+			"EmailSignInLink",
+			func() (string, error) { return s.Client.EmailSignInLink(ctx, testEmail, testActionCodeSettings) },
+			withSettings("EMAIL_SIGNIN"),
+		},
+	}
+	for i, tc := range cases {
+		link, err := tc.generate()
+		if err != nil {
+			t.Errorf("%s() = %v", tc.name, err)
+			continue
+		}
+		if link != testActionLink {
+			t.Errorf("%s() = %q; want = %q", tc.name, link, testActionLink)
+		}
+
+		req := s.Req[i]
+		wantPath := "/projects/mock-project-id/accounts:sendOobCode"
+		if req.Method != http.MethodPost || req.URL.Path != wantPath {
+			t.Errorf("%s() = %s %s; want = POST %s", tc.name, req.Method, req.URL.Path, wantPath)
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal(s.Rbody, &got); err != nil {
+			t.Fatal(err)
+		}
+		tc.want["email"] = testEmail
+		tc.want["returnOobLink"] = true
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s() request = %v; want = %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestEmailActionLinkInvalidArgs(t *testing.T) {
+	cases := []struct {
+		name     string
+		email    string
+		settings *ActionCodeSettings
+	}{
+		{"EmptyEmail", "", nil},
+		{"MalformedEmail", "not-an-email", nil},
+		{"EmptyURL", testEmail, &ActionCodeSettings{}},
+		{"MalformedURL", testEmail, &ActionCodeSettings{URL: "not a url"}},
+		{
+			"AndroidMinimumVersionWithoutPackage",
+			testEmail,
+			&ActionCodeSettings{URL: "https://example.com", AndroidMinimumVersion: "6"},
+		},
+		{
+			"AndroidInstallAppWithoutPackage",
+			testEmail,
+			&ActionCodeSettings{URL: "https://example.com", AndroidInstallApp: true},
+		},
+	}
+	for _, tc := range cases {
+		if link, err := client.PasswordResetLinkWithSettings(ctx, tc.email, tc.settings); link != "" || err == nil {
+			t.Errorf("PasswordResetLinkWithSettings(%s) = (%q, %v); want = ('', error)", tc.name, link, err)
+		}
+	}
+}
+
+func TestEmailSignInLinkInvalidSettings(t *testing.T) {
+	invalid := []*ActionCodeSettings{
+		nil,
+		{URL: "https://example.com"},
+	}
+	for _, settings := range invalid {
+		if link, err := client.EmailSignInLink(ctx, testEmail, settings); link != "" || err == nil {
+			t.Errorf("EmailSignInLink(%v) = (%q, %v); want = ('', error)", settings, link, err)
+		}
+	}
+}
+
+func TestEmailActionLinkError(t *testing.T) {
+	s := echoServer([]byte(`{"error":{"message":"USER_NOT_FOUND"}}`), t)
+	defer s.Close()
+	s.Client.idToolkitV1Endpoint = s.Srv.URL
+	s.Status = http.StatusBadRequest
+
+	if link, err := s.Client.PasswordResetLink(ctx, testEmail); link != "" || err == nil {
+		t.Errorf("PasswordResetLink() = (%q, %v); want = ('', error)", link, err)
+	}
+}
+
+func withSettings(requestType string) map[string]interface{} {
+	m := map[string]interface{}{"requestType": requestType}
+	for k, v := range testActionCodeSettingsMap {
+		m[k] = v
+	}
+	return m
+}
@@ -0,0 +1,278 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"firebase.google.com/go/internal"
+	"golang.org/x/net/context"
+)
+
+const (
+	// maxLookupIdentifiers is the largest number of identifiers accepted by a single call to the
+	// accounts:lookup endpoint.
+	maxLookupIdentifiers = 100
+
+	// maxConcurrentLookups is the largest number of lookup requests GetUsers runs at the same time.
+	maxConcurrentLookups = 4
+)
+
+// UserIdentifier identifies a user account to be looked up with GetUsers.
+//
+// This interface is implemented by UIDIdentifier, EmailIdentifier, PhoneIdentifier and
+// ProviderIdentifier.
+type UserIdentifier interface {
+	validate() error
+	populate(req *lookupRequest)
+	matches(u *UserRecord) bool
+}
+
+// UIDIdentifier identifies a user by their UID.
+type UIDIdentifier struct {
+	UID string
+}
+
+func (id UIDIdentifier) validate() error {
+	return validateUID(id.UID)
+}
+
+func (id UIDIdentifier) populate(req *lookupRequest) {
+	req.LocalID = append(req.LocalID, id.UID)
+}
+
+func (id UIDIdentifier) matches(u *UserRecord) bool {
+	return u.UID == id.UID
+}
+
+// EmailIdentifier identifies a user by their email address.
+type EmailIdentifier struct {
+	Email string
+}
+
+func (id EmailIdentifier) validate() error {
+	return validateEmail(id.Email)
+}
+
+func (id EmailIdentifier) populate(req *lookupRequest) {
+	req.Email = append(req.Email, id.Email)
+}
+
+func (id EmailIdentifier) matches(u *UserRecord) bool {
+	return strings.EqualFold(u.Email, id.Email)
+}
+
+// PhoneIdentifier identifies a user by their phone number.
+type PhoneIdentifier struct {
+	PhoneNumber string
+}
+
+func (id PhoneIdentifier) validate() error {
+	return validatePhone(id.PhoneNumber)
+}
+
+func (id PhoneIdentifier) populate(req *lookupRequest) {
+	req.PhoneNumber = append(req.PhoneNumber, id.PhoneNumber)
+}
+
+func (id PhoneIdentifier) matches(u *UserRecord) bool {
+	return u.PhoneNumber == id.PhoneNumber
+}
+
+// ProviderIdentifier identifies a user by the ID of a federated identity provider (e.g.
+// "google.com"), and the UID of the user at that provider.
+type ProviderIdentifier struct {
+	ProviderID  string
+	ProviderUID string
+}
+
+func (id ProviderIdentifier) validate() error {
+	if id.ProviderID == "" {
+		return errors.New("provider id must not be empty")
+	}
+	if id.ProviderUID == "" {
+		return errors.New("provider uid must not be empty")
+	}
+	return nil
+}
+
+func (id ProviderIdentifier) populate(req *lookupRequest) {
+	req.FederatedUserID = append(req.FederatedUserID, &federatedUserID{
+		ProviderID: id.ProviderID,
+		RawID:      id.ProviderUID,
+	})
+}
+
+func (id ProviderIdentifier) matches(u *UserRecord) bool {
+	for _, p := range u.ProviderUserInfo {
+		if p.ProviderID == id.ProviderID && p.UID == id.ProviderUID {
+			return true
+		}
+	}
+	return false
+}
+
+// GetUsersResult describes the outcome of a GetUsers call.
+//
+// Users contains the user accounts that matched at least one of the identifiers, each appearing
+// once. NotFound contains the identifiers that did not match any user account, in the order they
+// were passed to GetUsers.
+type GetUsersResult struct {
+	Users    []*UserRecord
+	NotFound []UserIdentifier
+}
+
+// GetUsers gets the user data corresponding to the given identifiers.
+//
+// The identifiers may be any mix of UIDIdentifier, EmailIdentifier, PhoneIdentifier and
+// ProviderIdentifier values. Identifiers that do not match a user account are reported in the
+// NotFound list of the returned GetUsersResult, and do not cause GetUsers to return an error.
+//
+// The identifiers are looked up in batches of 100, which are sent concurrently when there is more
+// than one of them. All identifiers are validated before any request is made, and invalid input
+// fails the whole call. Requires the project ID of the Client to be known.
+func (c *Client) GetUsers(ctx context.Context, identifiers []UserIdentifier) (result *GetUsersResult, err error) {
+	defer internal.WrapOpError(&err, "GetUsers", "")
+	for i, id := range identifiers {
+		if id == nil {
+			return nil, fmt.Errorf("identifier at index %d must not be nil", i)
+		}
+		if err := id.validate(); err != nil {
+			return nil, fmt.Errorf("identifier at index %d: %v", i, err)
+		}
+	}
+
+	var batches [][]UserIdentifier
+	for len(identifiers) > maxLookupIdentifiers {
+		batches = append(batches, identifiers[:maxLookupIdentifiers])
+		identifiers = identifiers[maxLookupIdentifiers:]
+	}
+	if len(identifiers) > 0 {
+		batches = append(batches, identifiers)
+	}
+
+	results, err := c.lookupBatches(ctx, batches)
+	if err != nil {
+		return nil, err
+	}
+
+	result = &GetUsersResult{}
+	seen := make(map[string]bool)
+	for i, users := range results {
+		for _, u := range users {
+			if !seen[u.UID] {
+				seen[u.UID] = true
+				result.Users = append(result.Users, u)
+			}
+		}
+		for _, id := range batches[i] {
+			if !matchesAny(id, users) {
+				result.NotFound = append(result.NotFound, id)
+			}
+		}
+	}
+	return result, nil
+}
+
+// lookupBatches looks up each batch of identifiers with a separate request, running at most
+// maxConcurrentLookups of them at a time. The users found for each batch are returned at the index
+// of the batch. Remaining requests are cancelled as soon as one of them fails.
+func (c *Client) lookupBatches(ctx context.Context, batches [][]UserIdentifier) ([][]*UserRecord, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([][]*UserRecord, len(batches))
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, maxConcurrentLookups)
+	for i, batch := range batches {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, batch []UserIdentifier) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			users, err := c.lookupUsers(ctx, batch)
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			results[i] = users
+		}(i, batch)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+func (c *Client) lookupUsers(ctx context.Context, identifiers []UserIdentifier) ([]*UserRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	request := &lookupRequest{}
+	for _, id := range identifiers {
+		id.populate(request)
+	}
+	var resp lookupResponse
+	if err := c.makeUserRequest(ctx, http.MethodPost, "accounts:lookup", request, &resp); err != nil {
+		return nil, err
+	}
+
+	var users []*UserRecord
+	for _, u := range resp.Users {
+		ur, err := makeUserRecord(u)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, ur)
+	}
+	return users, nil
+}
+
+func matchesAny(id UserIdentifier, users []*UserRecord) bool {
+	for _, u := range users {
+		if id.matches(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupRequest is a request to the accounts:lookup endpoint of the Identity Toolkit v1 API. The
+// identitytoolkit v3 request type cannot look up users by their federated identities.
+type lookupRequest struct {
+	LocalID         []string           `json:"localId,omitempty"`
+	Email           []string           `json:"email,omitempty"`
+	PhoneNumber     []string           `json:"phoneNumber,omitempty"`
+	FederatedUserID []*federatedUserID `json:"federatedUserId,omitempty"`
+}
+
+type federatedUserID struct {
+	ProviderID string `json:"providerId"`
+	RawID      string `json:"rawId"`
+}
@@ -0,0 +1,198 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGetUsers(t *testing.T) {
+	s := echoServer(testGetUserResponse, t)
+	defer s.Close()
+
+	identifiers := []UserIdentifier{
+		UIDIdentifier{"testuser"},
+		EmailIdentifier{"TestUser@example.com"},
+		PhoneIdentifier{"+1234567890"},
+		ProviderIdentifier{ProviderID: "password", ProviderUID: "testuid"},
+		UIDIdentifier{"missing"},
+		ProviderIdentifier{ProviderID: "google.com", ProviderUID: "testuid"},
+	}
+	result, err := s.Client.GetUsers(ctx, identifiers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &GetUsersResult{
+		Users: []*UserRecord{testUser},
+		NotFound: []UserIdentifier{
+			UIDIdentifier{"missing"},
+			ProviderIdentifier{ProviderID: "google.com", ProviderUID: "testuid"},
+		},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("GetUsers() = %#v; want = %#v", result, want)
+	}
+
+	if len(s.Req) != 1 {
+		t.Fatalf("Requests = %d; want = 1", len(s.Req))
+	}
+	if got, want := s.Req[0].URL.Path, "/projects/mock-project-id/accounts:lookup"; got != want {
+		t.Errorf("Path = %q; want = %q", got, want)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(s.Rbody, &got); err != nil {
+		t.Fatal(err)
+	}
+	wantReq := map[string]interface{}{
+		"localId":     []interface{}{"testuser", "missing"},
+		"email":       []interface{}{"TestUser@example.com"},
+		"phoneNumber": []interface{}{"+1234567890"},
+		"federatedUserId": []interface{}{
+			map[string]interface{}{"providerId": "password", "rawId": "testuid"},
+			map[string]interface{}{"providerId": "google.com", "rawId": "testuid"},
+		},
+	}
+	if !reflect.DeepEqual(got, wantReq) {
+		t.Errorf("GetUsers() request = %v; want = %v", got, wantReq)
+	}
+}
+
+func TestGetUsersEmpty(t *testing.T) {
+	s := echoServer(testGetUserResponse, t)
+	defer s.Close()
+
+	result, err := s.Client.GetUsers(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, &GetUsersResult{}) {
+		t.Errorf("GetUsers() = %#v; want = empty result", result)
+	}
+	if len(s.Req) != 0 {
+		t.Errorf("Requests = %d; want = 0", len(s.Req))
+	}
+}
+
+func TestInvalidGetUsers(t *testing.T) {
+	cases := []struct {
+		id   UserIdentifier
+		want string
+	}{
+		{nil, "GetUsers: identifier at index 1 must not be nil"},
+		{UIDIdentifier{""}, "GetUsers: identifier at index 1: uid must not be empty"},
+		{EmailIdentifier{"not-an-email"}, `GetUsers: identifier at index 1: malformed email string: "not-an-email"`},
+		{PhoneIdentifier{"1234"}, "GetUsers: identifier at index 1: phone number must be a valid, E.164 compliant identifier"},
+		{ProviderIdentifier{ProviderUID: "uid"}, "GetUsers: identifier at index 1: provider id must not be empty"},
+		{ProviderIdentifier{ProviderID: "google.com"}, "GetUsers: identifier at index 1: provider uid must not be empty"},
+	}
+	for _, tc := range cases {
+		result, err := client.GetUsers(ctx, []UserIdentifier{UIDIdentifier{"uid1"}, tc.id})
+		if result != nil || err == nil || err.Error() != tc.want {
+			t.Errorf("GetUsers(%#v) = (%v, %v); want = (nil, %q)", tc.id, result, err, tc.want)
+		}
+	}
+}
+
+func TestGetUsersBatches(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests int
+		active   int
+		peak     int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		active++
+		if active > peak {
+			peak = active
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}()
+
+		var req lookupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		if len(req.LocalID) > maxLookupIdentifiers {
+			t.Errorf("Identifiers = %d; want <= %d", len(req.LocalID), maxLookupIdentifiers)
+		}
+		// Only the users with an even number exist.
+		var users []map[string]interface{}
+		for _, uid := range req.LocalID {
+			if n, _ := strconv.Atoi(strings.TrimPrefix(uid, "user")); n%2 == 0 {
+				users = append(users, map[string]interface{}{"localId": uid})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"users": users})
+	}))
+	defer srv.Close()
+	s := echoServer(nil, t)
+	defer s.Close()
+	s.Client.idToolkitV1Endpoint = srv.URL
+
+	var identifiers []UserIdentifier
+	for i := 0; i < 250; i++ {
+		identifiers = append(identifiers, UIDIdentifier{fmt.Sprintf("user%d", i)})
+	}
+	result, err := s.Client.GetUsers(ctx, identifiers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 3 {
+		t.Errorf("Requests = %d; want = 3", requests)
+	}
+	if peak > maxConcurrentLookups {
+		t.Errorf("Concurrent requests = %d; want <= %d", peak, maxConcurrentLookups)
+	}
+	if len(result.Users) != 125 || len(result.NotFound) != 125 {
+		t.Fatalf("GetUsers() = (%d users, %d not found); want = (125, 125)", len(result.Users), len(result.NotFound))
+	}
+	for i, u := range result.Users {
+		if want := fmt.Sprintf("user%d", 2*i); u.UID != want {
+			t.Errorf("Users[%d] = %q; want = %q", i, u.UID, want)
+		}
+	}
+	for i, id := range result.NotFound {
+		if want := (UIDIdentifier{fmt.Sprintf("user%d", 2*i+1)}); id != want {
+			t.Errorf("NotFound[%d] = %v; want = %v", i, id, want)
+		}
+	}
+}
+
+func TestGetUsersError(t *testing.T) {
+	s := echoServer([]byte(`{"error": {"message": "INSUFFICIENT_PERMISSION"}}`), t)
+	defer s.Close()
+	s.Status = http.StatusForbidden
+
+	result, err := s.Client.GetUsers(ctx, []UserIdentifier{UIDIdentifier{"uid1"}})
+	if result != nil || err == nil || !IsInsufficientPermission(err) {
+		t.Errorf("GetUsers() = (%v, %v); want = (nil, InsufficientPermission)", result, err)
+	}
+}
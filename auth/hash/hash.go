@@ -0,0 +1,210 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hash contains a collection of password hash algorithms that can be used with the
+// auth.ImportUsers() API. Refer to https://firebase.google.com/docs/auth/admin/import-users for
+// more details about supported hash algorithms.
+package hash
+
+import (
+	"errors"
+	"fmt"
+
+	"firebase.google.com/go/internal"
+)
+
+// Bcrypt represents the BCRYPT hash algorithm.
+//
+// Refer to https://firebase.google.com/docs/auth/admin/import-users#import_users_with_bcrypt_hashed_passwords
+// for more details.
+type Bcrypt struct{}
+
+// Config returns the validated hash configuration.
+func (h Bcrypt) Config() (*internal.HashConfig, error) {
+	return &internal.HashConfig{HashAlgorithm: "BCRYPT"}, nil
+}
+
+// StandardScrypt represents the standard scrypt hash algorithm.
+//
+// Refer to https://firebase.google.com/docs/auth/admin/import-users#import_users_with_standard_scrypt_hashed_passwords
+// for more details.
+type StandardScrypt struct {
+	BlockSize        int
+	DerivedKeyLength int
+	MemoryCost       int
+	Parallelization  int
+}
+
+// Config returns the validated hash configuration.
+func (h StandardScrypt) Config() (*internal.HashConfig, error) {
+	return &internal.HashConfig{
+		HashAlgorithm:    "STANDARD_SCRYPT",
+		BlockSize:        int64(h.BlockSize),
+		CPUMemCost:       int64(h.MemoryCost),
+		DerivedKeyLength: int64(h.DerivedKeyLength),
+		Parallelization:  int64(h.Parallelization),
+	}, nil
+}
+
+// Scrypt represents the modified scrypt hash algorithm used by Firebase Auth.
+//
+// Refer to https://firebase.google.com/docs/auth/admin/import-users#import_users_with_firebase_scrypt_hashed_passwords
+// for more details. The signer key, salt separator, rounds and memory cost of a project are
+// available in the Password Hash Parameters section of the Firebase console.
+type Scrypt struct {
+	Key           []byte
+	SaltSeparator []byte
+	Rounds        int
+	MemoryCost    int
+}
+
+// Config returns the validated hash configuration.
+func (h Scrypt) Config() (*internal.HashConfig, error) {
+	if len(h.Key) == 0 {
+		return nil, errors.New("signer key not specified")
+	}
+	if h.Rounds < 1 || h.Rounds > 8 {
+		return nil, errors.New("rounds must be between 1 and 8")
+	}
+	if h.MemoryCost < 1 || h.MemoryCost > 14 {
+		return nil, errors.New("memory cost must be between 1 and 14")
+	}
+	return &internal.HashConfig{
+		HashAlgorithm: "SCRYPT",
+		SignerKey:     h.Key,
+		SaltSeparator: h.SaltSeparator,
+		Rounds:        int64(h.Rounds),
+		MemoryCost:    int64(h.MemoryCost),
+	}, nil
+}
+
+// HMACMD5 represents the HMAC MD5 hash algorithm.
+type HMACMD5 struct {
+	Key []byte
+}
+
+// Config returns the validated hash configuration.
+func (h HMACMD5) Config() (*internal.HashConfig, error) {
+	return hmacConfig("HMAC_MD5", h.Key)
+}
+
+// HMACSHA1 represents the HMAC SHA1 hash algorithm.
+type HMACSHA1 struct {
+	Key []byte
+}
+
+// Config returns the validated hash configuration.
+func (h HMACSHA1) Config() (*internal.HashConfig, error) {
+	return hmacConfig("HMAC_SHA1", h.Key)
+}
+
+// HMACSHA256 represents the HMAC SHA256 hash algorithm.
+type HMACSHA256 struct {
+	Key []byte
+}
+
+// Config returns the validated hash configuration.
+func (h HMACSHA256) Config() (*internal.HashConfig, error) {
+	return hmacConfig("HMAC_SHA256", h.Key)
+}
+
+// HMACSHA512 represents the HMAC SHA512 hash algorithm.
+type HMACSHA512 struct {
+	Key []byte
+}
+
+// Config returns the validated hash configuration.
+func (h HMACSHA512) Config() (*internal.HashConfig, error) {
+	return hmacConfig("HMAC_SHA512", h.Key)
+}
+
+// MD5 represents the MD5 hash algorithm.
+type MD5 struct {
+	Rounds int
+}
+
+// Config returns the validated hash configuration.
+func (h MD5) Config() (*internal.HashConfig, error) {
+	return basicConfig("MD5", h.Rounds, 0, 8192)
+}
+
+// SHA1 represents the SHA1 hash algorithm.
+type SHA1 struct {
+	Rounds int
+}
+
+// Config returns the validated hash configuration.
+func (h SHA1) Config() (*internal.HashConfig, error) {
+	return basicConfig("SHA1", h.Rounds, 1, 8192)
+}
+
+// SHA256 represents the SHA256 hash algorithm.
+type SHA256 struct {
+	Rounds int
+}
+
+// Config returns the validated hash configuration.
+func (h SHA256) Config() (*internal.HashConfig, error) {
+	return basicConfig("SHA256", h.Rounds, 1, 8192)
+}
+
+// SHA512 represents the SHA512 hash algorithm.
+type SHA512 struct {
+	Rounds int
+}
+
+// Config returns the validated hash configuration.
+func (h SHA512) Config() (*internal.HashConfig, error) {
+	return basicConfig("SHA512", h.Rounds, 1, 8192)
+}
+
+// PBKDFSHA1 represents the PBKDF SHA1 hash algorithm.
+type PBKDFSHA1 struct {
+	Rounds int
+}
+
+// Config returns the validated hash configuration.
+func (h PBKDFSHA1) Config() (*internal.HashConfig, error) {
+	return basicConfig("PBKDF_SHA1", h.Rounds, 0, 120000)
+}
+
+// PBKDF2SHA256 represents the PBKDF2 SHA256 hash algorithm.
+type PBKDF2SHA256 struct {
+	Rounds int
+}
+
+// Config returns the validated hash configuration.
+func (h PBKDF2SHA256) Config() (*internal.HashConfig, error) {
+	return basicConfig("PBKDF2_SHA256", h.Rounds, 0, 120000)
+}
+
+func hmacConfig(name string, key []byte) (*internal.HashConfig, error) {
+	if len(key) == 0 {
+		return nil, errors.New("signer key not specified")
+	}
+	return &internal.HashConfig{
+		HashAlgorithm: name,
+		SignerKey:     key,
+	}, nil
+}
+
+func basicConfig(name string, rounds, min, max int) (*internal.HashConfig, error) {
+	if rounds < min || rounds > max {
+		return nil, fmt.Errorf("rounds must be between %d and %d", min, max)
+	}
+	return &internal.HashConfig{
+		HashAlgorithm: name,
+		Rounds:        int64(rounds),
+	}, nil
+}
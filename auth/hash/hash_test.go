@@ -0,0 +1,101 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hash
+
+import (
+	"reflect"
+	"testing"
+
+	"firebase.google.com/go/internal"
+)
+
+type hashConfigurer interface {
+	Config() (*internal.HashConfig, error)
+}
+
+func TestValidHash(t *testing.T) {
+	cases := []struct {
+		alg  hashConfigurer
+		want *internal.HashConfig
+	}{
+		{Bcrypt{}, &internal.HashConfig{HashAlgorithm: "BCRYPT"}},
+		{
+			StandardScrypt{BlockSize: 1, DerivedKeyLength: 2, MemoryCost: 3, Parallelization: 4},
+			&internal.HashConfig{
+				HashAlgorithm:    "STANDARD_SCRYPT",
+				BlockSize:        1,
+				DerivedKeyLength: 2,
+				CPUMemCost:       3,
+				Parallelization:  4,
+			},
+		},
+		{
+			Scrypt{Key: []byte("key"), SaltSeparator: []byte("sep"), Rounds: 8, MemoryCost: 14},
+			&internal.HashConfig{
+				HashAlgorithm: "SCRYPT",
+				SignerKey:     []byte("key"),
+				SaltSeparator: []byte("sep"),
+				Rounds:        8,
+				MemoryCost:    14,
+			},
+		},
+		{HMACMD5{Key: []byte("key")}, &internal.HashConfig{HashAlgorithm: "HMAC_MD5", SignerKey: []byte("key")}},
+		{HMACSHA1{Key: []byte("key")}, &internal.HashConfig{HashAlgorithm: "HMAC_SHA1", SignerKey: []byte("key")}},
+		{HMACSHA256{Key: []byte("key")}, &internal.HashConfig{HashAlgorithm: "HMAC_SHA256", SignerKey: []byte("key")}},
+		{HMACSHA512{Key: []byte("key")}, &internal.HashConfig{HashAlgorithm: "HMAC_SHA512", SignerKey: []byte("key")}},
+		{MD5{Rounds: 0}, &internal.HashConfig{HashAlgorithm: "MD5"}},
+		{SHA1{Rounds: 1}, &internal.HashConfig{HashAlgorithm: "SHA1", Rounds: 1}},
+		{SHA256{Rounds: 8192}, &internal.HashConfig{HashAlgorithm: "SHA256", Rounds: 8192}},
+		{SHA512{Rounds: 100}, &internal.HashConfig{HashAlgorithm: "SHA512", Rounds: 100}},
+		{PBKDFSHA1{Rounds: 120000}, &internal.HashConfig{HashAlgorithm: "PBKDF_SHA1", Rounds: 120000}},
+		{PBKDF2SHA256{Rounds: 0}, &internal.HashConfig{HashAlgorithm: "PBKDF2_SHA256"}},
+	}
+	for _, tc := range cases {
+		got, err := tc.alg.Config()
+		if err != nil {
+			t.Errorf("Config(%#v) = %v", tc.alg, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Config(%#v) = %#v; want = %#v", tc.alg, got, tc.want)
+		}
+	}
+}
+
+func TestInvalidHash(t *testing.T) {
+	cases := []hashConfigurer{
+		Scrypt{Rounds: 8, MemoryCost: 14},
+		Scrypt{Key: []byte("key"), Rounds: 0, MemoryCost: 14},
+		Scrypt{Key: []byte("key"), Rounds: 9, MemoryCost: 14},
+		Scrypt{Key: []byte("key"), Rounds: 8, MemoryCost: 0},
+		Scrypt{Key: []byte("key"), Rounds: 8, MemoryCost: 15},
+		HMACMD5{},
+		HMACSHA1{},
+		HMACSHA256{Key: []byte{}},
+		HMACSHA512{},
+		MD5{Rounds: -1},
+		MD5{Rounds: 8193},
+		SHA1{Rounds: 0},
+		SHA256{Rounds: 8193},
+		SHA512{Rounds: 0},
+		PBKDFSHA1{Rounds: -1},
+		PBKDF2SHA256{Rounds: 120001},
+	}
+	for _, alg := range cases {
+		if got, err := alg.Config(); got != nil || err == nil {
+			t.Errorf("Config(%#v) = (%v, %v); want = (nil, error)", alg, got, err)
+		}
+	}
+}
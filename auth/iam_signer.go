@@ -0,0 +1,168 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"firebase.google.com/go/internal"
+)
+
+const (
+	defaultMetadataHost = "http://metadata.google.internal"
+	iamCredentialsURL   = "https://iamcredentials.googleapis.com/v1"
+	metadataTimeout     = 5 * time.Second
+)
+
+// iamSigner signs custom tokens using the signBlob API of the IAM Credentials service. It is used
+// when the SDK is initialized without a service account private key, as is the case when using the
+// credentials of the metadata server on GCE, Cloud Run and GKE.
+//
+// The service account is taken from the credentials if available, and otherwise discovered from the
+// metadata server on first use.
+type iamSigner struct {
+	hc           *internal.HTTPClient // authenticated client for calling signBlob
+	metadata     *internal.HTTPClient // unauthenticated client for querying the metadata server
+	metadataHost string
+	iamHost      string
+
+	mutex       sync.Mutex
+	serviceAcct string
+}
+
+// newIAMSigner creates an iamSigner that calls signBlob with hc. The metadata server is queried
+// without the credentials of hc, but through the same transport, request guard and timeout.
+func newIAMSigner(email string, hc *http.Client, conf *internal.AuthConfig) *iamSigner {
+	metadata := internal.Instrument(unauthorizedClient(conf.Transport), conf.Instrumentation, "auth")
+	metadata = internal.WithGuard(metadata, conf.RequestGuard)
+	return &iamSigner{
+		hc: &internal.HTTPClient{
+			Client:      hc,
+			MaxBodySize: conf.MaxResponseBodySize,
+			Timeout:     conf.RequestTimeout,
+		},
+		metadata: &internal.HTTPClient{
+			Client:      metadata,
+			MaxBodySize: conf.MaxResponseBodySize,
+			Timeout:     conf.RequestTimeout,
+		},
+		metadataHost: defaultMetadataHost,
+		iamHost:      iamCredentialsURL,
+		serviceAcct:  email,
+	}
+}
+
+// WithMetadataHost returns a ClientOption that sets the base URL of the metadata server, which is
+// queried for the service account email when custom tokens are signed without a private key.
+//
+// The default is http://metadata.google.internal. This is useful in networks where the host name
+// does not resolve reliably, and the server must be addressed by IP (e.g. http://169.254.169.254).
+// The option only applies to Clients that sign custom tokens with the IAM service, which is the
+// case when the SDK is initialized without a service account private key outside of App Engine
+// and the Auth emulator. For all other Clients it returns an error.
+func WithMetadataHost(host string) ClientOption {
+	return func(c *Client) error {
+		if host == "" {
+			return errors.New("metadata host must be a non-empty string")
+		}
+		s, ok := c.snr.(*iamSigner)
+		if !ok {
+			return errors.New("metadata host can only be set on clients that sign custom tokens " +
+				"with the iam service")
+		}
+		s.metadataHost = strings.TrimSuffix(host, "/")
+		return nil
+	}
+}
+
+// Email returns the email of the service account used to sign custom tokens.
+func (s *iamSigner) Email(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.serviceAcct != "" {
+		return s.serviceAcct, nil
+	}
+
+	email, err := s.queryMetadata(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to discover the service account email from the metadata server; "+
+			"initialize the SDK with a service account credential instead: %v", err)
+	}
+	s.serviceAcct = email
+	return email, nil
+}
+
+func (s *iamSigner) queryMetadata(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, metadataTimeout)
+	defer cancel()
+	resp, err := s.metadata.Do(ctx, &internal.Request{
+		Method: http.MethodGet,
+		URL:    s.metadataHost + "/computeMetadata/v1/instance/service-accounts/default/email",
+		Opts:   []internal.HTTPOption{internal.WithHeader("Metadata-Flavor", "Google")},
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := resp.CheckStatus(http.StatusOK); err != nil {
+		return "", err
+	}
+	email := strings.TrimSpace(string(resp.Body))
+	if email == "" {
+		return "", errors.New("metadata server returned an empty email")
+	}
+	return email, nil
+}
+
+// Sign signs b with the system-managed private key of the service account.
+func (s *iamSigner) Sign(ctx context.Context, b []byte) ([]byte, error) {
+	email, err := s.Email(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.hc.Do(ctx, &internal.Request{
+		Method: http.MethodPost,
+		URL:    fmt.Sprintf("%s/projects/-/serviceAccounts/%s:signBlob", s.iamHost, email),
+		Body: internal.NewJSONEntity(map[string]interface{}{
+			"payload": base64.StdEncoding.EncodeToString(b),
+		}),
+		// Signing has no side effects, so failed attempts can be retried.
+		Idempotent: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status == http.StatusForbidden {
+		return nil, internal.Errorf(insufficientPermission,
+			"failed to sign custom token: the credentials of the SDK require the "+
+				"iam.serviceAccounts.signBlob permission on the service account %q; reason: %s",
+			email, string(resp.Body))
+	}
+	var result struct {
+		SignedBlob string `json:"signedBlob"`
+	}
+	if err := resp.Unmarshal(http.StatusOK, &result); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(result.SignedBlob)
+}
@@ -0,0 +1,260 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/api/option"
+
+	"firebase.google.com/go/internal"
+)
+
+func newMockIAMServers(t *testing.T, signStatus int) (metadata, iam *httptest.Server) {
+	metadata = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			t.Errorf("Metadata-Flavor = %q; want = %q", r.Header.Get("Metadata-Flavor"), "Google")
+		}
+		if r.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/email" {
+			t.Errorf("Path = %q; want = default service account email", r.URL.Path)
+		}
+		w.Write([]byte("discovered@test.iam.gserviceaccount.com"))
+	}))
+	iam = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Payload string `json:"payload"`
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &req); err != nil {
+			t.Fatal(err)
+		}
+		payload, _ := base64.StdEncoding.DecodeString(req.Payload)
+		w.WriteHeader(signStatus)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keyId":      "key-id",
+			"signedBlob": base64.StdEncoding.EncodeToString(append([]byte("signed:"+r.URL.Path+":"), payload...)),
+		})
+	}))
+	return metadata, iam
+}
+
+func TestIAMSigner(t *testing.T) {
+	metadata, iam := newMockIAMServers(t, http.StatusOK)
+	defer metadata.Close()
+	defer iam.Close()
+
+	cases := []struct {
+		email string
+		want  string
+	}{
+		{"", "discovered@test.iam.gserviceaccount.com"},
+		{"configured@test.iam.gserviceaccount.com", "configured@test.iam.gserviceaccount.com"},
+	}
+	for _, tc := range cases {
+		s := newIAMSigner(tc.email, http.DefaultClient, &internal.AuthConfig{})
+		s.metadataHost = metadata.URL
+		s.iamHost = iam.URL
+
+		email, err := s.Email(ctx)
+		if err != nil || email != tc.want {
+			t.Errorf("Email() = (%q, %v); want = (%q, nil)", email, err, tc.want)
+		}
+		sig, err := s.Sign(ctx, []byte("content"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "signed:/projects/-/serviceAccounts/" + tc.want + ":signBlob:content"
+		if string(sig) != want {
+			t.Errorf("Sign() = %q; want = %q", string(sig), want)
+		}
+	}
+}
+
+func TestIAMSignerPermissionDenied(t *testing.T) {
+	metadata, iam := newMockIAMServers(t, http.StatusForbidden)
+	defer metadata.Close()
+	defer iam.Close()
+
+	s := newIAMSigner("", http.DefaultClient, &internal.AuthConfig{})
+	s.metadataHost = metadata.URL
+	s.iamHost = iam.URL
+	if sig, err := s.Sign(ctx, []byte("content")); sig != nil || !IsInsufficientPermission(err) {
+		t.Errorf("Sign() = (%v, %v); want = (nil, insufficient permission error)", sig, err)
+	}
+}
+
+func TestIAMSignerMetadataError(t *testing.T) {
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer metadata.Close()
+
+	s := newIAMSigner("", http.DefaultClient, &internal.AuthConfig{})
+	s.metadataHost = metadata.URL
+	if email, err := s.Email(ctx); email != "" || err == nil {
+		t.Errorf("Email() = (%q, %v); want = ('', error)", email, err)
+	}
+	if sig, err := s.Sign(ctx, []byte("content")); sig != nil || err == nil {
+		t.Errorf("Sign() = (%v, %v); want = (nil, error)", sig, err)
+	}
+}
+
+func TestIAMSignerCanceledContext(t *testing.T) {
+	metadata, iam := newMockIAMServers(t, http.StatusOK)
+	defer metadata.Close()
+	defer iam.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s := newIAMSigner("configured@test.iam.gserviceaccount.com", http.DefaultClient, &internal.AuthConfig{})
+	s.iamHost = iam.URL
+	if sig, err := s.Sign(ctx, []byte("content")); sig != nil || err == nil {
+		t.Errorf("Sign() = (%v, %v); want = (nil, error)", sig, err)
+	}
+}
+
+func TestIAMSignerMetadataTransport(t *testing.T) {
+	metadata, iam := newMockIAMServers(t, http.StatusOK)
+	defer metadata.Close()
+	defer iam.Close()
+
+	var requests int
+	transport := &mockHTTPResponse{
+		Response: http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader("transport@test.iam.gserviceaccount.com")),
+		},
+	}
+	conf := &internal.AuthConfig{
+		Transport: transport,
+		RequestGuard: func() error {
+			requests++
+			return nil
+		},
+	}
+	s := newIAMSigner("", http.DefaultClient, conf)
+	s.metadataHost = metadata.URL
+	email, err := s.Email(ctx)
+	if err != nil || email != "transport@test.iam.gserviceaccount.com" {
+		t.Errorf("Email() = (%q, %v); want = (%q, nil)", email, err, "transport@test.iam.gserviceaccount.com")
+	}
+	if requests != 1 {
+		t.Errorf("RequestGuard calls = %d; want = 1", requests)
+	}
+
+	conf.RequestGuard = func() error {
+		return errors.New("guard error")
+	}
+	s = newIAMSigner("", http.DefaultClient, conf)
+	if email, err := s.Email(ctx); email != "" || err == nil || !strings.Contains(err.Error(), "guard error") {
+		t.Errorf("Email() = (%q, %v); want = ('', guard error)", email, err)
+	}
+}
+
+func TestCustomTokenWithIAMSigner(t *testing.T) {
+	metadata, iam := newMockIAMServers(t, http.StatusOK)
+	defer metadata.Close()
+	defer iam.Close()
+
+	// AuthConfig without a private key.
+	conf := &internal.AuthConfig{Opts: defaultTestOpts}
+	c, err := NewClient(context.Background(), conf, WithMetadataHost(metadata.URL+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := c.snr.(*iamSigner)
+	if !ok {
+		t.Fatalf("signer = %T; want = *iamSigner", c.snr)
+	}
+	if s.metadataHost != metadata.URL {
+		t.Errorf("metadataHost = %q; want = %q", s.metadataHost, metadata.URL)
+	}
+	s.iamHost = iam.URL
+	s.hc.Client = http.DefaultClient
+
+	token, err := c.CustomToken("user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	var payload customToken
+	if err := decode(jsonDecoder{}, parts[1], &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Iss != "discovered@test.iam.gserviceaccount.com" || payload.UID != "user1" {
+		t.Errorf("CustomToken() = (iss: %q, uid: %q); want = (%q, %q)",
+			payload.Iss, payload.UID, "discovered@test.iam.gserviceaccount.com", "user1")
+	}
+	if got := c.EffectiveConfig().SignerType; got != SignerIAM {
+		t.Errorf("SignerType = %q; want = %q", got, SignerIAM)
+	}
+}
+
+func TestIAMSignerUsesSignerOpts(t *testing.T) {
+	var auth string
+	iam := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"signedBlob": "c2lnbmVk"}`))
+	}))
+	defer iam.Close()
+
+	conf := &internal.AuthConfig{
+		Opts: []option.ClientOption{
+			option.WithTokenSource(&internal.MockTokenSource{AccessToken: "auth-token"}),
+		},
+		SignerOpts: []option.ClientOption{
+			option.WithTokenSource(&internal.MockTokenSource{AccessToken: "signer-token"}),
+		},
+	}
+	c, err := NewClient(context.Background(), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := c.snr.(*iamSigner)
+	s.serviceAcct = "configured@test.iam.gserviceaccount.com"
+	s.iamHost = iam.URL
+
+	if _, err := c.CustomToken("user1"); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Bearer signer-token" {
+		t.Errorf("Authorization = %q; want = %q", auth, "Bearer signer-token")
+	}
+}
+
+func TestInvalidMetadataHost(t *testing.T) {
+	c := &Client{snr: newIAMSigner("", http.DefaultClient, &internal.AuthConfig{})}
+	if err := WithMetadataHost("")(c); err == nil {
+		t.Errorf("WithMetadataHost('') = nil; want = error")
+	}
+}
+
+func TestMetadataHostWithoutIAMSigner(t *testing.T) {
+	for _, snr := range []signer{nil, serviceAcctSigner{}, emulatorSigner{}, verifyOnlySigner{}} {
+		c := &Client{snr: snr}
+		if err := WithMetadataHost("http://169.254.169.254")(c); err == nil {
+			t.Errorf("WithMetadataHost(%T) = nil; want = error", snr)
+		}
+	}
+}
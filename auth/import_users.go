@@ -0,0 +1,301 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"firebase.google.com/go/internal"
+	"golang.org/x/net/context"
+
+	"google.golang.org/api/identitytoolkit/v3"
+)
+
+const maxImportUsers = 1000
+
+// UserToImport is the parameter struct for the ImportUsers function.
+type UserToImport struct {
+	params map[string]interface{}
+}
+
+func (u *UserToImport) set(key string, value interface{}) *UserToImport {
+	if u.params == nil {
+		u.params = make(map[string]interface{})
+	}
+	u.params[key] = value
+	return u
+}
+
+// CustomClaims setter.
+func (u *UserToImport) CustomClaims(cc map[string]interface{}) *UserToImport {
+	return u.set("customClaims", cc)
+}
+
+// Disabled setter.
+func (u *UserToImport) Disabled(d bool) *UserToImport { return u.set("disabled", d) }
+
+// DisplayName setter.
+func (u *UserToImport) DisplayName(dn string) *UserToImport { return u.set("displayName", dn) }
+
+// Email setter.
+func (u *UserToImport) Email(e string) *UserToImport { return u.set("email", e) }
+
+// EmailVerified setter.
+func (u *UserToImport) EmailVerified(ev bool) *UserToImport { return u.set("emailVerified", ev) }
+
+// Metadata setter.
+func (u *UserToImport) Metadata(md *UserMetadata) *UserToImport { return u.set("metadata", md) }
+
+// PasswordHash setter. When set, a hash algorithm must be specified with the WithHash() option.
+func (u *UserToImport) PasswordHash(h []byte) *UserToImport { return u.set("passwordHash", h) }
+
+// PasswordSalt setter.
+func (u *UserToImport) PasswordSalt(s []byte) *UserToImport { return u.set("salt", s) }
+
+// PhoneNumber setter.
+func (u *UserToImport) PhoneNumber(phone string) *UserToImport { return u.set("phoneNumber", phone) }
+
+// PhotoURL setter.
+func (u *UserToImport) PhotoURL(url string) *UserToImport { return u.set("photoUrl", url) }
+
+// ProviderUserInfo setter. Each provider must have a non-empty UID and ProviderID.
+func (u *UserToImport) ProviderUserInfo(providers ...*UserInfo) *UserToImport {
+	return u.set("providerUserInfo", providers)
+}
+
+// UID setter. The UID is required for all imported users.
+func (u *UserToImport) UID(uid string) *UserToImport { return u.set("localId", uid) }
+
+func (u *UserToImport) validatedUserInfo() (*identitytoolkit.UserInfo, error) {
+	params := map[string]interface{}{}
+	for k, v := range u.params {
+		params[k] = v
+	}
+	uid, ok := params["localId"]
+	if !ok {
+		return nil, errors.New("uid must be specified for each user to import")
+	}
+	if err := processClaims(params); err != nil {
+		return nil, err
+	}
+
+	info := &identitytoolkit.UserInfo{}
+	strs := map[string]*string{
+		"localId":     &info.LocalId,
+		"displayName": &info.DisplayName,
+		"email":       &info.Email,
+		"phoneNumber": &info.PhoneNumber,
+		"photoUrl":    &info.PhotoUrl,
+	}
+	for key, f := range strs {
+		if v, ok := params[key]; ok {
+			if err := commonValidators[key](v); err != nil {
+				return nil, fmt.Errorf("user %q: %v", uid, err)
+			}
+			*f = v.(string)
+		}
+	}
+	if v, ok := params["customAttributes"]; ok {
+		info.CustomAttributes = v.(string)
+	}
+	if v, ok := params["disabled"]; ok {
+		info.Disabled = v.(bool)
+	}
+	if v, ok := params["emailVerified"]; ok {
+		info.EmailVerified = v.(bool)
+	}
+	if v, ok := params["metadata"]; ok && v.(*UserMetadata) != nil {
+		info.CreatedAt = v.(*UserMetadata).CreationTimestamp
+		info.LastLoginAt = v.(*UserMetadata).LastLogInTimestamp
+	}
+	if v, ok := params["passwordHash"]; ok {
+		info.PasswordHash = base64.RawURLEncoding.EncodeToString(v.([]byte))
+	}
+	if v, ok := params["salt"]; ok {
+		info.Salt = base64.RawURLEncoding.EncodeToString(v.([]byte))
+	}
+	if v, ok := params["providerUserInfo"]; ok {
+		for _, p := range v.([]*UserInfo) {
+			if p == nil || p.UID == "" || p.ProviderID == "" {
+				return nil, fmt.Errorf("user %q: provider uid and provider id must be non-empty", uid)
+			}
+			info.ProviderUserInfo = append(info.ProviderUserInfo, &identitytoolkit.UserInfoProviderUserInfo{
+				DisplayName: p.DisplayName,
+				Email:       p.Email,
+				PhoneNumber: p.PhoneNumber,
+				PhotoUrl:    p.PhotoURL,
+				ProviderId:  p.ProviderID,
+				RawId:       p.UID,
+			})
+		}
+	}
+	return info, nil
+}
+
+// UserImportHash represents a hash algorithm used to import users with passwords. See the
+// firebase.google.com/go/auth/hash package for the supported algorithms.
+type UserImportHash interface {
+	Config() (*internal.HashConfig, error)
+}
+
+// UserImportOption is an option for the ImportUsers function.
+type UserImportOption interface {
+	applyTo(req *identitytoolkit.IdentitytoolkitRelyingpartyUploadAccountRequest) error
+}
+
+type withHash struct {
+	hash UserImportHash
+}
+
+func (w withHash) applyTo(req *identitytoolkit.IdentitytoolkitRelyingpartyUploadAccountRequest) error {
+	conf, err := w.hash.Config()
+	if err != nil {
+		return err
+	}
+	req.HashAlgorithm = conf.HashAlgorithm
+	req.Rounds = conf.Rounds
+	req.MemoryCost = conf.MemoryCost
+	req.CpuMemCost = conf.CPUMemCost
+	req.BlockSize = conf.BlockSize
+	req.Parallelization = conf.Parallelization
+	req.DkLen = conf.DerivedKeyLength
+	if len(conf.SignerKey) > 0 {
+		req.SignerKey = base64.RawURLEncoding.EncodeToString(conf.SignerKey)
+	}
+	if len(conf.SaltSeparator) > 0 {
+		req.SaltSeparator = base64.RawURLEncoding.EncodeToString(conf.SaltSeparator)
+	}
+	return nil
+}
+
+// WithHash returns a UserImportOption that specifies the hash algorithm used to hash the passwords
+// of the imported users.
+func WithHash(hash UserImportHash) UserImportOption {
+	return withHash{hash}
+}
+
+// UserImportResult describes the outcome of an ImportUsers call.
+type UserImportResult struct {
+	SuccessCount int
+	FailureCount int
+	Errors       []*ErrorInfo
+}
+
+// ErrorInfo describes the failure to import a single user. Index is the position of the user in
+// the list passed to ImportUsers.
+type ErrorInfo struct {
+	Index  int
+	Reason string
+}
+
+// ImportUsers imports the given users into Firebase Auth.
+//
+// At most 1000 users can be imported in a single call, and each user must have a unique UID. If
+// any of the users have a password hash, a hash algorithm must be specified with the WithHash()
+// option. The users are validated before the request is made, and invalid input fails the whole
+// batch. Users rejected by the server are reported in the Errors of the returned
+// UserImportResult, and do not cause ImportUsers to return an error.
+func (c *Client) ImportUsers(
+	ctx context.Context, users []*UserToImport, opts ...UserImportOption) (result *UserImportResult, err error) {
+
+	defer internal.WrapOpError(&err, "ImportUsers", "")
+	if len(users) == 0 {
+		return nil, errors.New("users list must not be empty")
+	}
+	if len(users) > maxImportUsers {
+		return nil, fmt.Errorf("users list must not contain more than %d elements", maxImportUsers)
+	}
+
+	request := &identitytoolkit.IdentitytoolkitRelyingpartyUploadAccountRequest{}
+	hashRequired := false
+	seen := make(map[string]int)
+	for i, u := range users {
+		if u == nil {
+			return nil, fmt.Errorf("user at index %d must not be nil", i)
+		}
+		info, err := u.validatedUserInfo()
+		if err != nil {
+			return nil, err
+		}
+		if info.PasswordHash != "" {
+			hashRequired = true
+		}
+		seen[info.LocalId]++
+		request.Users = append(request.Users, info)
+	}
+	if dups := duplicateUIDs(seen); len(dups) > 0 {
+		return nil, fmt.Errorf("users list must not contain duplicate uids: %q", dups)
+	}
+
+	for _, opt := range opts {
+		if err := opt.applyTo(request); err != nil {
+			return nil, err
+		}
+	}
+	if hashRequired && request.HashAlgorithm == "" {
+		return nil, errors.New("hash algorithm option is required to import users with passwords")
+	}
+
+	resp, err := c.uploadAccount(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	result = &UserImportResult{}
+	for _, e := range resp.Error {
+		result.Errors = append(result.Errors, &ErrorInfo{Index: int(e.Index), Reason: e.Message})
+	}
+	result.FailureCount = len(result.Errors)
+	result.SuccessCount = len(users) - result.FailureCount
+	return result, nil
+}
+
+func (c *Client) uploadAccount(
+	ctx context.Context,
+	request *identitytoolkit.IdentitytoolkitRelyingpartyUploadAccountRequest) (*identitytoolkit.UploadAccountResponse, error) {
+
+	if c.tenantID != "" {
+		var resp identitytoolkit.UploadAccountResponse
+		if err := c.makeTenantUserRequest(ctx, http.MethodPost, "accounts:batchCreate", request, &resp); err != nil {
+			return nil, err
+		}
+		return &resp, nil
+	}
+	if err := c.beforeRequest(ctx); err != nil {
+		return nil, err
+	}
+	call := c.is.Relyingparty.UploadAccount(request)
+	c.setHeader(call)
+	resp, err := call.Context(ctx).Do()
+	if err != nil {
+		return nil, handleServerError(err)
+	}
+	return resp, nil
+}
+
+func duplicateUIDs(counts map[string]int) []string {
+	var dups []string
+	for uid, n := range counts {
+		if n > 1 {
+			dups = append(dups, uid)
+		}
+	}
+	sort.Strings(dups)
+	return dups
+}
@@ -0,0 +1,230 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"firebase.google.com/go/auth/hash"
+)
+
+func TestImportUsers(t *testing.T) {
+	s := echoServer([]byte("{}"), t)
+	defer s.Close()
+
+	users := []*UserToImport{
+		(&UserToImport{}).UID("user1"),
+		(&UserToImport{}).UID("user2").
+			Email("user2@example.com").
+			EmailVerified(true).
+			Disabled(false).
+			DisplayName("User Two").
+			PhoneNumber("+11234567890").
+			PhotoURL("https://example.com/user2.png").
+			CustomClaims(map[string]interface{}{"admin": true}).
+			Metadata(&UserMetadata{CreationTimestamp: 100, LastLogInTimestamp: 200}).
+			ProviderUserInfo(&UserInfo{UID: "google-uid", ProviderID: "google.com", Email: "user2@gmail.com"}),
+	}
+	result, err := s.Client.ImportUsers(ctx, users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SuccessCount != 2 || result.FailureCount != 0 || len(result.Errors) != 0 {
+		t.Errorf("ImportUsers() = %#v; want = {SuccessCount: 2, FailureCount: 0}", result)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(s.Rbody, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"localId": "user1"},
+			map[string]interface{}{
+				"localId":          "user2",
+				"email":            "user2@example.com",
+				"emailVerified":    true,
+				"displayName":      "User Two",
+				"phoneNumber":      "+11234567890",
+				"photoUrl":         "https://example.com/user2.png",
+				"customAttributes": `{"admin":true}`,
+				"createdAt":        "100",
+				"lastLoginAt":      "200",
+				"providerUserInfo": []interface{}{
+					map[string]interface{}{
+						"rawId":      "google-uid",
+						"providerId": "google.com",
+						"email":      "user2@gmail.com",
+					},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportUsers() request = %v; want = %v", got, want)
+	}
+	if !strings.HasSuffix(s.Req[0].URL.Path, "/uploadAccount") {
+		t.Errorf("ImportUsers() path = %q; want = .../uploadAccount", s.Req[0].URL.Path)
+	}
+}
+
+func TestImportUsersWithHash(t *testing.T) {
+	s := echoServer([]byte("{}"), t)
+	defer s.Close()
+
+	users := []*UserToImport{
+		(&UserToImport{}).UID("user1").PasswordHash([]byte("password")).PasswordSalt([]byte("salt")),
+		(&UserToImport{}).UID("user2"),
+	}
+	h := hash.Scrypt{Key: []byte("key"), SaltSeparator: []byte("sep"), Rounds: 8, MemoryCost: 14}
+	result, err := s.Client.ImportUsers(ctx, users, WithHash(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SuccessCount != 2 || result.FailureCount != 0 {
+		t.Errorf("ImportUsers() = %#v; want = {SuccessCount: 2, FailureCount: 0}", result)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(s.Rbody, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"hashAlgorithm": "SCRYPT",
+		"signerKey":     "a2V5",
+		"saltSeparator": "c2Vw",
+		"rounds":        float64(8),
+		"memoryCost":    float64(14),
+		"users": []interface{}{
+			map[string]interface{}{
+				"localId":      "user1",
+				"passwordHash": "cGFzc3dvcmQ",
+				"salt":         "c2FsdA",
+			},
+			map[string]interface{}{"localId": "user2"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportUsers() request = %v; want = %v", got, want)
+	}
+}
+
+func TestImportUsersPartialFailure(t *testing.T) {
+	resp := `{
+		"error": [
+			{"index": 0, "message": "Some error occurred in user1"},
+			{"index": 2, "message": "Another error occurred in user3"}
+		]
+	}`
+	s := echoServer([]byte(resp), t)
+	defer s.Close()
+
+	users := []*UserToImport{
+		(&UserToImport{}).UID("user1"),
+		(&UserToImport{}).UID("user2"),
+		(&UserToImport{}).UID("user3"),
+	}
+	result, err := s.Client.ImportUsers(ctx, users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &UserImportResult{
+		SuccessCount: 1,
+		FailureCount: 2,
+		Errors: []*ErrorInfo{
+			{Index: 0, Reason: "Some error occurred in user1"},
+			{Index: 2, Reason: "Another error occurred in user3"},
+		},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("ImportUsers() = %#v; want = %#v", result, want)
+	}
+}
+
+func TestImportUsersInvalid(t *testing.T) {
+	tooMany := make([]*UserToImport, maxImportUsers+1)
+	for i := range tooMany {
+		tooMany[i] = (&UserToImport{}).UID("user")
+	}
+
+	cases := []struct {
+		name  string
+		users []*UserToImport
+		opts  []UserImportOption
+	}{
+		{"NoUsers", nil, nil},
+		{"TooManyUsers", tooMany, nil},
+		{"NilUser", []*UserToImport{nil}, nil},
+		{"NoUID", []*UserToImport{(&UserToImport{}).Email("user@example.com")}, nil},
+		{"EmptyUID", []*UserToImport{(&UserToImport{}).UID("")}, nil},
+		{"InvalidEmail", []*UserToImport{(&UserToImport{}).UID("user").Email("not-an-email")}, nil},
+		{"InvalidPhone", []*UserToImport{(&UserToImport{}).UID("user").PhoneNumber("1234")}, nil},
+		{"EmptyDisplayName", []*UserToImport{(&UserToImport{}).UID("user").DisplayName("")}, nil},
+		{
+			"ReservedClaim",
+			[]*UserToImport{(&UserToImport{}).UID("user").CustomClaims(map[string]interface{}{"sub": "x"})},
+			nil,
+		},
+		{
+			"InvalidProvider",
+			[]*UserToImport{(&UserToImport{}).UID("user").ProviderUserInfo(&UserInfo{UID: "uid"})},
+			nil,
+		},
+		{
+			"NoHash",
+			[]*UserToImport{(&UserToImport{}).UID("user").PasswordHash([]byte("password"))},
+			nil,
+		},
+		{
+			"InvalidHash",
+			[]*UserToImport{(&UserToImport{}).UID("user").PasswordHash([]byte("password"))},
+			[]UserImportOption{WithHash(hash.HMACSHA256{})},
+		},
+	}
+	for _, tc := range cases {
+		if result, err := client.ImportUsers(ctx, tc.users, tc.opts...); result != nil || err == nil {
+			t.Errorf("ImportUsers(%s) = (%v, %v); want = (nil, error)", tc.name, result, err)
+		}
+	}
+}
+
+func TestImportUsersDuplicateUIDs(t *testing.T) {
+	users := []*UserToImport{
+		(&UserToImport{}).UID("user1"),
+		(&UserToImport{}).UID("user2"),
+		(&UserToImport{}).UID("user1"),
+		(&UserToImport{}).UID("user3"),
+		(&UserToImport{}).UID("user2"),
+	}
+	result, err := client.ImportUsers(ctx, users)
+	we := `ImportUsers: users list must not contain duplicate uids: ["user1" "user2"]`
+	if result != nil || err == nil || err.Error() != we {
+		t.Errorf("ImportUsers() = (%v, %v); want = (nil, %q)", result, err, we)
+	}
+}
+
+func TestImportUsersServerError(t *testing.T) {
+	s := echoServer([]byte(`{"error":{"message":"INTERNAL_ERROR"}}`), t)
+	defer s.Close()
+	s.Status = 500
+
+	users := []*UserToImport{(&UserToImport{}).UID("user1")}
+	if result, err := s.Client.ImportUsers(ctx, users); result != nil || err == nil {
+		t.Errorf("ImportUsers() = (%v, %v); want = (nil, error)", result, err)
+	}
+}
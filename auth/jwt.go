@@ -15,12 +15,13 @@
 package auth
 
 import (
-	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
+
+	"golang.org/x/net/context"
 )
 
 type jwtHeader struct {
@@ -30,36 +31,46 @@ type jwtHeader struct {
 }
 
 type jwtPayload interface {
-	decode(s string) error
+	decode(d jsonDecoder, s string) error
 }
 
 type customToken struct {
-	Iss    string                 `json:"iss"`
-	Aud    string                 `json:"aud"`
-	Exp    int64                  `json:"exp"`
-	Iat    int64                  `json:"iat"`
-	Sub    string                 `json:"sub,omitempty"`
-	UID    string                 `json:"uid,omitempty"`
-	Claims map[string]interface{} `json:"claims,omitempty"`
+	Iss      string                 `json:"iss"`
+	Aud      string                 `json:"aud"`
+	Exp      int64                  `json:"exp"`
+	Iat      int64                  `json:"iat"`
+	Sub      string                 `json:"sub,omitempty"`
+	UID      string                 `json:"uid,omitempty"`
+	TenantID string                 `json:"tenant_id,omitempty"`
+	Claims   map[string]interface{} `json:"claims,omitempty"`
 }
 
-func (p *customToken) decode(s string) error {
-	return decode(s, p)
+func (p *customToken) decode(d jsonDecoder, s string) error {
+	return decode(d, s, p)
 }
 
-func (t *Token) decode(s string) error {
+// decode decodes the claims of an ID token or a session cookie. The claims that Token does not
+// define are reported in its Claims map, so they are accepted even if d is strict.
+func (t *Token) decode(d jsonDecoder, s string) error {
 	claims := make(map[string]interface{})
-	if err := decode(s, &claims); err != nil {
+	if err := decode(d, s, &claims); err != nil {
 		return err
 	}
-	if err := decode(s, t); err != nil {
+	if err := decode(jsonDecoder{}, s, t); err != nil {
 		return err
 	}
 
+	t.hasSubject = claims["sub"] != nil
 	for _, r := range []string{"iss", "aud", "exp", "iat", "sub", "uid"} {
 		delete(claims, r)
 	}
 	t.Claims = claims
+	t.PhoneNumber, _ = claims["phone_number"].(string)
+	if fb, ok := claims["firebase"].(map[string]interface{}); ok {
+		t.SecondFactorIdentifier, _ = fb["sign_in_second_factor"].(string)
+		t.TenantID, _ = fb["tenant"].(string)
+		t.SignInProvider, _ = fb["sign_in_provider"].(string)
+	}
 	return nil
 }
 
@@ -75,15 +86,15 @@ func encode(i interface{}) (string, error) {
 	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
-func decode(s string, i interface{}) error {
+func decode(d jsonDecoder, s string, i interface{}) error {
 	decoded, err := base64.RawURLEncoding.DecodeString(s)
 	if err != nil {
 		return err
 	}
-	return json.NewDecoder(bytes.NewBuffer(decoded)).Decode(i)
+	return d.unmarshal(decoded, i)
 }
 
-func encodeToken(s signer, h jwtHeader, p jwtPayload) (string, error) {
+func encodeToken(ctx context.Context, s signer, h jwtHeader, p jwtPayload) (string, error) {
 	header, err := encode(h)
 	if err != nil {
 		return "", err
@@ -94,42 +105,76 @@ func encodeToken(s signer, h jwtHeader, p jwtPayload) (string, error) {
 	}
 
 	ss := fmt.Sprintf("%s.%s", header, payload)
-	sig, err := s.Sign([]byte(ss))
+	sig, err := s.Sign(ctx, []byte(ss))
 	if err != nil {
 		return "", err
 	}
 	return fmt.Sprintf("%s.%s", ss, base64.RawURLEncoding.EncodeToString(sig)), nil
 }
 
-func decodeToken(token string, ks keySource, h *jwtHeader, p jwtPayload) error {
-	s := strings.Split(token, ".")
-	if len(s) != 3 {
-		return errors.New("incorrect number of segments")
-	}
+// errTokenSignature is returned when none of the available public keys verifies the signature of
+// a token.
+var errTokenSignature = errors.New("failed to verify token signature")
 
-	if err := decode(s[0], h); err != nil {
-		return err
-	}
-	if err := p.decode(s[1]); err != nil {
+func decodeToken(
+	ctx context.Context, token string, ks KeySource, sv SignatureVerifier, d jsonDecoder,
+	h *jwtHeader, p jwtPayload) error {
+
+	s, err := decodeUnverifiedToken(token, d, h, p)
+	if err != nil {
 		return err
 	}
+	return verifyTokenSignature(ctx, s, ks, sv, h)
+}
 
-	keys, err := ks.Keys()
+// verifyTokenSignature verifies the signature of the token with the given segments using the keys
+// of ks. It returns errTokenSignature if no key verifies the signature.
+//
+// If ks pins a set of keys, these are tried first, and the keys of the fallback key source are only
+// fetched when none of the pinned keys verifies the signature.
+func verifyTokenSignature(ctx context.Context, s []string, ks KeySource, sv SignatureVerifier, h *jwtHeader) error {
+	if p, ok := ks.(*pinnedKeySource); ok {
+		if verifyWithKeys(s, p.pinned, sv, h) {
+			return nil
+		}
+		ks = p.fallback
+	}
+	keys, err := ks.Keys(ctx)
 	if err != nil {
 		return err
 	}
-	verified := false
+	if !verifyWithKeys(s, keys, sv, h) {
+		return errTokenSignature
+	}
+	return nil
+}
+
+// verifyWithKeys reports whether any of the given keys verifies the signature of the token with the
+// given segments.
+func verifyWithKeys(s []string, keys []*PublicKey, sv SignatureVerifier, h *jwtHeader) bool {
 	for _, k := range keys {
 		if h.KeyID == "" || h.KeyID == k.Kid {
-			if verifySignature(s, k) == nil {
-				verified = true
-				break
+			if verifySignature(sv, h.Algorithm, s, k) == nil {
+				return true
 			}
 		}
 	}
+	return false
+}
+
+// decodeUnverifiedToken decodes the header and the payload of token without verifying its
+// signature, and returns the segments of the token. The segments are decoded with d.
+func decodeUnverifiedToken(token string, d jsonDecoder, h *jwtHeader, p jwtPayload) ([]string, error) {
+	s := strings.Split(token, ".")
+	if len(s) != 3 {
+		return nil, errors.New("incorrect number of segments")
+	}
 
-	if !verified {
-		return errors.New("failed to verify token signature")
+	if err := decode(d, s[0], h); err != nil {
+		return nil, err
 	}
-	return nil
+	if err := p.decode(d, s[1]); err != nil {
+		return nil, err
+	}
+	return s, nil
 }
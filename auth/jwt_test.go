@@ -19,12 +19,14 @@ import (
 	"errors"
 	"strings"
 	"testing"
+
+	"golang.org/x/net/context"
 )
 
 func TestEncodeToken(t *testing.T) {
 	h := defaultHeader()
 	p := mockIDTokenPayload{"key": "value"}
-	s, err := encodeToken(&mockSigner{}, h, p)
+	s, err := encodeToken(ctx, &mockSigner{}, h, p)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -34,14 +36,14 @@ func TestEncodeToken(t *testing.T) {
 	}
 
 	var header jwtHeader
-	if err := decode(parts[0], &header); err != nil {
+	if err := decode(jsonDecoder{}, parts[0], &header); err != nil {
 		t.Fatal(err)
 	} else if h != header {
 		t.Errorf("decode(header) = %v; want = %v", header, h)
 	}
 
 	payload := make(mockIDTokenPayload)
-	if err := decode(parts[1], &payload); err != nil {
+	if err := decode(jsonDecoder{}, parts[1], &payload); err != nil {
 		t.Fatal(err)
 	} else if len(payload) != 1 || payload["key"] != "value" {
 		t.Errorf("decode(payload) = %v; want = %v", payload, p)
@@ -60,7 +62,7 @@ func TestEncodeSignError(t *testing.T) {
 	signer := &mockSigner{
 		err: errors.New("sign error"),
 	}
-	if s, err := encodeToken(signer, h, p); s != "" || err == nil {
+	if s, err := encodeToken(ctx, signer, h, p); s != "" || err == nil {
 		t.Errorf("encodeToken() = (%v, %v); want = ('', error)", s, err)
 	}
 }
@@ -68,7 +70,7 @@ func TestEncodeSignError(t *testing.T) {
 func TestEncodeInvalidPayload(t *testing.T) {
 	h := defaultHeader()
 	p := mockIDTokenPayload{"key": func() {}}
-	if s, err := encodeToken(&mockSigner{}, h, p); s != "" || err == nil {
+	if s, err := encodeToken(ctx, &mockSigner{}, h, p); s != "" || err == nil {
 		t.Errorf("encodeToken() = (%v, %v); want = ('', error)", s, err)
 	}
 }
@@ -77,11 +79,11 @@ type mockSigner struct {
 	err error
 }
 
-func (s *mockSigner) Email() (string, error) {
+func (s *mockSigner) Email(ctx context.Context) (string, error) {
 	return "", nil
 }
 
-func (s *mockSigner) Sign(b []byte) ([]byte, error) {
+func (s *mockSigner) Sign(ctx context.Context, b []byte) ([]byte, error) {
 	if s.err != nil {
 		return nil, s.err
 	}
@@ -0,0 +1,209 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+)
+
+const encryptedPKCS8BlockType = "ENCRYPTED PRIVATE KEY"
+const keyPassphraseEnvVar = "FIREBASE_PRIVATE_KEY_PASSPHRASE"
+
+// maxPBKDF2Iterations bounds the work done to derive the key of an encrypted private key, so that
+// a corrupt or malicious key file cannot stall NewClient. It is far above the counts used by
+// common tools (OpenSSL defaults to 2048).
+const maxPBKDF2Iterations = 10000000
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// WithPrivateKeyPassphrase returns a ClientOption that sets the passphrase of an encrypted service
+// account private key.
+//
+// Private keys stored as encrypted PKCS8 ("ENCRYPTED PRIVATE KEY") PEM blocks are decrypted with
+// this passphrase before they are used to sign custom tokens. If the option is not set, the
+// passphrase is read from the FIREBASE_PRIVATE_KEY_PASSPHRASE environment variable. Unencrypted
+// keys do not require a passphrase. Keys must be encrypted using PBES2, with PBKDF2 and AES-CBC.
+func WithPrivateKeyPassphrase(passphrase string) ClientOption {
+	return func(c *Client) error {
+		if passphrase == "" {
+			return errors.New("private key passphrase must be a non-empty string")
+		}
+		c.keyPassphrase = passphrase
+		return nil
+	}
+}
+
+func (c *Client) privateKeyPassphrase() string {
+	if c.keyPassphrase != "" {
+		return c.keyPassphrase
+	}
+	return os.Getenv(keyPassphraseEnvVar)
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8 decrypts the DER encoded EncryptedPrivateKeyInfo structure of RFC 5208, and returns
+// the DER encoded PKCS8 private key it contains.
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if err := unmarshalDER(der, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse encrypted private key: %v", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption algorithm: %v; only PBES2 is supported",
+			info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if err := unmarshalDER(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("failed to parse private key encryption parameters: %v", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported private key derivation function: %v; only PBKDF2 is supported",
+			params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if err := unmarshalDER(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("failed to parse private key derivation parameters: %v", err)
+	}
+	var prf func() hash.Hash
+	switch {
+	case len(kdf.PRF.Algorithm) == 0, kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported private key derivation PRF: %v", kdf.PRF.Algorithm)
+	}
+
+	var keyLen int
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keyLen = 16
+	case scheme.Equal(oidAES192CBC):
+		keyLen = 24
+	case scheme.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, fmt.Errorf("unsupported private key encryption scheme: %v; only AES-CBC is supported", scheme)
+	}
+	var iv []byte
+	if err := unmarshalDER(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("failed to parse private key encryption IV: %v", err)
+	}
+	if kdf.IterationCount <= 0 || len(iv) != aes.BlockSize ||
+		len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, errors.New("malformed encrypted private key")
+	}
+	if kdf.IterationCount > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("private key derivation iteration count must not exceed %d: %d",
+			maxPBKDF2Iterations, kdf.IterationCount)
+	}
+	if kdf.KeyLength != 0 && kdf.KeyLength != keyLen {
+		return nil, fmt.Errorf("private key derivation key length %d does not match the encryption scheme; "+
+			"want %d", kdf.KeyLength, keyLen)
+	}
+
+	block, err := aes.NewCipher(pbkdf2(prf, passphrase, kdf.Salt, kdf.IterationCount, keyLen))
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, info.EncryptedData)
+
+	// Strip the PKCS7 padding. Invalid padding almost always means that the passphrase is wrong.
+	pad := int(data[len(data)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return nil, errors.New("failed to decrypt private key; the passphrase may be incorrect")
+	}
+	for _, b := range data[len(data)-pad:] {
+		if int(b) != pad {
+			return nil, errors.New("failed to decrypt private key; the passphrase may be incorrect")
+		}
+	}
+	return data[:len(data)-pad], nil
+}
+
+// unmarshalDER parses the DER encoded value b into v, and rejects any trailing data.
+func unmarshalDER(b []byte, v interface{}) error {
+	rest, err := asn1.Unmarshal(b, v)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errors.New("trailing data")
+	}
+	return nil
+}
+
+// pbkdf2 derives a key of keyLen bytes from the password and the salt as described in RFC 8018.
+func pbkdf2(prf func() hash.Hash, password, salt []byte, iter, keyLen int) []byte {
+	mac := hmac.New(prf, password)
+	var key []byte
+	buf := make([]byte, 4)
+	for i := uint32(1); len(key) < keyLen; i++ {
+		mac.Reset()
+		mac.Write(salt)
+		binary.BigEndian.PutUint32(buf, i)
+		mac.Write(buf)
+		u := mac.Sum(nil)
+		t := make([]byte, len(u))
+		copy(t, u)
+		for n := 1; n < iter; n++ {
+			mac.Reset()
+			mac.Write(u)
+			u = mac.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
@@ -0,0 +1,177 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/net/context"
+
+	"firebase.google.com/go/internal"
+)
+
+// SMSRegionConfig specifies the regions that users can receive SMS messages from Firebase Auth in,
+// e.g. for phone sign-in and multi-factor authentication.
+//
+// Regions are identified by their ISO 3166-1 alpha-2 codes (e.g. "US"). If AllowByDefault is true,
+// SMS messages can be sent to all regions except DisallowedRegions, and AllowedRegions must be
+// empty. Otherwise SMS messages can only be sent to AllowedRegions, and DisallowedRegions must be
+// empty.
+type SMSRegionConfig struct {
+	AllowByDefault    bool
+	AllowedRegions    []string
+	DisallowedRegions []string
+}
+
+func (c *SMSRegionConfig) validate() error {
+	if c == nil {
+		return errors.New("sms region config must not be nil")
+	}
+	if c.AllowByDefault && len(c.AllowedRegions) > 0 {
+		return errors.New("allowed regions must not be specified when allowing all regions by default")
+	}
+	if !c.AllowByDefault && len(c.DisallowedRegions) > 0 {
+		return errors.New("disallowed regions must only be specified when allowing all regions by default")
+	}
+	for _, r := range append(append([]string(nil), c.AllowedRegions...), c.DisallowedRegions...) {
+		if err := validateRegionCode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRegionCode checks that code is formatted as an ISO 3166-1 alpha-2 code. Whether the code
+// is actually assigned to a region is checked by the server.
+func validateRegionCode(code string) error {
+	if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return fmt.Errorf("region code must be an ISO 3166-1 alpha-2 code (e.g. \"US\"): %q", code)
+	}
+	return nil
+}
+
+type smsRegionConfigResource struct {
+	AllowByDefault *smsAllowByDefault `json:"allowByDefault,omitempty"`
+	AllowlistOnly  *smsAllowlistOnly  `json:"allowlistOnly,omitempty"`
+}
+
+type smsAllowByDefault struct {
+	DisallowedRegions []string `json:"disallowedRegions,omitempty"`
+}
+
+type smsAllowlistOnly struct {
+	AllowedRegions []string `json:"allowedRegions,omitempty"`
+}
+
+func (r *smsRegionConfigResource) toConfig() *SMSRegionConfig {
+	config := &SMSRegionConfig{}
+	if r.AllowByDefault != nil {
+		config.AllowByDefault = true
+		config.DisallowedRegions = r.AllowByDefault.DisallowedRegions
+	} else if r.AllowlistOnly != nil {
+		config.AllowedRegions = r.AllowlistOnly.AllowedRegions
+	}
+	return config
+}
+
+func newSMSRegionConfigResource(c *SMSRegionConfig) *smsRegionConfigResource {
+	if c.AllowByDefault {
+		return &smsRegionConfigResource{
+			AllowByDefault: &smsAllowByDefault{DisallowedRegions: c.DisallowedRegions},
+		}
+	}
+	return &smsRegionConfigResource{
+		AllowlistOnly: &smsAllowlistOnly{AllowedRegions: c.AllowedRegions},
+	}
+}
+
+type projectConfig struct {
+	SMSRegionConfig *smsRegionConfigResource `json:"smsRegionConfig,omitempty"`
+}
+
+// GetSMSRegionConfig returns the SMS region config of the project.
+//
+// Managing the SMS region config requires Google Cloud Identity Platform.
+func (c *Client) GetSMSRegionConfig(ctx context.Context) (config *SMSRegionConfig, err error) {
+	defer internal.WrapOpError(&err, "GetSMSRegionConfig", "")
+	pc, err := c.makeProjectConfigRequest(ctx, http.MethodGet, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if pc.SMSRegionConfig == nil {
+		return &SMSRegionConfig{AllowByDefault: true}, nil
+	}
+	return pc.SMSRegionConfig.toConfig(), nil
+}
+
+// UpdateSMSRegionConfig replaces the SMS region config of the project, and returns the updated
+// config.
+//
+// Managing the SMS region config requires Google Cloud Identity Platform.
+func (c *Client) UpdateSMSRegionConfig(
+	ctx context.Context, config *SMSRegionConfig) (updated *SMSRegionConfig, err error) {
+
+	defer internal.WrapOpError(&err, "UpdateSMSRegionConfig", "")
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	req := &projectConfig{SMSRegionConfig: newSMSRegionConfigResource(config)}
+	pc, err := c.makeProjectConfigRequest(ctx, http.MethodPatch, req, []internal.HTTPOption{
+		internal.WithQueryParam("updateMask", "smsRegionConfig"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pc.SMSRegionConfig == nil {
+		return &SMSRegionConfig{AllowByDefault: true}, nil
+	}
+	return pc.SMSRegionConfig.toConfig(), nil
+}
+
+func (c *Client) makeProjectConfigRequest(
+	ctx context.Context, method string, body *projectConfig, opts []internal.HTTPOption) (*projectConfig, error) {
+
+	if c.projectID == "" {
+		return nil, errors.New("project id not available")
+	}
+	if err := c.beforeRequest(ctx); err != nil {
+		return nil, err
+	}
+
+	request := &internal.Request{
+		Method: method,
+		URL:    fmt.Sprintf("%s/projects/%s/config", c.projectEndpoint, c.projectID),
+		Opts:   append(opts, internal.WithHeader("X-Client-Version", c.version)),
+	}
+	if body != nil {
+		request.Body = internal.NewJSONEntity(body)
+	}
+	resp, err := c.adminClient.Do(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != http.StatusOK {
+		return nil, handleHTTPError(resp)
+	}
+
+	var result projectConfig
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestGetSMSRegionConfig(t *testing.T) {
+	cases := []struct {
+		resp string
+		want *SMSRegionConfig
+	}{
+		{
+			`{"smsRegionConfig": {"allowByDefault": {"disallowedRegions": ["AC", "AD"]}}}`,
+			&SMSRegionConfig{AllowByDefault: true, DisallowedRegions: []string{"AC", "AD"}},
+		},
+		{
+			`{"smsRegionConfig": {"allowlistOnly": {"allowedRegions": ["US"]}}}`,
+			&SMSRegionConfig{AllowedRegions: []string{"US"}},
+		},
+		{
+			`{"smsRegionConfig": {"allowByDefault": {}}}`,
+			&SMSRegionConfig{AllowByDefault: true},
+		},
+		{
+			`{"name": "projects/mock-project-id/config"}`,
+			&SMSRegionConfig{AllowByDefault: true},
+		},
+	}
+	for _, tc := range cases {
+		s := echoServer([]byte(tc.resp), t)
+		s.Client.projectEndpoint = s.Srv.URL
+		config, err := s.Client.GetSMSRegionConfig(context.Background())
+		s.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(config, tc.want) {
+			t.Errorf("GetSMSRegionConfig() = %#v; want = %#v", config, tc.want)
+		}
+		req := s.Req[0]
+		if req.Method != http.MethodGet || req.URL.Path != "/projects/mock-project-id/config" {
+			t.Errorf("GetSMSRegionConfig() = %s %s; want = GET /projects/mock-project-id/config",
+				req.Method, req.URL.Path)
+		}
+	}
+}
+
+func TestUpdateSMSRegionConfig(t *testing.T) {
+	cases := []struct {
+		config *SMSRegionConfig
+		body   string
+	}{
+		{
+			&SMSRegionConfig{AllowByDefault: true, DisallowedRegions: []string{"AC"}},
+			`{"smsRegionConfig":{"allowByDefault":{"disallowedRegions":["AC"]}}}`,
+		},
+		{
+			&SMSRegionConfig{AllowedRegions: []string{"US", "CA"}},
+			`{"smsRegionConfig":{"allowlistOnly":{"allowedRegions":["US","CA"]}}}`,
+		},
+	}
+	for _, tc := range cases {
+		s := echoServer([]byte(tc.body), t)
+		s.Client.projectEndpoint = s.Srv.URL
+		config, err := s.Client.UpdateSMSRegionConfig(context.Background(), tc.config)
+		s.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(config, tc.config) {
+			t.Errorf("UpdateSMSRegionConfig() = %#v; want = %#v", config, tc.config)
+		}
+		if string(s.Rbody) != tc.body {
+			t.Errorf("UpdateSMSRegionConfig() body = %s; want = %s", string(s.Rbody), tc.body)
+		}
+		req := s.Req[0]
+		if req.Method != http.MethodPatch || req.URL.Query().Get("updateMask") != "smsRegionConfig" {
+			t.Errorf("UpdateSMSRegionConfig() = %s %s; want = PATCH with updateMask", req.Method, req.URL)
+		}
+	}
+}
+
+func TestInvalidSMSRegionConfig(t *testing.T) {
+	cases := []*SMSRegionConfig{
+		nil,
+		{AllowByDefault: true, AllowedRegions: []string{"US"}},
+		{DisallowedRegions: []string{"US"}},
+		{AllowedRegions: []string{"us"}},
+		{AllowedRegions: []string{"USA"}},
+		{AllowByDefault: true, DisallowedRegions: []string{""}},
+	}
+	for _, config := range cases {
+		if got, err := client.UpdateSMSRegionConfig(context.Background(), config); got != nil || err == nil {
+			t.Errorf("UpdateSMSRegionConfig(%#v) = (%v, %v); want = (nil, error)", config, got, err)
+		}
+	}
+}
+
+func TestSMSRegionConfigError(t *testing.T) {
+	s := echoServer([]byte(`{"error": {"message": "PROJECT_NOT_FOUND : no such project"}}`), t)
+	defer s.Close()
+	s.Status = http.StatusNotFound
+	s.Client.projectEndpoint = s.Srv.URL
+	config, err := s.Client.GetSMSRegionConfig(context.Background())
+	if config != nil || !IsProjectNotFound(err) {
+		t.Errorf("GetSMSRegionConfig() = (%v, %v); want = (nil, project not found error)", config, err)
+	}
+}
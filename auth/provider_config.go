@@ -0,0 +1,832 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/api/iterator"
+
+	"firebase.google.com/go/internal"
+)
+
+const (
+	maxProviderConfigResults = 100
+
+	oidcCollection = "oauthIdpConfigs"
+	oidcIDParam    = "oauthIdpConfigId"
+	oidcPrefix     = "oidc."
+	samlCollection = "inboundSamlConfigs"
+	samlIDParam    = "inboundSamlConfigId"
+	samlPrefix     = "saml."
+
+	clientIDKey        = "clientId"
+	displayNameKey     = "displayName"
+	enabledKey         = "enabled"
+	idpCertificatesKey = "idpConfig.idpCertificates"
+	idpEntityIDKey     = "idpConfig.idpEntityId"
+	issuerKey          = "issuer"
+	signRequestKey     = "idpConfig.signRequest"
+	spCallbackURIKey   = "spConfig.callbackUri"
+	spEntityIDKey      = "spConfig.spEntityId"
+	ssoURLKey          = "idpConfig.ssoUrl"
+)
+
+// OIDCProviderConfig is the configuration of an OpenID Connect (OIDC) identity provider.
+type OIDCProviderConfig struct {
+	ID          string
+	DisplayName string
+	Enabled     bool
+	ClientID    string
+	Issuer      string
+}
+
+// SAMLProviderConfig is the configuration of a SAML identity provider.
+//
+// IDPEntityID, SSOURL and X509Certificates describe the identity provider (IdP). RPEntityID and
+// CallbackURL describe the Firebase project as the relying party (RP) of the IdP.
+type SAMLProviderConfig struct {
+	ID                    string
+	DisplayName           string
+	Enabled               bool
+	IDPEntityID           string
+	SSOURL                string
+	RequestSigningEnabled bool
+	X509Certificates      []string
+	RPEntityID            string
+	CallbackURL           string
+}
+
+func (c *SAMLProviderConfig) copy() *SAMLProviderConfig {
+	cp := *c
+	cp.X509Certificates = append([]string(nil), c.X509Certificates...)
+	return &cp
+}
+
+type oidcProviderConfigResource struct {
+	Name        string `json:"name"`
+	ClientID    string `json:"clientId"`
+	Issuer      string `json:"issuer"`
+	DisplayName string `json:"displayName"`
+	Enabled     bool   `json:"enabled"`
+}
+
+func (r *oidcProviderConfigResource) toConfig() *OIDCProviderConfig {
+	return &OIDCProviderConfig{
+		ID:          r.Name[strings.LastIndex(r.Name, "/")+1:],
+		DisplayName: r.DisplayName,
+		Enabled:     r.Enabled,
+		ClientID:    r.ClientID,
+		Issuer:      r.Issuer,
+	}
+}
+
+type samlProviderConfigResource struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Enabled     bool   `json:"enabled"`
+	IDPConfig   struct {
+		IDPEntityID     string `json:"idpEntityId"`
+		SSOURL          string `json:"ssoUrl"`
+		SignRequest     bool   `json:"signRequest"`
+		IDPCertificates []struct {
+			X509Certificate string `json:"x509Certificate"`
+		} `json:"idpCertificates"`
+	} `json:"idpConfig"`
+	SPConfig struct {
+		SPEntityID  string `json:"spEntityId"`
+		CallbackURI string `json:"callbackUri"`
+	} `json:"spConfig"`
+}
+
+func (r *samlProviderConfigResource) toConfig() *SAMLProviderConfig {
+	var certs []string
+	for _, cert := range r.IDPConfig.IDPCertificates {
+		certs = append(certs, cert.X509Certificate)
+	}
+	return &SAMLProviderConfig{
+		ID:                    r.Name[strings.LastIndex(r.Name, "/")+1:],
+		DisplayName:           r.DisplayName,
+		Enabled:               r.Enabled,
+		IDPEntityID:           r.IDPConfig.IDPEntityID,
+		SSOURL:                r.IDPConfig.SSOURL,
+		RequestSigningEnabled: r.IDPConfig.SignRequest,
+		X509Certificates:      certs,
+		RPEntityID:            r.SPConfig.SPEntityID,
+		CallbackURL:           r.SPConfig.CallbackURI,
+	}
+}
+
+// providerParams holds the fields of a provider config to be created or updated, keyed by their
+// dot-separated paths in the provider config resource (e.g. "idpConfig.ssoUrl").
+type providerParams map[string]interface{}
+
+func (p *providerParams) set(key string, value interface{}) {
+	if *p == nil {
+		*p = make(providerParams)
+	}
+	(*p)[key] = value
+}
+
+// validate checks the set fields, and that all the required fields are set.
+func (p providerParams) validate(required ...string) error {
+	for _, key := range required {
+		if _, ok := p[key]; !ok {
+			return fmt.Errorf("%s must be specified", providerParamNames[key])
+		}
+	}
+	for key, val := range p {
+		switch v := val.(type) {
+		case string:
+			if v == "" {
+				return fmt.Errorf("%s must be a non-empty string", providerParamNames[key])
+			}
+			if key == issuerKey || key == ssoURLKey || key == spCallbackURIKey {
+				if u, err := url.ParseRequestURI(v); err != nil || u.Host == "" {
+					return fmt.Errorf("%s must be a valid URL: %q", providerParamNames[key], v)
+				}
+			}
+		case []map[string]string:
+			if len(v) == 0 {
+				return fmt.Errorf("%s must not be empty", providerParamNames[key])
+			}
+			for _, cert := range v {
+				if cert["x509Certificate"] == "" {
+					return fmt.Errorf("%s must not contain empty strings", providerParamNames[key])
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// updateMask returns the sorted, comma-separated paths of the set fields.
+func (p providerParams) updateMask() string {
+	var keys []string
+	for key := range p {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// body returns the set fields as a nested map, to be sent as a request body.
+func (p providerParams) body() map[string]interface{} {
+	body := make(map[string]interface{})
+	for key, val := range p {
+		segs := strings.Split(key, ".")
+		m := body
+		for _, seg := range segs[:len(segs)-1] {
+			child, ok := m[seg].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				m[seg] = child
+			}
+			m = child
+		}
+		m[segs[len(segs)-1]] = val
+	}
+	return body
+}
+
+var providerParamNames = map[string]string{
+	clientIDKey:        "client id",
+	displayNameKey:     "display name",
+	idpCertificatesKey: "x509 certificates",
+	idpEntityIDKey:     "idp entity id",
+	issuerKey:          "issuer",
+	spCallbackURIKey:   "callback url",
+	spEntityIDKey:      "rp entity id",
+	ssoURLKey:          "sso url",
+}
+
+func newCertificates(certs []string) []map[string]string {
+	result := make([]map[string]string, len(certs))
+	for i, cert := range certs {
+		result[i] = map[string]string{"x509Certificate": cert}
+	}
+	return result
+}
+
+// OIDCProviderConfigToCreate is the parameter struct for the CreateOIDCProviderConfig function.
+type OIDCProviderConfigToCreate struct {
+	id     string
+	params providerParams
+}
+
+// ID setter. The ID must start with "oidc.".
+func (c *OIDCProviderConfigToCreate) ID(id string) *OIDCProviderConfigToCreate {
+	c.id = id
+	return c
+}
+
+// DisplayName setter.
+func (c *OIDCProviderConfigToCreate) DisplayName(name string) *OIDCProviderConfigToCreate {
+	c.params.set(displayNameKey, name)
+	return c
+}
+
+// Enabled setter.
+func (c *OIDCProviderConfigToCreate) Enabled(enabled bool) *OIDCProviderConfigToCreate {
+	c.params.set(enabledKey, enabled)
+	return c
+}
+
+// ClientID setter.
+func (c *OIDCProviderConfigToCreate) ClientID(clientID string) *OIDCProviderConfigToCreate {
+	c.params.set(clientIDKey, clientID)
+	return c
+}
+
+// Issuer setter.
+func (c *OIDCProviderConfigToCreate) Issuer(issuer string) *OIDCProviderConfigToCreate {
+	c.params.set(issuerKey, issuer)
+	return c
+}
+
+// OIDCProviderConfigToUpdate is the parameter struct for the UpdateOIDCProviderConfig function.
+type OIDCProviderConfigToUpdate struct {
+	params providerParams
+}
+
+// DisplayName setter.
+func (c *OIDCProviderConfigToUpdate) DisplayName(name string) *OIDCProviderConfigToUpdate {
+	c.params.set(displayNameKey, name)
+	return c
+}
+
+// Enabled setter.
+func (c *OIDCProviderConfigToUpdate) Enabled(enabled bool) *OIDCProviderConfigToUpdate {
+	c.params.set(enabledKey, enabled)
+	return c
+}
+
+// ClientID setter.
+func (c *OIDCProviderConfigToUpdate) ClientID(clientID string) *OIDCProviderConfigToUpdate {
+	c.params.set(clientIDKey, clientID)
+	return c
+}
+
+// Issuer setter.
+func (c *OIDCProviderConfigToUpdate) Issuer(issuer string) *OIDCProviderConfigToUpdate {
+	c.params.set(issuerKey, issuer)
+	return c
+}
+
+// SAMLProviderConfigToCreate is the parameter struct for the CreateSAMLProviderConfig function.
+type SAMLProviderConfigToCreate struct {
+	id     string
+	params providerParams
+}
+
+// ID setter. The ID must start with "saml.".
+func (c *SAMLProviderConfigToCreate) ID(id string) *SAMLProviderConfigToCreate {
+	c.id = id
+	return c
+}
+
+// DisplayName setter.
+func (c *SAMLProviderConfigToCreate) DisplayName(name string) *SAMLProviderConfigToCreate {
+	c.params.set(displayNameKey, name)
+	return c
+}
+
+// Enabled setter.
+func (c *SAMLProviderConfigToCreate) Enabled(enabled bool) *SAMLProviderConfigToCreate {
+	c.params.set(enabledKey, enabled)
+	return c
+}
+
+// IDPEntityID setter.
+func (c *SAMLProviderConfigToCreate) IDPEntityID(entityID string) *SAMLProviderConfigToCreate {
+	c.params.set(idpEntityIDKey, entityID)
+	return c
+}
+
+// SSOURL setter.
+func (c *SAMLProviderConfigToCreate) SSOURL(url string) *SAMLProviderConfigToCreate {
+	c.params.set(ssoURLKey, url)
+	return c
+}
+
+// RequestSigningEnabled setter.
+func (c *SAMLProviderConfigToCreate) RequestSigningEnabled(enabled bool) *SAMLProviderConfigToCreate {
+	c.params.set(signRequestKey, enabled)
+	return c
+}
+
+// X509Certificates setter.
+func (c *SAMLProviderConfigToCreate) X509Certificates(certs []string) *SAMLProviderConfigToCreate {
+	c.params.set(idpCertificatesKey, newCertificates(certs))
+	return c
+}
+
+// RPEntityID setter.
+func (c *SAMLProviderConfigToCreate) RPEntityID(entityID string) *SAMLProviderConfigToCreate {
+	c.params.set(spEntityIDKey, entityID)
+	return c
+}
+
+// CallbackURL setter.
+func (c *SAMLProviderConfigToCreate) CallbackURL(url string) *SAMLProviderConfigToCreate {
+	c.params.set(spCallbackURIKey, url)
+	return c
+}
+
+// SAMLProviderConfigToUpdate is the parameter struct for the UpdateSAMLProviderConfig function.
+type SAMLProviderConfigToUpdate struct {
+	params providerParams
+}
+
+// DisplayName setter.
+func (c *SAMLProviderConfigToUpdate) DisplayName(name string) *SAMLProviderConfigToUpdate {
+	c.params.set(displayNameKey, name)
+	return c
+}
+
+// Enabled setter.
+func (c *SAMLProviderConfigToUpdate) Enabled(enabled bool) *SAMLProviderConfigToUpdate {
+	c.params.set(enabledKey, enabled)
+	return c
+}
+
+// IDPEntityID setter.
+func (c *SAMLProviderConfigToUpdate) IDPEntityID(entityID string) *SAMLProviderConfigToUpdate {
+	c.params.set(idpEntityIDKey, entityID)
+	return c
+}
+
+// SSOURL setter.
+func (c *SAMLProviderConfigToUpdate) SSOURL(url string) *SAMLProviderConfigToUpdate {
+	c.params.set(ssoURLKey, url)
+	return c
+}
+
+// RequestSigningEnabled setter.
+func (c *SAMLProviderConfigToUpdate) RequestSigningEnabled(enabled bool) *SAMLProviderConfigToUpdate {
+	c.params.set(signRequestKey, enabled)
+	return c
+}
+
+// X509Certificates setter.
+func (c *SAMLProviderConfigToUpdate) X509Certificates(certs []string) *SAMLProviderConfigToUpdate {
+	c.params.set(idpCertificatesKey, newCertificates(certs))
+	return c
+}
+
+// RPEntityID setter.
+func (c *SAMLProviderConfigToUpdate) RPEntityID(entityID string) *SAMLProviderConfigToUpdate {
+	c.params.set(spEntityIDKey, entityID)
+	return c
+}
+
+// CallbackURL setter.
+func (c *SAMLProviderConfigToUpdate) CallbackURL(url string) *SAMLProviderConfigToUpdate {
+	c.params.set(spCallbackURIKey, url)
+	return c
+}
+
+// OIDCProviderConfig returns the OIDC provider config with the specified ID.
+func (c *Client) OIDCProviderConfig(ctx context.Context, id string) (config *OIDCProviderConfig, err error) {
+	defer internal.WrapOpError(&err, "OIDCProviderConfig", id)
+	if err := validateProviderID(id, oidcPrefix); err != nil {
+		return nil, err
+	}
+	key := c.providerConfigPath(oidcCollection, id)
+	cached, gen, ok := c.providerCache.get(key, c.now())
+	if ok {
+		cfg := *cached.(*OIDCProviderConfig)
+		return &cfg, nil
+	}
+	var result oidcProviderConfigResource
+	if err := c.makeProviderConfigRequest(ctx, http.MethodGet, key, nil, &result); err != nil {
+		return nil, err
+	}
+	config = result.toConfig()
+	cfg := *config
+	c.providerCache.put(key, &cfg, gen, c.now())
+	return config, nil
+}
+
+// CreateOIDCProviderConfig creates a new OIDC provider config with the specified parameters, and
+// returns it. The ID, client ID and issuer of the config must be specified.
+func (c *Client) CreateOIDCProviderConfig(
+	ctx context.Context, config *OIDCProviderConfigToCreate) (created *OIDCProviderConfig, err error) {
+
+	defer internal.WrapOpError(&err, "CreateOIDCProviderConfig", "")
+	if config == nil {
+		return nil, errors.New("config must not be nil")
+	}
+	if err := validateProviderID(config.id, oidcPrefix); err != nil {
+		return nil, err
+	}
+	if err := config.params.validate(clientIDKey, issuerKey); err != nil {
+		return nil, err
+	}
+	var result oidcProviderConfigResource
+	path := c.providerConfigPath(oidcCollection, "")
+	opt := internal.WithQueryParam(oidcIDParam, config.id)
+	if err := c.makeProviderConfigRequest(ctx, http.MethodPost, path, config.params.body(), &result, opt); err != nil {
+		return nil, err
+	}
+	return result.toConfig(), nil
+}
+
+// UpdateOIDCProviderConfig updates the OIDC provider config with the specified ID, and returns
+// the updated config. Only the fields set in config are changed.
+func (c *Client) UpdateOIDCProviderConfig(
+	ctx context.Context, id string, config *OIDCProviderConfigToUpdate) (updated *OIDCProviderConfig, err error) {
+
+	defer internal.WrapOpError(&err, "UpdateOIDCProviderConfig", id)
+	if err := validateProviderID(id, oidcPrefix); err != nil {
+		return nil, err
+	}
+	if config == nil || len(config.params) == 0 {
+		return nil, errors.New("update parameters must not be nil or empty")
+	}
+	if err := config.params.validate(); err != nil {
+		return nil, err
+	}
+	var result oidcProviderConfigResource
+	key := c.providerConfigPath(oidcCollection, id)
+	// The config is evicted once the request completes, whether it succeeds or not, so that configs
+	// fetched while it is in flight are not cached.
+	defer c.providerCache.invalidate(key)
+	opt := internal.WithQueryParam("updateMask", config.params.updateMask())
+	if err := c.makeProviderConfigRequest(ctx, http.MethodPatch, key, config.params.body(), &result, opt); err != nil {
+		return nil, err
+	}
+	return result.toConfig(), nil
+}
+
+// DeleteOIDCProviderConfig deletes the OIDC provider config with the specified ID.
+func (c *Client) DeleteOIDCProviderConfig(ctx context.Context, id string) (err error) {
+	defer internal.WrapOpError(&err, "DeleteOIDCProviderConfig", id)
+	if err := validateProviderID(id, oidcPrefix); err != nil {
+		return err
+	}
+	key := c.providerConfigPath(oidcCollection, id)
+	defer c.providerCache.invalidate(key)
+	return c.makeProviderConfigRequest(ctx, http.MethodDelete, key, nil, nil)
+}
+
+// SAMLProviderConfig returns the SAML provider config with the specified ID.
+func (c *Client) SAMLProviderConfig(ctx context.Context, id string) (config *SAMLProviderConfig, err error) {
+	defer internal.WrapOpError(&err, "SAMLProviderConfig", id)
+	if err := validateProviderID(id, samlPrefix); err != nil {
+		return nil, err
+	}
+	key := c.providerConfigPath(samlCollection, id)
+	cached, gen, ok := c.providerCache.get(key, c.now())
+	if ok {
+		return cached.(*SAMLProviderConfig).copy(), nil
+	}
+	var result samlProviderConfigResource
+	if err := c.makeProviderConfigRequest(ctx, http.MethodGet, key, nil, &result); err != nil {
+		return nil, err
+	}
+	config = result.toConfig()
+	c.providerCache.put(key, config.copy(), gen, c.now())
+	return config, nil
+}
+
+// CreateSAMLProviderConfig creates a new SAML provider config with the specified parameters, and
+// returns it. The ID, IdP entity ID, SSO URL, X.509 certificates, RP entity ID and callback URL of
+// the config must be specified.
+func (c *Client) CreateSAMLProviderConfig(
+	ctx context.Context, config *SAMLProviderConfigToCreate) (created *SAMLProviderConfig, err error) {
+
+	defer internal.WrapOpError(&err, "CreateSAMLProviderConfig", "")
+	if config == nil {
+		return nil, errors.New("config must not be nil")
+	}
+	if err := validateProviderID(config.id, samlPrefix); err != nil {
+		return nil, err
+	}
+	err = config.params.validate(idpEntityIDKey, ssoURLKey, idpCertificatesKey, spEntityIDKey, spCallbackURIKey)
+	if err != nil {
+		return nil, err
+	}
+	var result samlProviderConfigResource
+	path := c.providerConfigPath(samlCollection, "")
+	opt := internal.WithQueryParam(samlIDParam, config.id)
+	if err := c.makeProviderConfigRequest(ctx, http.MethodPost, path, config.params.body(), &result, opt); err != nil {
+		return nil, err
+	}
+	return result.toConfig(), nil
+}
+
+// UpdateSAMLProviderConfig updates the SAML provider config with the specified ID, and returns
+// the updated config. Only the fields set in config are changed.
+func (c *Client) UpdateSAMLProviderConfig(
+	ctx context.Context, id string, config *SAMLProviderConfigToUpdate) (updated *SAMLProviderConfig, err error) {
+
+	defer internal.WrapOpError(&err, "UpdateSAMLProviderConfig", id)
+	if err := validateProviderID(id, samlPrefix); err != nil {
+		return nil, err
+	}
+	if config == nil || len(config.params) == 0 {
+		return nil, errors.New("update parameters must not be nil or empty")
+	}
+	if err := config.params.validate(); err != nil {
+		return nil, err
+	}
+	var result samlProviderConfigResource
+	key := c.providerConfigPath(samlCollection, id)
+	// The config is evicted once the request completes, whether it succeeds or not, so that configs
+	// fetched while it is in flight are not cached.
+	defer c.providerCache.invalidate(key)
+	opt := internal.WithQueryParam("updateMask", config.params.updateMask())
+	if err := c.makeProviderConfigRequest(ctx, http.MethodPatch, key, config.params.body(), &result, opt); err != nil {
+		return nil, err
+	}
+	return result.toConfig(), nil
+}
+
+// DeleteSAMLProviderConfig deletes the SAML provider config with the specified ID.
+func (c *Client) DeleteSAMLProviderConfig(ctx context.Context, id string) (err error) {
+	defer internal.WrapOpError(&err, "DeleteSAMLProviderConfig", id)
+	if err := validateProviderID(id, samlPrefix); err != nil {
+		return err
+	}
+	key := c.providerConfigPath(samlCollection, id)
+	defer c.providerCache.invalidate(key)
+	return c.makeProviderConfigRequest(ctx, http.MethodDelete, key, nil, nil)
+}
+
+// OIDCProviderConfigIterator is an iterator over OIDC provider configs.
+type OIDCProviderConfigIterator struct {
+	client   *Client
+	ctx      context.Context
+	nextFunc func() error
+	pageInfo *iterator.PageInfo
+	configs  []*OIDCProviderConfig
+}
+
+// OIDCProviderConfigs returns an iterator over the OIDC provider configs.
+//
+// If nextPageToken is empty, the iterator will start at the beginning.
+// If the nextPageToken is not empty, the iterator starts after the token.
+func (c *Client) OIDCProviderConfigs(ctx context.Context, nextPageToken string) *OIDCProviderConfigIterator {
+	it := &OIDCProviderConfigIterator{
+		client: c,
+		ctx:    ctx,
+	}
+	it.pageInfo, it.nextFunc = iterator.NewPageInfo(
+		it.fetch,
+		func() int { return len(it.configs) },
+		func() interface{} { b := it.configs; it.configs = nil; return b })
+	it.pageInfo.MaxSize = maxProviderConfigResults
+	it.pageInfo.Token = nextPageToken
+	return it
+}
+
+func (it *OIDCProviderConfigIterator) fetch(pageSize int, pageToken string) (string, error) {
+	var result struct {
+		Configs       []*oidcProviderConfigResource `json:"oauthIdpConfigs"`
+		NextPageToken string                        `json:"nextPageToken"`
+	}
+	if err := it.client.listProviderConfigs(it.ctx, oidcCollection, pageSize, pageToken, &result); err != nil {
+		return "", &internal.OpError{Op: "OIDCProviderConfigs", Err: err}
+	}
+	for _, r := range result.Configs {
+		it.configs = append(it.configs, r.toConfig())
+	}
+	it.pageInfo.Token = result.NextPageToken
+	return result.NextPageToken, nil
+}
+
+// PageInfo supports pagination. See the google.golang.org/api/iterator package for details.
+func (it *OIDCProviderConfigIterator) PageInfo() *iterator.PageInfo { return it.pageInfo }
+
+// Next returns the next result. Its second return value is [iterator.Done] if
+// there are no more results. Once Next returns [iterator.Done], all subsequent
+// calls will return [iterator.Done].
+func (it *OIDCProviderConfigIterator) Next() (*OIDCProviderConfig, error) {
+	if err := it.nextFunc(); err != nil {
+		return nil, err
+	}
+	config := it.configs[0]
+	it.configs = it.configs[1:]
+	return config, nil
+}
+
+// SAMLProviderConfigIterator is an iterator over SAML provider configs.
+type SAMLProviderConfigIterator struct {
+	client   *Client
+	ctx      context.Context
+	nextFunc func() error
+	pageInfo *iterator.PageInfo
+	configs  []*SAMLProviderConfig
+}
+
+// SAMLProviderConfigs returns an iterator over the SAML provider configs.
+//
+// If nextPageToken is empty, the iterator will start at the beginning.
+// If the nextPageToken is not empty, the iterator starts after the token.
+func (c *Client) SAMLProviderConfigs(ctx context.Context, nextPageToken string) *SAMLProviderConfigIterator {
+	it := &SAMLProviderConfigIterator{
+		client: c,
+		ctx:    ctx,
+	}
+	it.pageInfo, it.nextFunc = iterator.NewPageInfo(
+		it.fetch,
+		func() int { return len(it.configs) },
+		func() interface{} { b := it.configs; it.configs = nil; return b })
+	it.pageInfo.MaxSize = maxProviderConfigResults
+	it.pageInfo.Token = nextPageToken
+	return it
+}
+
+func (it *SAMLProviderConfigIterator) fetch(pageSize int, pageToken string) (string, error) {
+	var result struct {
+		Configs       []*samlProviderConfigResource `json:"inboundSamlConfigs"`
+		NextPageToken string                        `json:"nextPageToken"`
+	}
+	if err := it.client.listProviderConfigs(it.ctx, samlCollection, pageSize, pageToken, &result); err != nil {
+		return "", &internal.OpError{Op: "SAMLProviderConfigs", Err: err}
+	}
+	for _, r := range result.Configs {
+		it.configs = append(it.configs, r.toConfig())
+	}
+	it.pageInfo.Token = result.NextPageToken
+	return result.NextPageToken, nil
+}
+
+// PageInfo supports pagination. See the google.golang.org/api/iterator package for details.
+func (it *SAMLProviderConfigIterator) PageInfo() *iterator.PageInfo { return it.pageInfo }
+
+// Next returns the next result. Its second return value is [iterator.Done] if
+// there are no more results. Once Next returns [iterator.Done], all subsequent
+// calls will return [iterator.Done].
+func (it *SAMLProviderConfigIterator) Next() (*SAMLProviderConfig, error) {
+	if err := it.nextFunc(); err != nil {
+		return nil, err
+	}
+	config := it.configs[0]
+	it.configs = it.configs[1:]
+	return config, nil
+}
+
+func (c *Client) listProviderConfigs(
+	ctx context.Context, collection string, pageSize int, pageToken string, v interface{}) error {
+
+	params := map[string]string{"pageSize": strconv.Itoa(pageSize)}
+	if pageToken != "" {
+		params["pageToken"] = pageToken
+	}
+	path := c.providerConfigPath(collection, "")
+	return c.makeProviderConfigRequest(ctx, http.MethodGet, path, nil, v, internal.WithQueryParams(params))
+}
+
+func validateProviderID(id, prefix string) error {
+	if !strings.HasPrefix(id, prefix) || len(id) == len(prefix) {
+		return fmt.Errorf("provider id must be a string starting with %q: %q", prefix, id)
+	}
+	return nil
+}
+
+// providerConfigPath returns the path of the provider config with the given ID in the collection,
+// relative to the project management endpoint, or the path of the collection if id is empty.
+// Provider configs of tenant-scoped Clients belong to the tenant.
+func (c *Client) providerConfigPath(collection, id string) string {
+	path := "/projects/" + c.projectID
+	if c.tenantID != "" {
+		path += "/tenants/" + c.tenantID
+	}
+	path += "/" + collection
+	if id != "" {
+		path += "/" + id
+	}
+	return path
+}
+
+func (c *Client) makeProviderConfigRequest(
+	ctx context.Context, method, path string, body, v interface{}, opts ...internal.HTTPOption) error {
+
+	if c.projectID == "" {
+		return errors.New("project id not available")
+	}
+	resp, err := c.sendAdminRequest(ctx, method, c.projectEndpoint+path, body, opts...)
+	if err != nil {
+		return err
+	}
+	if resp.Status != http.StatusOK {
+		// The backend services report missing provider configs with the same error code as
+		// projects without a Firebase Auth configuration.
+		if serverErrorCode(resp) == "CONFIGURATION_NOT_FOUND" {
+			return internal.Errorf(configurationNotFound, "http error status: %d; reason: %s",
+				resp.Status, string(resp.Body))
+		}
+		return handleHTTPError(resp)
+	}
+	if v == nil {
+		return nil
+	}
+	return c.decoder.unmarshal(resp.Body, v)
+}
+
+// providerConfigCache is a read-through cache of provider configs, keyed by their resource paths.
+// A nil cache caches nothing. It is safe for concurrent use.
+//
+// Each key has a generation, which is incremented when the key is invalidated. A config fetched
+// after a cache miss is only stored if the generation of its key is still the one returned by the
+// get call, so a fetch that races with an update or deletion does not cache a stale config.
+type providerConfigCache struct {
+	ttl time.Duration
+
+	mu          sync.Mutex
+	entries     map[string]*providerConfigCacheEntry
+	generations map[string]uint64
+}
+
+type providerConfigCacheEntry struct {
+	config interface{}
+	expiry time.Time
+}
+
+func (pc *providerConfigCache) get(key string, now time.Time) (interface{}, uint64, bool) {
+	if pc == nil {
+		return nil, 0, false
+	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	gen := pc.generations[key]
+	e, ok := pc.entries[key]
+	if !ok {
+		return nil, gen, false
+	}
+	if !now.Before(e.expiry) {
+		delete(pc.entries, key)
+		return nil, gen, false
+	}
+	return e.config, gen, true
+}
+
+func (pc *providerConfigCache) put(key string, config interface{}, gen uint64, now time.Time) {
+	if pc == nil {
+		return
+	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.generations[key] != gen {
+		return
+	}
+	if pc.entries == nil {
+		pc.entries = make(map[string]*providerConfigCacheEntry)
+	}
+	pc.entries[key] = &providerConfigCacheEntry{config: config, expiry: now.Add(pc.ttl)}
+}
+
+func (pc *providerConfigCache) invalidate(key string) {
+	if pc == nil {
+		return
+	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	delete(pc.entries, key)
+	if pc.generations == nil {
+		pc.generations = make(map[string]uint64)
+	}
+	pc.generations[key]++
+}
+
+// WithProviderConfigCache returns a ClientOption that makes the Client cache the OIDC and SAML
+// provider configs it fetches for the specified TTL.
+//
+// Cached configs are served by OIDCProviderConfig() and SAMLProviderConfig() without contacting
+// the backend services. Updating or deleting a config through the Client evicts it from the cache,
+// but changes made by other processes are only observed once the TTL elapses. Listing provider
+// configs always contacts the backend services. Tenant-scoped Clients obtained from the Client
+// share its cache.
+func WithProviderConfigCache(ttl time.Duration) ClientOption {
+	return func(c *Client) error {
+		if ttl <= 0 {
+			return fmt.Errorf("provider config cache ttl must be positive: %v", ttl)
+		}
+		c.providerCache = &providerConfigCache{ttl: ttl}
+		return nil
+	}
+}
@@ -0,0 +1,530 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/iterator"
+)
+
+const testOIDCConfigJSON = `{
+	"name": "projects/mock-project-id/oauthIdpConfigs/oidc.provider",
+	"clientId": "CLIENT_ID",
+	"issuer": "https://oidc.com/issuer",
+	"displayName": "oidcProviderName",
+	"enabled": true
+}`
+
+const testSAMLConfigJSON = `{
+	"name": "projects/mock-project-id/inboundSamlConfigs/saml.provider",
+	"idpConfig": {
+		"idpEntityId": "IDP_ENTITY_ID",
+		"ssoUrl": "https://example.com/login",
+		"signRequest": true,
+		"idpCertificates": [{"x509Certificate": "CERT1"}, {"x509Certificate": "CERT2"}]
+	},
+	"spConfig": {
+		"spEntityId": "RP_ENTITY_ID",
+		"callbackUri": "https://projectId.firebaseapp.com/__/auth/handler"
+	},
+	"displayName": "samlProviderName",
+	"enabled": true
+}`
+
+var testOIDCConfig = &OIDCProviderConfig{
+	ID:          "oidc.provider",
+	DisplayName: "oidcProviderName",
+	Enabled:     true,
+	ClientID:    "CLIENT_ID",
+	Issuer:      "https://oidc.com/issuer",
+}
+
+var testSAMLConfig = &SAMLProviderConfig{
+	ID:                    "saml.provider",
+	DisplayName:           "samlProviderName",
+	Enabled:               true,
+	IDPEntityID:           "IDP_ENTITY_ID",
+	SSOURL:                "https://example.com/login",
+	RequestSigningEnabled: true,
+	X509Certificates:      []string{"CERT1", "CERT2"},
+	RPEntityID:            "RP_ENTITY_ID",
+	CallbackURL:           "https://projectId.firebaseapp.com/__/auth/handler",
+}
+
+func providerConfigServer(resp string, t *testing.T) *mockAuthServer {
+	s := echoServer([]byte(resp), t)
+	s.Client.projectEndpoint = s.Srv.URL
+	return s
+}
+
+func checkJSONBody(t *testing.T, body []byte, want map[string]interface{}) {
+	var got map[string]interface{}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Req = %v; want = %v", got, want)
+	}
+}
+
+func TestOIDCProviderConfig(t *testing.T) {
+	s := providerConfigServer(testOIDCConfigJSON, t)
+	defer s.Close()
+
+	config, err := s.Client.OIDCProviderConfig(ctx, "oidc.provider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config, testOIDCConfig) {
+		t.Errorf("OIDCProviderConfig() = %#v; want = %#v", config, testOIDCConfig)
+	}
+	checkRequest(t, s.Req[0], http.MethodGet, "/projects/mock-project-id/oauthIdpConfigs/oidc.provider")
+}
+
+func TestOIDCProviderConfigNotFound(t *testing.T) {
+	s := providerConfigServer(`{"error": {"message": "CONFIGURATION_NOT_FOUND"}}`, t)
+	defer s.Close()
+	s.Status = http.StatusNotFound
+
+	config, err := s.Client.OIDCProviderConfig(ctx, "oidc.provider")
+	if config != nil || !IsConfigurationNotFound(err) {
+		t.Errorf("OIDCProviderConfig() = (%v, %v); want = (nil, ConfigurationNotFound)", config, err)
+	}
+	if IsProjectNotFound(err) {
+		t.Errorf("IsProjectNotFound() = true; want = false")
+	}
+}
+
+func TestCreateOIDCProviderConfig(t *testing.T) {
+	s := providerConfigServer(testOIDCConfigJSON, t)
+	defer s.Close()
+
+	config, err := s.Client.CreateOIDCProviderConfig(ctx, (&OIDCProviderConfigToCreate{}).
+		ID("oidc.provider").
+		DisplayName("oidcProviderName").
+		Enabled(true).
+		ClientID("CLIENT_ID").
+		Issuer("https://oidc.com/issuer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config, testOIDCConfig) {
+		t.Errorf("CreateOIDCProviderConfig() = %#v; want = %#v", config, testOIDCConfig)
+	}
+	req := s.Req[0]
+	checkRequest(t, req, http.MethodPost, "/projects/mock-project-id/oauthIdpConfigs")
+	if got := req.URL.Query().Get("oauthIdpConfigId"); got != "oidc.provider" {
+		t.Errorf("oauthIdpConfigId = %q; want = %q", got, "oidc.provider")
+	}
+	checkJSONBody(t, s.Rbody, map[string]interface{}{
+		"displayName": "oidcProviderName",
+		"enabled":     true,
+		"clientId":    "CLIENT_ID",
+		"issuer":      "https://oidc.com/issuer",
+	})
+}
+
+func TestCreateOIDCProviderConfigInvalid(t *testing.T) {
+	valid := func() *OIDCProviderConfigToCreate {
+		return (&OIDCProviderConfigToCreate{}).
+			ID("oidc.provider").
+			ClientID("CLIENT_ID").
+			Issuer("https://oidc.com/issuer")
+	}
+	cases := []*OIDCProviderConfigToCreate{
+		nil,
+		(&OIDCProviderConfigToCreate{}).ClientID("CLIENT_ID").Issuer("https://oidc.com/issuer"),
+		valid().ID("saml.provider"),
+		valid().ID("oidc."),
+		(&OIDCProviderConfigToCreate{}).ID("oidc.provider").Issuer("https://oidc.com/issuer"),
+		(&OIDCProviderConfigToCreate{}).ID("oidc.provider").ClientID("CLIENT_ID"),
+		valid().ClientID(""),
+		valid().Issuer("not a url"),
+		valid().DisplayName(""),
+	}
+	for i, tc := range cases {
+		if config, err := client.CreateOIDCProviderConfig(ctx, tc); config != nil || err == nil {
+			t.Errorf("CreateOIDCProviderConfig(%d) = (%v, %v); want = (nil, error)", i, config, err)
+		}
+	}
+}
+
+func TestUpdateOIDCProviderConfig(t *testing.T) {
+	s := providerConfigServer(testOIDCConfigJSON, t)
+	defer s.Close()
+
+	config, err := s.Client.UpdateOIDCProviderConfig(ctx, "oidc.provider", (&OIDCProviderConfigToUpdate{}).
+		Issuer("https://oidc.com/issuer").
+		Enabled(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config, testOIDCConfig) {
+		t.Errorf("UpdateOIDCProviderConfig() = %#v; want = %#v", config, testOIDCConfig)
+	}
+	req := s.Req[0]
+	checkRequest(t, req, http.MethodPatch, "/projects/mock-project-id/oauthIdpConfigs/oidc.provider")
+	if got, want := req.URL.Query().Get("updateMask"), "enabled,issuer"; got != want {
+		t.Errorf("updateMask = %q; want = %q", got, want)
+	}
+	checkJSONBody(t, s.Rbody, map[string]interface{}{
+		"enabled": false,
+		"issuer":  "https://oidc.com/issuer",
+	})
+
+	if config, err := s.Client.UpdateOIDCProviderConfig(ctx, "oidc.provider", nil); config != nil || err == nil {
+		t.Errorf("UpdateOIDCProviderConfig(nil) = (%v, %v); want = (nil, error)", config, err)
+	}
+}
+
+func TestDeleteOIDCProviderConfig(t *testing.T) {
+	s := providerConfigServer("{}", t)
+	defer s.Close()
+
+	if err := s.Client.DeleteOIDCProviderConfig(ctx, "oidc.provider"); err != nil {
+		t.Fatal(err)
+	}
+	checkRequest(t, s.Req[0], http.MethodDelete, "/projects/mock-project-id/oauthIdpConfigs/oidc.provider")
+
+	if err := s.Client.DeleteOIDCProviderConfig(ctx, "saml.provider"); err == nil {
+		t.Errorf("DeleteOIDCProviderConfig(saml) = nil; want = error")
+	}
+}
+
+func TestOIDCProviderConfigs(t *testing.T) {
+	s := providerConfigServer(`{"oauthIdpConfigs": [`+testOIDCConfigJSON+`]}`, t)
+	defer s.Close()
+
+	it := s.Client.OIDCProviderConfigs(ctx, "token")
+	var configs []*OIDCProviderConfig
+	for {
+		config, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		configs = append(configs, config)
+	}
+	if !reflect.DeepEqual(configs, []*OIDCProviderConfig{testOIDCConfig}) {
+		t.Errorf("OIDCProviderConfigs() = %v; want = %v", configs, []*OIDCProviderConfig{testOIDCConfig})
+	}
+	req := s.Req[0]
+	checkRequest(t, req, http.MethodGet, "/projects/mock-project-id/oauthIdpConfigs")
+	if got := req.URL.Query().Get("pageToken"); got != "token" {
+		t.Errorf("pageToken = %q; want = %q", got, "token")
+	}
+	if got := req.URL.Query().Get("pageSize"); got != "100" {
+		t.Errorf("pageSize = %q; want = %q", got, "100")
+	}
+}
+
+func TestSAMLProviderConfig(t *testing.T) {
+	s := providerConfigServer(testSAMLConfigJSON, t)
+	defer s.Close()
+
+	config, err := s.Client.SAMLProviderConfig(ctx, "saml.provider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config, testSAMLConfig) {
+		t.Errorf("SAMLProviderConfig() = %#v; want = %#v", config, testSAMLConfig)
+	}
+	checkRequest(t, s.Req[0], http.MethodGet, "/projects/mock-project-id/inboundSamlConfigs/saml.provider")
+
+	if config, err := s.Client.SAMLProviderConfig(ctx, "oidc.provider"); config != nil || err == nil {
+		t.Errorf("SAMLProviderConfig(oidc) = (%v, %v); want = (nil, error)", config, err)
+	}
+}
+
+func TestCreateSAMLProviderConfig(t *testing.T) {
+	s := providerConfigServer(testSAMLConfigJSON, t)
+	defer s.Close()
+
+	config, err := s.Client.CreateSAMLProviderConfig(ctx, (&SAMLProviderConfigToCreate{}).
+		ID("saml.provider").
+		DisplayName("samlProviderName").
+		Enabled(true).
+		IDPEntityID("IDP_ENTITY_ID").
+		SSOURL("https://example.com/login").
+		RequestSigningEnabled(true).
+		X509Certificates([]string{"CERT1", "CERT2"}).
+		RPEntityID("RP_ENTITY_ID").
+		CallbackURL("https://projectId.firebaseapp.com/__/auth/handler"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config, testSAMLConfig) {
+		t.Errorf("CreateSAMLProviderConfig() = %#v; want = %#v", config, testSAMLConfig)
+	}
+	req := s.Req[0]
+	checkRequest(t, req, http.MethodPost, "/projects/mock-project-id/inboundSamlConfigs")
+	if got := req.URL.Query().Get("inboundSamlConfigId"); got != "saml.provider" {
+		t.Errorf("inboundSamlConfigId = %q; want = %q", got, "saml.provider")
+	}
+	checkJSONBody(t, s.Rbody, map[string]interface{}{
+		"displayName": "samlProviderName",
+		"enabled":     true,
+		"idpConfig": map[string]interface{}{
+			"idpEntityId": "IDP_ENTITY_ID",
+			"ssoUrl":      "https://example.com/login",
+			"signRequest": true,
+			"idpCertificates": []interface{}{
+				map[string]interface{}{"x509Certificate": "CERT1"},
+				map[string]interface{}{"x509Certificate": "CERT2"},
+			},
+		},
+		"spConfig": map[string]interface{}{
+			"spEntityId":  "RP_ENTITY_ID",
+			"callbackUri": "https://projectId.firebaseapp.com/__/auth/handler",
+		},
+	})
+}
+
+func TestCreateSAMLProviderConfigInvalid(t *testing.T) {
+	valid := func() *SAMLProviderConfigToCreate {
+		return (&SAMLProviderConfigToCreate{}).
+			ID("saml.provider").
+			IDPEntityID("IDP_ENTITY_ID").
+			SSOURL("https://example.com/login").
+			X509Certificates([]string{"CERT1"}).
+			RPEntityID("RP_ENTITY_ID").
+			CallbackURL("https://projectId.firebaseapp.com/__/auth/handler")
+	}
+	cases := []*SAMLProviderConfigToCreate{
+		nil,
+		valid().ID("oidc.provider"),
+		valid().IDPEntityID(""),
+		valid().SSOURL("not a url"),
+		valid().X509Certificates(nil),
+		valid().X509Certificates([]string{""}),
+		valid().RPEntityID(""),
+		valid().CallbackURL("/relative"),
+		(&SAMLProviderConfigToCreate{}).ID("saml.provider"),
+	}
+	for i, tc := range cases {
+		if config, err := client.CreateSAMLProviderConfig(ctx, tc); config != nil || err == nil {
+			t.Errorf("CreateSAMLProviderConfig(%d) = (%v, %v); want = (nil, error)", i, config, err)
+		}
+	}
+}
+
+func TestUpdateSAMLProviderConfig(t *testing.T) {
+	s := providerConfigServer(testSAMLConfigJSON, t)
+	defer s.Close()
+
+	config, err := s.Client.UpdateSAMLProviderConfig(ctx, "saml.provider", (&SAMLProviderConfigToUpdate{}).
+		SSOURL("https://example.com/login").
+		X509Certificates([]string{"CERT1", "CERT2"}).
+		CallbackURL("https://projectId.firebaseapp.com/__/auth/handler"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config, testSAMLConfig) {
+		t.Errorf("UpdateSAMLProviderConfig() = %#v; want = %#v", config, testSAMLConfig)
+	}
+	req := s.Req[0]
+	checkRequest(t, req, http.MethodPatch, "/projects/mock-project-id/inboundSamlConfigs/saml.provider")
+	want := "idpConfig.idpCertificates,idpConfig.ssoUrl,spConfig.callbackUri"
+	if got := req.URL.Query().Get("updateMask"); got != want {
+		t.Errorf("updateMask = %q; want = %q", got, want)
+	}
+}
+
+func TestDeleteSAMLProviderConfig(t *testing.T) {
+	s := providerConfigServer("{}", t)
+	defer s.Close()
+
+	if err := s.Client.DeleteSAMLProviderConfig(ctx, "saml.provider"); err != nil {
+		t.Fatal(err)
+	}
+	checkRequest(t, s.Req[0], http.MethodDelete, "/projects/mock-project-id/inboundSamlConfigs/saml.provider")
+}
+
+func TestSAMLProviderConfigs(t *testing.T) {
+	s := providerConfigServer(`{"inboundSamlConfigs": [`+testSAMLConfigJSON+`]}`, t)
+	defer s.Close()
+
+	config, err := s.Client.SAMLProviderConfigs(ctx, "").Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config, testSAMLConfig) {
+		t.Errorf("SAMLProviderConfigs() = %#v; want = %#v", config, testSAMLConfig)
+	}
+	checkRequest(t, s.Req[0], http.MethodGet, "/projects/mock-project-id/inboundSamlConfigs")
+}
+
+func TestTenantProviderConfig(t *testing.T) {
+	s := providerConfigServer(testOIDCConfigJSON, t)
+	defer s.Close()
+	tc, err := s.Client.TenantManager().AuthForTenant("tenant1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tc.OIDCProviderConfig(ctx, "oidc.provider"); err != nil {
+		t.Fatal(err)
+	}
+	checkRequest(t, s.Req[0], http.MethodGet,
+		"/projects/mock-project-id/tenants/tenant1/oauthIdpConfigs/oidc.provider")
+}
+
+func TestProviderConfigCache(t *testing.T) {
+	s := providerConfigServer(testOIDCConfigJSON, t)
+	defer s.Close()
+	mc := &mockClock{now: time.Unix(0, 0)}
+	for _, opt := range []ClientOption{WithProviderConfigCache(time.Minute), withClock(mc)} {
+		if err := opt(s.Client); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := s.Client.EffectiveConfig().ProviderConfigTTL; got != time.Minute {
+		t.Errorf("ProviderConfigTTL = %v; want = %v", got, time.Minute)
+	}
+
+	get := func() {
+		config, err := s.Client.OIDCProviderConfig(ctx, "oidc.provider")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(config, testOIDCConfig) {
+			t.Errorf("OIDCProviderConfig() = %#v; want = %#v", config, testOIDCConfig)
+		}
+		// Changes to the returned config must not affect the cached one.
+		config.ClientID = "modified"
+	}
+
+	get()
+	get()
+	if len(s.Req) != 1 {
+		t.Errorf("Requests = %d; want = 1", len(s.Req))
+	}
+
+	mc.now = mc.now.Add(time.Minute)
+	get()
+	if len(s.Req) != 2 {
+		t.Errorf("Requests = %d; want = 2", len(s.Req))
+	}
+
+	if _, err := s.Client.UpdateOIDCProviderConfig(ctx, "oidc.provider",
+		(&OIDCProviderConfigToUpdate{}).Enabled(true)); err != nil {
+		t.Fatal(err)
+	}
+	get()
+	if len(s.Req) != 4 {
+		t.Errorf("Requests = %d; want = 4", len(s.Req))
+	}
+
+	if err := s.Client.DeleteOIDCProviderConfig(ctx, "oidc.provider"); err != nil {
+		t.Fatal(err)
+	}
+	get()
+	if len(s.Req) != 6 {
+		t.Errorf("Requests = %d; want = 6", len(s.Req))
+	}
+
+	// Tenant-scoped clients share the cache, but not the cached configs.
+	tc, err := s.Client.TenantManager().AuthForTenant("tenant1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tc.OIDCProviderConfig(ctx, "oidc.provider"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Req) != 7 {
+		t.Errorf("Requests = %d; want = 7", len(s.Req))
+	}
+}
+
+func TestProviderConfigCacheConcurrentUpdate(t *testing.T) {
+	updatedJSON := strings.Replace(testOIDCConfigJSON, `"enabled": true`, `"enabled": false`, 1)
+	var (
+		mu      sync.Mutex
+		gets    int
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			gets++
+			first := gets == 1
+			mu.Unlock()
+			if first {
+				// Hold the first read until the update has completed.
+				close(started)
+				<-release
+				w.Write([]byte(testOIDCConfigJSON))
+				return
+			}
+		}
+		w.Write([]byte(updatedJSON))
+	}))
+	defer srv.Close()
+	s := echoServer(nil, t)
+	defer s.Close()
+	s.Client.projectEndpoint = srv.URL
+	mc := &mockClock{now: time.Unix(0, 0)}
+	for _, opt := range []ClientOption{WithProviderConfigCache(time.Minute), withClock(mc)} {
+		if err := opt(s.Client); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := s.Client.OIDCProviderConfig(ctx, "oidc.provider")
+		done <- err
+	}()
+	<-started
+	if _, err := s.Client.UpdateOIDCProviderConfig(ctx, "oidc.provider",
+		(&OIDCProviderConfigToUpdate{}).Enabled(false)); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// The config read before the update completed must not have been cached.
+	config, err := s.Client.OIDCProviderConfig(ctx, "oidc.provider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Enabled {
+		t.Errorf("OIDCProviderConfig().Enabled = true; want = false")
+	}
+	if gets != 2 {
+		t.Errorf("Reads = %d; want = 2", gets)
+	}
+}
+
+func TestProviderConfigCacheInvalidTTL(t *testing.T) {
+	c := *client
+	if err := WithProviderConfigCache(0)(&c); err == nil {
+		t.Errorf("WithProviderConfigCache(0) = nil; want = error")
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"firebase.google.com/go/internal"
+)
+
+// RateLimit configures the client-side rate limiting of the requests made by a Client to the
+// Firebase Auth backend services.
+//
+// Rate limiting is implemented as a token bucket, which holds up to Burst tokens, and refills at
+// Rate tokens per second. Each request consumes a token. When the bucket is empty, requests wait
+// for a token to become available, unless FailFast is set. If FailFast is set, such requests fail
+// immediately with an error that can be checked with IsRateLimitExceeded().
+type RateLimit struct {
+	Rate     float64 // Number of requests allowed per second on average.
+	Burst    int     // Maximum number of requests allowed at once.
+	FailFast bool
+}
+
+// WithRateLimit returns a ClientOption that applies the specified rate limit to all the requests
+// made by the Client to the Firebase Auth backend services. Fetching the public keys used to verify
+// ID tokens is not rate limited.
+func WithRateLimit(rl *RateLimit) ClientOption {
+	return func(c *Client) error {
+		if rl == nil {
+			return errors.New("rate limit must not be nil")
+		}
+		if rl.Rate <= 0 {
+			return errors.New("rate limit rate must be positive")
+		}
+		if rl.Burst < 1 {
+			return errors.New("rate limit burst must be at least 1")
+		}
+		c.limiter = newRateLimiter(rl)
+		return nil
+	}
+}
+
+type rateLimiter struct {
+	rate     float64
+	burst    float64
+	failFast bool
+	clock    clock
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rl *RateLimit) *rateLimiter {
+	return &rateLimiter{
+		rate:     rl.Rate,
+		burst:    float64(rl.Burst),
+		failFast: rl.FailFast,
+		clock:    systemClock{},
+		tokens:   float64(rl.Burst),
+	}
+}
+
+// wait blocks until the rate limit allows a request to be made, or until ctx is done. A nil
+// rateLimiter allows all requests without blocking.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	delay, err := l.reserve()
+	if err != nil || delay <= 0 {
+		return err
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		l.release()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token from the bucket, and returns how long the caller must wait before the
+// token becomes available. The token count goes negative when there are waiting callers.
+func (l *rateLimiter) reserve() (time.Duration, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.clock.Now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0, nil
+	}
+	if l.failFast {
+		return 0, internal.Error(rateLimitExceeded, "client-side rate limit exceeded")
+	}
+	l.tokens--
+	return time.Duration(-l.tokens / l.rate * float64(time.Second)), nil
+}
+
+// release returns a token reserved by a caller that stopped waiting for it.
+func (l *rateLimiter) release() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.tokens++
+}
@@ -0,0 +1,146 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"firebase.google.com/go/internal"
+)
+
+func TestWithRateLimit(t *testing.T) {
+	conf := &internal.AuthConfig{Opts: defaultTestOpts}
+	c, err := NewClient(context.Background(), conf, WithRateLimit(&RateLimit{Rate: 10, Burst: 5}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.limiter == nil {
+		t.Fatalf("limiter = nil; want non-nil")
+	}
+	if c.limiter.rate != 10 || c.limiter.burst != 5 || c.limiter.failFast {
+		t.Errorf("limiter = %#v; want = {rate: 10, burst: 5, failFast: false}", c.limiter)
+	}
+}
+
+func TestWithRateLimitInvalid(t *testing.T) {
+	cases := []*RateLimit{
+		nil,
+		{Rate: 0, Burst: 1},
+		{Rate: -1, Burst: 1},
+		{Rate: 1, Burst: 0},
+	}
+	conf := &internal.AuthConfig{Opts: defaultTestOpts}
+	for _, rl := range cases {
+		if c, err := NewClient(context.Background(), conf, WithRateLimit(rl)); c != nil || err == nil {
+			t.Errorf("NewClient(%v) = (%v, %v); want = (nil, error)", rl, c, err)
+		}
+	}
+}
+
+func TestRateLimiterNil(t *testing.T) {
+	var l *rateLimiter
+	if err := l.wait(context.Background()); err != nil {
+		t.Errorf("wait() = %v; want = nil", err)
+	}
+}
+
+func TestRateLimiterFailFast(t *testing.T) {
+	mc := &mockClock{now: time.Unix(0, 0)}
+	l := newRateLimiter(&RateLimit{Rate: 2, Burst: 2, FailFast: true})
+	l.clock = mc
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := l.wait(ctx); err != nil {
+			t.Fatalf("wait(%d) = %v; want = nil", i, err)
+		}
+	}
+	if err := l.wait(ctx); !IsRateLimitExceeded(err) {
+		t.Errorf("wait() = %v; want = rate limit exceeded error", err)
+	}
+
+	mc.now = mc.now.Add(500 * time.Millisecond)
+	if err := l.wait(ctx); err != nil {
+		t.Errorf("wait() = %v; want = nil", err)
+	}
+	if err := l.wait(ctx); !IsRateLimitExceeded(err) {
+		t.Errorf("wait() = %v; want = rate limit exceeded error", err)
+	}
+
+	// Refills never exceed the burst size.
+	mc.now = mc.now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if err := l.wait(ctx); err != nil {
+			t.Fatalf("wait(%d) = %v; want = nil", i, err)
+		}
+	}
+	if err := l.wait(ctx); !IsRateLimitExceeded(err) {
+		t.Errorf("wait() = %v; want = rate limit exceeded error", err)
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	l := newRateLimiter(&RateLimit{Rate: 50, Burst: 1})
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.wait(ctx); err != nil {
+			t.Fatalf("wait(%d) = %v; want = nil", i, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("wait() x 3 took %v; want >= 30ms", elapsed)
+	}
+}
+
+func TestRateLimiterWaitCancel(t *testing.T) {
+	mc := &mockClock{now: time.Unix(0, 0)}
+	l := newRateLimiter(&RateLimit{Rate: 0.001, Burst: 1})
+	l.clock = mc
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("wait() = %v; want = %v", err, context.DeadlineExceeded)
+	}
+	if l.tokens != 0 {
+		t.Errorf("tokens = %v; want = 0", l.tokens)
+	}
+}
+
+func TestRateLimitedRequest(t *testing.T) {
+	s := echoServer(testGetUserResponse, t)
+	defer s.Close()
+	if err := WithRateLimit(&RateLimit{Rate: 1, Burst: 1, FailFast: true})(s.Client); err != nil {
+		t.Fatal(err)
+	}
+	s.Client.limiter.clock = &mockClock{now: time.Unix(0, 0)}
+
+	if _, err := s.Client.GetUser(context.Background(), "ignored_id"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Client.GetUser(context.Background(), "ignored_id"); !IsRateLimitExceeded(err) {
+		t.Errorf("GetUser() = %v; want = rate limit exceeded error", err)
+	}
+	if len(s.Req) != 1 {
+		t.Errorf("requests = %d; want = 1", len(s.Req))
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"firebase.google.com/go/internal"
+)
+
+const (
+	sessionCookieCertURL      = "https://www.googleapis.com/identitytoolkit/v3/relyingparty/publicKeys"
+	sessionCookieIssuerPrefix = "https://session.firebase.google.com/"
+
+	minSessionCookieDuration = 5 * time.Minute
+	maxSessionCookieDuration = 14 * 24 * time.Hour
+)
+
+var sessionCookieInfo = &tokenInfo{
+	name:         "session cookie",
+	article:      "a",
+	verifyFunc:   "VerifySessionCookie()",
+	spanName:     "firebase.auth.VerifySessionCookie",
+	issuerPrefix: sessionCookieIssuerPrefix,
+	docURL:       "https://firebase.google.com/docs/auth/admin/manage-cookies",
+	revokedCode:  sessionCookieRevoked,
+	expiredCode:  sessionCookieExpired,
+	invalidCode:  sessionCookieInvalid,
+}
+
+// SessionCookie creates a new Firebase session cookie from the given ID token and expiry
+// duration.
+//
+// The returned session cookie is a signed JWT that can be set as a cookie by a server-rendered web
+// application, and later verified with VerifySessionCookie(). The ID token must be valid, and the
+// duration must be between 5 minutes and 14 days. The expiry time of the cookie is set by the
+// Firebase Auth service.
+func (c *Client) SessionCookie(
+	ctx context.Context, idToken string, expiresIn time.Duration) (cookie string, err error) {
+
+	defer internal.WrapOpError(&err, "SessionCookie", "")
+	if idToken == "" {
+		return "", errors.New("id token must be a non-empty string")
+	}
+	if expiresIn < minSessionCookieDuration || expiresIn > maxSessionCookieDuration {
+		return "", fmt.Errorf("session cookie duration must be between %v and %v: %v",
+			minSessionCookieDuration, maxSessionCookieDuration, expiresIn)
+	}
+	if c.projectID == "" {
+		return "", errors.New("project id not available")
+	}
+	if err := c.beforeRequest(ctx); err != nil {
+		return "", err
+	}
+
+	request := &internal.Request{
+		Method: http.MethodPost,
+		URL:    fmt.Sprintf("%s/projects/%s:createSessionCookie", c.idToolkitV1Endpoint, c.projectID),
+		Body: internal.NewJSONEntity(map[string]interface{}{
+			"idToken":       idToken,
+			"validDuration": int64(expiresIn / time.Second),
+		}),
+		Opts: []internal.HTTPOption{internal.WithHeader("X-Client-Version", c.version)},
+	}
+	resp, err := c.adminClient.Do(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	if resp.Status != http.StatusOK {
+		return "", handleHTTPError(resp)
+	}
+
+	var result struct {
+		SessionCookie string `json:"sessionCookie"`
+	}
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		return "", err
+	}
+	if result.SessionCookie == "" {
+		return "", errors.New("failed to create a session cookie")
+	}
+	return result.SessionCookie, nil
+}
+
+// WithSessionCookieClockSkew returns a ClientOption that makes the Client tolerate the specified
+// clock skew when checking the timestamps of session cookies.
+//
+// By default session cookies are verified with the same clock skew as ID tokens, which can be set
+// with WithClockSkew(). Since session cookies are long-lived, a larger tolerance may be appropriate
+// for them. The skew is truncated to whole seconds, and must not be negative.
+func WithSessionCookieClockSkew(skew time.Duration) ClientOption {
+	return func(c *Client) error {
+		if skew < 0 {
+			return fmt.Errorf("session cookie clock skew must not be negative: %v", skew)
+		}
+		skew = skew / time.Second * time.Second
+		c.cookieClockSkew = &skew
+		return nil
+	}
+}
+
+func (c *Client) sessionCookieClockSkew() time.Duration {
+	if c.cookieClockSkew != nil {
+		return *c.cookieClockSkew
+	}
+	return c.clockSkew
+}
+
+// VerifySessionCookie verifies the signature and payload of the provided Firebase session cookie.
+//
+// VerifySessionCookie accepts a signed session cookie string, and verifies that it is current,
+// issued for the correct Firebase project, and signed by the Google Firebase services in the cloud.
+// It returns a Token containing the decoded claims in the input session cookie. The public keys
+// used to verify session cookies are fetched and cached separately from those of ID tokens.
+//
+// This does not check whether or not the session cookie has been revoked.
+func (c *Client) VerifySessionCookie(ctx context.Context, sessionCookie string) (token *Token, err error) {
+	defer internal.WrapOpError(&err, "VerifySessionCookie", "")
+	return c.verifySessionCookie(ctx, sessionCookie, &verifyConfig{})
+}
+
+// VerifySessionCookieAndCheckRevoked verifies the provided session cookie, and checks that it has
+// not been revoked.
+//
+// In addition to the checks of VerifySessionCookie(), this looks up the user the session cookie
+// belongs to, and checks that the cookie was issued after the last call to RevokeRefreshTokens()
+// for the user. Use IsSessionCookieRevoked() to check whether verification failed due to a revoked
+// session cookie.
+func (c *Client) VerifySessionCookieAndCheckRevoked(
+	ctx context.Context, sessionCookie string) (token *Token, err error) {
+
+	defer internal.WrapOpError(&err, "VerifySessionCookieAndCheckRevoked", "")
+	vc := &verifyConfig{checkRevoked: true}
+	p, err := c.verifySessionCookie(ctx, sessionCookie, vc)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.checkUser(ctx, p, sessionCookieInfo, vc); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (c *Client) verifySessionCookie(ctx context.Context, sessionCookie string, vc *verifyConfig) (*Token, error) {
+	return c.verifyToken(ctx, sessionCookie, sessionCookieInfo, vc.keySource(c.cookieKS), c.sessionCookieClockSkew(), vc)
+}
+
+// TokenType is the type of a token verified by VerifyIDTokenOrSessionCookie.
+type TokenType string
+
+const (
+	// TokenTypeIDToken indicates a Firebase ID token.
+	TokenTypeIDToken TokenType = "id_token"
+
+	// TokenTypeSessionCookie indicates a Firebase session cookie.
+	TokenTypeSessionCookie TokenType = "session_cookie"
+)
+
+// VerifyIDTokenOrSessionCookie verifies the provided token as either an ID token or a session
+// cookie, and reports which of the two it is.
+//
+// The type of the token is determined by its 'iss' (issuer) claim, after which the token is verified
+// exactly like VerifyIDToken() or VerifySessionCookie() would. This is meant for services that accept
+// both, e.g. ID tokens from mobile apps and session cookies from server-rendered web pages.
+func (c *Client) VerifyIDTokenOrSessionCookie(
+	ctx context.Context, token string) (t *Token, tt TokenType, err error) {
+
+	defer internal.WrapOpError(&err, "VerifyIDTokenOrSessionCookie", "")
+	if isSessionCookie(token) {
+		t, err = c.verifySessionCookie(ctx, token, &verifyConfig{})
+		tt = TokenTypeSessionCookie
+	} else {
+		t, err = c.verifyIDToken(ctx, token, &verifyConfig{})
+		tt = TokenTypeIDToken
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return t, tt, nil
+}
+
+// isSessionCookie reports whether the unverified issuer of token is that of session cookies.
+// Malformed tokens are reported as not being session cookies.
+func isSessionCookie(token string) bool {
+	s := strings.Split(token, ".")
+	if len(s) != 3 {
+		return false
+	}
+	var p struct {
+		Issuer string `json:"iss"`
+	}
+	if err := decode(jsonDecoder{}, s[1], &p); err != nil {
+		return false
+	}
+	return strings.HasPrefix(p.Issuer, sessionCookieIssuerPrefix)
+}
@@ -0,0 +1,340 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifySessionCookie(t *testing.T) {
+	cookie := getSessionCookie(nil)
+	ft, err := client.VerifySessionCookie(ctx, cookie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.Claims["admin"] != true {
+		t.Errorf("Claims['admin'] = %v; want = true", ft.Claims["admin"])
+	}
+	if ft.UID != ft.Subject {
+		t.Errorf("UID = %q; Sub = %q; want UID = Sub", ft.UID, ft.Subject)
+	}
+	if ft.Issuer != sessionCookieIssuerPrefix+client.projectID {
+		t.Errorf("Issuer = %q; want = %q", ft.Issuer, sessionCookieIssuerPrefix+client.projectID)
+	}
+}
+
+func TestVerifySessionCookieError(t *testing.T) {
+	now := time.Now().Unix()
+	cases := []struct {
+		name   string
+		cookie string
+		want   string
+	}{
+		{"Empty", "", "Session cookie must be a non-empty string"},
+		{"IDToken", testIDToken, "Session cookie has invalid 'iss' (issuer) claim"},
+		{"NoKid", getSessionCookieWithKid("", nil), "Session cookie has no 'kid' header"},
+		{"WrongAudience", getSessionCookie(mockIDTokenPayload{"aud": "other-project"}),
+			"Session cookie has invalid 'aud' (audience) claim"},
+		{"Expired", getSessionCookie(mockIDTokenPayload{"iat": now - 7200, "exp": now - 3600}),
+			"Session cookie has expired"},
+		{"EmptySubject", getSessionCookie(mockIDTokenPayload{"sub": ""}),
+			"Session cookie has empty 'sub' (subject) claim"},
+	}
+	for _, tc := range cases {
+		ft, err := client.VerifySessionCookie(ctx, tc.cookie)
+		if ft != nil || err == nil || !strings.HasPrefix(err.Error(), "VerifySessionCookie: "+tc.want) {
+			t.Errorf("VerifySessionCookie(%s) = (%v, %v); want = (nil, %q)", tc.name, ft, err, tc.want)
+		}
+	}
+
+	ct, err := client.CustomToken("user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	we := "VerifySessionCookie: VerifySessionCookie() expects a session cookie, but was given a custom token"
+	if ft, err := client.VerifySessionCookie(ctx, ct); ft != nil || err == nil || err.Error() != we {
+		t.Errorf("VerifySessionCookie(custom token) = (%v, %v); want = (nil, %q)", ft, err, we)
+	}
+}
+
+func TestVerifySessionCookieErrorCode(t *testing.T) {
+	now := time.Now().Unix()
+	cookie := getSessionCookie(mockIDTokenPayload{"iat": now - 7200, "exp": now - 3600})
+	if _, err := client.VerifySessionCookie(ctx, cookie); !IsSessionCookieExpired(err) || IsIDTokenExpired(err) {
+		t.Errorf("VerifySessionCookie(expired) = %v; want = SessionCookieExpired", err)
+	}
+	if _, err := client.VerifySessionCookie(ctx, testIDToken); !IsSessionCookieInvalid(err) || IsIDTokenInvalid(err) {
+		t.Errorf("VerifySessionCookie(ID token) = %v; want = SessionCookieInvalid", err)
+	}
+}
+
+func TestVerifyIDTokenWithSessionCookie(t *testing.T) {
+	ft, err := client.VerifyIDToken(getSessionCookie(nil))
+	if ft != nil || err == nil || !strings.Contains(err.Error(), "ID token has invalid 'iss' (issuer) claim") {
+		t.Errorf("VerifyIDToken(session cookie) = (%v, %v); want = (nil, issuer error)", ft, err)
+	}
+}
+
+func TestSessionCookieKeySource(t *testing.T) {
+	c := *client
+	c.ks = &mockKeySource{err: errors.New("key fetch failed")}
+	if _, err := c.VerifySessionCookie(ctx, getSessionCookie(nil)); err != nil {
+		t.Errorf("VerifySessionCookie() = %v; want = nil", err)
+	}
+	if ft, err := c.VerifyIDToken(testIDToken); ft != nil || err == nil {
+		t.Errorf("VerifyIDToken() = (%v, %v); want = (nil, error)", ft, err)
+	}
+
+	c = *client
+	c.cookieKS = &mockKeySource{err: errors.New("key fetch failed")}
+	if ft, err := c.VerifySessionCookie(ctx, getSessionCookie(nil)); ft != nil || err == nil {
+		t.Errorf("VerifySessionCookie() = (%v, %v); want = (nil, error)", ft, err)
+	}
+	if _, err := c.VerifyIDToken(testIDToken); err != nil {
+		t.Errorf("VerifyIDToken() = %v; want = nil", err)
+	}
+}
+
+func TestSessionCookieClockSkew(t *testing.T) {
+	now := time.Now().Unix()
+	cookie := getSessionCookie(mockIDTokenPayload{"iat": now - 7200, "exp": now - 30})
+	idToken := getIDToken(mockIDTokenPayload{"iat": now - 7200, "exp": now - 30})
+
+	c := *client
+	if err := WithClockSkew(time.Minute)(&c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.VerifySessionCookie(ctx, cookie); err != nil {
+		t.Errorf("VerifySessionCookie(skew = 1m) = %v; want = nil", err)
+	}
+
+	if err := WithSessionCookieClockSkew(10 * time.Second)(&c); err != nil {
+		t.Fatal(err)
+	}
+	if ft, err := c.VerifySessionCookie(ctx, cookie); ft != nil || err == nil {
+		t.Errorf("VerifySessionCookie(cookie skew = 10s) = (%v, %v); want = (nil, error)", ft, err)
+	}
+	if _, err := c.VerifyIDToken(idToken); err != nil {
+		t.Errorf("VerifyIDToken(skew = 1m) = %v; want = nil", err)
+	}
+
+	c = *client
+	if err := WithSessionCookieClockSkew(time.Minute)(&c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.VerifySessionCookie(ctx, cookie); err != nil {
+		t.Errorf("VerifySessionCookie(cookie skew = 1m) = %v; want = nil", err)
+	}
+	if ft, err := c.VerifyIDToken(idToken); ft != nil || err == nil {
+		t.Errorf("VerifyIDToken(skew = 0) = (%v, %v); want = (nil, error)", ft, err)
+	}
+	if got := c.EffectiveConfig().SessionCookieSkew; got != time.Minute {
+		t.Errorf("SessionCookieSkew = %v; want = %v", got, time.Minute)
+	}
+
+	if err := WithSessionCookieClockSkew(-time.Second)(&c); err == nil {
+		t.Errorf("WithSessionCookieClockSkew(-1s) = nil; want = error")
+	}
+}
+
+func TestVerifyIDTokenOrSessionCookie(t *testing.T) {
+	cases := []struct {
+		name  string
+		token string
+		want  TokenType
+	}{
+		{"IDToken", testIDToken, TokenTypeIDToken},
+		{"SessionCookie", getSessionCookie(nil), TokenTypeSessionCookie},
+	}
+	for _, tc := range cases {
+		ft, tt, err := client.VerifyIDTokenOrSessionCookie(ctx, tc.token)
+		if err != nil || tt != tc.want || ft.UID != "1234567890" {
+			t.Errorf("VerifyIDTokenOrSessionCookie(%s) = (%v, %q, %v); want = (token, %q, nil)",
+				tc.name, ft, tt, err, tc.want)
+		}
+	}
+
+	now := time.Now().Unix()
+	invalid := []string{
+		"",
+		"not.a.token",
+		getIDToken(mockIDTokenPayload{"iat": now - 7200, "exp": now - 3600}),
+		getSessionCookie(mockIDTokenPayload{"iat": now - 7200, "exp": now - 3600}),
+	}
+	for _, token := range invalid {
+		if ft, tt, err := client.VerifyIDTokenOrSessionCookie(ctx, token); ft != nil || tt != "" || err == nil {
+			t.Errorf("VerifyIDTokenOrSessionCookie(%q) = (%v, %q, %v); want = (nil, '', error)", token, ft, tt, err)
+		}
+	}
+}
+
+func TestSessionCookie(t *testing.T) {
+	resp := map[string]interface{}{
+		"sessionCookie": "expectedCookie",
+	}
+	s := echoServer(resp, t)
+	defer s.Close()
+	s.Client.idToolkitV1Endpoint = s.Srv.URL
+
+	cookie, err := s.Client.SessionCookie(ctx, "idToken", 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cookie != "expectedCookie" {
+		t.Errorf("SessionCookie() = %q; want = %q", cookie, "expectedCookie")
+	}
+
+	req := s.Req[0]
+	wantPath := "/projects/mock-project-id:createSessionCookie"
+	if req.Method != http.MethodPost || req.URL.Path != wantPath {
+		t.Errorf("SessionCookie() = %s %s; want = POST %s", req.Method, req.URL.Path, wantPath)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(s.Rbody, &body); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"idToken":       "idToken",
+		"validDuration": float64(600),
+	}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("SessionCookie() body = %v; want = %v", body, want)
+	}
+}
+
+func TestSessionCookieInvalidArgs(t *testing.T) {
+	cases := []struct {
+		idToken   string
+		expiresIn time.Duration
+	}{
+		{"", 10 * time.Minute},
+		{"idToken", 0},
+		{"idToken", 4 * time.Minute},
+		{"idToken", 14*24*time.Hour + time.Second},
+	}
+	for _, tc := range cases {
+		cookie, err := client.SessionCookie(ctx, tc.idToken, tc.expiresIn)
+		if cookie != "" || err == nil {
+			t.Errorf("SessionCookie(%q, %v) = (%q, %v); want = ('', error)", tc.idToken, tc.expiresIn, cookie, err)
+		}
+	}
+}
+
+func TestSessionCookieError(t *testing.T) {
+	s := echoServer([]byte(`{"error":{"message":"INVALID_ID_TOKEN"}}`), t)
+	defer s.Close()
+	s.Client.idToolkitV1Endpoint = s.Srv.URL
+	s.Status = http.StatusBadRequest
+
+	cookie, err := s.Client.SessionCookie(ctx, "idToken", 10*time.Minute)
+	if cookie != "" || err == nil {
+		t.Errorf("SessionCookie() = (%q, %v); want = ('', error)", cookie, err)
+	}
+}
+
+func TestSessionCookieEmptyResponse(t *testing.T) {
+	s := echoServer([]byte(`{}`), t)
+	defer s.Close()
+	s.Client.idToolkitV1Endpoint = s.Srv.URL
+
+	cookie, err := s.Client.SessionCookie(ctx, "idToken", 10*time.Minute)
+	if cookie != "" || err == nil {
+		t.Errorf("SessionCookie() = (%q, %v); want = ('', error)", cookie, err)
+	}
+}
+
+func TestVerifySessionCookieAndCheckRevoked(t *testing.T) {
+	s := echoServer(testGetUserResponse, t)
+	defer s.Close()
+	s.Client.cookieKS = s.Client.ks
+
+	ft, err := s.Client.VerifySessionCookieAndCheckRevoked(ctx, getSessionCookie(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.Claims["admin"] != true {
+		t.Errorf("Claims['admin'] = %v; want = true", ft.Claims["admin"])
+	}
+}
+
+func TestVerifySessionCookieAndCheckRevokedInvalidated(t *testing.T) {
+	s := echoServer(testGetUserResponse, t)
+	defer s.Close()
+	s.Client.cookieKS = s.Client.ks
+	cookie := getSessionCookie(mockIDTokenPayload{"uid": "uid", "iat": 1970}) // old cookie
+
+	p, err := s.Client.VerifySessionCookieAndCheckRevoked(ctx, cookie)
+	we := "VerifySessionCookieAndCheckRevoked: Session cookie has been revoked"
+	if p != nil || err == nil || err.Error() != we || !IsSessionCookieRevoked(err) {
+		t.Errorf("VerifySessionCookieAndCheckRevoked() = (%v, %v); want = (nil, %q)", p, err, we)
+	}
+	if IsIDTokenRevoked(err) {
+		t.Errorf("IsIDTokenRevoked(%v) = true; want = false", err)
+	}
+}
+
+func TestVerifySessionCookieWithClock(t *testing.T) {
+	iat := time.Unix(1500000000, 0)
+	cookie := getSessionCookie(mockIDTokenPayload{"iat": iat.Unix(), "exp": iat.Add(time.Hour).Unix()})
+	mc := &mockClock{now: iat.Add(59 * time.Minute)}
+	c := *client
+	if err := WithClock(mc)(&c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.VerifySessionCookie(ctx, cookie); err != nil {
+		t.Errorf("VerifySessionCookie(now = exp - 1m) = %v; want = nil", err)
+	}
+
+	mc.now = iat.Add(61 * time.Minute)
+	if ft, err := c.VerifySessionCookie(ctx, cookie); ft != nil || err == nil {
+		t.Errorf("VerifySessionCookie(now = exp + 1m) = (%v, %v); want = (nil, error)", ft, err)
+	}
+
+	if err := WithClock(nil)(&c); err == nil {
+		t.Errorf("WithClock(nil) = nil; want = error")
+	}
+}
+
+func getSessionCookie(p mockIDTokenPayload) string {
+	return getSessionCookieWithKid("mock-key-id-1", p)
+}
+
+func getSessionCookieWithKid(kid string, p mockIDTokenPayload) string {
+	pCopy := mockIDTokenPayload{
+		"aud":   client.projectID,
+		"iss":   sessionCookieIssuerPrefix + client.projectID,
+		"iat":   time.Now().Unix() - 100,
+		"exp":   time.Now().Unix() + 3600,
+		"sub":   "1234567890",
+		"admin": true,
+	}
+	for k, v := range p {
+		pCopy[k] = v
+	}
+	h := defaultHeader()
+	h.KeyID = kid
+	cookie, err := encodeToken(ctx, client.snr, h, pCopy)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return cookie
+}
@@ -0,0 +1,350 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/api/iterator"
+
+	"firebase.google.com/go/internal"
+)
+
+const maxTenantResults = 1000
+
+// Tenant is a tenant of a multi-tenant project.
+//
+// Tenants partition the users and the sign-in configuration of a Google Cloud Identity Platform
+// project. Use TenantManager.AuthForTenant() to manage the users of a tenant.
+type Tenant struct {
+	ID                    string
+	DisplayName           string
+	AllowPasswordSignUp   bool
+	EnableEmailLinkSignIn bool
+}
+
+type tenantResource struct {
+	Name                  string `json:"name"`
+	DisplayName           string `json:"displayName"`
+	AllowPasswordSignUp   bool   `json:"allowPasswordSignup"`
+	EnableEmailLinkSignIn bool   `json:"enableEmailLinkSignin"`
+}
+
+func (r *tenantResource) toTenant() *Tenant {
+	return &Tenant{
+		ID:                    r.Name[strings.LastIndex(r.Name, "/")+1:],
+		DisplayName:           r.DisplayName,
+		AllowPasswordSignUp:   r.AllowPasswordSignUp,
+		EnableEmailLinkSignIn: r.EnableEmailLinkSignIn,
+	}
+}
+
+// TenantToCreate is the parameter struct for the CreateTenant function.
+type TenantToCreate struct {
+	params map[string]interface{}
+}
+
+func (t *TenantToCreate) set(key string, value interface{}) *TenantToCreate {
+	if t.params == nil {
+		t.params = make(map[string]interface{})
+	}
+	t.params[key] = value
+	return t
+}
+
+// DisplayName setter.
+func (t *TenantToCreate) DisplayName(name string) *TenantToCreate {
+	return t.set("displayName", name)
+}
+
+// AllowPasswordSignUp setter.
+func (t *TenantToCreate) AllowPasswordSignUp(allow bool) *TenantToCreate {
+	return t.set("allowPasswordSignup", allow)
+}
+
+// EnableEmailLinkSignIn setter.
+func (t *TenantToCreate) EnableEmailLinkSignIn(enable bool) *TenantToCreate {
+	return t.set("enableEmailLinkSignin", enable)
+}
+
+// TenantToUpdate is the parameter struct for the UpdateTenant function.
+type TenantToUpdate struct {
+	params map[string]interface{}
+}
+
+func (t *TenantToUpdate) set(key string, value interface{}) *TenantToUpdate {
+	if t.params == nil {
+		t.params = make(map[string]interface{})
+	}
+	t.params[key] = value
+	return t
+}
+
+// DisplayName setter.
+func (t *TenantToUpdate) DisplayName(name string) *TenantToUpdate {
+	return t.set("displayName", name)
+}
+
+// AllowPasswordSignUp setter.
+func (t *TenantToUpdate) AllowPasswordSignUp(allow bool) *TenantToUpdate {
+	return t.set("allowPasswordSignup", allow)
+}
+
+// EnableEmailLinkSignIn setter.
+func (t *TenantToUpdate) EnableEmailLinkSignIn(enable bool) *TenantToUpdate {
+	return t.set("enableEmailLinkSignin", enable)
+}
+
+// validateTenantParams checks the parameters of a tenant to be created or updated, and returns the
+// names of the fields they set in sorted order.
+func validateTenantParams(params map[string]interface{}) ([]string, error) {
+	var fields []string
+	for k, v := range params {
+		if k == "displayName" && v.(string) == "" {
+			return nil, errors.New("tenant display name must be a non-empty string")
+		}
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
+
+// TenantManager manages the tenants of a multi-tenant project, and provides Clients scoped to
+// individual tenants.
+//
+// Managing tenants requires Google Cloud Identity Platform with multi-tenancy enabled.
+type TenantManager struct {
+	client *Client
+}
+
+// TenantManager returns the TenantManager of the project of the Client.
+func (c *Client) TenantManager() *TenantManager {
+	return &TenantManager{client: c}
+}
+
+// AuthForTenant returns a Client scoped to the specified tenant.
+//
+// The returned Client shares the configuration, public key caches and rate limit of the Client the
+// TenantManager was obtained from. Its user management functions operate on the users of the
+// tenant, custom tokens minted by it carry the tenant ID, and it only accepts ID tokens and session
+// cookies of users who belong to the tenant. Use IsTenantIDMismatch() to check whether
+// verification failed for this reason.
+func (tm *TenantManager) AuthForTenant(tenantID string) (*Client, error) {
+	if tenantID == "" {
+		return nil, errors.New("tenant id must be a non-empty string")
+	}
+	scoped := *tm.client
+	scoped.tenantID = tenantID
+	return &scoped, nil
+}
+
+// GetTenant returns the tenant with the specified ID.
+func (tm *TenantManager) GetTenant(ctx context.Context, tenantID string) (tenant *Tenant, err error) {
+	defer internal.WrapOpError(&err, "GetTenant", tenantID)
+	if tenantID == "" {
+		return nil, errors.New("tenant id must be a non-empty string")
+	}
+	var result tenantResource
+	if err := tm.makeRequest(ctx, http.MethodGet, "/"+tenantID, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.toTenant(), nil
+}
+
+// CreateTenant creates a new tenant with the specified parameters, and returns it. The ID of the
+// tenant is assigned by the server.
+func (tm *TenantManager) CreateTenant(ctx context.Context, tenant *TenantToCreate) (t *Tenant, err error) {
+	defer internal.WrapOpError(&err, "CreateTenant", "")
+	if tenant == nil {
+		tenant = &TenantToCreate{}
+	}
+	if _, err := validateTenantParams(tenant.params); err != nil {
+		return nil, err
+	}
+	req := tenant.params
+	if req == nil {
+		req = map[string]interface{}{}
+	}
+	var result tenantResource
+	if err := tm.makeRequest(ctx, http.MethodPost, "", req, &result); err != nil {
+		return nil, err
+	}
+	return result.toTenant(), nil
+}
+
+// UpdateTenant updates the tenant with the specified ID, and returns the updated tenant. Only the
+// fields set in tenant are changed.
+func (tm *TenantManager) UpdateTenant(
+	ctx context.Context, tenantID string, tenant *TenantToUpdate) (t *Tenant, err error) {
+
+	defer internal.WrapOpError(&err, "UpdateTenant", tenantID)
+	if tenantID == "" {
+		return nil, errors.New("tenant id must be a non-empty string")
+	}
+	if tenant == nil || len(tenant.params) == 0 {
+		return nil, errors.New("update parameters must not be nil or empty")
+	}
+	fields, err := validateTenantParams(tenant.params)
+	if err != nil {
+		return nil, err
+	}
+	var result tenantResource
+	opt := internal.WithQueryParam("updateMask", strings.Join(fields, ","))
+	if err := tm.makeRequest(ctx, http.MethodPatch, "/"+tenantID, tenant.params, &result, opt); err != nil {
+		return nil, err
+	}
+	return result.toTenant(), nil
+}
+
+// DeleteTenant deletes the tenant with the specified ID, along with all of its users.
+func (tm *TenantManager) DeleteTenant(ctx context.Context, tenantID string) (err error) {
+	defer internal.WrapOpError(&err, "DeleteTenant", tenantID)
+	if tenantID == "" {
+		return errors.New("tenant id must be a non-empty string")
+	}
+	return tm.makeRequest(ctx, http.MethodDelete, "/"+tenantID, nil, nil)
+}
+
+// TenantIterator is an iterator over tenants.
+type TenantIterator struct {
+	tm       *TenantManager
+	ctx      context.Context
+	nextFunc func() error
+	pageInfo *iterator.PageInfo
+	tenants  []*Tenant
+}
+
+// Tenants returns an iterator over the tenants of the project.
+//
+// If nextPageToken is empty, the iterator will start at the beginning.
+// If the nextPageToken is not empty, the iterator starts after the token.
+func (tm *TenantManager) Tenants(ctx context.Context, nextPageToken string) *TenantIterator {
+	it := &TenantIterator{
+		tm:  tm,
+		ctx: ctx,
+	}
+	it.pageInfo, it.nextFunc = iterator.NewPageInfo(
+		it.fetch,
+		func() int { return len(it.tenants) },
+		func() interface{} { b := it.tenants; it.tenants = nil; return b })
+	it.pageInfo.MaxSize = maxTenantResults
+	it.pageInfo.Token = nextPageToken
+	return it
+}
+
+func (it *TenantIterator) fetch(pageSize int, pageToken string) (string, error) {
+	params := map[string]string{"pageSize": strconv.Itoa(pageSize)}
+	if pageToken != "" {
+		params["pageToken"] = pageToken
+	}
+	var result struct {
+		Tenants       []*tenantResource `json:"tenants"`
+		NextPageToken string            `json:"nextPageToken"`
+	}
+	err := it.tm.makeRequest(it.ctx, http.MethodGet, "", nil, &result, internal.WithQueryParams(params))
+	if err != nil {
+		return "", &internal.OpError{Op: "Tenants", Err: err}
+	}
+	for _, t := range result.Tenants {
+		it.tenants = append(it.tenants, t.toTenant())
+	}
+	it.pageInfo.Token = result.NextPageToken
+	return result.NextPageToken, nil
+}
+
+// PageInfo supports pagination. See the google.golang.org/api/iterator package for details.
+func (it *TenantIterator) PageInfo() *iterator.PageInfo { return it.pageInfo }
+
+// Next returns the next result. Its second return value is [iterator.Done] if
+// there are no more results. Once Next returns [iterator.Done], all subsequent
+// calls will return [iterator.Done].
+func (it *TenantIterator) Next() (*Tenant, error) {
+	if err := it.nextFunc(); err != nil {
+		return nil, err
+	}
+	tenant := it.tenants[0]
+	it.tenants = it.tenants[1:]
+	return tenant, nil
+}
+
+// makeRequest sends a request to the tenants collection of the project, or to the tenant at the
+// given path relative to it.
+func (tm *TenantManager) makeRequest(
+	ctx context.Context, method, path string, body, v interface{}, opts ...internal.HTTPOption) error {
+
+	c := tm.client
+	if c.projectID == "" {
+		return errors.New("project id not available")
+	}
+	url := fmt.Sprintf("%s/projects/%s/tenants%s", c.projectEndpoint, c.projectID, path)
+	return c.makeAdminRequest(ctx, method, url, body, v, opts...)
+}
+
+// makeTenantUserRequest sends a user management request to the v1 API endpoint of the tenant of
+// the Client, identified by action (e.g. "accounts:lookup"). The request and response payloads of
+// these endpoints use the same fields as the identitytoolkit v3 API.
+func (c *Client) makeTenantUserRequest(
+	ctx context.Context, method, action string, body, v interface{}, opts ...internal.HTTPOption) error {
+
+	if c.projectID == "" {
+		return errors.New("project id not available")
+	}
+	url := fmt.Sprintf("%s/projects/%s/tenants/%s/%s", c.idToolkitV1Endpoint, c.projectID, c.tenantID, action)
+	return c.makeAdminRequest(ctx, method, url, body, v, opts...)
+}
+
+// makeAdminRequest sends an authorized request to the given URL, and unmarshals the response into
+// v, unless v is nil.
+func (c *Client) makeAdminRequest(
+	ctx context.Context, method, url string, body, v interface{}, opts ...internal.HTTPOption) error {
+
+	resp, err := c.sendAdminRequest(ctx, method, url, body, opts...)
+	if err != nil {
+		return err
+	}
+	if resp.Status != http.StatusOK {
+		return handleHTTPError(resp)
+	}
+	if v == nil {
+		return nil
+	}
+	return c.decoder.unmarshal(resp.Body, v)
+}
+
+// sendAdminRequest sends an authorized request to the given URL, and returns the response
+// regardless of its status.
+func (c *Client) sendAdminRequest(
+	ctx context.Context, method, url string, body interface{}, opts ...internal.HTTPOption) (*internal.Response, error) {
+
+	if err := c.beforeRequest(ctx); err != nil {
+		return nil, err
+	}
+	request := &internal.Request{
+		Method: method,
+		URL:    url,
+		Opts:   append(opts, internal.WithHeader("X-Client-Version", c.version)),
+	}
+	if body != nil {
+		request.Body = internal.NewJSONEntity(body)
+	}
+	return c.adminClient.Do(ctx, request)
+}
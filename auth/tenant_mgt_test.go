@@ -0,0 +1,308 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/iterator"
+)
+
+const testTenantJSON = `{
+	"name": "projects/mock-project-id/tenants/tenant1",
+	"displayName": "Test Tenant",
+	"allowPasswordSignup": true,
+	"enableEmailLinkSignin": false
+}`
+
+var testTenant = &Tenant{
+	ID:                  "tenant1",
+	DisplayName:         "Test Tenant",
+	AllowPasswordSignUp: true,
+}
+
+func TestGetTenant(t *testing.T) {
+	s := echoServer([]byte(testTenantJSON), t)
+	defer s.Close()
+	s.Client.projectEndpoint = s.Srv.URL
+
+	tenant, err := s.Client.TenantManager().GetTenant(ctx, "tenant1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tenant, testTenant) {
+		t.Errorf("GetTenant() = %#v; want = %#v", tenant, testTenant)
+	}
+	checkRequest(t, s.Req[0], http.MethodGet, "/projects/mock-project-id/tenants/tenant1")
+}
+
+func TestGetTenantNotFound(t *testing.T) {
+	s := echoServer([]byte(`{"error": {"message": "TENANT_NOT_FOUND"}}`), t)
+	defer s.Close()
+	s.Client.projectEndpoint = s.Srv.URL
+	s.Status = http.StatusNotFound
+
+	tenant, err := s.Client.TenantManager().GetTenant(ctx, "tenant1")
+	if tenant != nil || !IsTenantNotFound(err) {
+		t.Errorf("GetTenant() = (%v, %v); want = (nil, TenantNotFound)", tenant, err)
+	}
+}
+
+func TestCreateTenant(t *testing.T) {
+	s := echoServer([]byte(testTenantJSON), t)
+	defer s.Close()
+	s.Client.projectEndpoint = s.Srv.URL
+
+	tenant, err := s.Client.TenantManager().CreateTenant(ctx, (&TenantToCreate{}).
+		DisplayName("Test Tenant").
+		AllowPasswordSignUp(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tenant, testTenant) {
+		t.Errorf("CreateTenant() = %#v; want = %#v", tenant, testTenant)
+	}
+	checkRequest(t, s.Req[0], http.MethodPost, "/projects/mock-project-id/tenants")
+	want := `{"allowPasswordSignup":true,"displayName":"Test Tenant"}`
+	if string(s.Rbody) != want {
+		t.Errorf("CreateTenant() Req = %s; want = %s", s.Rbody, want)
+	}
+}
+
+func TestUpdateTenant(t *testing.T) {
+	s := echoServer([]byte(testTenantJSON), t)
+	defer s.Close()
+	s.Client.projectEndpoint = s.Srv.URL
+
+	tenant, err := s.Client.TenantManager().UpdateTenant(ctx, "tenant1", (&TenantToUpdate{}).
+		EnableEmailLinkSignIn(false).
+		DisplayName("Test Tenant"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tenant, testTenant) {
+		t.Errorf("UpdateTenant() = %#v; want = %#v", tenant, testTenant)
+	}
+	req := s.Req[0]
+	checkRequest(t, req, http.MethodPatch, "/projects/mock-project-id/tenants/tenant1")
+	if got, want := req.URL.Query().Get("updateMask"), "displayName,enableEmailLinkSignin"; got != want {
+		t.Errorf("updateMask = %q; want = %q", got, want)
+	}
+	want := `{"displayName":"Test Tenant","enableEmailLinkSignin":false}`
+	if string(s.Rbody) != want {
+		t.Errorf("UpdateTenant() Req = %s; want = %s", s.Rbody, want)
+	}
+}
+
+func TestInvalidTenantParams(t *testing.T) {
+	tm := client.TenantManager()
+	if tenant, err := tm.CreateTenant(ctx, (&TenantToCreate{}).DisplayName("")); tenant != nil || err == nil {
+		t.Errorf("CreateTenant(empty name) = (%v, %v); want = (nil, error)", tenant, err)
+	}
+	if tenant, err := tm.UpdateTenant(ctx, "tenant1", nil); tenant != nil || err == nil {
+		t.Errorf("UpdateTenant(nil) = (%v, %v); want = (nil, error)", tenant, err)
+	}
+	if tenant, err := tm.UpdateTenant(ctx, "", (&TenantToUpdate{}).DisplayName("name")); tenant != nil || err == nil {
+		t.Errorf("UpdateTenant('') = (%v, %v); want = (nil, error)", tenant, err)
+	}
+	if tenant, err := tm.GetTenant(ctx, ""); tenant != nil || err == nil {
+		t.Errorf("GetTenant('') = (%v, %v); want = (nil, error)", tenant, err)
+	}
+	if err := tm.DeleteTenant(ctx, ""); err == nil {
+		t.Errorf("DeleteTenant('') = nil; want = error")
+	}
+}
+
+func TestDeleteTenant(t *testing.T) {
+	s := echoServer([]byte("{}"), t)
+	defer s.Close()
+	s.Client.projectEndpoint = s.Srv.URL
+
+	if err := s.Client.TenantManager().DeleteTenant(ctx, "tenant1"); err != nil {
+		t.Fatal(err)
+	}
+	checkRequest(t, s.Req[0], http.MethodDelete, "/projects/mock-project-id/tenants/tenant1")
+}
+
+func TestTenants(t *testing.T) {
+	s := echoServer([]byte(`{"tenants": [`+testTenantJSON+`, `+testTenantJSON+`]}`), t)
+	defer s.Close()
+	s.Client.projectEndpoint = s.Srv.URL
+
+	it := s.Client.TenantManager().Tenants(ctx, "token")
+	var tenants []*Tenant
+	for {
+		tenant, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		tenants = append(tenants, tenant)
+	}
+	if !reflect.DeepEqual(tenants, []*Tenant{testTenant, testTenant}) {
+		t.Errorf("Tenants() = %v; want = %v", tenants, []*Tenant{testTenant, testTenant})
+	}
+	req := s.Req[0]
+	checkRequest(t, req, http.MethodGet, "/projects/mock-project-id/tenants")
+	if got := req.URL.Query().Get("pageToken"); got != "token" {
+		t.Errorf("pageToken = %q; want = %q", got, "token")
+	}
+	if got := req.URL.Query().Get("pageSize"); got != "1000" {
+		t.Errorf("pageSize = %q; want = %q", got, "1000")
+	}
+}
+
+func TestAuthForTenant(t *testing.T) {
+	tm := client.TenantManager()
+	if tc, err := tm.AuthForTenant(""); tc != nil || err == nil {
+		t.Errorf("AuthForTenant('') = (%v, %v); want = (nil, error)", tc, err)
+	}
+
+	tc, err := tm.AuthForTenant("tenant1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tc.EffectiveConfig().TenantID; got != "tenant1" {
+		t.Errorf("TenantID = %q; want = %q", got, "tenant1")
+	}
+	if got := client.EffectiveConfig().TenantID; got != "" {
+		t.Errorf("TenantID = %q; want = %q", got, "")
+	}
+
+	tok := getIDToken(mockIDTokenPayload{
+		"firebase": map[string]interface{}{"sign_in_provider": "password", "tenant": "tenant1"},
+	})
+	if _, err := tc.VerifyIDToken(tok); err != nil {
+		t.Errorf("VerifyIDToken(tenant token) = %v; want = nil", err)
+	}
+	if ft, err := tc.VerifyIDToken(testIDToken); ft != nil || !IsTenantIDMismatch(err) {
+		t.Errorf("VerifyIDToken(no tenant) = (%v, %v); want = (nil, TenantIDMismatch)", ft, err)
+	}
+}
+
+func TestTenantUserManagement(t *testing.T) {
+	s := echoServer(testGetUserResponse, t)
+	defer s.Close()
+	s.Client.idToolkitV1Endpoint = s.Srv.URL
+	tc, err := s.Client.TenantManager().AuthForTenant("tenant1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := tc.GetUser(ctx, "testuser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(user, testUser) {
+		t.Errorf("GetUser() = %#v; want = %#v", user, testUser)
+	}
+	checkRequest(t, s.Req[0], http.MethodPost, "/projects/mock-project-id/tenants/tenant1/accounts:lookup")
+	if want := `{"localId":["testuser"]}`; string(s.Rbody) != want {
+		t.Errorf("GetUser() Req = %s; want = %s", s.Rbody, want)
+	}
+
+	if err := tc.DeleteUser(ctx, "testuser"); err != nil {
+		t.Fatal(err)
+	}
+	checkRequest(t, s.Req[1], http.MethodPost, "/projects/mock-project-id/tenants/tenant1/accounts:delete")
+
+	if err := tc.SetCustomUserClaims(ctx, "testuser", map[string]interface{}{"admin": true}); err != nil {
+		t.Fatal(err)
+	}
+	checkRequest(t, s.Req[2], http.MethodPost, "/projects/mock-project-id/tenants/tenant1/accounts:update")
+	if want := `{"customAttributes":"{\"admin\":true}","localId":"testuser"}`; string(s.Rbody) != want {
+		t.Errorf("SetCustomUserClaims() Req = %s; want = %s", s.Rbody, want)
+	}
+
+	if _, err := tc.Users(ctx, "token").Next(); err != nil {
+		t.Fatal(err)
+	}
+	req := s.Req[3]
+	checkRequest(t, req, http.MethodGet, "/projects/mock-project-id/tenants/tenant1/accounts:batchGet")
+	if got := req.URL.Query().Get("nextPageToken"); got != "token" {
+		t.Errorf("nextPageToken = %q; want = %q", got, "token")
+	}
+}
+
+func TestTenantCreateUser(t *testing.T) {
+	s := echoServer([]byte(`{"localId": "newuser"}`), t)
+	defer s.Close()
+	s.Client.idToolkitV1Endpoint = s.Srv.URL
+	tc, err := s.Client.TenantManager().AuthForTenant("tenant1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tc.createUser(ctx, (&UserToCreate{}).UID("newuser")); err != nil {
+		t.Fatal(err)
+	}
+	checkRequest(t, s.Req[0], http.MethodPost, "/projects/mock-project-id/tenants/tenant1/accounts")
+	if want := `{"localId":"newuser"}`; string(s.Rbody) != want {
+		t.Errorf("CreateUser() Req = %s; want = %s", s.Rbody, want)
+	}
+
+	result, err := tc.ImportUsers(ctx, []*UserToImport{(&UserToImport{}).UID("user1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SuccessCount != 1 {
+		t.Errorf("SuccessCount = %d; want = 1", result.SuccessCount)
+	}
+	checkRequest(t, s.Req[1], http.MethodPost, "/projects/mock-project-id/tenants/tenant1/accounts:batchCreate")
+}
+
+func TestTenantUserManagementError(t *testing.T) {
+	s := echoServer([]byte(`{"error": {"message": "USER_NOT_FOUND"}}`), t)
+	defer s.Close()
+	s.Client.idToolkitV1Endpoint = s.Srv.URL
+	s.Status = http.StatusBadRequest
+	tc, err := s.Client.TenantManager().AuthForTenant("tenant1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tc.DeleteUser(ctx, "testuser")
+	if err == nil || !strings.HasPrefix(err.Error(), `DeleteUser("testuser"): http error status: 400`) {
+		t.Errorf("DeleteUser() = %v; want = http error", err)
+	}
+}
+
+func TestTenantEmailActionLink(t *testing.T) {
+	s := echoServer([]byte(`{"oobLink": "https://test.link"}`), t)
+	defer s.Close()
+	s.Client.idToolkitV1Endpoint = s.Srv.URL
+	tc, err := s.Client.TenantManager().AuthForTenant("tenant1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tc.PasswordResetLink(ctx, testEmail); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(s.Rbody), `"tenantId":"tenant1"`) {
+		t.Errorf("PasswordResetLink() Req = %s; want = tenantId", s.Rbody)
+	}
+}
+
+func checkRequest(t *testing.T, req *http.Request, method, path string) {
+	if req.Method != method || req.URL.Path != path {
+		t.Errorf("Request = %s %s; want = %s %s", req.Method, req.URL.Path, method, path)
+	}
+}
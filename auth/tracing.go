@@ -0,0 +1,133 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Tracer creates spans for tracing the operations of a Client, such as fetching public keys and
+// verifying ID tokens.
+//
+// Tracer allows integrating the SDK with a distributed tracing system like OpenTelemetry, without
+// the SDK depending on it. See WithTracer().
+type Tracer interface {
+	// StartSpan starts a new span with the given name as a child of any span in ctx, and returns a
+	// context containing the new span.
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation started by a Tracer.
+type Span interface {
+	// SetAttribute annotates the span with a key-value pair.
+	SetAttribute(key string, value interface{})
+
+	// End completes the span. err is the error the operation failed with, or nil if it succeeded.
+	End(err error)
+}
+
+// WithTracer returns a ClientOption that makes the Client report spans to the specified Tracer.
+//
+// The Client starts a span named "firebase.auth.VerifyIDToken" for each ID token verification, and
+// a span named "firebase.auth.RefreshKeys" each time it fetches the Google public keys. Both spans
+// have an "outcome" attribute, which is either "success" or "failure". Verification spans also have
+// a "kid" attribute identifying the key the token claims to be signed with.
+func WithTracer(t Tracer) ClientOption {
+	return func(c *Client) error {
+		if t == nil {
+			return errors.New("tracer must not be nil")
+		}
+		c.tracer = t
+		for _, ks := range []KeySource{c.ks, c.cookieKS} {
+			if ks, ok := ks.(*httpKeySource); ok {
+				ks.Tracer = t
+			}
+		}
+		return nil
+	}
+}
+
+// KeyCacheObserver receives events about the cache of the Google public keys, e.g. to export them
+// as metrics.
+//
+// Each method receives the URL the keys are fetched from, which tells the keys used to verify ID
+// tokens apart from those used to verify session cookies. The methods are called synchronously on
+// the verification path, but never while the cache is locked. Implementations must be safe for
+// concurrent use, and should return quickly.
+type KeyCacheObserver interface {
+	// CacheHit is called when a verification is served fresh keys from the cache.
+	CacheHit(url string)
+
+	// CacheMiss is called when a verification finds the cache empty or expired.
+	CacheMiss(url string)
+
+	// RefreshStarted is called when a refresh of the keys starts. Concurrent misses share a single
+	// refresh.
+	RefreshStarted(url string)
+
+	// RefreshCompleted is called when a refresh of the keys completes, including any retries.
+	// err is the error the refresh failed with, or nil if it succeeded.
+	RefreshCompleted(url string, elapsed time.Duration, err error)
+}
+
+// WithKeyCacheObserver returns a ClientOption that reports the events of the public key caches of
+// the Client to the specified KeyCacheObserver.
+func WithKeyCacheObserver(o KeyCacheObserver) ClientOption {
+	return func(c *Client) error {
+		if o == nil {
+			return errors.New("key cache observer must not be nil")
+		}
+		for _, ks := range []KeySource{c.ks, c.cookieKS} {
+			if ks, ok := ks.(*httpKeySource); ok {
+				ks.Observer = o
+			}
+		}
+		return nil
+	}
+}
+
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+
+func (noopSpan) End(err error) {}
+
+// startSpan starts a span using t, or a no-op span if t is nil.
+func startSpan(ctx context.Context, t Tracer, name string) (context.Context, Span) {
+	if t == nil {
+		t = noopTracer{}
+	}
+	return t.StartSpan(ctx, name)
+}
+
+func (c *Client) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	return startSpan(ctx, c.tracer, name)
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
@@ -0,0 +1,204 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type recordedSpan struct {
+	name  string
+	attrs map[string]interface{}
+	err   error
+	ended bool
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) {
+	s.attrs[key] = value
+}
+
+func (s *recordedSpan) End(err error) {
+	s.err = err
+	s.ended = true
+}
+
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	s := &recordedSpan{name: name, attrs: make(map[string]interface{})}
+	t.spans = append(t.spans, s)
+	return ctx, s
+}
+
+func TestVerifyIDTokenTracing(t *testing.T) {
+	tr := &recordingTracer{}
+	c := *client
+	if err := WithTracer(tr)(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.VerifyIDToken(testIDToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.VerifyIDToken("invalid.token"); err == nil {
+		t.Fatal("VerifyIDToken() = nil; want = error")
+	}
+
+	if len(tr.spans) != 2 {
+		t.Fatalf("spans = %d; want = 2", len(tr.spans))
+	}
+	s := tr.spans[0]
+	if s.name != "firebase.auth.VerifyIDToken" || !s.ended || s.err != nil {
+		t.Errorf("span = %#v; want = ended VerifyIDToken span without error", s)
+	}
+	if s.attrs["kid"] != "mock-key-id-1" || s.attrs["outcome"] != "success" {
+		t.Errorf("span attributes = %v; want = {kid: mock-key-id-1, outcome: success}", s.attrs)
+	}
+	s = tr.spans[1]
+	if !s.ended || s.err == nil || s.attrs["outcome"] != "failure" {
+		t.Errorf("span = %#v; want = ended span with failure", s)
+	}
+}
+
+func TestHTTPKeySourceTracing(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/public_certs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc, _ := newTestHTTPClient(data)
+	c := &Client{ks: newHTTPKeySource("http://mock.url", hc)}
+	tr := &recordingTracer{}
+	if err := WithTracer(tr)(c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ks.Keys(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tr.spans) != 1 {
+		t.Fatalf("spans = %d; want = 1", len(tr.spans))
+	}
+	s := tr.spans[0]
+	if s.name != "firebase.auth.RefreshKeys" || !s.ended || s.err != nil {
+		t.Errorf("span = %#v; want = ended RefreshKeys span without error", s)
+	}
+	if s.attrs["url"] != "http://mock.url" || s.attrs["keys"] != 3 || s.attrs["outcome"] != "success" {
+		t.Errorf("span attributes = %v; want = {url: http://mock.url, keys: 3, outcome: success}", s.attrs)
+	}
+}
+
+func TestWithTracerNil(t *testing.T) {
+	if err := WithTracer(nil)(&Client{}); err == nil {
+		t.Errorf("WithTracer(nil) = nil; want = error")
+	}
+}
+
+// recordingObserver records the key cache events it receives. It also locks the cache of ks on
+// each event, which deadlocks if the event is reported while the cache is locked.
+type recordingObserver struct {
+	ks     *httpKeySource
+	mutex  sync.Mutex
+	events []string
+}
+
+func (o *recordingObserver) record(event string) {
+	o.ks.Mutex.Lock()
+	o.ks.Mutex.Unlock()
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.events = append(o.events, event)
+}
+
+func (o *recordingObserver) CacheHit(url string)       { o.record("hit " + url) }
+func (o *recordingObserver) CacheMiss(url string)      { o.record("miss " + url) }
+func (o *recordingObserver) RefreshStarted(url string) { o.record("start " + url) }
+
+func (o *recordingObserver) RefreshCompleted(url string, elapsed time.Duration, err error) {
+	if elapsed < 0 {
+		err = fmt.Errorf("negative elapsed time: %v", elapsed)
+	}
+	o.record(fmt.Sprintf("done %s %v", url, err))
+}
+
+func TestKeyCacheObserver(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/public_certs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bt := &blockingTransport{data: data, release: make(chan struct{})}
+	close(bt.release)
+	mc := &mockClock{now: time.Unix(0, 0)}
+	c, err := NewVerifyOnlyClient(ctx, "mock-project-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := c.ks.(*httpKeySource)
+	ks.KeyURI = "http://mock.url"
+	ks.HTTPClient = &http.Client{Transport: bt}
+	ks.Clock = mc
+	ks.RetryConfig = nil
+	ks.RefreshAhead, ks.MaxStale = 0, 0
+	o := &recordingObserver{ks: ks}
+	if err := WithKeyCacheObserver(o)(c); err != nil {
+		t.Fatal(err)
+	}
+	if ks.Observer != o || c.cookieKS.(*httpKeySource).Observer != o {
+		t.Fatalf("Observer not set on all key sources")
+	}
+
+	if _, err := ks.Keys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Keys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mc.now = ks.ExpiryTime.Add(time.Second)
+	bt.err = errors.New("network error")
+	if _, err := ks.Keys(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"miss http://mock.url",
+		"start http://mock.url",
+		"done http://mock.url <nil>",
+		"hit http://mock.url",
+		"miss http://mock.url",
+		"start http://mock.url",
+	}
+	if len(o.events) != len(want)+1 || !reflect.DeepEqual(o.events[:len(want)], want) {
+		t.Fatalf("events = %v; want = %v + failed refresh", o.events, want)
+	}
+	if last := o.events[len(want)]; last == "done http://mock.url <nil>" {
+		t.Errorf("events[%d] = %q; want = failed refresh", len(want), last)
+	}
+}
+
+func TestWithKeyCacheObserverNil(t *testing.T) {
+	if err := WithKeyCacheObserver(nil)(&Client{}); err == nil {
+		t.Errorf("WithKeyCacheObserver(nil) = nil; want = error")
+	}
+}
@@ -15,11 +15,14 @@
 package auth
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -33,6 +36,7 @@ import (
 
 const maxReturnedResults = 1000
 const maxLenPayloadCC = 1000
+const maxDeleteUsers = 1000
 
 const defaultProviderID = "firebase"
 
@@ -76,7 +80,28 @@ type UserMetadata struct {
 	LastLogInTimestamp int64
 }
 
+// MultiFactorInfo describes a second factor enrolled by a user.
+//
+// UID is the ID of the enrollment, which is assigned by the server. FactorID identifies the type of
+// the second factor, and is currently always "phone".
+type MultiFactorInfo struct {
+	UID                 string
+	DisplayName         string
+	EnrollmentTimestamp int64 // milliseconds since epoch.
+	FactorID            string
+	PhoneNumber         string
+}
+
+// MultiFactorSettings contains the second factors enrolled by a user.
+type MultiFactorSettings struct {
+	EnrolledFactors []*MultiFactorInfo
+}
+
 // UserRecord contains metadata associated with a Firebase user account.
+//
+// MultiFactor is nil for users without any enrolled second factors. It is only populated for users
+// retrieved with GetUser, GetUserByEmail, GetUserByPhoneNumber and GetUsers, or returned by
+// CreateUser and UpdateUser, when the project ID of the Client is known.
 type UserRecord struct {
 	*UserInfo
 	CustomClaims           map[string]interface{}
@@ -85,6 +110,7 @@ type UserRecord struct {
 	ProviderUserInfo       []*UserInfo
 	TokensValidAfterMillis int64 // milliseconds since epoch.
 	UserMetadata           *UserMetadata
+	MultiFactor            *MultiFactorSettings
 }
 
 // ExportedUserRecord is the returned user value used when listing all the users.
@@ -103,6 +129,39 @@ type UserIterator struct {
 	nextFunc func() error
 	pageInfo *iterator.PageInfo
 	users    []*ExportedUserRecord
+	fields   googleapi.Field
+}
+
+// UserField identifies a field of the user accounts returned by UsersWithFields().
+type UserField string
+
+// Fields of the user accounts that can be selected in UsersWithFields(). The UID of each user
+// account is always returned.
+const (
+	UserFieldCustomClaims     UserField = "customAttributes"
+	UserFieldDisabled         UserField = "disabled"
+	UserFieldDisplayName      UserField = "displayName"
+	UserFieldEmail            UserField = "email"
+	UserFieldEmailVerified    UserField = "emailVerified"
+	UserFieldMetadata         UserField = "createdAt,lastLoginAt"
+	UserFieldPasswordHash     UserField = "passwordHash,salt"
+	UserFieldPhoneNumber      UserField = "phoneNumber"
+	UserFieldPhotoURL         UserField = "photoUrl"
+	UserFieldProviderUserInfo UserField = "providerUserInfo"
+	UserFieldTokensValidAfter UserField = "validSince"
+)
+
+// userFieldMask returns the partial response field mask of a user listing that selects the given
+// user fields.
+func userFieldMask(fields []UserField) googleapi.Field {
+	if len(fields) == 0 {
+		return ""
+	}
+	selected := []string{"localId"}
+	for _, f := range fields {
+		selected = append(selected, string(f))
+	}
+	return googleapi.Field(fmt.Sprintf("users(%s),nextPageToken", strings.Join(selected, ",")))
 }
 
 // UserToCreate is the parameter struct for the CreateUser function.
@@ -180,6 +239,32 @@ func (u *UserToUpdate) PhoneNumber(phone string) *UserToUpdate { u.set("phoneNum
 // PhotoURL setter.
 func (u *UserToUpdate) PhotoURL(url string) *UserToUpdate { u.set("photoUrl", url); return u }
 
+// MFASettings setter. Replaces the second factors enrolled by the user with the EnrolledFactors of
+// mfa. Factors that have a UID are kept as they are, while factors without one are enrolled anew.
+// To remove a factor, omit it from the list; an empty list removes all the second factors of the
+// user. Requires the project ID of the Client to be known.
+func (u *UserToUpdate) MFASettings(mfa MultiFactorSettings) *UserToUpdate {
+	u.set("mfa", mfa)
+	return u
+}
+
+// ProviderToLink setter. Links the given federated identity to the user, e.g. to complete an
+// account-merge flow from a backend without an interactive sign-in. The ProviderID and UID of
+// the provider are required. Phone and email providers cannot be linked this way; set the
+// PhoneNumber or Email of the user instead. Requires the project ID of the Client to be known.
+func (u *UserToUpdate) ProviderToLink(provider *UserInfo) *UserToUpdate {
+	u.set("providerToLink", provider)
+	return u
+}
+
+// ProvidersToUnlink setter. Unlinks the providers with the given IDs (e.g. "google.com" or
+// "phone") from the user. Unlinking the "phone" provider also removes the phone number of the
+// user.
+func (u *UserToUpdate) ProvidersToUnlink(providerIDs ...string) *UserToUpdate {
+	u.set("providersToUnlink", providerIDs)
+	return u
+}
+
 // revokeRefreshTokens revokes all refresh tokens for a user by setting the validSince property
 // to the present in epoch seconds.
 func (u *UserToUpdate) revokeRefreshTokens() *UserToUpdate {
@@ -188,26 +273,29 @@ func (u *UserToUpdate) revokeRefreshTokens() *UserToUpdate {
 }
 
 // CreateUser creates a new user with the specified properties.
-func (c *Client) CreateUser(ctx context.Context, user *UserToCreate) (*UserRecord, error) {
+func (c *Client) CreateUser(ctx context.Context, user *UserToCreate) (ur *UserRecord, err error) {
+	defer internal.WrapOpError(&err, "CreateUser", "")
 	uid, err := c.createUser(ctx, user)
 	if err != nil {
 		return nil, err
 	}
-	return c.GetUser(ctx, uid)
+	return c.getUserByUID(ctx, uid)
 }
 
 // UpdateUser updates an existing user account with the specified properties.
 //
 // DisplayName, PhotoURL and PhoneNumber will be set to "" to signify deleting them from the record.
 func (c *Client) UpdateUser(ctx context.Context, uid string, user *UserToUpdate) (ur *UserRecord, err error) {
+	defer internal.WrapOpError(&err, "UpdateUser", uid)
 	if err := c.updateUser(ctx, uid, user); err != nil {
 		return nil, err
 	}
-	return c.GetUser(ctx, uid)
+	return c.getUserByUID(ctx, uid)
 }
 
 // DeleteUser deletes the user by the given UID.
-func (c *Client) DeleteUser(ctx context.Context, uid string) error {
+func (c *Client) DeleteUser(ctx context.Context, uid string) (err error) {
+	defer internal.WrapOpError(&err, "DeleteUser", uid)
 	if err := validateUID(uid); err != nil {
 		return err
 	}
@@ -215,6 +303,12 @@ func (c *Client) DeleteUser(ctx context.Context, uid string) error {
 		LocalId: uid,
 	}
 
+	if c.tenantID != "" {
+		return c.makeTenantUserRequest(ctx, http.MethodPost, "accounts:delete", request, nil)
+	}
+	if err := c.beforeRequest(ctx); err != nil {
+		return err
+	}
 	call := c.is.Relyingparty.DeleteAccount(request)
 	c.setHeader(call)
 	if _, err := call.Context(ctx).Do(); err != nil {
@@ -223,8 +317,66 @@ func (c *Client) DeleteUser(ctx context.Context, uid string) error {
 	return nil
 }
 
+// DeleteUsersResult describes the outcome of a DeleteUsers call.
+type DeleteUsersResult struct {
+	SuccessCount int
+	FailureCount int
+	Errors       []*ErrorInfo
+}
+
+// DeleteUsers deletes the users with the given UIDs.
+//
+// At most 1000 users can be deleted in a single call. The UIDs are validated before the request is
+// made, and invalid input fails the whole batch. UIDs of users that do not exist are counted as
+// successful deletions. Users that the server fails to delete are reported in the Errors of the
+// returned DeleteUsersResult, with the Index of each error referring to the position of the UID in
+// uids, and do not cause DeleteUsers to return an error. Requires the project ID of the Client to
+// be known.
+func (c *Client) DeleteUsers(ctx context.Context, uids []string) (result *DeleteUsersResult, err error) {
+	defer internal.WrapOpError(&err, "DeleteUsers", "")
+	if len(uids) > maxDeleteUsers {
+		return nil, fmt.Errorf("uids list must not contain more than %d elements", maxDeleteUsers)
+	}
+	for _, uid := range uids {
+		if err := validateUID(uid); err != nil {
+			return nil, err
+		}
+	}
+
+	result = &DeleteUsersResult{}
+	if len(uids) == 0 {
+		return result, nil
+	}
+	request := map[string]interface{}{
+		"localIds": uids,
+		"force":    true,
+	}
+	var resp struct {
+		Errors []struct {
+			Index   int    `json:"index"`
+			LocalID string `json:"localId"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := c.makeUserRequest(ctx, http.MethodPost, "accounts:batchDelete", request, &resp); err != nil {
+		return nil, err
+	}
+
+	for _, e := range resp.Errors {
+		result.Errors = append(result.Errors, &ErrorInfo{Index: e.Index, Reason: e.Message})
+	}
+	result.FailureCount = len(result.Errors)
+	result.SuccessCount = len(uids) - result.FailureCount
+	return result, nil
+}
+
 // GetUser gets the user data corresponding to the specified user ID.
-func (c *Client) GetUser(ctx context.Context, uid string) (*UserRecord, error) {
+func (c *Client) GetUser(ctx context.Context, uid string) (ur *UserRecord, err error) {
+	defer internal.WrapOpError(&err, "GetUser", uid)
+	return c.getUserByUID(ctx, uid)
+}
+
+func (c *Client) getUserByUID(ctx context.Context, uid string) (*UserRecord, error) {
 	if err := validateUID(uid); err != nil {
 		return nil, err
 	}
@@ -235,7 +387,8 @@ func (c *Client) GetUser(ctx context.Context, uid string) (*UserRecord, error) {
 }
 
 // GetUserByPhoneNumber gets the user data corresponding to the specified user phone number.
-func (c *Client) GetUserByPhoneNumber(ctx context.Context, phone string) (*UserRecord, error) {
+func (c *Client) GetUserByPhoneNumber(ctx context.Context, phone string) (ur *UserRecord, err error) {
+	defer internal.WrapOpError(&err, "GetUserByPhoneNumber", "")
 	if err := validatePhone(phone); err != nil {
 		return nil, err
 	}
@@ -246,7 +399,8 @@ func (c *Client) GetUserByPhoneNumber(ctx context.Context, phone string) (*UserR
 }
 
 // GetUserByEmail gets the user data corresponding to the specified email.
-func (c *Client) GetUserByEmail(ctx context.Context, email string) (*UserRecord, error) {
+func (c *Client) GetUserByEmail(ctx context.Context, email string) (ur *UserRecord, err error) {
+	defer internal.WrapOpError(&err, "GetUserByEmail", "")
 	if err := validateEmail(email); err != nil {
 		return nil, err
 	}
@@ -261,9 +415,21 @@ func (c *Client) GetUserByEmail(ctx context.Context, email string) (*UserRecord,
 // If nextPageToken is empty, the iterator will start at the beginning.
 // If the nextPageToken is not empty, the iterator starts after the token.
 func (c *Client) Users(ctx context.Context, nextPageToken string) *UserIterator {
+	return c.UsersWithFields(ctx, nextPageToken)
+}
+
+// UsersWithFields is similar to Users, but only requests the specified fields of each user account
+// from the server.
+//
+// Selecting only the required fields reduces the size of the listing responses, and the time spent
+// parsing them. The fields of the returned user records that were not selected are left empty. The
+// UID of each user account is always returned. If no fields are specified, all the fields are
+// returned.
+func (c *Client) UsersWithFields(ctx context.Context, nextPageToken string, fields ...UserField) *UserIterator {
 	it := &UserIterator{
 		ctx:    ctx,
 		client: c,
+		fields: userFieldMask(fields),
 	}
 	it.pageInfo, it.nextFunc = iterator.NewPageInfo(
 		it.fetch,
@@ -279,17 +445,15 @@ func (it *UserIterator) fetch(pageSize int, pageToken string) (string, error) {
 		MaxResults:    int64(pageSize),
 		NextPageToken: pageToken,
 	}
-	call := it.client.is.Relyingparty.DownloadAccount(request)
-	it.client.setHeader(call)
-	resp, err := call.Context(it.ctx).Do()
+	resp, err := it.downloadAccount(request)
 	if err != nil {
-		return "", handleServerError(err)
+		return "", &internal.OpError{Op: "Users", Err: err}
 	}
 
 	for _, u := range resp.Users {
 		eu, err := makeExportedUser(u)
 		if err != nil {
-			return "", err
+			return "", &internal.OpError{Op: "Users", Err: err}
 		}
 		it.users = append(it.users, eu)
 	}
@@ -297,6 +461,41 @@ func (it *UserIterator) fetch(pageSize int, pageToken string) (string, error) {
 	return resp.NextPageToken, nil
 }
 
+func (it *UserIterator) downloadAccount(
+	request *identitytoolkit.IdentitytoolkitRelyingpartyDownloadAccountRequest) (*identitytoolkit.DownloadAccountResponse, error) {
+
+	if it.client.tenantID != "" {
+		params := map[string]string{"maxResults": strconv.FormatInt(request.MaxResults, 10)}
+		if request.NextPageToken != "" {
+			params["nextPageToken"] = request.NextPageToken
+		}
+		if it.fields != "" {
+			params["fields"] = string(it.fields)
+		}
+		var resp identitytoolkit.DownloadAccountResponse
+		err := it.client.makeTenantUserRequest(
+			it.ctx, http.MethodGet, "accounts:batchGet", nil, &resp, internal.WithQueryParams(params))
+		if err != nil {
+			return nil, err
+		}
+		return &resp, nil
+	}
+
+	if err := it.client.beforeRequest(it.ctx); err != nil {
+		return nil, err
+	}
+	call := it.client.is.Relyingparty.DownloadAccount(request)
+	it.client.setHeader(call)
+	if it.fields != "" {
+		call.Fields(it.fields)
+	}
+	resp, err := call.Context(it.ctx).Do()
+	if err != nil {
+		return nil, handleServerError(err)
+	}
+	return resp, nil
+}
+
 // PageInfo supports pagination. See the google.golang.org/api/iterator package for details.
 // Page size can be determined by the NewPager(...) function described there.
 func (it *UserIterator) PageInfo() *iterator.PageInfo { return it.pageInfo }
@@ -313,6 +512,94 @@ func (it *UserIterator) Next() (*ExportedUserRecord, error) {
 	return user, nil
 }
 
+// ExportOptions configures a user export started by ExportUsers.
+type ExportOptions struct {
+	// PageToken resumes a previous export from the specified page token, as passed to Checkpoint.
+	// If empty, the export starts at the beginning.
+	PageToken string
+
+	// Checkpoint, if set, is called with the token of the next page after all the users of a page
+	// have been passed to the export callback. The token is empty after the last page. Saving the
+	// token and passing it as PageToken later resumes the export without repeating or skipping any
+	// users. An error returned by Checkpoint stops the export.
+	Checkpoint func(pageToken string) error
+
+	// Fields selects the fields of the exported user accounts as in UsersWithFields(). If empty,
+	// all the fields are exported.
+	Fields []UserField
+}
+
+// ExportUsers calls fn with every user account in the project, one page of users at a time.
+//
+// ExportUsers is meant for long-running exports. When opts specifies a Checkpoint callback, an
+// interrupted export can be resumed from the last checkpoint. opts may be nil. The export stops
+// when fn returns an error, or when ctx is done; the error returned by fn or Checkpoint, or the
+// context error is returned as is. Errors from listing the users are the same as those returned
+// by UserIterator.
+func (c *Client) ExportUsers(
+	ctx context.Context, opts *ExportOptions, fn func(*ExportedUserRecord) error) error {
+
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+	it := c.UsersWithFields(ctx, "", opts.Fields...)
+	pageToken := opts.PageToken
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		nextPageToken, err := it.fetch(maxReturnedResults, pageToken)
+		if err != nil {
+			return err
+		}
+		users := it.users
+		it.users = nil
+		for _, u := range users {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+		if opts.Checkpoint != nil {
+			if err := opts.Checkpoint(nextPageToken); err != nil {
+				return err
+			}
+		}
+		if nextPageToken == "" {
+			return nil
+		}
+		pageToken = nextPageToken
+	}
+}
+
+// UserClaims pairs the ID of a user with the custom claims set on the user account.
+type UserClaims struct {
+	UID          string                 `json:"uid"`
+	CustomClaims map[string]interface{} `json:"customClaims"`
+}
+
+// ExportCustomClaims calls fn with the custom claims of every user account in the project.
+//
+// The claims are read from the paged user listing (see ExportUsers()), so no additional request is
+// made per user. Only the UIDs and the custom claims of the users are requested, regardless of
+// opts.Fields. CustomClaims is nil for users without custom claims. opts may be nil. Iteration
+// stops when fn returns an error, or when ctx is done; the error returned by fn, or the context
+// error is returned as is.
+func (c *Client) ExportCustomClaims(
+	ctx context.Context, opts *ExportOptions, fn func(*UserClaims) error) error {
+
+	eo := &ExportOptions{}
+	if opts != nil {
+		*eo = *opts
+	}
+	eo.Fields = []UserField{UserFieldCustomClaims}
+	return c.ExportUsers(ctx, eo, func(u *ExportedUserRecord) error {
+		return fn(&UserClaims{UID: u.UID, CustomClaims: u.CustomClaims})
+	})
+}
+
 // SetCustomUserClaims sets additional claims on an existing user account.
 //
 // Custom claims set via this function can be used to define user roles and privilege levels.
@@ -321,13 +608,75 @@ func (it *UserIterator) Next() (*ExportedUserRecord, error) {
 // can be accessed via the user's ID token JWT. If a reserved OIDC claim is specified (sub, iat,
 // iss, etc), an error is thrown. Claims payload must also not be larger then 1000 characters
 // when serialized into a JSON string.
-func (c *Client) SetCustomUserClaims(ctx context.Context, uid string, customClaims map[string]interface{}) error {
+func (c *Client) SetCustomUserClaims(ctx context.Context, uid string, customClaims map[string]interface{}) (err error) {
+	defer internal.WrapOpError(&err, "SetCustomUserClaims", uid)
 	if customClaims == nil || len(customClaims) == 0 {
 		customClaims = map[string]interface{}{}
 	}
 	return c.updateUser(ctx, uid, (&UserToUpdate{}).CustomClaims(customClaims))
 }
 
+// SetCustomUserClaimsIfChanged sets additional claims on an existing user account, only if they
+// differ from the claims currently set on the account.
+//
+// SetCustomUserClaimsIfChanged fetches the user account, and compares its current custom claims to
+// customClaims. The claims are compared by their JSON representation, so that the order of keys
+// and the Go types of numeric values do not matter. If the claims are different, updates the
+// account as SetCustomUserClaims does. Returns true if the account was updated. Avoiding
+// unnecessary updates saves quota, and prevents forcing clients to refresh their ID tokens.
+func (c *Client) SetCustomUserClaimsIfChanged(
+	ctx context.Context, uid string, customClaims map[string]interface{}) (updated bool, err error) {
+
+	defer internal.WrapOpError(&err, "SetCustomUserClaimsIfChanged", uid)
+	user, err := c.getUserByUID(ctx, uid)
+	if err != nil {
+		return false, err
+	}
+
+	if len(user.CustomClaims) == 0 && len(customClaims) == 0 {
+		return false, nil
+	}
+	equal, err := sameJSON(user.CustomClaims, customClaims)
+	if err != nil {
+		return false, fmt.Errorf("custom claims marshaling error: %v", err)
+	}
+	if equal {
+		return false, nil
+	}
+
+	if customClaims == nil {
+		customClaims = map[string]interface{}{}
+	}
+	if err := c.updateUser(ctx, uid, (&UserToUpdate{}).CustomClaims(customClaims)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// sameJSON reports whether a and b have the same JSON representation, so that for example an int
+// matches a number decoded as float64, and a []string matches an equal []interface{}.
+func sameJSON(a, b interface{}) (bool, error) {
+	normalize := func(v interface{}) (interface{}, error) {
+		j, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var n interface{}
+		err = json.Unmarshal(j, &n)
+		return n, err
+	}
+
+	na, err := normalize(a)
+	if err != nil {
+		return false, err
+	}
+	nb, err := normalize(b)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(na, nb), nil
+}
+
 func processDeletion(p map[string]interface{}, field, listKey, listVal string) {
 	if dn, ok := p[field]; ok && len(dn.(string)) == 0 {
 		addToListParam(p, listKey, listVal)
@@ -343,6 +692,45 @@ func addToListParam(p map[string]interface{}, listname, param string) {
 	}
 }
 
+func processProviders(p map[string]interface{}) error {
+	if ids, ok := p["providersToUnlink"]; ok {
+		if len(ids.([]string)) == 0 {
+			return fmt.Errorf("providers to unlink must not be empty")
+		}
+		for _, id := range ids.([]string) {
+			if id == "" {
+				return fmt.Errorf("provider id to unlink must be a non-empty string")
+			}
+			if id == "phone" && p["phoneNumber"] != nil {
+				return fmt.Errorf("phone number cannot be set while unlinking the phone provider")
+			}
+			addToListParam(p, "deleteProvider", id)
+		}
+		delete(p, "providersToUnlink")
+	}
+
+	v, ok := p["providerToLink"]
+	if !ok {
+		return nil
+	}
+	link := v.(*UserInfo)
+	if link == nil || link.ProviderID == "" || link.UID == "" {
+		return fmt.Errorf("provider to link must have a non-empty uid and provider id")
+	}
+	if link.ProviderID == "phone" || link.ProviderID == "email" {
+		return fmt.Errorf("provider %q cannot be linked; set the %s of the user instead",
+			link.ProviderID, map[string]string{"phone": "phone number", "email": "email"}[link.ProviderID])
+	}
+	if ids, ok := p["deleteProvider"]; ok {
+		for _, id := range ids.([]string) {
+			if id == link.ProviderID {
+				return fmt.Errorf("provider %q cannot be both linked and unlinked", id)
+			}
+		}
+	}
+	return nil
+}
+
 func processClaims(p map[string]interface{}) error {
 	cc, ok := p["customClaims"]
 	if !ok {
@@ -376,21 +764,60 @@ func processClaims(p map[string]interface{}) error {
 // Error handlers.
 
 const (
+	authTimeMissing          = "auth-time-missing"
+	configurationNotFound    = "configuration-not-found"
 	emailAlredyExists        = "email-already-exists"
+	idTokenExpired           = "id-token-expired"
+	idTokenInvalid           = "id-token-invalid"
 	idTokenRevoked           = "id-token-revoked"
 	insufficientPermission   = "insufficient-permission"
+	invalidAudience          = "invalid-audience"
+	invalidIssuer            = "invalid-issuer"
+	invalidSignature         = "invalid-signature"
+	issuedInFuture           = "issued-in-future"
 	phoneNumberAlreadyExists = "phone-number-already-exists"
 	projectNotFound          = "project-not-found"
+	rateLimitExceeded        = "rate-limit-exceeded"
+	secondFactorMissing      = "second-factor-missing"
+	sessionCookieExpired     = "session-cookie-expired"
+	sessionCookieInvalid     = "session-cookie-invalid"
+	sessionCookieRevoked     = "session-cookie-revoked"
+	tenantIDMismatch         = "tenant-id-mismatch"
+	tenantNotFound           = "tenant-not-found"
 	uidAlreadyExists         = "uid-already-exists"
 	unknown                  = "unknown-error"
+	userDisabled             = "user-disabled"
 	userNotFound             = "user-not-found"
 )
 
+// IsAuthTimeMissing checks if the given error was due to an ID token without an 'auth_time' claim.
+func IsAuthTimeMissing(err error) bool {
+	return internal.HasErrorCode(err, authTimeMissing)
+}
+
+// IsConfigurationNotFound checks if the given error was due to a non-existing OIDC or SAML
+// provider config.
+func IsConfigurationNotFound(err error) bool {
+	return internal.HasErrorCode(err, configurationNotFound)
+}
+
 // IsEmailAlreadyExists checks if the given error was due to a duplicate email.
 func IsEmailAlreadyExists(err error) bool {
 	return internal.HasErrorCode(err, emailAlredyExists)
 }
 
+// IsIDTokenExpired checks if the given error was due to an expired ID token.
+func IsIDTokenExpired(err error) bool {
+	return internal.HasErrorCode(err, idTokenExpired)
+}
+
+// IsIDTokenInvalid checks if the given error was due to a malformed ID token, or an ID token with
+// an invalid signature or invalid claims. Expired and revoked ID tokens are reported with their
+// own error codes.
+func IsIDTokenInvalid(err error) bool {
+	return internal.HasErrorCode(err, idTokenInvalid)
+}
+
 // IsIDTokenRevoked checks if the given error was due to a revoked ID token.
 func IsIDTokenRevoked(err error) bool {
 	return internal.HasErrorCode(err, idTokenRevoked)
@@ -401,6 +828,35 @@ func IsInsufficientPermission(err error) bool {
 	return internal.HasErrorCode(err, insufficientPermission)
 }
 
+// IsInvalidAudience checks if the given error was due to an ID token or session cookie with an
+// 'aud' (audience) claim that is not accepted by the Client. Such errors are also reported by
+// IsIDTokenInvalid() or IsSessionCookieInvalid().
+func IsInvalidAudience(err error) bool {
+	return internal.HasErrorCode(err, invalidAudience)
+}
+
+// IsInvalidIssuer checks if the given error was due to an ID token or session cookie with an 'iss'
+// (issuer) claim that is not accepted by the Client. Such errors are also reported by
+// IsIDTokenInvalid() or IsSessionCookieInvalid().
+func IsInvalidIssuer(err error) bool {
+	return internal.HasErrorCode(err, invalidIssuer)
+}
+
+// IsInvalidSignature checks if the given error was due to an ID token or session cookie whose
+// signature could not be verified with any of the public keys. This usually indicates a forged or
+// tampered token. Such errors are also reported by IsIDTokenInvalid() or IsSessionCookieInvalid().
+func IsInvalidSignature(err error) bool {
+	return internal.HasErrorCode(err, invalidSignature)
+}
+
+// IsIssuedInFuture checks if the given error was due to an ID token or session cookie that is not
+// valid yet, because its 'iat', 'nbf' or 'auth_time' claim is later than the current time plus the
+// clock skew tolerated by the Client (see WithClockSkew()). Such errors are also reported by
+// IsIDTokenInvalid() or IsSessionCookieInvalid().
+func IsIssuedInFuture(err error) bool {
+	return internal.HasErrorCode(err, issuedInFuture)
+}
+
 // IsPhoneNumberAlreadyExists checks if the given error was due to a duplicate phone number.
 func IsPhoneNumberAlreadyExists(err error) bool {
 	return internal.HasErrorCode(err, phoneNumberAlreadyExists)
@@ -411,6 +867,46 @@ func IsProjectNotFound(err error) bool {
 	return internal.HasErrorCode(err, projectNotFound)
 }
 
+// IsRateLimitExceeded checks if the given error was due to the client-side rate limit of the Client
+// being exceeded.
+func IsRateLimitExceeded(err error) bool {
+	return internal.HasErrorCode(err, rateLimitExceeded)
+}
+
+// IsSecondFactorMissing checks if the given error was due to an ID token that was not issued for a
+// multi-factor sign-in.
+func IsSecondFactorMissing(err error) bool {
+	return internal.HasErrorCode(err, secondFactorMissing)
+}
+
+// IsSessionCookieExpired checks if the given error was due to an expired session cookie.
+func IsSessionCookieExpired(err error) bool {
+	return internal.HasErrorCode(err, sessionCookieExpired)
+}
+
+// IsSessionCookieInvalid checks if the given error was due to a malformed session cookie, or a
+// session cookie with an invalid signature or invalid claims. Expired and revoked session cookies
+// are reported with their own error codes.
+func IsSessionCookieInvalid(err error) bool {
+	return internal.HasErrorCode(err, sessionCookieInvalid)
+}
+
+// IsSessionCookieRevoked checks if the given error was due to a revoked session cookie.
+func IsSessionCookieRevoked(err error) bool {
+	return internal.HasErrorCode(err, sessionCookieRevoked)
+}
+
+// IsTenantIDMismatch checks if the given error was due to a token that does not belong to the
+// expected tenant.
+func IsTenantIDMismatch(err error) bool {
+	return internal.HasErrorCode(err, tenantIDMismatch)
+}
+
+// IsTenantNotFound checks if the given error was due to a non-existing tenant.
+func IsTenantNotFound(err error) bool {
+	return internal.HasErrorCode(err, tenantNotFound)
+}
+
 // IsUIDAlreadyExists checks if the given error was due to a duplicate uid.
 func IsUIDAlreadyExists(err error) bool {
 	return internal.HasErrorCode(err, uidAlreadyExists)
@@ -421,6 +917,11 @@ func IsUnknown(err error) bool {
 	return internal.HasErrorCode(err, unknown)
 }
 
+// IsUserDisabled checks if the given error was due to an ID token of a disabled user account.
+func IsUserDisabled(err error) bool {
+	return internal.HasErrorCode(err, userDisabled)
+}
+
 // IsUserNotFound checks if the given error was due to non-existing user.
 func IsUserNotFound(err error) bool {
 	return internal.HasErrorCode(err, userNotFound)
@@ -434,6 +935,7 @@ var serverError = map[string]string{
 	"INSUFFICIENT_PERMISSION": insufficientPermission,
 	"PHONE_NUMBER_EXISTS":     phoneNumberAlreadyExists,
 	"PROJECT_NOT_FOUND":       projectNotFound,
+	"TENANT_NOT_FOUND":        tenantNotFound,
 }
 
 func handleServerError(err error) error {
@@ -547,6 +1049,9 @@ func (u *UserToUpdate) preparePayload(user *identitytoolkit.IdentitytoolkitRelyi
 	processDeletion(params, "displayName", "deleteAttribute", "DISPLAY_NAME")
 	processDeletion(params, "photoUrl", "deleteAttribute", "PHOTO_URL")
 	processDeletion(params, "phoneNumber", "deleteProvider", "phone")
+	if err := processProviders(params); err != nil {
+		return err
+	}
 
 	if err := processClaims(params); err != nil {
 		return err
@@ -595,6 +1100,15 @@ func (u *UserToUpdate) preparePayload(user *identitytoolkit.IdentitytoolkitRelyi
 
 // Helper functions for retrieval and HTTP calls.
 
+// beforeRequest must be called before each request to the Firebase Auth backend services. It fails
+// for verify-only clients, and otherwise waits for the rate limit of the Client, if any.
+func (c *Client) beforeRequest(ctx context.Context) error {
+	if c.is == nil {
+		return errVerifyOnly
+	}
+	return c.limiter.wait(ctx)
+}
+
 func (c *Client) createUser(ctx context.Context, user *UserToCreate) (string, error) {
 	if user == nil {
 		user = &UserToCreate{}
@@ -606,6 +1120,16 @@ func (c *Client) createUser(ctx context.Context, user *UserToCreate) (string, er
 		return "", err
 	}
 
+	if c.tenantID != "" {
+		var resp identitytoolkit.SignupNewUserResponse
+		if err := c.makeTenantUserRequest(ctx, http.MethodPost, "accounts", request, &resp); err != nil {
+			return "", err
+		}
+		return resp.LocalId, nil
+	}
+	if err := c.beforeRequest(ctx); err != nil {
+		return "", err
+	}
 	call := c.is.Relyingparty.SignupNewUser(request)
 	c.setHeader(call)
 	resp, err := call.Context(ctx).Do()
@@ -631,6 +1155,50 @@ func (c *Client) updateUser(ctx context.Context, uid string, user *UserToUpdate)
 		return err
 	}
 
+	mfa, hasMFA := user.params["mfa"].(MultiFactorSettings)
+	if hasMFA && c.tenantID == "" && c.projectID == "" {
+		return fmt.Errorf("project id is required to update multi-factor settings")
+	}
+	link, hasLink := user.params["providerToLink"].(*UserInfo)
+	if hasLink && c.tenantID == "" && c.projectID == "" {
+		return fmt.Errorf("project id is required to link providers")
+	}
+	if c.tenantID != "" || c.projectID != "" {
+		fields := map[string]interface{}{}
+		if hasMFA {
+			enrollments, err := mfaEnrollments(mfa)
+			if err != nil {
+				return err
+			}
+			// An empty list of factors removes all the second factors of the user.
+			m := map[string]interface{}{}
+			if len(enrollments) > 0 {
+				m["enrollments"] = enrollments
+			}
+			fields["mfa"] = m
+		}
+		if hasLink {
+			fields["linkProviderUserInfo"] = &identitytoolkit.UserInfoProviderUserInfo{
+				DisplayName: link.DisplayName,
+				Email:       link.Email,
+				PhoneNumber: link.PhoneNumber,
+				PhotoUrl:    link.PhotoURL,
+				ProviderId:  link.ProviderID,
+				RawId:       link.UID,
+			}
+		}
+		var body interface{} = request
+		if len(fields) > 0 {
+			var err error
+			if body, err = withFields(request, fields); err != nil {
+				return err
+			}
+		}
+		return c.makeUserRequest(ctx, http.MethodPost, "accounts:update", body, nil)
+	}
+	if err := c.beforeRequest(ctx); err != nil {
+		return err
+	}
 	call := c.is.Relyingparty.SetAccountInfo(request)
 	c.setHeader(call)
 	if _, err := call.Context(ctx).Do(); err != nil {
@@ -640,11 +1208,9 @@ func (c *Client) updateUser(ctx context.Context, uid string, user *UserToUpdate)
 }
 
 func (c *Client) getUser(ctx context.Context, request *identitytoolkit.IdentitytoolkitRelyingpartyGetAccountInfoRequest) (*UserRecord, error) {
-	call := c.is.Relyingparty.GetAccountInfo(request)
-	c.setHeader(call)
-	resp, err := call.Context(ctx).Do()
+	resp, err := c.getAccountInfo(ctx, request)
 	if err != nil {
-		return nil, handleServerError(err)
+		return nil, err
 	}
 	if len(resp.Users) == 0 {
 		var msg string
@@ -658,13 +1224,184 @@ func (c *Client) getUser(ctx context.Context, request *identitytoolkit.Identityt
 		return nil, internal.Error(userNotFound, msg)
 	}
 
-	eu, err := makeExportedUser(resp.Users[0])
+	return makeUserRecord(resp.Users[0])
+}
+
+func makeUserRecord(u *lookupUser) (*UserRecord, error) {
+	eu, err := makeExportedUser(u.info())
 	if err != nil {
 		return nil, err
 	}
+	if eu.MultiFactor, err = makeMultiFactorSettings(u.MfaInfo); err != nil {
+		return nil, err
+	}
 	return eu.UserRecord, nil
 }
 
+// lookupResponse is the response of the accounts:lookup endpoint of the Identity Toolkit v1 API.
+// The identitytoolkit v3 types it reuses do not carry the multi-factor enrollments of the users.
+type lookupResponse struct {
+	Kind  string        `json:"kind,omitempty"`
+	Users []*lookupUser `json:"users"`
+}
+
+// userInfo has the fields of identitytoolkit.UserInfo, but not its UnmarshalJSON method. Once
+// promoted to lookupUser, that method would decode the users by itself, ignoring their
+// multi-factor enrollments and the settings of the decoder.
+type userInfo identitytoolkit.UserInfo
+
+type lookupUser struct {
+	userInfo
+	MfaInfo []*mfaEnrollment `json:"mfaInfo,omitempty"`
+}
+
+func (u *lookupUser) info() *identitytoolkit.UserInfo {
+	return (*identitytoolkit.UserInfo)(&u.userInfo)
+}
+
+// mfaEnrollment is a second factor as represented by the Identity Toolkit v1 API.
+type mfaEnrollment struct {
+	MfaEnrollmentID string `json:"mfaEnrollmentId,omitempty"`
+	DisplayName     string `json:"displayName,omitempty"`
+	PhoneInfo       string `json:"phoneInfo,omitempty"`
+	EnrolledAt      string `json:"enrolledAt,omitempty"`
+}
+
+// getAccountInfo looks up user accounts. The accounts are looked up with the v1 API when the
+// project ID of the Client is known, and with the v3 API, which does not report the second factors
+// of the users, otherwise.
+func (c *Client) getAccountInfo(
+	ctx context.Context,
+	request *identitytoolkit.IdentitytoolkitRelyingpartyGetAccountInfoRequest) (*lookupResponse, error) {
+
+	resp := &lookupResponse{}
+	if c.tenantID != "" || c.projectID != "" {
+		if err := c.makeUserRequest(ctx, http.MethodPost, "accounts:lookup", request, resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+	if err := c.beforeRequest(ctx); err != nil {
+		return nil, err
+	}
+	call := c.is.Relyingparty.GetAccountInfo(request)
+	c.setHeader(call)
+	v3, err := call.Context(ctx).Do()
+	if err != nil {
+		return nil, handleServerError(err)
+	}
+	for _, u := range v3.Users {
+		resp.Users = append(resp.Users, &lookupUser{userInfo: userInfo(*u)})
+	}
+	return resp, nil
+}
+
+// makeUserRequest sends a request to the given user management action of the Identity Toolkit v1
+// API, scoped to the tenant of the Client if it has one.
+//
+// Outside of tenants, these requests replace calls to the v3 API, and their errors are reported in
+// the same format as those of the v3 calls.
+func (c *Client) makeUserRequest(
+	ctx context.Context, method, action string, body, v interface{}, opts ...internal.HTTPOption) error {
+
+	if c.tenantID != "" {
+		return c.makeTenantUserRequest(ctx, method, action, body, v, opts...)
+	}
+	if c.projectID == "" {
+		return fmt.Errorf("project id not available")
+	}
+	url := fmt.Sprintf("%s/projects/%s/%s", c.idToolkitV1Endpoint, c.projectID, action)
+	resp, err := c.sendAdminRequest(ctx, method, url, body, opts...)
+	if err != nil {
+		return err
+	}
+	if err := googleapi.CheckResponse(&http.Response{
+		StatusCode: resp.Status,
+		Header:     resp.Header,
+		Body:       ioutil.NopCloser(bytes.NewReader(resp.Body)),
+	}); err != nil {
+		return handleServerError(err)
+	}
+	if v == nil {
+		return nil
+	}
+	return c.decoder.unmarshal(resp.Body, v)
+}
+
+func makeMultiFactorSettings(enrollments []*mfaEnrollment) (*MultiFactorSettings, error) {
+	if len(enrollments) == 0 {
+		return nil, nil
+	}
+	mfa := &MultiFactorSettings{}
+	for _, e := range enrollments {
+		info := &MultiFactorInfo{
+			UID:         e.MfaEnrollmentID,
+			DisplayName: e.DisplayName,
+			PhoneNumber: e.PhoneInfo,
+		}
+		if e.PhoneInfo != "" {
+			info.FactorID = "phone"
+		}
+		if e.EnrolledAt != "" {
+			t, err := time.Parse(time.RFC3339Nano, e.EnrolledAt)
+			if err != nil {
+				return nil, fmt.Errorf("invalid enrollment time for second factor %q: %v", e.MfaEnrollmentID, err)
+			}
+			info.EnrollmentTimestamp = t.UnixNano() / int64(time.Millisecond)
+		}
+		mfa.EnrolledFactors = append(mfa.EnrolledFactors, info)
+	}
+	return mfa, nil
+}
+
+func mfaEnrollments(mfa MultiFactorSettings) ([]*mfaEnrollment, error) {
+	enrollments := []*mfaEnrollment{}
+	for i, f := range mfa.EnrolledFactors {
+		if f == nil {
+			return nil, fmt.Errorf("enrolled factor at index %d must not be nil", i)
+		}
+		if f.FactorID != "phone" {
+			return nil, fmt.Errorf("enrolled factor at index %d has unsupported factor id: %q; want: %q",
+				i, f.FactorID, "phone")
+		}
+		if err := validatePhone(f.PhoneNumber); err != nil {
+			return nil, fmt.Errorf("enrolled factor at index %d: %v", i, err)
+		}
+		e := &mfaEnrollment{
+			MfaEnrollmentID: f.UID,
+			DisplayName:     f.DisplayName,
+			PhoneInfo:       f.PhoneNumber,
+		}
+		if f.EnrollmentTimestamp > 0 {
+			ms := f.EnrollmentTimestamp
+			e.EnrolledAt = time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano)
+		}
+		enrollments = append(enrollments, e)
+	}
+	return enrollments, nil
+}
+
+// withFields returns the body of an accounts:update request, which contains the given fields in
+// addition to the fields of request. These are fields the v3 API used by request does not support,
+// such as the second factors and the provider to link.
+func withFields(
+	request *identitytoolkit.IdentitytoolkitRelyingpartySetAccountInfoRequest,
+	fields map[string]interface{}) (map[string]interface{}, error) {
+
+	b, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(b, &body); err != nil {
+		return nil, err
+	}
+	for k, v := range fields {
+		body[k] = v
+	}
+	return body, nil
+}
+
 func makeExportedUser(r *identitytoolkit.UserInfo) (*ExportedUserRecord, error) {
 	var cc map[string]interface{}
 	if r.CustomAttributes != "" {
@@ -17,6 +17,7 @@ package auth
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -149,19 +150,19 @@ func TestGetNonExistingUser(t *testing.T) {
 	s := echoServer([]byte(resp), t)
 	defer s.Close()
 
-	we := `cannot find user from uid: "id-nonexisting"`
+	we := `GetUser("id-nonexisting"): cannot find user from uid: "id-nonexisting"`
 	user, err := s.Client.GetUser(context.Background(), "id-nonexisting")
 	if user != nil || err == nil || err.Error() != we || !IsUserNotFound(err) {
 		t.Errorf("GetUser(non-existing) = (%v, %q); want = (nil, %q)", user, err, we)
 	}
 
-	we = `cannot find user from email: "foo@bar.nonexisting"`
+	we = `GetUserByEmail: cannot find user from email: "foo@bar.nonexisting"`
 	user, err = s.Client.GetUserByEmail(context.Background(), "foo@bar.nonexisting")
 	if user != nil || err == nil || err.Error() != we || !IsUserNotFound(err) {
 		t.Errorf("GetUserByEmail(non-existing) = (%v, %q); want = (nil, %q)", user, err, we)
 	}
 
-	we = `cannot find user from phone number: "+12345678901"`
+	we = `GetUserByPhoneNumber: cannot find user from phone number: "+12345678901"`
 	user, err = s.Client.GetUserByPhoneNumber(context.Background(), "+12345678901")
 	if user != nil || err == nil || err.Error() != we || !IsUserNotFound(err) {
 		t.Errorf("GetUserPhoneNumber(non-existing) = (%v, %q); want = (nil, %q)", user, err, we)
@@ -222,6 +223,213 @@ func TestListUsers(t *testing.T) {
 		"pageToken", map[string]interface{}{"maxResults": 1000, "nextPageToken": "pageToken"})
 }
 
+func TestListUsersWithFields(t *testing.T) {
+	s := echoServer(testListUsersResponse, t)
+	defer s.Close()
+
+	it := s.Client.UsersWithFields(context.Background(), "", UserFieldEmail, UserFieldCustomClaims)
+	if _, err := it.Next(); err != nil {
+		t.Fatal(err)
+	}
+	want := "users(localId,email,customAttributes),nextPageToken"
+	if got := s.Req[0].URL.Query().Get("fields"); got != want {
+		t.Errorf("UsersWithFields() fields = %q; want = %q", got, want)
+	}
+
+	it = s.Client.Users(context.Background(), "")
+	if _, err := it.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Req[1].URL.Query()["fields"]; ok {
+		t.Errorf("Users() fields = %q; want none", s.Req[1].URL.Query().Get("fields"))
+	}
+}
+
+func TestUserFieldMask(t *testing.T) {
+	cases := []struct {
+		fields []UserField
+		want   string
+	}{
+		{nil, ""},
+		{[]UserField{UserFieldCustomClaims}, "users(localId,customAttributes),nextPageToken"},
+		{
+			[]UserField{UserFieldMetadata, UserFieldPasswordHash},
+			"users(localId,createdAt,lastLoginAt,passwordHash,salt),nextPageToken",
+		},
+	}
+	for _, tc := range cases {
+		if got := userFieldMask(tc.fields); string(got) != tc.want {
+			t.Errorf("userFieldMask(%v) = %q; want = %q", tc.fields, got, tc.want)
+		}
+	}
+}
+
+func TestExportCustomClaims(t *testing.T) {
+	s := echoServer(testListUsersResponse, t)
+	defer s.Close()
+
+	var got []*UserClaims
+	err := s.Client.ExportCustomClaims(context.Background(), nil, func(uc *UserClaims) error {
+		got = append(got, uc)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &UserClaims{UID: "testuser", CustomClaims: testUser.CustomClaims}
+	if len(got) != 3 {
+		t.Fatalf("ExportCustomClaims() = %d users; want = 3", len(got))
+	}
+	for _, uc := range got {
+		if !reflect.DeepEqual(uc, want) {
+			t.Errorf("ExportCustomClaims() = %#v; want = %#v", uc, want)
+		}
+	}
+	if len(s.Req) != 1 {
+		t.Fatalf("requests = %d; want = 1", len(s.Req))
+	}
+	fields := "users(localId,customAttributes),nextPageToken"
+	if got := s.Req[0].URL.Query().Get("fields"); got != fields {
+		t.Errorf("ExportCustomClaims() fields = %q; want = %q", got, fields)
+	}
+}
+
+func TestExportCustomClaimsCallbackError(t *testing.T) {
+	s := echoServer(testListUsersResponse, t)
+	defer s.Close()
+
+	want := errors.New("callback error")
+	count := 0
+	err := s.Client.ExportCustomClaims(context.Background(), nil, func(uc *UserClaims) error {
+		count++
+		return want
+	})
+	if err != want || count != 1 {
+		t.Errorf("ExportCustomClaims() = (%v, %d calls); want = (%v, 1 call)", err, count, want)
+	}
+}
+
+func TestExportCustomClaimsCancel(t *testing.T) {
+	s := echoServer(testListUsersResponse, t)
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	count := 0
+	err := s.Client.ExportCustomClaims(ctx, nil, func(uc *UserClaims) error {
+		count++
+		cancel()
+		return nil
+	})
+	if err != context.Canceled || count != 1 {
+		t.Errorf("ExportCustomClaims() = (%v, %d calls); want = (%v, 1 call)", err, count, context.Canceled)
+	}
+}
+
+func TestExportUsersCheckpoint(t *testing.T) {
+	s := echoServer(testListUsersResponse, t)
+	defer s.Close()
+	var tokens []string
+	srv := pagedListUsersServer(t, &tokens)
+	defer srv.Close()
+	s.Client.is.BasePath = srv.URL + "/"
+
+	var hashes, checkpoints []string
+	opts := &ExportOptions{
+		Checkpoint: func(pageToken string) error {
+			checkpoints = append(checkpoints, pageToken)
+			return nil
+		},
+	}
+	err := s.Client.ExportUsers(context.Background(), opts, func(u *ExportedUserRecord) error {
+		hashes = append(hashes, u.PasswordHash)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHashes := []string{
+		"passwordhash1", "passwordhash2", "passwordhash3", "passwordhash1", "passwordhash2", "passwordhash3",
+	}
+	if !reflect.DeepEqual(hashes, wantHashes) {
+		t.Errorf("ExportUsers() = %v; want = %v", hashes, wantHashes)
+	}
+	if want := []string{"page2", ""}; !reflect.DeepEqual(checkpoints, want) {
+		t.Errorf("Checkpoints = %q; want = %q", checkpoints, want)
+	}
+	if want := []string{"", "page2"}; !reflect.DeepEqual(tokens, want) {
+		t.Errorf("Requested pages = %q; want = %q", tokens, want)
+	}
+}
+
+func TestExportUsersResume(t *testing.T) {
+	s := echoServer(testListUsersResponse, t)
+	defer s.Close()
+	var tokens []string
+	srv := pagedListUsersServer(t, &tokens)
+	defer srv.Close()
+	s.Client.is.BasePath = srv.URL + "/"
+
+	count := 0
+	opts := &ExportOptions{PageToken: "page2"}
+	err := s.Client.ExportUsers(context.Background(), opts, func(u *ExportedUserRecord) error {
+		count++
+		return nil
+	})
+	if err != nil || count != 3 {
+		t.Errorf("ExportUsers() = (%v, %d users); want = (nil, 3 users)", err, count)
+	}
+	if want := []string{"page2"}; !reflect.DeepEqual(tokens, want) {
+		t.Errorf("Requested pages = %q; want = %q", tokens, want)
+	}
+}
+
+func TestExportUsersCheckpointError(t *testing.T) {
+	s := echoServer(testListUsersResponse, t)
+	defer s.Close()
+	var tokens []string
+	srv := pagedListUsersServer(t, &tokens)
+	defer srv.Close()
+	s.Client.is.BasePath = srv.URL + "/"
+
+	want := errors.New("checkpoint error")
+	opts := &ExportOptions{
+		Checkpoint: func(pageToken string) error {
+			return want
+		},
+	}
+	err := s.Client.ExportUsers(context.Background(), opts, func(u *ExportedUserRecord) error {
+		return nil
+	})
+	if err != want || len(tokens) != 1 {
+		t.Errorf("ExportUsers() = (%v, %d pages); want = (%v, 1 page)", err, len(tokens), want)
+	}
+}
+
+// pagedListUsersServer serves two pages of the test users, and records the requested page tokens.
+func pagedListUsersServer(t *testing.T, tokens *[]string) *httptest.Server {
+	var page map[string]interface{}
+	if err := json.Unmarshal(testListUsersResponse, &page); err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		*tokens = append(*tokens, req.NextPageToken)
+		if req.NextPageToken == "" {
+			page["nextPageToken"] = "page2"
+		} else {
+			page["nextPageToken"] = ""
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	}))
+}
+
 func TestInvalidCreateUser(t *testing.T) {
 	cases := []struct {
 		params *UserToCreate
@@ -273,8 +481,8 @@ func TestInvalidCreateUser(t *testing.T) {
 		if user != nil || err == nil {
 			t.Errorf("[%d] CreateUser() = (%v, %v); want = (nil, error)", i, user, err)
 		}
-		if err.Error() != tc.want {
-			t.Errorf("[%d] CreateUser() = %v; want = %v", i, err.Error(), tc.want)
+		if want := "CreateUser: " + tc.want; err.Error() != want {
+			t.Errorf("[%d] CreateUser() = %v; want = %v", i, err.Error(), want)
 		}
 	}
 }
@@ -376,6 +584,32 @@ func TestInvalidUpdateUser(t *testing.T) {
 		}, {
 			(&UserToUpdate{}).CustomClaims(map[string]interface{}{"a": strings.Repeat("a", 993)}),
 			"serialized custom claims must not exceed 1000 characters",
+		}, {
+			(&UserToUpdate{}).ProvidersToUnlink(),
+			"providers to unlink must not be empty",
+		}, {
+			(&UserToUpdate{}).ProvidersToUnlink("google.com", ""),
+			"provider id to unlink must be a non-empty string",
+		}, {
+			(&UserToUpdate{}).PhoneNumber("+11234567890").ProvidersToUnlink("phone"),
+			"phone number cannot be set while unlinking the phone provider",
+		}, {
+			(&UserToUpdate{}).ProviderToLink(nil),
+			"provider to link must have a non-empty uid and provider id",
+		}, {
+			(&UserToUpdate{}).ProviderToLink(&UserInfo{ProviderID: "google.com"}),
+			"provider to link must have a non-empty uid and provider id",
+		}, {
+			(&UserToUpdate{}).ProviderToLink(&UserInfo{ProviderID: "phone", UID: "+11234567890"}),
+			`provider "phone" cannot be linked; set the phone number of the user instead`,
+		}, {
+			(&UserToUpdate{}).ProviderToLink(&UserInfo{ProviderID: "email", UID: "user@example.com"}),
+			`provider "email" cannot be linked; set the email of the user instead`,
+		}, {
+			(&UserToUpdate{}).
+				ProviderToLink(&UserInfo{ProviderID: "google.com", UID: "google_uid"}).
+				ProvidersToUnlink("google.com"),
+			`provider "google.com" cannot be both linked and unlinked`,
 		},
 	}
 
@@ -395,8 +629,8 @@ func TestInvalidUpdateUser(t *testing.T) {
 		if user != nil || err == nil {
 			t.Errorf("[%d] UpdateUser() = (%v, %v); want = (nil, error)", i, user, err)
 		}
-		if err.Error() != tc.want {
-			t.Errorf("[%d] UpdateUser() = %v; want = %v", i, err.Error(), tc.want)
+		if want := `UpdateUser("uid"): ` + tc.want; err.Error() != want {
+			t.Errorf("[%d] UpdateUser() = %v; want = %v", i, err.Error(), want)
 		}
 	}
 }
@@ -476,6 +710,14 @@ func TestUpdateUser(t *testing.T) {
 				"deleteProvider":  []string{"phone"},
 			},
 		},
+		{
+			(&UserToUpdate{}).ProvidersToUnlink("google.com", "facebook.com"),
+			map[string]interface{}{"deleteProvider": []string{"google.com", "facebook.com"}},
+		},
+		{
+			(&UserToUpdate{}).PhoneNumber("").ProvidersToUnlink("google.com"),
+			map[string]interface{}{"deleteProvider": []string{"phone", "google.com"}},
+		},
 		{
 			(&UserToUpdate{}).CustomClaims(map[string]interface{}{"a": strings.Repeat("a", 992)}),
 			map[string]interface{}{"customAttributes": fmt.Sprintf(`{"a":%q}`, strings.Repeat("a", 992))},
@@ -504,6 +746,261 @@ func TestUpdateUser(t *testing.T) {
 		}
 	}
 }
+
+func TestGetUserMultiFactor(t *testing.T) {
+	resp := `{
+		"users": [{
+			"localId": "testuser",
+			"mfaInfo": [
+				{
+					"mfaEnrollmentId": "enrollment1",
+					"displayName": "Work phone",
+					"phoneInfo": "+11234567890",
+					"enrolledAt": "2014-10-03T15:01:23.456Z"
+				},
+				{"mfaEnrollmentId": "enrollment2", "phoneInfo": "+16505551234"}
+			]
+		}]
+	}`
+	s := echoServer([]byte(resp), t)
+	defer s.Close()
+
+	user, err := s.Client.GetUser(context.Background(), "testuser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &MultiFactorSettings{
+		EnrolledFactors: []*MultiFactorInfo{
+			{
+				UID:                 "enrollment1",
+				DisplayName:         "Work phone",
+				EnrollmentTimestamp: 1412348483456,
+				FactorID:            "phone",
+				PhoneNumber:         "+11234567890",
+			},
+			{UID: "enrollment2", FactorID: "phone", PhoneNumber: "+16505551234"},
+		},
+	}
+	if !reflect.DeepEqual(user.MultiFactor, want) {
+		t.Errorf("MultiFactor = %#v; want = %#v", user.MultiFactor, want)
+	}
+	if got, want := s.Req[0].URL.Path, "/projects/mock-project-id/accounts:lookup"; got != want {
+		t.Errorf("Path = %q; want = %q", got, want)
+	}
+}
+
+func TestUpdateUserMultiFactor(t *testing.T) {
+	s := echoServer([]byte(`{"localId": "uid"}`), t)
+	defer s.Close()
+
+	cases := []struct {
+		factors []*MultiFactorInfo
+		want    map[string]interface{}
+	}{
+		{
+			[]*MultiFactorInfo{
+				{
+					UID:                 "enrollment1",
+					DisplayName:         "Work phone",
+					EnrollmentTimestamp: 1412348483456,
+					FactorID:            "phone",
+					PhoneNumber:         "+11234567890",
+				},
+				{FactorID: "phone", PhoneNumber: "+16505551234"},
+			},
+			map[string]interface{}{
+				"enrollments": []interface{}{
+					map[string]interface{}{
+						"mfaEnrollmentId": "enrollment1",
+						"displayName":     "Work phone",
+						"phoneInfo":       "+11234567890",
+						"enrolledAt":      "2014-10-03T15:01:23.456Z",
+					},
+					map[string]interface{}{"phoneInfo": "+16505551234"},
+				},
+			},
+		},
+		{nil, map[string]interface{}{}},
+		{[]*MultiFactorInfo{}, map[string]interface{}{}},
+	}
+	for _, tc := range cases {
+		user := (&UserToUpdate{}).DisplayName("Test").MFASettings(MultiFactorSettings{EnrolledFactors: tc.factors})
+		if err := s.Client.updateUser(context.Background(), "uid", user); err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal(s.Rbody, &got); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]interface{}{"localId": "uid", "displayName": "Test", "mfa": tc.want}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("updateUser() request = %v; want = %v", got, want)
+		}
+		if got, want := s.Req[len(s.Req)-1].URL.Path, "/projects/mock-project-id/accounts:update"; got != want {
+			t.Errorf("Path = %q; want = %q", got, want)
+		}
+	}
+}
+
+func TestUpdateUserProviderToLink(t *testing.T) {
+	s := echoServer([]byte(`{"localId": "uid"}`), t)
+	defer s.Close()
+
+	provider := &UserInfo{
+		ProviderID:  "google.com",
+		UID:         "google_uid",
+		DisplayName: "Test User",
+		Email:       "user@example.com",
+	}
+	user := (&UserToUpdate{}).ProviderToLink(provider).ProvidersToUnlink("facebook.com")
+	if err := s.Client.updateUser(context.Background(), "uid", user); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(s.Rbody, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"localId":        "uid",
+		"deleteProvider": []interface{}{"facebook.com"},
+		"linkProviderUserInfo": map[string]interface{}{
+			"providerId":  "google.com",
+			"rawId":       "google_uid",
+			"displayName": "Test User",
+			"email":       "user@example.com",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("updateUser() request = %v; want = %v", got, want)
+	}
+	if got, want := s.Req[0].URL.Path, "/projects/mock-project-id/accounts:update"; got != want {
+		t.Errorf("Path = %q; want = %q", got, want)
+	}
+
+	s.Client.projectID = ""
+	msg := "project id is required to link providers"
+	if err := s.Client.updateUser(context.Background(), "uid", user); err == nil || err.Error() != msg {
+		t.Errorf("updateUser(no project) = %v; want = %q", err, msg)
+	}
+}
+
+func TestUpdateUserInvalidMultiFactor(t *testing.T) {
+	s := echoServer([]byte(`{"localId": "uid"}`), t)
+	defer s.Close()
+
+	cases := []*MultiFactorInfo{
+		nil,
+		{FactorID: "totp", PhoneNumber: "+11234567890"},
+		{FactorID: "phone"},
+		{FactorID: "phone", PhoneNumber: "1234567890"},
+	}
+	for _, f := range cases {
+		user := (&UserToUpdate{}).MFASettings(MultiFactorSettings{EnrolledFactors: []*MultiFactorInfo{f}})
+		if err := s.Client.updateUser(context.Background(), "uid", user); err == nil {
+			t.Errorf("updateUser(%#v) = nil; want = error", f)
+		}
+	}
+	if len(s.Req) != 0 {
+		t.Errorf("Requests = %d; want = 0", len(s.Req))
+	}
+
+	s.Client.projectID = ""
+	user := (&UserToUpdate{}).MFASettings(MultiFactorSettings{})
+	want := "project id is required to update multi-factor settings"
+	if err := s.Client.updateUser(context.Background(), "uid", user); err == nil || err.Error() != want {
+		t.Errorf("updateUser(no project) = %v; want = %q", err, want)
+	}
+}
+
+func TestDeleteUsers(t *testing.T) {
+	resp := `{
+		"errors": [
+			{"index": 1, "localId": "uid2", "message": "NOT_DISABLED : Disable the account before batch deletion."}
+		]
+	}`
+	s := echoServer([]byte(resp), t)
+	defer s.Close()
+
+	result, err := s.Client.DeleteUsers(context.Background(), []string{"uid1", "uid2", "uid3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &DeleteUsersResult{
+		SuccessCount: 2,
+		FailureCount: 1,
+		Errors: []*ErrorInfo{
+			{Index: 1, Reason: "NOT_DISABLED : Disable the account before batch deletion."},
+		},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("DeleteUsers() = %#v; want = %#v", result, want)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(s.Rbody, &got); err != nil {
+		t.Fatal(err)
+	}
+	wantReq := map[string]interface{}{
+		"localIds": []interface{}{"uid1", "uid2", "uid3"},
+		"force":    true,
+	}
+	if !reflect.DeepEqual(got, wantReq) {
+		t.Errorf("DeleteUsers() request = %v; want = %v", got, wantReq)
+	}
+	if got, want := s.Req[0].URL.Path, "/projects/mock-project-id/accounts:batchDelete"; got != want {
+		t.Errorf("Path = %q; want = %q", got, want)
+	}
+}
+
+func TestDeleteUsersEmpty(t *testing.T) {
+	s := echoServer([]byte("{}"), t)
+	defer s.Close()
+
+	result, err := s.Client.DeleteUsers(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, &DeleteUsersResult{}) {
+		t.Errorf("DeleteUsers() = %#v; want = empty result", result)
+	}
+	if len(s.Req) != 0 {
+		t.Errorf("Requests = %d; want = 0", len(s.Req))
+	}
+}
+
+func TestInvalidDeleteUsers(t *testing.T) {
+	var tooMany []string
+	for i := 0; i <= maxDeleteUsers; i++ {
+		tooMany = append(tooMany, fmt.Sprintf("uid%d", i))
+	}
+	cases := []struct {
+		name string
+		uids []string
+		want string
+	}{
+		{"TooMany", tooMany, "DeleteUsers: uids list must not contain more than 1000 elements"},
+		{"EmptyUID", []string{"uid1", ""}, "DeleteUsers: uid must not be empty"},
+		{"LongUID", []string{strings.Repeat("a", 129)}, "DeleteUsers: uid string must not be longer than 128 characters"},
+	}
+	for _, tc := range cases {
+		result, err := client.DeleteUsers(context.Background(), tc.uids)
+		if result != nil || err == nil || err.Error() != tc.want {
+			t.Errorf("DeleteUsers(%s) = (%v, %v); want = (nil, %q)", tc.name, result, err, tc.want)
+		}
+	}
+}
+
+func TestDeleteUsersError(t *testing.T) {
+	s := echoServer([]byte(`{"error": {"message": "INSUFFICIENT_PERMISSION"}}`), t)
+	defer s.Close()
+	s.Status = http.StatusForbidden
+
+	result, err := s.Client.DeleteUsers(context.Background(), []string{"uid1"})
+	if result != nil || err == nil || !IsInsufficientPermission(err) {
+		t.Errorf("DeleteUsers() = (%v, %v); want = (nil, InsufficientPermission)", result, err)
+	}
+}
+
 func TestRevokeRefreshTokens(t *testing.T) {
 	resp := `{
 		"kind": "identitytoolkit#SetAccountInfoResponse",
@@ -534,7 +1031,7 @@ func TestRevokeRefreshTokensInvalidUID(t *testing.T) {
 	s := echoServer([]byte(resp), t)
 	defer s.Close()
 
-	we := "uid must not be empty"
+	we := "RevokeRefreshTokens: uid must not be empty"
 	if err := s.Client.RevokeRefreshTokens(context.Background(), ""); err == nil || err.Error() != we {
 		t.Errorf("RevokeRefreshTokens(); err = %s; want err = %s", err.Error(), we)
 	}
@@ -571,8 +1068,8 @@ func TestInvalidSetCustomClaims(t *testing.T) {
 		if err == nil {
 			t.Errorf("SetCustomUserClaims() = nil; want error: %s", tc.want)
 		}
-		if err.Error() != tc.want {
-			t.Errorf("SetCustomUserClaims() = %q; want = %q", err.Error(), tc.want)
+		if want := `SetCustomUserClaims("uid"): ` + tc.want; err.Error() != want {
+			t.Errorf("SetCustomUserClaims() = %q; want = %q", err.Error(), want)
 		}
 	}
 }
@@ -620,6 +1117,115 @@ func TestSetCustomClaims(t *testing.T) {
 	}
 }
 
+func TestSetCustomClaimsIfChangedUnchanged(t *testing.T) {
+	cases := []map[string]interface{}{
+		{"admin": true, "package": "gold"},
+		{"package": "gold", "admin": true},
+	}
+
+	s := echoServer(testGetUserResponse, t)
+	defer s.Close()
+	for _, tc := range cases {
+		s.Req = nil
+		updated, err := s.Client.SetCustomUserClaimsIfChanged(context.Background(), "uid", tc)
+		if updated || err != nil {
+			t.Errorf("SetCustomUserClaimsIfChanged(%v) = (%v, %v); want = (false, nil)", tc, updated, err)
+		}
+		if len(s.Req) != 1 {
+			t.Errorf("Requests = %d; want = 1", len(s.Req))
+		}
+	}
+}
+
+func TestSetCustomClaimsIfChanged(t *testing.T) {
+	cases := []map[string]interface{}{
+		nil,
+		{"admin": false, "package": "gold"},
+		{"admin": true, "package": "gold", "level": 1},
+		{"admin": true, "package": map[string]interface{}{"name": "gold"}},
+	}
+
+	s := echoServer(testGetUserResponse, t)
+	defer s.Close()
+	for _, tc := range cases {
+		s.Req = nil
+		updated, err := s.Client.SetCustomUserClaimsIfChanged(context.Background(), "uid", tc)
+		if !updated || err != nil {
+			t.Errorf("SetCustomUserClaimsIfChanged(%v) = (%v, %v); want = (true, nil)", tc, updated, err)
+		}
+		if len(s.Req) != 2 {
+			t.Errorf("Requests = %d; want = 2", len(s.Req))
+		}
+
+		input := tc
+		if input == nil {
+			input = map[string]interface{}{}
+		}
+		b, err := json.Marshal(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := json.Marshal(map[string]interface{}{
+			"localId":          "uid",
+			"customAttributes": string(b),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(s.Rbody, want) {
+			t.Errorf("SetCustomUserClaimsIfChanged() = %v; want = %v", string(s.Rbody), string(want))
+		}
+	}
+}
+
+func TestSetCustomClaimsIfChangedError(t *testing.T) {
+	s := echoServer(testGetUserResponse, t)
+	defer s.Close()
+
+	cases := []struct {
+		name   string
+		uid    string
+		claims map[string]interface{}
+	}{
+		{"EmptyUID", "", nil},
+		{"ReservedClaim", "uid", map[string]interface{}{"sub": "1234"}},
+		{"InvalidClaims", "uid", map[string]interface{}{"a": func() {}}},
+	}
+	for _, tc := range cases {
+		updated, err := s.Client.SetCustomUserClaimsIfChanged(context.Background(), tc.uid, tc.claims)
+		if updated || err == nil {
+			t.Errorf("SetCustomUserClaimsIfChanged(%s) = (%v, %v); want = (false, error)", tc.name, updated, err)
+		}
+	}
+}
+
+func TestSameJSON(t *testing.T) {
+	cases := []struct {
+		current, desired interface{}
+		want             bool
+	}{
+		{nil, nil, true},
+		{nil, map[string]interface{}{}, false},
+		{float64(1), 1, true},
+		{"1", 1, false},
+		{map[string]interface{}{"n": float64(1)}, map[string]interface{}{"n": 1}, true},
+		{
+			map[string]interface{}{"roles": []interface{}{"a", "b"}, "org": map[string]interface{}{"id": "x"}},
+			map[string]interface{}{"org": map[string]string{"id": "x"}, "roles": []string{"a", "b"}},
+			true,
+		},
+		{map[string]interface{}{"roles": []interface{}{"a", "b"}}, map[string]interface{}{"roles": []string{"b", "a"}}, false},
+		{nil, map[string]interface{}{"admin": true}, false},
+		{map[string]interface{}{"admin": true}, map[string]interface{}{"admin": "true"}, false},
+	}
+	for i, tc := range cases {
+		got, err := sameJSON(tc.current, tc.desired)
+		if got != tc.want || err != nil {
+			t.Errorf("[%d] sameJSON() = (%v, %v); want = (%v, nil)", i, got, err, tc.want)
+		}
+	}
+}
+
 func TestDeleteUser(t *testing.T) {
 	resp := `{
 		"kind": "identitytoolkit#SignupNewUserResponse",
@@ -700,7 +1306,7 @@ func TestHTTPError(t *testing.T) {
 		t.Fatalf("GetUser() = (%v, %v); want = (nil, error)", u, err)
 	}
 
-	want := `googleapi: got HTTP response code 500 with body: {"error":"test"}`
+	want := `GetUser("some uid"): googleapi: got HTTP response code 500 with body: {"error":"test"}`
 	if err.Error() != want || !IsUnknown(err) {
 		t.Errorf("GetUser() = %v; want = %q", err, want)
 	}
@@ -727,7 +1333,7 @@ func TestHTTPErrorWithCode(t *testing.T) {
 			t.Fatalf("GetUser() = (%v, %v); want = (nil, error)", u, err)
 		}
 
-		want := fmt.Sprintf("googleapi: Error 500: %s", code)
+		want := fmt.Sprintf(`GetUser("some uid"): googleapi: Error 500: %s`, code)
 		if err.Error() != want || !check(err) {
 			t.Errorf("GetUser() = %v; want = %q", err, want)
 		}
@@ -808,12 +1414,12 @@ func echoServer(resp interface{}, t *testing.T) *mockAuthServer {
 		Version:   testVersion,
 	}
 
-	authClient, err := NewClient(ctx, conf)
-	authClient.ks = &fileKeySource{FilePath: "../testdata/public_certs.json"}
+	authClient, err := NewClient(ctx, conf, WithPublicKeyFile("../testdata/public_certs.json", false))
 	if err != nil {
 		t.Fatal(err)
 	}
 	authClient.is.BasePath = s.Srv.URL + "/"
+	authClient.idToolkitV1Endpoint = s.Srv.URL
 	s.Client = authClient
 	return &s
 }
@@ -27,13 +27,14 @@ import (
 
 	"golang.org/x/net/context"
 	"google.golang.org/api/option"
-	"google.golang.org/api/transport"
 )
 
 const userAgentFormat = "Firebase/HTTP/%s/%s/AdminGo"
 const invalidChars = "[].#$"
 const authVarOverride = "auth_variable_override"
 
+const indexNotDefined = "index-not-defined"
+
 // Client is the interface for the Firebase Realtime Database service.
 type Client struct {
 	hc           *internal.HTTPClient
@@ -48,11 +49,19 @@ type Client struct {
 func NewClient(ctx context.Context, c *internal.DatabaseConfig) (*Client, error) {
 	opts := append([]option.ClientOption{}, c.Opts...)
 	ua := fmt.Sprintf(userAgentFormat, c.Version, runtime.Version())
+	if c.UserAgentSuffix != "" {
+		// The User-Agent set via the client options replaces the header of each request, so the
+		// suffix is added here instead of by internal.WithHeaders.
+		ua += " " + c.UserAgentSuffix
+	}
 	opts = append(opts, option.WithUserAgent(ua))
-	hc, _, err := transport.NewHTTPClient(ctx, opts...)
+	hc, err := internal.NewHTTPClient(ctx, c.Transport, opts...)
 	if err != nil {
 		return nil, err
 	}
+	hc = internal.WithHeaders(hc, c.Headers, "")
+	hc = internal.Instrument(hc, c.Instrumentation, "db")
+	hc = internal.WithGuard(hc, c.RequestGuard)
 
 	p, err := url.ParseRequestURI(c.URL)
 	if err != nil {
@@ -81,12 +90,25 @@ func NewClient(ctx context.Context, c *internal.DatabaseConfig) (*Client, error)
 		return p.Error
 	}
 	return &Client{
-		hc:           &internal.HTTPClient{Client: hc, ErrParser: ep},
+		hc: &internal.HTTPClient{
+			Client:      hc,
+			ErrParser:   ep,
+			MaxBodySize: c.MaxResponseBodySize,
+			RetryConfig: internal.NewRetryConfig(c.MaxRetries),
+			Timeout:     c.RequestTimeout,
+		},
 		url:          fmt.Sprintf("https://%s", p.Host),
 		authOverride: string(ao),
 	}, nil
 }
 
+// IsIndexNotDefined checks if the given error was due to a query that orders by a child, key or
+// value for which no index is defined in the database rules. Add an ".indexOn" rule for the
+// path to fix such errors.
+func IsIndexNotDefined(err error) bool {
+	return internal.HasErrorCode(err, indexNotDefined)
+}
+
 // NewRef returns a new database reference representing the node at the specified path.
 func (c *Client) NewRef(path string) *Ref {
 	segs := parsePath(path)
@@ -115,6 +137,8 @@ func (c *Client) send(
 	if c.authOverride != "" {
 		opts = append(opts, internal.WithQueryParam(authVarOverride, c.authOverride))
 	}
+	// Database paths are unbounded, so requests are reported by their method instead.
+	ctx = internal.WithOperation(ctx, method)
 	return c.hc.Do(ctx, &internal.Request{
 		Method: method,
 		URL:    fmt.Sprintf("%s%s.json", c.url, path),
@@ -0,0 +1,294 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/internal"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// Delays between reconnection attempts of a Listener. The delay doubles after each failed attempt,
+// up to the maximum. Declared as variables to enable testing.
+var (
+	listenRetryDelay    = time.Second
+	listenMaxRetryDelay = 30 * time.Second
+)
+
+// Event is a change to the data at or below the location of a Listener.
+//
+// Type is either "put" or "patch". For a put, Data replaces the value at Path. For a patch, each
+// child of Data replaces the corresponding child of the value at Path. Path is relative to the
+// location of the Listener. When a Listener connects, and every time it reconnects, the first
+// event is a put with the path "/", which contains the full value at the location.
+type Event struct {
+	Type string
+	Path string
+	Data json.RawMessage
+}
+
+// Unmarshal parses the JSON-encoded data of the Event, and stores the result in the value pointed
+// to by v.
+func (e *Event) Unmarshal(v interface{}) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// Listener receives the changes to the data at a database location, as they happen. Use
+// Ref.Listen() to create a Listener.
+type Listener struct {
+	// Events delivers the changes in the order they happen. It is closed when the Listener stops.
+	Events <-chan *Event
+
+	err  error
+	done chan struct{}
+}
+
+// Err returns the reason the Listener stopped. It returns nil until Events is closed. After that,
+// it returns the context error if the context of the Listener was done, the error reported by
+// the database if it cancelled the stream (for example when the security rules no longer permit
+// reading the location), or the error of a reconnection attempt that cannot succeed by retrying
+// (for example a 401, 403 or 404 response).
+func (l *Listener) Err() error {
+	select {
+	case <-l.done:
+		return l.err
+	default:
+		return nil
+	}
+}
+
+// Listen starts listening for changes to the data at the location of r.
+//
+// Listen uses the streaming REST API of the Realtime Database. It returns an error if the initial
+// connection fails. After that, the Listener reconnects automatically when the connection drops,
+// or when the database revokes the credentials of the stream, in which case a new OAuth2 token is
+// used to reconnect. Reconnection attempts that fail with a network error or a 429 or 5xx response
+// are retried with backoff. The Listener stops when ctx is done, when the database cancels the
+// stream, when a reconnection attempt fails with any other response, or when the database sends
+// an event larger than the MaxResponseBodySize of the App. Events must be read continuously,
+// since the Listener does not buffer them.
+func (r *Ref) Listen(ctx context.Context) (l *Listener, err error) {
+	defer internal.WrapOpError(&err, "Listen", r.Path)
+	body, _, err := r.openStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan *Event)
+	l = &Listener{
+		Events: events,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		l.err = r.listen(ctx, body, events)
+		close(l.done)
+		close(events)
+	}()
+	return l, nil
+}
+
+func (r *Ref) listen(ctx context.Context, body io.ReadCloser, events chan<- *Event) error {
+	delay := listenRetryDelay
+	for {
+		connected, err := r.readStream(ctx, body, events)
+		body.Close()
+		if err != nil {
+			return err
+		}
+		if connected {
+			delay = listenRetryDelay
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > listenMaxRetryDelay {
+				delay = listenMaxRetryDelay
+			}
+			var retry bool
+			if body, retry, err = r.openStream(ctx); err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if !retry {
+				return err
+			}
+		}
+	}
+}
+
+// openStream opens a stream of server-sent events for the location of r. If it fails, the returned
+// bool indicates whether the error is transient, i.e. a network error or a 429 or 5xx response,
+// after which the stream may be reopened. Other errors, such as a 401 or 403 response after the
+// security rules have changed, or a 404 response for a bad path, stop the Listener.
+func (r *Ref) openStream(ctx context.Context) (io.ReadCloser, bool, error) {
+	c := r.client
+	if strings.ContainsAny(r.Path, invalidChars) {
+		return nil, false, fmt.Errorf("invalid path with illegal characters: %q", r.Path)
+	}
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s%s.json", c.url, r.Path), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if c.authOverride != "" {
+		q := req.URL.Query()
+		q.Add(authVarOverride, c.authOverride)
+		req.URL.RawQuery = q.Encode()
+	}
+
+	resp, err := ctxhttp.Do(ctx, c.hc.Client, req)
+	if err != nil {
+		return nil, true, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		retry := internal.IsRetryableStatus(resp.StatusCode)
+		b, err := internal.ReadBody(resp.Body, c.hc.MaxBodySize)
+		if err != nil {
+			return nil, retry, err
+		}
+		var msg string
+		if c.hc.ErrParser != nil {
+			msg = c.hc.ErrParser(b)
+		}
+		if msg == "" {
+			msg = string(b)
+		}
+		return nil, retry, fmt.Errorf("http error status: %d; reason: %s", resp.StatusCode, msg)
+	}
+	return resp.Body, false, nil
+}
+
+// readStream reads server-sent events from body, and delivers the put and patch events. It returns
+// a nil error when the stream should be reopened, and reports whether any event was received.
+//
+// The data lines of an event are joined with newlines, as specified for server-sent events. Lines
+// and events larger than the MaxBodySize of the client stop the Listener with an error, so that a
+// misbehaving server cannot make it buffer an unbounded amount of data.
+func (r *Ref) readStream(ctx context.Context, body io.Reader, events chan<- *Event) (bool, error) {
+	limit := r.client.hc.MaxBodySize
+	if limit <= 0 {
+		limit = internal.DefaultMaxResponseBodySize
+	}
+	tooLarge := fmt.Errorf("server-sent event exceeds the limit of %d bytes", limit)
+
+	reader := bufio.NewReader(body)
+	received := false
+	var name string
+	var data []string
+	var size int64
+	for {
+		line, err := readLine(reader, limit)
+		if err == errLineTooLong {
+			return received, tooLarge
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return received, ctx.Err()
+			}
+			return received, nil
+		}
+
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			value := strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+			if size += int64(len(value)) + 1; size > limit {
+				return received, tooLarge
+			}
+			data = append(data, value)
+		case line == "":
+			if name != "" {
+				received = true
+				reconnect, err := dispatchEvent(ctx, name, strings.Join(data, "\n"), events)
+				if err != nil || reconnect {
+					return received, err
+				}
+			}
+			name, data, size = "", nil, 0
+		}
+	}
+}
+
+var errLineTooLong = errors.New("line too long")
+
+// readLine reads a line from r, and returns it without the line terminator. It returns
+// errLineTooLong if the line is longer than limit bytes.
+func readLine(r *bufio.Reader, limit int64) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if int64(len(line)+len(chunk)) > limit {
+			return "", errLineTooLong
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
+
+// dispatchEvent handles a single server-sent event. It reports whether the stream must be
+// reopened, and returns an error if the Listener must stop.
+func dispatchEvent(ctx context.Context, name, data string, events chan<- *Event) (bool, error) {
+	switch name {
+	case "put", "patch":
+		var p struct {
+			Path string          `json:"path"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			return false, fmt.Errorf("error parsing %s event: %v", name, err)
+		}
+		select {
+		case events <- &Event{Type: name, Path: p.Path, Data: p.Data}:
+			return false, nil
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	case "auth_revoked":
+		return true, nil
+	case "cancel":
+		var reason string
+		if err := json.Unmarshal([]byte(data), &reason); err != nil || reason == "" {
+			reason = data
+		}
+		return false, errors.New("listener cancelled by the database: " + reason)
+	default:
+		// keep-alive and unknown events are ignored.
+		return false, nil
+	}
+}
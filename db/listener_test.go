@@ -0,0 +1,345 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// streamServer serves each incoming streaming request with the next entry of streams. An entry is
+// written as is, and the connection is closed afterwards unless hold is set for the last entry, in
+// which case the connection is kept open until the client goes away. Requests whose index is in
+// status are answered with that status code instead.
+type streamServer struct {
+	streams []string
+	hold    bool
+	status  map[int]int
+
+	mu   sync.Mutex
+	reqs []*http.Request
+}
+
+func (s *streamServer) Start(c *Client) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		idx := len(s.reqs)
+		s.reqs = append(s.reqs, r)
+		s.mu.Unlock()
+		if idx >= len(s.streams) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if code, ok := s.status[idx]; ok {
+			w.WriteHeader(code)
+			w.Write([]byte(`{"error": "test error"}`))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(s.streams[idx]))
+		w.(http.Flusher).Flush()
+		if s.hold && idx == len(s.streams)-1 {
+			<-r.Context().Done()
+		}
+	}))
+	c.url = srv.URL
+	return srv
+}
+
+func (s *streamServer) requests() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reqs
+}
+
+func sseEvent(name, data string) string {
+	return fmt.Sprintf("event: %s\ndata: %s\n\n", name, data)
+}
+
+func TestListen(t *testing.T) {
+	s := &streamServer{
+		streams: []string{
+			sseEvent("put", `{"path": "/", "data": {"name": "Alice", "age": 30}}`) +
+				sseEvent("keep-alive", "null") +
+				sseEvent("patch", `{"path": "/", "data": {"age": 31}}`),
+		},
+		hold: true,
+	}
+	srv := s.Start(client)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := testref.Listen(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := receiveEvent(t, l)
+	var p person
+	if err := e.Unmarshal(&p); err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != "put" || e.Path != "/" || !reflect.DeepEqual(p, person{Name: "Alice", Age: 30}) {
+		t.Errorf("Event = {%q, %q, %v}; want = {put, /, Alice 30}", e.Type, e.Path, p)
+	}
+
+	e = receiveEvent(t, l)
+	var patch map[string]interface{}
+	if err := e.Unmarshal(&patch); err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != "patch" || e.Path != "/" || !reflect.DeepEqual(patch, map[string]interface{}{"age": float64(31)}) {
+		t.Errorf("Event = {%q, %q, %v}; want = {patch, /, map[age:31]}", e.Type, e.Path, patch)
+	}
+	if err := l.Err(); err != nil {
+		t.Errorf("Err() = %v; want = nil", err)
+	}
+
+	cancel()
+	waitForClose(t, l)
+	if err := l.Err(); err != context.Canceled {
+		t.Errorf("Err() = %v; want = %v", err, context.Canceled)
+	}
+
+	reqs := s.requests()
+	if len(reqs) != 1 {
+		t.Fatalf("Requests = %d; want = 1", len(reqs))
+	}
+	req := reqs[0]
+	if req.Method != "GET" || req.URL.Path != "/peter.json" {
+		t.Errorf("Request = %s %s; want = GET /peter.json", req.Method, req.URL.Path)
+	}
+	if h := req.Header.Get("Accept"); h != "text/event-stream" {
+		t.Errorf("Accept = %q; want = %q", h, "text/event-stream")
+	}
+	if h := req.Header.Get("Authorization"); h != "Bearer mock-token" {
+		t.Errorf("Authorization = %q; want = %q", h, "Bearer mock-token")
+	}
+}
+
+func TestListenReconnect(t *testing.T) {
+	defer setListenRetryDelay(time.Millisecond)()
+	s := &streamServer{
+		streams: []string{
+			sseEvent("put", `{"path": "/", "data": "first"}`),
+			sseEvent("put", `{"path": "/", "data": "second"}`) +
+				sseEvent("auth_revoked", `"credential is no longer valid"`),
+			sseEvent("put", `{"path": "/", "data": "third"}`),
+		},
+		hold: true,
+	}
+	srv := s.Start(client)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := testref.Listen(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"first", "second", "third"} {
+		var got string
+		if err := receiveEvent(t, l).Unmarshal(&got); err != nil || got != want {
+			t.Errorf("Event = (%q, %v); want = (%q, nil)", got, err, want)
+		}
+	}
+	if reqs := s.requests(); len(reqs) != 3 {
+		t.Errorf("Requests = %d; want = 3", len(reqs))
+	}
+}
+
+func TestListenReconnectNonRetryableError(t *testing.T) {
+	defer setListenRetryDelay(time.Millisecond)()
+	s := &streamServer{
+		streams: []string{sseEvent("put", `{"path": "/", "data": "first"}`), "", ""},
+		status: map[int]int{
+			1: http.StatusServiceUnavailable,
+			2: http.StatusForbidden,
+		},
+	}
+	srv := s.Start(client)
+	defer srv.Close()
+
+	l, err := testref.Listen(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	if err := receiveEvent(t, l).Unmarshal(&got); err != nil || got != "first" {
+		t.Errorf("Event = (%q, %v); want = (%q, nil)", got, err, "first")
+	}
+	waitForClose(t, l)
+	want := "http error status: 403; reason: test error"
+	if err := l.Err(); err == nil || err.Error() != want {
+		t.Errorf("Err() = %v; want = %q", err, want)
+	}
+	if reqs := s.requests(); len(reqs) != 3 {
+		t.Errorf("Requests = %d; want = 3", len(reqs))
+	}
+}
+
+func TestListenCancelledByServer(t *testing.T) {
+	s := &streamServer{
+		streams: []string{
+			sseEvent("put", `{"path": "/", "data": null}`) +
+				sseEvent("cancel", `"Permission denied"`),
+		},
+		hold: true,
+	}
+	srv := s.Start(client)
+	defer srv.Close()
+
+	l, err := testref.Listen(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := receiveEvent(t, l); e.Type != "put" || string(e.Data) != "null" {
+		t.Errorf("Event = {%q, %s}; want = {put, null}", e.Type, e.Data)
+	}
+	waitForClose(t, l)
+	want := "listener cancelled by the database: Permission denied"
+	if err := l.Err(); err == nil || err.Error() != want {
+		t.Errorf("Err() = %v; want = %q", err, want)
+	}
+}
+
+func TestListenMultiLineData(t *testing.T) {
+	s := &streamServer{
+		streams: []string{
+			"event: put\ndata: {\"path\": \"/\",\ndata:  \"data\": \"foo\"}\n\n" +
+				"data: {}\n\n" +
+				"event: patch\r\ndata:{\"path\": \"/\", \"data\": {\"age\": 31}}\r\n\r\n",
+		},
+		hold: true,
+	}
+	srv := s.Start(client)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := testref.Listen(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := receiveEvent(t, l); e.Type != "put" || e.Path != "/" || string(e.Data) != `"foo"` {
+		t.Errorf("Event = {%q, %q, %s}; want = {put, /, \"foo\"}", e.Type, e.Path, e.Data)
+	}
+	// Data without an event name is discarded, and not prepended to the data of the next event.
+	if e := receiveEvent(t, l); e.Type != "patch" || e.Path != "/" || string(e.Data) != `{"age": 31}` {
+		t.Errorf("Event = {%q, %q, %s}; want = {patch, /, {\"age\": 31}}", e.Type, e.Path, e.Data)
+	}
+}
+
+func TestListenEventTooLarge(t *testing.T) {
+	large := `{"path": "/", "data": "` + strings.Repeat("a", 100) + `"}`
+	cases := []struct {
+		name   string
+		stream string
+	}{
+		{"LongLine", sseEvent("put", large)},
+		{"ManyLines", "event: put\n" + strings.Repeat("data: aaaaaaaaaa\n", 20) + "\n"},
+		{"Unterminated", "event: put\ndata: " + strings.Repeat("a", 5000)},
+	}
+	defer func(limit int64) { client.hc.MaxBodySize = limit }(client.hc.MaxBodySize)
+	client.hc.MaxBodySize = 100
+	for _, tc := range cases {
+		s := &streamServer{
+			streams: []string{sseEvent("put", `{"path": "/", "data": null}`) + tc.stream},
+			hold:    true,
+		}
+		srv := s.Start(client)
+
+		l, err := testref.Listen(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := receiveEvent(t, l); e.Type != "put" || string(e.Data) != "null" {
+			t.Errorf("[%s] Event = {%q, %s}; want = {put, null}", tc.name, e.Type, e.Data)
+		}
+		waitForClose(t, l)
+		want := "server-sent event exceeds the limit of 100 bytes"
+		if err := l.Err(); err == nil || err.Error() != want {
+			t.Errorf("[%s] Err() = %v; want = %q", tc.name, err, want)
+		}
+		srv.Close()
+	}
+}
+
+func TestListenError(t *testing.T) {
+	mock := &mockServer{Resp: map[string]string{"error": "test error"}, Status: http.StatusUnauthorized}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	l, err := testref.Listen(context.Background())
+	want := "http error status: 401; reason: test error"
+	if l != nil || err == nil || !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("Listen() = (%v, %v); want = (nil, %q)", l, err, want)
+	}
+}
+
+func TestListenInvalidPath(t *testing.T) {
+	mock := &mockServer{}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	r := &Ref{Path: "/foo$", client: client}
+	if l, err := r.Listen(context.Background()); l != nil || err == nil {
+		t.Errorf("Listen() = (%v, %v); want = (nil, error)", l, err)
+	}
+	if len(mock.Reqs) != 0 {
+		t.Errorf("Requests = %v; want = empty", mock.Reqs)
+	}
+}
+
+func receiveEvent(t *testing.T, l *Listener) *Event {
+	select {
+	case e, ok := <-l.Events:
+		if !ok {
+			t.Fatalf("Events closed unexpectedly; Err() = %v", l.Err())
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return nil
+}
+
+func waitForClose(t *testing.T, l *Listener) {
+	select {
+	case e, ok := <-l.Events:
+		if ok {
+			t.Fatalf("Events = %v; want = closed", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the listener to stop")
+	}
+}
+
+func setListenRetryDelay(d time.Duration) func() {
+	old := listenRetryDelay
+	listenRetryDelay = d
+	return func() { listenRetryDelay = old }
+}
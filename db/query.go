@@ -105,7 +105,12 @@ func (q *Query) LimitToLast(n int) *Query {
 //
 // Despite the ordering constraint of the Query, results are not stored in any particular order
 // in v. Use GetOrdered() to obtain ordered results.
-func (q *Query) Get(ctx context.Context, v interface{}) error {
+func (q *Query) Get(ctx context.Context, v interface{}) (err error) {
+	defer internal.WrapOpError(&err, "Get", q.path)
+	return q.get(ctx, v)
+}
+
+func (q *Query) get(ctx context.Context, v interface{}) error {
 	qp := make(map[string]string)
 	if err := initQueryParams(q, qp); err != nil {
 		return err
@@ -114,13 +119,32 @@ func (q *Query) Get(ctx context.Context, v interface{}) error {
 	if err != nil {
 		return err
 	}
+	if err := checkIndexError(resp); err != nil {
+		return err
+	}
 	return resp.Unmarshal(http.StatusOK, v)
 }
 
+// checkIndexError returns an error with the index-not-defined code if the database rejected a
+// query because the child, key or value it orders by is not indexed in the database rules.
+func checkIndexError(resp *internal.Response) error {
+	if resp.Status != http.StatusBadRequest {
+		return nil
+	}
+	var p struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(resp.Body, &p); err != nil || !strings.HasPrefix(p.Error, "Index not defined") {
+		return nil
+	}
+	return internal.Errorf(indexNotDefined, "http error status: %d; reason: %s", resp.Status, p.Error)
+}
+
 // GetOrdered executes the Query and returns the results as an ordered slice.
-func (q *Query) GetOrdered(ctx context.Context) ([]QueryNode, error) {
+func (q *Query) GetOrdered(ctx context.Context) (nodes []QueryNode, err error) {
+	defer internal.WrapOpError(&err, "GetOrdered", q.path)
 	var temp interface{}
-	if err := q.Get(ctx, &temp); err != nil {
+	if err := q.get(ctx, &temp); err != nil {
 		return nil, err
 	}
 	if temp == nil {
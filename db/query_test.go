@@ -15,7 +15,9 @@ package db
 
 import (
 	"fmt"
+	"net/http"
 	"reflect"
+	"strings"
 	"testing"
 
 	"golang.org/x/net/context"
@@ -393,6 +395,37 @@ func TestInvalidFilterQuery(t *testing.T) {
 	}
 }
 
+func TestQueryIndexNotDefined(t *testing.T) {
+	msg := `Index not defined, add ".indexOn": "messages", for path "/peter", to the rules`
+	mock := &mockServer{Resp: map[string]string{"error": msg}, Status: http.StatusBadRequest}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	var got map[string]interface{}
+	err := testref.OrderByChild("messages").Get(context.Background(), &got)
+	want := "http error status: 400; reason: " + msg
+	if got != nil || err == nil || !strings.HasSuffix(err.Error(), want) || !IsIndexNotDefined(err) {
+		t.Errorf("Get() = (%v, %v); want = (nil, %q)", got, err, want)
+	}
+
+	nodes, err := testref.OrderByChild("messages").GetOrdered(context.Background())
+	if nodes != nil || !IsIndexNotDefined(err) {
+		t.Errorf("GetOrdered() = (%v, %v); want = (nil, index-not-defined error)", nodes, err)
+	}
+}
+
+func TestQueryBadRequest(t *testing.T) {
+	mock := &mockServer{Resp: map[string]string{"error": "test error"}, Status: http.StatusBadRequest}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	var got map[string]interface{}
+	err := testref.OrderByChild("messages").Get(context.Background(), &got)
+	if got != nil || err == nil || IsIndexNotDefined(err) {
+		t.Errorf("Get() = (%v, %v); want = (nil, error)", got, err)
+	}
+}
+
 func TestAllParamsQuery(t *testing.T) {
 	want := map[string]interface{}{"m1": "Hello", "m2": "Bye"}
 	mock := &mockServer{Resp: want}
@@ -763,7 +796,7 @@ func TestQueryHttpError(t *testing.T) {
 	srv := mock.Start(client)
 	defer srv.Close()
 
-	want := "http error status: 500; reason: test error"
+	want := `GetOrdered("/peter"): http error status: 500; reason: test error`
 	result, err := testref.OrderByChild("child").GetOrdered(context.Background())
 	if err == nil || err.Error() != want {
 		t.Errorf("GetOrdered() = %v; want = %v", err, want)
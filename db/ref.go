@@ -75,7 +75,8 @@ func (r *Ref) Child(path string) *Ref {
 // Data deserialization is performed using https://golang.org/pkg/encoding/json/#Unmarshal, and
 // therefore v has the same requirements as the json package. Specifically, it must be a pointer,
 // and must not be nil.
-func (r *Ref) Get(ctx context.Context, v interface{}) error {
+func (r *Ref) Get(ctx context.Context, v interface{}) (err error) {
+	defer internal.WrapOpError(&err, "Get", r.Path)
 	resp, err := r.send(ctx, "GET")
 	if err != nil {
 		return err
@@ -84,7 +85,8 @@ func (r *Ref) Get(ctx context.Context, v interface{}) error {
 }
 
 // GetWithETag retrieves the value at the current database location, along with its ETag.
-func (r *Ref) GetWithETag(ctx context.Context, v interface{}) (string, error) {
+func (r *Ref) GetWithETag(ctx context.Context, v interface{}) (etag string, err error) {
+	defer internal.WrapOpError(&err, "GetWithETag", r.Path)
 	resp, err := r.send(ctx, "GET", internal.WithHeader("X-Firebase-ETag", "true"))
 	if err != nil {
 		return "", err
@@ -97,7 +99,8 @@ func (r *Ref) GetWithETag(ctx context.Context, v interface{}) (string, error) {
 // GetShallow performs a shallow read on the current database location.
 //
 // Shallow reads do not retrieve the child nodes of the current reference.
-func (r *Ref) GetShallow(ctx context.Context, v interface{}) error {
+func (r *Ref) GetShallow(ctx context.Context, v interface{}) (err error) {
+	defer internal.WrapOpError(&err, "GetShallow", r.Path)
 	resp, err := r.send(ctx, "GET", internal.WithQueryParam("shallow", "true"))
 	if err != nil {
 		return err
@@ -112,7 +115,10 @@ func (r *Ref) GetShallow(ctx context.Context, v interface{}) error {
 // location. The value of the database location will be stored in v just like a regular Get() call.
 // If the etag matches, returns false along with the same ETag passed into the function. No data
 // will be stored in v in this case.
-func (r *Ref) GetIfChanged(ctx context.Context, etag string, v interface{}) (bool, string, error) {
+func (r *Ref) GetIfChanged(
+	ctx context.Context, etag string, v interface{}) (changed bool, newEtag string, err error) {
+
+	defer internal.WrapOpError(&err, "GetIfChanged", r.Path)
 	resp, err := r.send(ctx, "GET", internal.WithHeader("If-None-Match", etag))
 	if err != nil {
 		return false, "", err
@@ -131,7 +137,8 @@ func (r *Ref) GetIfChanged(ctx context.Context, etag string, v interface{}) (boo
 // Set uses https://golang.org/pkg/encoding/json/#Marshal to serialize values into JSON. Therefore
 // v has the same requirements as the json package. Values like functions and channels cannot be
 // saved into Realtime Database.
-func (r *Ref) Set(ctx context.Context, v interface{}) error {
+func (r *Ref) Set(ctx context.Context, v interface{}) (err error) {
+	defer internal.WrapOpError(&err, "Set", r.Path)
 	resp, err := r.sendWithBody(ctx, "PUT", v, internal.WithQueryParam("print", "silent"))
 	if err != nil {
 		return err
@@ -143,7 +150,8 @@ func (r *Ref) Set(ctx context.Context, v interface{}) error {
 //
 // Sets the data at this location to v only if the specified ETag matches. Returns true if the
 // value is written. Returns false if no changes are made to the database.
-func (r *Ref) SetIfUnchanged(ctx context.Context, etag string, v interface{}) (bool, error) {
+func (r *Ref) SetIfUnchanged(ctx context.Context, etag string, v interface{}) (ok bool, err error) {
+	defer internal.WrapOpError(&err, "SetIfUnchanged", r.Path)
 	resp, err := r.sendWithBody(ctx, "PUT", v, internal.WithHeader("If-Match", etag))
 	if err != nil {
 		return false, err
@@ -161,7 +169,8 @@ func (r *Ref) SetIfUnchanged(ctx context.Context, etag string, v interface{}) (b
 //
 // If v is not nil, it will be set as the initial value of the new child node. If v is nil, the
 // new child node will be created with empty string as the value.
-func (r *Ref) Push(ctx context.Context, v interface{}) (*Ref, error) {
+func (r *Ref) Push(ctx context.Context, v interface{}) (ref *Ref, err error) {
+	defer internal.WrapOpError(&err, "Push", r.Path)
 	if v == nil {
 		v = ""
 	}
@@ -179,7 +188,8 @@ func (r *Ref) Push(ctx context.Context, v interface{}) (*Ref, error) {
 }
 
 // Update modifies the specified child keys of the current location to the provided values.
-func (r *Ref) Update(ctx context.Context, v map[string]interface{}) error {
+func (r *Ref) Update(ctx context.Context, v map[string]interface{}) (err error) {
+	defer internal.WrapOpError(&err, "Update", r.Path)
 	if len(v) == 0 {
 		return fmt.Errorf("value argument must be a non-empty map")
 	}
@@ -207,7 +217,8 @@ type UpdateFn func(TransactionNode) (interface{}, error)
 //
 // The update function may also force an early abort by returning an error instead of returning a
 // value.
-func (r *Ref) Transaction(ctx context.Context, fn UpdateFn) error {
+func (r *Ref) Transaction(ctx context.Context, fn UpdateFn) (err error) {
+	defer internal.WrapOpError(&err, "Transaction", r.Path)
 	resp, err := r.send(ctx, "GET", internal.WithHeader("X-Firebase-ETag", "true"))
 	if err != nil {
 		return err
@@ -236,7 +247,8 @@ func (r *Ref) Transaction(ctx context.Context, fn UpdateFn) error {
 }
 
 // Delete removes this node from the database.
-func (r *Ref) Delete(ctx context.Context) error {
+func (r *Ref) Delete(ctx context.Context) (err error) {
+	defer internal.WrapOpError(&err, "Delete", r.Path)
 	resp, err := r.send(ctx, "DELETE")
 	if err != nil {
 		return err
@@ -18,9 +18,12 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strings"
 	"testing"
 
 	"golang.org/x/net/context"
+
+	"firebase.google.com/go/internal"
 )
 
 type refOp func(r *Ref) error
@@ -283,9 +286,10 @@ func TestWelformedHttpError(t *testing.T) {
 	srv := mock.Start(client)
 	defer srv.Close()
 
-	want := "http error status: 500; reason: test error"
+	reason := "http error status: 500; reason: test error"
 	for _, tc := range testOps {
 		err := tc.op(testref)
+		want := fmt.Sprintf("%s(%q): %s", strings.TrimSuffix(tc.name, "()"), testref.Path, reason)
 		if err == nil || err.Error() != want {
 			t.Errorf("%s = %v; want = %v", tc.name, err, want)
 		}
@@ -301,9 +305,10 @@ func TestUnexpectedHttpError(t *testing.T) {
 	srv := mock.Start(client)
 	defer srv.Close()
 
-	want := "http error status: 500; reason: \"unexpected error\""
+	reason := "http error status: 500; reason: \"unexpected error\""
 	for _, tc := range testOps {
 		err := tc.op(testref)
+		want := fmt.Sprintf("%s(%q): %s", strings.TrimSuffix(tc.name, "()"), testref.Path, reason)
 		if err == nil || err.Error() != want {
 			t.Errorf("%s = %v; want = %v", tc.name, err, want)
 		}
@@ -643,7 +648,8 @@ func TestTransactionError(t *testing.T) {
 		p.Age++
 		return &p, nil
 	}
-	if err := testref.Transaction(context.Background(), fn); err == nil || err.Error() != want {
+	err := testref.Transaction(context.Background(), fn)
+	if oe, ok := err.(*internal.OpError); !ok || oe.Err.Error() != want {
 		t.Errorf("Transaction() = %v; want = %q", err, want)
 	}
 	if cnt != 1 {
@@ -0,0 +1,129 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dynamiclinks contains functions for retrieving the analytics of Firebase Dynamic Links.
+package dynamiclinks // import "firebase.google.com/go/dynamiclinks"
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"firebase.google.com/go/internal"
+)
+
+const dynamicLinksEndpoint = "https://firebasedynamiclinks.googleapis.com/v1"
+
+// Platforms on which Dynamic Link events are recorded.
+const (
+	Android = "ANDROID"
+	IOS     = "IOS"
+	Desktop = "DESKTOP"
+)
+
+// Types of Dynamic Link events.
+const (
+	Click        = "CLICK"
+	Redirect     = "REDIRECT"
+	AppInstall   = "APP_INSTALL"
+	AppFirstOpen = "APP_FIRST_OPEN"
+	AppReOpen    = "APP_RE_OPEN"
+)
+
+// Client is the interface for the Firebase Dynamic Links service.
+type Client struct {
+	// To enable testing against arbitrary endpoints.
+	endpoint string
+	client   *internal.HTTPClient
+	version  string
+}
+
+// LinkStats contains the event counts of a Dynamic Link.
+type LinkStats struct {
+	EventStats []*EventStats `json:"linkEventStats"`
+}
+
+// EventStats is the number of events of a single type recorded for a Dynamic Link on a single
+// platform.
+//
+// Platform is one of Android, IOS and Desktop. Event is one of Click, Redirect, AppInstall,
+// AppFirstOpen and AppReOpen.
+type EventStats struct {
+	Platform string `json:"platform"`
+	Event    string `json:"event"`
+	Count    int64  `json:"count,string"`
+}
+
+// NewClient creates a new instance of the Firebase Dynamic Links Client.
+//
+// This function can only be invoked from within the SDK. Client applications should access the
+// the Dynamic Links service through firebase.App.
+func NewClient(ctx context.Context, c *internal.DynamicLinksConfig) (*Client, error) {
+	hc, err := internal.NewHTTPClient(ctx, c.Transport, c.Opts...)
+	if err != nil {
+		return nil, err
+	}
+	hc = internal.WithHeaders(hc, c.Headers, c.UserAgentSuffix)
+	hc = internal.Instrument(hc, c.Instrumentation, "dynamiclinks")
+	hc = internal.WithGuard(hc, c.RequestGuard)
+
+	return &Client{
+		endpoint: dynamicLinksEndpoint,
+		client: &internal.HTTPClient{
+			Client:      hc,
+			MaxBodySize: c.MaxResponseBodySize,
+			RetryConfig: internal.NewRetryConfig(c.MaxRetries),
+			Timeout:     c.RequestTimeout,
+		},
+		version: "Go/Admin/" + c.Version,
+	}, nil
+}
+
+// LinkStats returns the event counts of the given short Dynamic Link over the last durationDays
+// days.
+//
+// The short link must be a full URL, such as "https://example.page.link/abcd". Event types that
+// were not recorded in the period are omitted from the returned LinkStats.
+func (c *Client) LinkStats(ctx context.Context, shortLink string, durationDays int) (ls *LinkStats, err error) {
+	defer internal.WrapOpError(&err, "LinkStats", shortLink)
+	if !strings.HasPrefix(shortLink, "https://") {
+		return nil, errors.New("short link must be a URL starting with https://")
+	}
+	if durationDays <= 0 {
+		return nil, errors.New("duration must be a positive number of days")
+	}
+
+	resp, err := c.client.Do(ctx, &internal.Request{
+		Method: http.MethodGet,
+		URL:    fmt.Sprintf("%s/%s/linkStats", c.endpoint, url.PathEscape(shortLink)),
+		Opts: []internal.HTTPOption{
+			internal.WithQueryParam("durationDays", strconv.Itoa(durationDays)),
+			internal.WithHeader("X-Client-Version", c.version),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result LinkStats
+	if err := resp.Unmarshal(http.StatusOK, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dynamiclinks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/api/option"
+
+	"firebase.google.com/go/internal"
+)
+
+const testShortLink = "https://example.page.link/abcd"
+
+var testDynamicLinksConfig = &internal.DynamicLinksConfig{
+	Opts: []option.ClientOption{
+		option.WithTokenSource(&internal.MockTokenSource{AccessToken: "test-token"}),
+	},
+	Version: "test-version",
+}
+
+const testStatsJSON = `{
+	"linkEventStats": [
+		{"platform": "ANDROID", "count": "123", "event": "CLICK"},
+		{"platform": "IOS", "count": "45", "event": "APP_INSTALL"},
+		{"platform": "DESKTOP", "count": "6", "event": "REDIRECT"}
+	]
+}`
+
+func newTestClient(t *testing.T, status int, resp string) (*Client, *httptest.Server, *http.Request) {
+	req := &http.Request{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*req = *r
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(resp))
+	}))
+	client, err := NewClient(context.Background(), testDynamicLinksConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.endpoint = ts.URL
+	return client, ts, req
+}
+
+func TestLinkStats(t *testing.T) {
+	client, ts, req := newTestClient(t, http.StatusOK, testStatsJSON)
+	defer ts.Close()
+
+	got, err := client.LinkStats(context.Background(), testShortLink, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &LinkStats{
+		EventStats: []*EventStats{
+			{Platform: Android, Event: Click, Count: 123},
+			{Platform: IOS, Event: AppInstall, Count: 45},
+			{Platform: Desktop, Event: Redirect, Count: 6},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LinkStats() = %#v; want = %#v", got, want)
+	}
+
+	if req.Method != http.MethodGet {
+		t.Errorf("Method = %q; want = %q", req.Method, http.MethodGet)
+	}
+	wantPath := "/https:%2F%2Fexample.page.link%2Fabcd/linkStats"
+	if path := req.URL.EscapedPath(); path != wantPath {
+		t.Errorf("Path = %q; want = %q", path, wantPath)
+	}
+	if d := req.URL.Query().Get("durationDays"); d != "7" {
+		t.Errorf("durationDays = %q; want = %q", d, "7")
+	}
+	if h := req.Header.Get("Authorization"); h != "Bearer test-token" {
+		t.Errorf("Authorization = %q; want = %q", h, "Bearer test-token")
+	}
+	if h := req.Header.Get("X-Client-Version"); h != "Go/Admin/test-version" {
+		t.Errorf("X-Client-Version = %q; want = %q", h, "Go/Admin/test-version")
+	}
+}
+
+func TestLinkStatsEmpty(t *testing.T) {
+	client, ts, _ := newTestClient(t, http.StatusOK, "{}")
+	defer ts.Close()
+
+	got, err := client.LinkStats(context.Background(), testShortLink, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.EventStats) != 0 {
+		t.Errorf("LinkStats() = %v; want = empty", got.EventStats)
+	}
+}
+
+func TestInvalidLinkStats(t *testing.T) {
+	client, err := NewClient(context.Background(), testDynamicLinksConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		link string
+		days int
+	}{
+		{"EmptyLink", "", 7},
+		{"NotURL", "example.page.link/abcd", 7},
+		{"HTTPLink", "http://example.page.link/abcd", 7},
+		{"ZeroDays", testShortLink, 0},
+		{"NegativeDays", testShortLink, -1},
+	}
+	for _, tc := range cases {
+		if got, err := client.LinkStats(context.Background(), tc.link, tc.days); got != nil || err == nil {
+			t.Errorf("LinkStats(%s) = (%v, %v); want = (nil, error)", tc.name, got, err)
+		}
+	}
+}
+
+func TestLinkStatsError(t *testing.T) {
+	client, ts, _ := newTestClient(t, http.StatusForbidden, `{"error": {"message": "permission denied"}}`)
+	defer ts.Close()
+
+	got, err := client.LinkStats(context.Background(), testShortLink, 7)
+	want := `LinkStats("https://example.page.link/abcd"): http error status: 403; reason: {"error": {"message": "permission denied"}}`
+	if got != nil || err == nil || err.Error() != want {
+		t.Errorf("LinkStats() = (%v, %v); want = (nil, %q)", got, err, want)
+	}
+}
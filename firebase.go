@@ -20,18 +20,26 @@ package firebase // import "firebase.google.com/go"
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"sync"
+	"time"
 
 	"golang.org/x/net/context"
 
 	"cloud.google.com/go/firestore"
 
+	"firebase.google.com/go/appcheck"
 	"firebase.google.com/go/auth"
 	"firebase.google.com/go/db"
+	"firebase.google.com/go/dynamiclinks"
 	"firebase.google.com/go/iid"
 	"firebase.google.com/go/internal"
 	"firebase.google.com/go/messaging"
+	"firebase.google.com/go/projectmanagement"
+	"firebase.google.com/go/remoteconfig"
 	"firebase.google.com/go/storage"
 
 	"golang.org/x/oauth2/google"
@@ -54,7 +62,20 @@ type App struct {
 	dbURL         string
 	projectID     string
 	storageBucket string
+	maxBodySize   int64
+	maxRetries    int
+	timeout       time.Duration
+	quotaProject  string
+	headers       http.Header
+	uaSuffix      string
+	transport     http.RoundTripper
+	instr         Instrumentation
 	opts          []option.ClientOption
+
+	name    string // empty for apps created with NewApp
+	mu      sync.Mutex
+	deleted bool
+	closers []io.Closer // Firestore and Storage clients, closed by DeleteApp
 }
 
 // Config represents the configuration used to initialize an App.
@@ -63,72 +84,318 @@ type Config struct {
 	DatabaseURL   string                  `json:"databaseURL"`
 	ProjectID     string                  `json:"projectId"`
 	StorageBucket string                  `json:"storageBucket"`
+
+	// MaxResponseBodySize is the maximum size in bytes of an HTTP response body read by the
+	// services of the App. Responses larger than this cause the corresponding operation to fail.
+	// If zero, a generous default of 256 MB is used.
+	MaxResponseBodySize int64 `json:"-"`
+
+	// MaxRetries is the maximum number of times the services of the App retry an HTTP request
+	// that failed with a network error, or with a 429 or 5xx response. Retries are delayed with
+	// exponential backoff, and honor the Retry-After header sent by the server. If zero, failed
+	// requests are not retried.
+	//
+	// Requests that are not idempotent, such as sending a message or pushing a child to the
+	// database, are only retried after a 429 response, since the server may already have processed
+	// them when a network error or a 5xx response occurs.
+	MaxRetries int `json:"-"`
+
+	// RequestTimeout bounds the time spent on an HTTP request made by the services of the App,
+	// including any retries, when the context of the request has no deadline. If zero, requests
+	// are only bounded by their context.
+	RequestTimeout time.Duration `json:"-"`
+
+	// QuotaProject is the Google Cloud project that the requests made by the services of the App
+	// are billed and quota-limited against. It is sent in the X-Goog-User-Project header, and
+	// takes precedence over any quota project of the credentials.
+	QuotaProject string `json:"-"`
+
+	// Headers are additional HTTP headers sent with every request made by the services of the
+	// App, including the requests that fetch the public keys used to verify ID tokens. They do not
+	// replace the headers set by the SDK itself. Firestore and Storage clients do not send them.
+	Headers http.Header `json:"-"`
+
+	// UserAgentSuffix is appended to the User-Agent header of every request made by the services
+	// of the App, e.g. to identify the application to an egress proxy. Like Headers, it does not
+	// apply to Firestore and Storage clients.
+	UserAgentSuffix string `json:"-"`
+
+	// Transport is the http.RoundTripper through which the services of the App send their HTTP
+	// requests, e.g. to route them via a corporate proxy, or to use client certificates. The
+	// requests are still authorized with the credentials of the App. If nil, the default transport
+	// is used. Like Headers, it does not apply to Firestore and Storage clients. To replace the
+	// HTTP client of the App altogether, including the authorization of requests, pass
+	// option.WithHTTPClient() to NewApp instead.
+	Transport http.RoundTripper `json:"-"`
+
+	// Instrumentation, if set, is notified of every HTTP request made by the services of the App,
+	// e.g. to record traces and latency metrics. Like Headers, it does not apply to Firestore and
+	// Storage clients.
+	Instrumentation Instrumentation `json:"-"`
+}
+
+// AppCheck returns an instance of appcheck.Client.
+func (a *App) AppCheck(ctx context.Context) (*appcheck.Client, error) {
+	if err := a.checkNotDeleted(); err != nil {
+		return nil, err
+	}
+	conf := &internal.AppCheckConfig{
+		ProjectID:           a.projectID,
+		Opts:                a.serviceOpts(internal.AppCheckScopes),
+		Version:             Version,
+		MaxResponseBodySize: a.maxBodySize,
+		MaxRetries:          a.maxRetries,
+		RequestTimeout:      a.timeout,
+		Headers:             a.headers,
+		UserAgentSuffix:     a.uaSuffix,
+		Transport:           a.transport,
+		Instrumentation:     a.instr,
+		RequestGuard:        a.checkNotDeleted,
+	}
+	return appcheck.NewClient(ctx, conf)
 }
 
 // Auth returns an instance of auth.Client.
-func (a *App) Auth(ctx context.Context) (*auth.Client, error) {
+//
+// Optional ClientOptions, such as auth.WithRateLimit(), can be specified to further configure the
+// returned client.
+func (a *App) Auth(ctx context.Context, opts ...auth.ClientOption) (*auth.Client, error) {
+	if err := a.checkNotDeleted(); err != nil {
+		return nil, err
+	}
+	conf := &internal.AuthConfig{
+		Creds:               a.creds,
+		ProjectID:           a.projectID,
+		Opts:                a.serviceOpts(internal.AuthScopes),
+		SignerOpts:          a.serviceOpts(internal.IAMScopes),
+		Version:             Version,
+		MaxResponseBodySize: a.maxBodySize,
+		MaxRetries:          a.maxRetries,
+		RequestTimeout:      a.timeout,
+		Headers:             a.headers,
+		UserAgentSuffix:     a.uaSuffix,
+		Transport:           a.transport,
+		Instrumentation:     a.instr,
+		RequestGuard:        a.checkNotDeleted,
+	}
+	return auth.NewClient(ctx, conf, opts...)
+}
+
+// VerifyOnlyAuth returns an instance of auth.Client that only verifies ID tokens and session
+// cookies, like the one returned by auth.NewVerifyOnlyClient().
+//
+// The returned client never uses the credentials of the App. It fetches the Google public keys
+// with the HTTP settings of the App, such as its Transport, Headers and MaxResponseBodySize.
+func (a *App) VerifyOnlyAuth(ctx context.Context, opts ...auth.ClientOption) (*auth.Client, error) {
+	if err := a.checkNotDeleted(); err != nil {
+		return nil, err
+	}
 	conf := &internal.AuthConfig{
-		Creds:     a.creds,
-		ProjectID: a.projectID,
-		Opts:      a.opts,
-		Version:   Version,
+		ProjectID:           a.projectID,
+		Version:             Version,
+		MaxResponseBodySize: a.maxBodySize,
+		MaxRetries:          a.maxRetries,
+		Headers:             a.headers,
+		UserAgentSuffix:     a.uaSuffix,
+		Transport:           a.transport,
+		Instrumentation:     a.instr,
+		RequestGuard:        a.checkNotDeleted,
+		VerifyOnly:          true,
 	}
-	return auth.NewClient(ctx, conf)
+	return auth.NewClient(ctx, conf, opts...)
 }
 
 // Database returns an instance of db.Client.
 func (a *App) Database(ctx context.Context) (*db.Client, error) {
+	if err := a.checkNotDeleted(); err != nil {
+		return nil, err
+	}
 	conf := &internal.DatabaseConfig{
-		AuthOverride: a.authOverride,
-		URL:          a.dbURL,
-		Opts:         a.opts,
-		Version:      Version,
+		AuthOverride:        a.authOverride,
+		URL:                 a.dbURL,
+		Opts:                a.serviceOpts(internal.DatabaseScopes),
+		Version:             Version,
+		MaxResponseBodySize: a.maxBodySize,
+		MaxRetries:          a.maxRetries,
+		RequestTimeout:      a.timeout,
+		Headers:             a.headers,
+		UserAgentSuffix:     a.uaSuffix,
+		Transport:           a.transport,
+		Instrumentation:     a.instr,
+		RequestGuard:        a.checkNotDeleted,
 	}
 	return db.NewClient(ctx, conf)
 }
 
+// DynamicLinks returns an instance of dynamiclinks.Client.
+func (a *App) DynamicLinks(ctx context.Context) (*dynamiclinks.Client, error) {
+	if err := a.checkNotDeleted(); err != nil {
+		return nil, err
+	}
+	conf := &internal.DynamicLinksConfig{
+		Opts:                a.serviceOpts(internal.DynamicLinksScopes),
+		Version:             Version,
+		MaxResponseBodySize: a.maxBodySize,
+		MaxRetries:          a.maxRetries,
+		RequestTimeout:      a.timeout,
+		Headers:             a.headers,
+		UserAgentSuffix:     a.uaSuffix,
+		Transport:           a.transport,
+		Instrumentation:     a.instr,
+		RequestGuard:        a.checkNotDeleted,
+	}
+	return dynamiclinks.NewClient(ctx, conf)
+}
+
 // Storage returns a new instance of storage.Client.
 func (a *App) Storage(ctx context.Context) (*storage.Client, error) {
+	if err := a.checkNotDeleted(); err != nil {
+		return nil, err
+	}
 	conf := &internal.StorageConfig{
-		Opts:   a.opts,
+		Opts:   a.serviceOpts(internal.StorageScopes),
 		Bucket: a.storageBucket,
 	}
-	return storage.NewClient(ctx, conf)
+	client, err := storage.NewClient(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	a.addCloser(client)
+	return client, nil
 }
 
 // Firestore returns a new firestore.Client instance from the https://godoc.org/cloud.google.com/go/firestore
 // package.
 func (a *App) Firestore(ctx context.Context) (*firestore.Client, error) {
+	if err := a.checkNotDeleted(); err != nil {
+		return nil, err
+	}
 	if a.projectID == "" {
 		return nil, errors.New("project id is required to access Firestore")
 	}
-	return firestore.NewClient(ctx, a.projectID, a.opts...)
+	client, err := firestore.NewClient(ctx, a.projectID, a.serviceOpts(internal.FirestoreScopes)...)
+	if err != nil {
+		return nil, err
+	}
+	a.addCloser(client)
+	return client, nil
 }
 
 // InstanceID returns an instance of iid.Client.
 func (a *App) InstanceID(ctx context.Context) (*iid.Client, error) {
+	if err := a.checkNotDeleted(); err != nil {
+		return nil, err
+	}
 	conf := &internal.InstanceIDConfig{
-		ProjectID: a.projectID,
-		Opts:      a.opts,
+		ProjectID:           a.projectID,
+		Opts:                a.serviceOpts(internal.InstanceIDScopes),
+		MaxResponseBodySize: a.maxBodySize,
+		MaxRetries:          a.maxRetries,
+		RequestTimeout:      a.timeout,
+		Headers:             a.headers,
+		UserAgentSuffix:     a.uaSuffix,
+		Transport:           a.transport,
+		Instrumentation:     a.instr,
+		RequestGuard:        a.checkNotDeleted,
 	}
 	return iid.NewClient(ctx, conf)
 }
 
 // Messaging returns an instance of messaging.Client.
 func (a *App) Messaging(ctx context.Context) (*messaging.Client, error) {
+	if err := a.checkNotDeleted(); err != nil {
+		return nil, err
+	}
 	conf := &internal.MessagingConfig{
-		ProjectID: a.projectID,
-		Opts:      a.opts,
-		Version:   Version,
+		ProjectID:           a.projectID,
+		Opts:                a.serviceOpts(internal.MessagingScopes),
+		Version:             Version,
+		MaxResponseBodySize: a.maxBodySize,
+		MaxRetries:          a.maxRetries,
+		RequestTimeout:      a.timeout,
+		Headers:             a.headers,
+		UserAgentSuffix:     a.uaSuffix,
+		Transport:           a.transport,
+		Instrumentation:     a.instr,
+		RequestGuard:        a.checkNotDeleted,
 	}
 	return messaging.NewClient(ctx, conf)
 }
 
+// ProjectManagement returns an instance of projectmanagement.Client.
+func (a *App) ProjectManagement(ctx context.Context) (*projectmanagement.Client, error) {
+	if err := a.checkNotDeleted(); err != nil {
+		return nil, err
+	}
+	conf := &internal.ProjectManagementConfig{
+		ProjectID:           a.projectID,
+		Opts:                a.serviceOpts(internal.ProjectManagementScopes),
+		Version:             Version,
+		MaxResponseBodySize: a.maxBodySize,
+		MaxRetries:          a.maxRetries,
+		RequestTimeout:      a.timeout,
+		Headers:             a.headers,
+		UserAgentSuffix:     a.uaSuffix,
+		Transport:           a.transport,
+		Instrumentation:     a.instr,
+		RequestGuard:        a.checkNotDeleted,
+	}
+	return projectmanagement.NewClient(ctx, conf)
+}
+
+// RemoteConfig returns an instance of remoteconfig.Client.
+func (a *App) RemoteConfig(ctx context.Context) (*remoteconfig.Client, error) {
+	if err := a.checkNotDeleted(); err != nil {
+		return nil, err
+	}
+	conf := &internal.RemoteConfigConfig{
+		ProjectID:           a.projectID,
+		Opts:                a.serviceOpts(internal.RemoteConfigScopes),
+		Version:             Version,
+		MaxResponseBodySize: a.maxBodySize,
+		MaxRetries:          a.maxRetries,
+		RequestTimeout:      a.timeout,
+		Headers:             a.headers,
+		UserAgentSuffix:     a.uaSuffix,
+		Transport:           a.transport,
+		Instrumentation:     a.instr,
+		RequestGuard:        a.checkNotDeleted,
+	}
+	return remoteconfig.NewClient(ctx, conf)
+}
+
+// ProjectID returns the ID of the Google Cloud project the App is associated with.
+//
+// The project ID is taken from the first of the following that specifies one: the ProjectID of
+// the Config, the credentials of the App (which, on Google Cloud, includes the metadata server),
+// and the GOOGLE_CLOUD_PROJECT and GCLOUD_PROJECT environment variables. Returns an empty string
+// if the project ID could not be determined.
+func (a *App) ProjectID() string {
+	return a.projectID
+}
+
+// serviceOpts returns the client options used to initialize a service that requires the given
+// OAuth2 scopes.
+//
+// The default scopes are placed before the options specified by the developer. Therefore any
+// scopes explicitly specified via option.WithScopes() take precedence over the defaults. The same
+// applies to the QuotaProject of the Config, and option.WithQuotaProject().
+func (a *App) serviceOpts(scopes []string) []option.ClientOption {
+	o := []option.ClientOption{option.WithScopes(scopes...)}
+	if a.quotaProject != "" {
+		o = append(o, option.WithQuotaProject(a.quotaProject))
+	}
+	return append(o, a.opts...)
+}
+
 // NewApp creates a new App from the provided config and client options.
 //
 // If the client options contain a valid credential (a service account file, a refresh token
 // file or an oauth2.TokenSource) the App will be authenticated using that credential. Otherwise,
 // NewApp attempts to authenticate the App with Google application default credentials.
+// By default each service requests only the OAuth2 scopes it requires. To use a fixed set of scopes
+// for all services instead, pass option.WithScopes() in the client options.
+// See ProjectID for how the project ID of the App is determined.
 // If `config` is nil, the SDK will attempt to load the config options from the
 // `FIREBASE_CONFIG` environment variable. If the value in it starts with a `{` it is parsed as a
 // JSON object, otherwise it is assumed to be the name of the JSON file containing the options.
@@ -150,7 +417,7 @@ func NewApp(ctx context.Context, config *Config, opts ...option.ClientOption) (*
 		pid = config.ProjectID
 	} else if creds.ProjectID != "" {
 		pid = creds.ProjectID
-	} else {
+	} else if pid = os.Getenv("GOOGLE_CLOUD_PROJECT"); pid == "" {
 		pid = os.Getenv("GCLOUD_PROJECT")
 	}
 
@@ -165,7 +432,15 @@ func NewApp(ctx context.Context, config *Config, opts ...option.ClientOption) (*
 		dbURL:         config.DatabaseURL,
 		projectID:     pid,
 		storageBucket: config.StorageBucket,
-		opts:          o,
+		maxBodySize:   config.MaxResponseBodySize,
+		maxRetries:    config.MaxRetries,
+		timeout:       config.RequestTimeout,
+		quotaProject:  config.QuotaProject,
+		headers:       config.Headers,
+		uaSuffix:      config.UserAgentSuffix,
+		transport:     config.Transport,
+		instr:         config.Instrumentation,
+		opts:          opts,
 	}, nil
 }
 
@@ -28,6 +28,9 @@ import (
 
 	"golang.org/x/net/context"
 
+	"firebase.google.com/go/auth"
+	"firebase.google.com/go/internal"
+
 	"golang.org/x/oauth2/google"
 
 	"google.golang.org/api/transport"
@@ -58,8 +61,8 @@ func TestServiceAcctFile(t *testing.T) {
 	if app.projectID != "mock-project-id" {
 		t.Errorf("Project ID: %q; want: %q", app.projectID, "mock-project-id")
 	}
-	if len(app.opts) != 2 {
-		t.Errorf("Client opts: %d; want: 2", len(app.opts))
+	if len(app.opts) != 1 {
+		t.Errorf("Client opts: %d; want: 1", len(app.opts))
 	}
 	if app.creds == nil {
 		t.Error("Credentials: nil; want creds")
@@ -112,8 +115,8 @@ func TestRefreshTokenFile(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(app.opts) != 2 {
-		t.Errorf("Client opts: %d; want: 2", len(app.opts))
+	if len(app.opts) != 1 {
+		t.Errorf("Client opts: %d; want: 1", len(app.opts))
 	}
 	if app.creds == nil {
 		t.Error("Credentials: nil; want creds")
@@ -131,8 +134,8 @@ func TestRefreshTokenFileWithConfig(t *testing.T) {
 	if app.projectID != "mock-project-id" {
 		t.Errorf("Project ID: %q; want: mock-project-id", app.projectID)
 	}
-	if len(app.opts) != 2 {
-		t.Errorf("Client opts: %d; want: 2", len(app.opts))
+	if len(app.opts) != 1 {
+		t.Errorf("Client opts: %d; want: 1", len(app.opts))
 	}
 	if app.creds == nil {
 		t.Error("Credentials: nil; want creds")
@@ -164,6 +167,61 @@ func TestRefreshTokenWithEnvVar(t *testing.T) {
 	}
 }
 
+func TestProjectIDFromEnv(t *testing.T) {
+	for _, name := range []string{"GOOGLE_CLOUD_PROJECT", "GCLOUD_PROJECT"} {
+		current := os.Getenv(name)
+		defer os.Setenv(name, current)
+	}
+
+	cases := []struct {
+		googleCloudProject string
+		gcloudProject      string
+		want               string
+	}{
+		{"", "", ""},
+		{"google-cloud-project", "", "google-cloud-project"},
+		{"", "gcloud-project", "gcloud-project"},
+		{"google-cloud-project", "gcloud-project", "google-cloud-project"},
+	}
+	for _, tc := range cases {
+		os.Setenv("GOOGLE_CLOUD_PROJECT", tc.googleCloudProject)
+		os.Setenv("GCLOUD_PROJECT", tc.gcloudProject)
+		app, err := NewApp(context.Background(), nil, option.WithCredentialsFile("testdata/refresh_token.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := app.ProjectID(); got != tc.want {
+			t.Errorf("ProjectID(%q, %q) = %q; want = %q", tc.googleCloudProject, tc.gcloudProject, got, tc.want)
+		}
+	}
+}
+
+func TestProjectIDPrecedence(t *testing.T) {
+	current := os.Getenv("GOOGLE_CLOUD_PROJECT")
+	if err := os.Setenv("GOOGLE_CLOUD_PROJECT", "env-project"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("GOOGLE_CLOUD_PROJECT", current)
+
+	ctx := context.Background()
+	opt := option.WithCredentialsFile("testdata/service_account.json")
+	app, err := NewApp(ctx, nil, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := app.ProjectID(); got != "mock-project-id" {
+		t.Errorf("ProjectID() = %q; want = %q", got, "mock-project-id")
+	}
+
+	app, err = NewApp(ctx, &Config{ProjectID: "explicit-project"}, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := app.ProjectID(); got != "explicit-project" {
+		t.Errorf("ProjectID() = %q; want = %q", got, "explicit-project")
+	}
+}
+
 func TestAppDefault(t *testing.T) {
 	current := os.Getenv(credEnvVar)
 
@@ -177,8 +235,8 @@ func TestAppDefault(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if len(app.opts) != 1 {
-		t.Errorf("Client opts: %d; want: 1", len(app.opts))
+	if len(app.opts) != 0 {
+		t.Errorf("Client opts: %d; want: 0", len(app.opts))
 	}
 	if app.creds == nil {
 		t.Error("Credentials: nil; want creds")
@@ -216,6 +274,41 @@ func TestInvalidCredentialFile(t *testing.T) {
 	}
 }
 
+func TestMaxResponseBodySize(t *testing.T) {
+	ctx := context.Background()
+	config := &Config{MaxResponseBodySize: 1024}
+	app, err := NewApp(ctx, config, option.WithCredentialsFile("testdata/service_account.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if app.maxBodySize != 1024 {
+		t.Errorf("MaxResponseBodySize = %d; want: 1024", app.maxBodySize)
+	}
+	if c, err := app.Messaging(ctx); c == nil || err != nil {
+		t.Errorf("Messaging() = (%v, %v); want (messaging, nil)", c, err)
+	}
+}
+
+func TestRetryConfig(t *testing.T) {
+	ctx := context.Background()
+	config := &Config{MaxRetries: 3, RequestTimeout: 5 * time.Second}
+	app, err := NewApp(ctx, config, option.WithCredentialsFile("testdata/service_account.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if app.maxRetries != 3 {
+		t.Errorf("MaxRetries = %d; want: 3", app.maxRetries)
+	}
+	if app.timeout != 5*time.Second {
+		t.Errorf("RequestTimeout = %v; want: %v", app.timeout, 5*time.Second)
+	}
+	if c, err := app.RemoteConfig(ctx); c == nil || err != nil {
+		t.Errorf("RemoteConfig() = (%v, %v); want (remoteconfig, nil)", c, err)
+	}
+}
+
 func TestAuth(t *testing.T) {
 	ctx := context.Background()
 	app, err := NewApp(ctx, nil, option.WithCredentialsFile("testdata/service_account.json"))
@@ -228,6 +321,24 @@ func TestAuth(t *testing.T) {
 	}
 }
 
+func TestVerifyOnlyAuth(t *testing.T) {
+	ctx := context.Background()
+	conf := &Config{ProjectID: "mock-project-id", MaxResponseBodySize: 1024}
+	app, err := NewApp(ctx, conf, option.WithCredentialsFile("testdata/service_account.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := app.VerifyOnlyAuth(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec := c.EffectiveConfig()
+	if ec.SignerType != auth.SignerNone || ec.UserManagement || ec.MaxResponseBodySize != 1024 {
+		t.Errorf("VerifyOnlyAuth().EffectiveConfig() = %#v; want = verify-only config", ec)
+	}
+}
+
 func TestDatabase(t *testing.T) {
 	ctx := context.Background()
 	conf := &Config{DatabaseURL: "https://mock-db.firebaseio.com"}
@@ -335,6 +446,18 @@ func TestFirestoreWithNoProjectID(t *testing.T) {
 	}
 }
 
+func TestAppCheck(t *testing.T) {
+	ctx := context.Background()
+	app, err := NewApp(ctx, nil, option.WithCredentialsFile("testdata/service_account.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := app.AppCheck(ctx); c == nil || err != nil {
+		t.Errorf("AppCheck() = (%v, %v); want (appcheck, nil)", c, err)
+	}
+}
+
 func TestInstanceID(t *testing.T) {
 	ctx := context.Background()
 	app, err := NewApp(ctx, nil, option.WithCredentialsFile("testdata/service_account.json"))
@@ -359,6 +482,194 @@ func TestMessaging(t *testing.T) {
 	}
 }
 
+func TestProjectManagement(t *testing.T) {
+	ctx := context.Background()
+	app, err := NewApp(ctx, nil, option.WithCredentialsFile("testdata/service_account.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := app.ProjectManagement(ctx); c == nil || err != nil {
+		t.Errorf("ProjectManagement() = (%v, %v); want (projectmanagement, nil)", c, err)
+	}
+}
+
+func TestDynamicLinks(t *testing.T) {
+	ctx := context.Background()
+	app, err := NewApp(ctx, nil, option.WithCredentialsFile("testdata/service_account.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := app.DynamicLinks(ctx); c == nil || err != nil {
+		t.Errorf("DynamicLinks() = (%v, %v); want (dynamiclinks, nil)", c, err)
+	}
+}
+
+func TestRemoteConfig(t *testing.T) {
+	ctx := context.Background()
+	app, err := NewApp(ctx, nil, option.WithCredentialsFile("testdata/service_account.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := app.RemoteConfig(ctx); c == nil || err != nil {
+		t.Errorf("RemoteConfig() = (%v, %v); want (remoteconfig, nil)", c, err)
+	}
+}
+
+func TestServiceOpts(t *testing.T) {
+	ctx := context.Background()
+	app, err := NewApp(ctx, nil, option.WithCredentialsFile("testdata/service_account.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := app.serviceOpts(internal.MessagingScopes)
+	if len(opts) != 2 {
+		t.Fatalf("serviceOpts() = %d; want: 2", len(opts))
+	}
+	want := option.WithScopes(internal.MessagingScopes...)
+	if !reflect.DeepEqual(opts[0], want) {
+		t.Errorf("serviceOpts()[0] = %v; want: %v", opts[0], want)
+	}
+	if _, err := transport.Creds(ctx, opts...); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServiceOptsWithExplicitScopes(t *testing.T) {
+	ctx := context.Background()
+	scopes := option.WithScopes("https://www.googleapis.com/auth/firebase.messaging")
+	app, err := NewApp(ctx, nil, option.WithCredentialsFile("testdata/service_account.json"), scopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := app.serviceOpts(internal.FirestoreScopes)
+	if len(opts) != 3 {
+		t.Fatalf("serviceOpts() = %d; want: 3", len(opts))
+	}
+	if !reflect.DeepEqual(opts[2], scopes) {
+		t.Errorf("serviceOpts()[2] = %v; want: %v", opts[2], scopes)
+	}
+}
+
+func TestServiceOptsWithQuotaProject(t *testing.T) {
+	ctx := context.Background()
+	ts := &testTokenSource{AccessToken: "mock-token-from-custom"}
+	app, err := NewApp(ctx, &Config{QuotaProject: "quota-project"}, option.WithTokenSource(ts))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := app.serviceOpts(internal.MessagingScopes)
+	if len(opts) != 3 {
+		t.Fatalf("serviceOpts() = %d; want: 3", len(opts))
+	}
+	client, _, err := transport.NewHTTPClient(ctx, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var quotaProject string
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		quotaProject = r.Header.Get("X-Goog-User-Project")
+	}))
+	defer service.Close()
+
+	resp, err := client.Get(service.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if quotaProject != "quota-project" {
+		t.Errorf("X-Goog-User-Project: %q; want: %q", quotaProject, "quota-project")
+	}
+}
+
+type recordingTransport struct {
+	reqs []*http.Request
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.reqs = append(t.reqs, req)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}, nil
+}
+
+type recordingInstrumentation struct {
+	ops []string
+}
+
+func (r *recordingInstrumentation) StartRequest(
+	ctx context.Context, service, operation string, req *http.Request) context.Context {
+	return ctx
+}
+
+func (r *recordingInstrumentation) EndRequest(
+	ctx context.Context, service, operation string, status int, elapsed time.Duration, err error) {
+	r.ops = append(r.ops, service+"."+operation+":"+strconv.Itoa(status))
+}
+
+func TestInstrumentation(t *testing.T) {
+	ctx := context.Background()
+	inst := &recordingInstrumentation{}
+	conf := &Config{
+		ProjectID:       "mock-project-id",
+		Transport:       &recordingTransport{},
+		Instrumentation: inst,
+	}
+	app, err := NewApp(ctx, conf, option.WithTokenSource(&testTokenSource{AccessToken: "mock-token"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := app.InstanceID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteInstanceID(ctx, "test-iid"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"iid.DeleteInstanceID:200"}
+	if !reflect.DeepEqual(inst.ops, want) {
+		t.Errorf("Instrumentation = %v; want = %v", inst.ops, want)
+	}
+}
+
+func TestCustomTransport(t *testing.T) {
+	ctx := context.Background()
+	rt := &recordingTransport{}
+	ts := &testTokenSource{AccessToken: "mock-token-from-custom"}
+	app, err := NewApp(ctx, &Config{ProjectID: "mock-project-id", Transport: rt}, option.WithTokenSource(ts))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := app.InstanceID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteInstanceID(ctx, "test-iid"); err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.reqs) != 1 {
+		t.Fatalf("Requests = %d; want = 1", len(rt.reqs))
+	}
+	req := rt.reqs[0]
+	if req.URL.Host != "console.firebase.google.com" {
+		t.Errorf("Host = %q; want = %q", req.URL.Host, "console.firebase.google.com")
+	}
+	if h := req.Header.Get("Authorization"); h != "Bearer "+ts.AccessToken {
+		t.Errorf("Authorization = %q; want = %q", h, "Bearer "+ts.AccessToken)
+	}
+}
+
 func TestCustomTokenSource(t *testing.T) {
 	ctx := context.Background()
 	ts := &testTokenSource{AccessToken: "mock-token-from-custom"}
@@ -22,8 +22,6 @@ import (
 
 	"golang.org/x/net/context"
 
-	"google.golang.org/api/transport"
-
 	"firebase.google.com/go/internal"
 )
 
@@ -57,15 +55,23 @@ func NewClient(ctx context.Context, c *internal.InstanceIDConfig) (*Client, erro
 		return nil, errors.New("project id is required to access instance id client")
 	}
 
-	hc, _, err := transport.NewHTTPClient(ctx, c.Opts...)
+	hc, err := internal.NewHTTPClient(ctx, c.Transport, c.Opts...)
 	if err != nil {
 		return nil, err
 	}
+	hc = internal.WithHeaders(hc, c.Headers, c.UserAgentSuffix)
+	hc = internal.Instrument(hc, c.Instrumentation, "iid")
+	hc = internal.WithGuard(hc, c.RequestGuard)
 
 	return &Client{
 		endpoint: iidEndpoint,
-		client:   &internal.HTTPClient{Client: hc},
-		project:  c.ProjectID,
+		client: &internal.HTTPClient{
+			Client:      hc,
+			MaxBodySize: c.MaxResponseBodySize,
+			RetryConfig: internal.NewRetryConfig(c.MaxRetries),
+			Timeout:     c.RequestTimeout,
+		},
+		project: c.ProjectID,
 	}, nil
 }
 
@@ -73,19 +79,21 @@ func NewClient(ctx context.Context, c *internal.InstanceIDConfig) (*Client, erro
 //
 // This can be used to delete an instance ID and associated user data from a Firebase project,
 // pursuant to the General Data protection Regulation (GDPR).
-func (c *Client) DeleteInstanceID(ctx context.Context, iid string) error {
+func (c *Client) DeleteInstanceID(ctx context.Context, iid string) (err error) {
+	defer internal.WrapOpError(&err, "DeleteInstanceID", iid)
 	if iid == "" {
 		return errors.New("instance id must not be empty")
 	}
 
 	url := fmt.Sprintf("%s/project/%s/instanceId/%s", c.endpoint, c.project, iid)
+	ctx = internal.WithOperation(ctx, "DeleteInstanceID")
 	resp, err := c.client.Do(ctx, &internal.Request{Method: http.MethodDelete, URL: url})
 	if err != nil {
 		return err
 	}
 
 	if msg, ok := errorCodes[resp.Status]; ok {
-		return fmt.Errorf("instance id %q: %s", iid, msg)
+		return errors.New(msg)
 	}
 	return resp.CheckStatus(http.StatusOK)
 }
@@ -111,7 +111,7 @@ func TestDeleteInstanceIDError(t *testing.T) {
 			t.Fatal("DeleteInstanceID() = nil; want = error")
 		}
 
-		want := fmt.Sprintf("instance id %q: %s", "test-iid", v)
+		want := fmt.Sprintf("DeleteInstanceID(%q): %s", "test-iid", v)
 		if err.Error() != want {
 			t.Errorf("DeleteInstanceID() = %v; want = %v", err, want)
 		}
@@ -154,7 +154,7 @@ func TestDeleteInstanceIDUnexpectedError(t *testing.T) {
 		t.Fatal("DeleteInstanceID() = nil; want = error")
 	}
 
-	want := "http error status: 511; reason: {}"
+	want := `DeleteInstanceID("test-iid"): http error status: 511; reason: {}`
 	if err.Error() != want {
 		t.Errorf("DeleteInstanceID() = %v; want = %v", err, want)
 	}
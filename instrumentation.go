@@ -0,0 +1,42 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package firebase
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Instrumentation receives events about the HTTP requests made by the services of an App, such
+// as the requests that refresh the public keys used to verify ID tokens, and the user management
+// requests of the Auth service. It can be used to record traces and metrics for these requests,
+// e.g. by adapting it to OpenTelemetry or OpenCensus.
+//
+// StartRequest is called before each request is sent, and returns the context used for the rest
+// of the request, which may carry a span. EndRequest is called once the response headers are
+// received, or the request fails, with the HTTP status (zero on failure) and the elapsed time.
+// Each attempt of a retried request is reported separately. The service is the name of the
+// package that made the request (e.g. "auth", "messaging"), and the operation is the name of
+// the API method called (e.g. "accounts:lookup", "RefreshKeys"). Implementations must be safe
+// for concurrent use.
+//
+// Token verifications that do not make HTTP requests are not reported. Use auth.WithTracer() to
+// trace them.
+type Instrumentation interface {
+	StartRequest(ctx context.Context, service, operation string, req *http.Request) context.Context
+	EndRequest(ctx context.Context, service, operation string, status int, elapsed time.Duration, err error)
+}
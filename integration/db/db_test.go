@@ -25,6 +25,7 @@ import (
 	"net/http"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
 	"golang.org/x/net/context"
@@ -585,12 +586,12 @@ func TestNoAccess(t *testing.T) {
 	var got string
 	if err := r.Get(context.Background(), &got); err == nil || got != "" {
 		t.Errorf("Get() = (%q, %v); want = (empty, error)", got, err)
-	} else if err.Error() != permDenied {
+	} else if !strings.HasSuffix(err.Error(), permDenied) {
 		t.Errorf("Error = %q; want = %q", err.Error(), permDenied)
 	}
 	if err := r.Set(context.Background(), "update"); err == nil {
 		t.Errorf("Set() = nil; want = error")
-	} else if err.Error() != permDenied {
+	} else if !strings.HasSuffix(err.Error(), permDenied) {
 		t.Errorf("Error = %q; want = %q", err.Error(), permDenied)
 	}
 }
@@ -603,7 +604,7 @@ func TestReadAccess(t *testing.T) {
 	}
 	if err := r.Set(context.Background(), "update"); err == nil {
 		t.Errorf("Set() = nil; want = error")
-	} else if err.Error() != permDenied {
+	} else if !strings.HasSuffix(err.Error(), permDenied) {
 		t.Errorf("Error = %q; want = %q", err.Error(), permDenied)
 	}
 }
@@ -624,7 +625,7 @@ func TestQueryAccess(t *testing.T) {
 	got := make(map[string]interface{})
 	if err := r.OrderByKey().LimitToFirst(2).Get(context.Background(), &got); err == nil {
 		t.Errorf("OrderByQuery() = nil; want = error")
-	} else if err.Error() != permDenied {
+	} else if !strings.HasSuffix(err.Error(), permDenied) {
 		t.Errorf("Error = %q; want = %q", err.Error(), permDenied)
 	}
 }
@@ -637,7 +638,7 @@ func TestGuestAccess(t *testing.T) {
 	}
 	if err := r.Set(context.Background(), "update"); err == nil {
 		t.Errorf("Set() = nil; want = error")
-	} else if err.Error() != permDenied {
+	} else if !strings.HasSuffix(err.Error(), permDenied) {
 		t.Errorf("Error = %q; want = %q", err.Error(), permDenied)
 	}
 
@@ -645,21 +646,21 @@ func TestGuestAccess(t *testing.T) {
 	r = guestClient.NewRef("_adminsdk/go")
 	if err := r.Get(context.Background(), &got); err == nil || got != "" {
 		t.Errorf("Get() = (%q, %v); want = (empty, error)", got, err)
-	} else if err.Error() != permDenied {
+	} else if !strings.HasSuffix(err.Error(), permDenied) {
 		t.Errorf("Error = %q; want = %q", err.Error(), permDenied)
 	}
 
 	c := r.Child("protected/user2")
 	if err := c.Get(context.Background(), &got); err == nil || got != "" {
 		t.Errorf("Get() = (%q, %v); want = (empty, error)", got, err)
-	} else if err.Error() != permDenied {
+	} else if !strings.HasSuffix(err.Error(), permDenied) {
 		t.Errorf("Error = %q; want = %q", err.Error(), permDenied)
 	}
 
 	c = r.Child("admin")
 	if err := c.Get(context.Background(), &got); err == nil || got != "" {
 		t.Errorf("Get() = (%q, %v); want = (empty, error)", got, err)
-	} else if err.Error() != permDenied {
+	} else if !strings.HasSuffix(err.Error(), permDenied) {
 		t.Errorf("Error = %q; want = %q", err.Error(), permDenied)
 	}
 }
@@ -56,7 +56,7 @@ func TestNonExisting(t *testing.T) {
 	if err == nil {
 		t.Errorf("DeleteInstanceID(non-existing) = nil; want error")
 	}
-	want := `instance id "fictive-ID0": failed to find the instance id`
+	want := `DeleteInstanceID("fictive-ID0"): failed to find the instance id`
 	if err.Error() != want {
 		t.Errorf("DeleteInstanceID(non-existing) = %v; want = %v", err, want)
 	}
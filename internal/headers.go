@@ -0,0 +1,74 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"net/http"
+)
+
+// WithHeaders returns an http.Client that behaves like hc, but adds the given headers to each
+// request, and appends uaSuffix to its User-Agent header.
+//
+// Headers already present on a request are not overwritten. Returns hc itself if there is nothing
+// to add.
+func WithHeaders(hc *http.Client, header http.Header, uaSuffix string) *http.Client {
+	if len(header) == 0 && uaSuffix == "" {
+		return hc
+	}
+	canonical := make(http.Header, len(header))
+	for k, v := range header {
+		canonical[http.CanonicalHeaderKey(k)] = v
+	}
+	c := *hc
+	c.Transport = &headerTransport{
+		base:     hc.Transport,
+		header:   canonical,
+		uaSuffix: uaSuffix,
+	}
+	return &c
+}
+
+type headerTransport struct {
+	base     http.RoundTripper
+	header   http.Header
+	uaSuffix string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request, so the headers are set on a shallow copy.
+	r := *req
+	r.Header = make(http.Header, len(req.Header)+len(t.header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	for k, v := range t.header {
+		if _, ok := r.Header[k]; !ok {
+			r.Header[k] = v
+		}
+	}
+	if t.uaSuffix != "" {
+		ua := t.uaSuffix
+		if current := r.Header.Get("User-Agent"); current != "" {
+			ua = current + " " + ua
+		}
+		r.Header.Set("User-Agent", ua)
+	}
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(&r)
+}
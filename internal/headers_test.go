@@ -0,0 +1,91 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithHeaders(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer server.Close()
+
+	header := http.Header{
+		"x-custom-header":  []string{"custom-value"},
+		"X-Client-Version": []string{"overridden"},
+	}
+	client := WithHeaders(http.DefaultClient, header, "my-app/1.0")
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("User-Agent", "sdk/2.0")
+	req.Header.Set("X-Client-Version", "Go/Admin/test")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	want := map[string]string{
+		"X-Custom-Header":  "custom-value",
+		"X-Client-Version": "Go/Admin/test",
+		"User-Agent":       "sdk/2.0 my-app/1.0",
+	}
+	for k, v := range want {
+		if h := got.Get(k); h != v {
+			t.Errorf("%s = %q; want = %q", k, h, v)
+		}
+	}
+	if h := req.Header.Get("User-Agent"); h != "sdk/2.0" {
+		t.Errorf("Request User-Agent = %q; want = %q", h, "sdk/2.0")
+	}
+	if h := req.Header.Get("X-Custom-Header"); h != "" {
+		t.Errorf("Request X-Custom-Header = %q; want = %q", h, "")
+	}
+}
+
+func TestWithHeadersUserAgentOnly(t *testing.T) {
+	var ua string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua = r.Header.Get("User-Agent")
+	}))
+	defer server.Close()
+
+	client := WithHeaders(http.DefaultClient, nil, "my-app/1.0")
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if ua != "my-app/1.0" {
+		t.Errorf("User-Agent = %q; want = %q", ua, "my-app/1.0")
+	}
+}
+
+func TestWithHeadersNoop(t *testing.T) {
+	hc := &http.Client{}
+	if got := WithHeaders(hc, nil, ""); got != hc {
+		t.Errorf("WithHeaders() = %p; want = %p", got, hc)
+	}
+	if got := WithHeaders(hc, http.Header{}, ""); got != hc {
+		t.Errorf("WithHeaders(empty) = %p; want = %p", got, hc)
+	}
+}
@@ -21,47 +21,171 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	"golang.org/x/net/context/ctxhttp"
 
 	"golang.org/x/net/context"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/transport"
+	htransport "google.golang.org/api/transport/http"
 )
 
+// DefaultMaxResponseBodySize is the default upper limit on the size of the HTTP response bodies read
+// by the SDK. It is large enough to accommodate the largest single read supported by the Firebase
+// Realtime Database (256 MB).
+const DefaultMaxResponseBodySize int64 = 256 << 20
+
 // HTTPClient is a convenient API to make HTTP calls.
 //
 // This API handles some of the repetitive tasks such as entity serialization and deserialization
 // involved in making HTTP calls. It provides a convenient mechanism to set headers and query
 // parameters on outgoing requests, while enforcing that an explicit context is used per request.
 // Responses returned by HTTPClient can be easily parsed as JSON, and provide a simple mechanism to
-// extract error details.
+// extract error details. Requests that fail with transient errors are retried according to the
+// RetryConfig of the HTTPClient.
 type HTTPClient struct {
 	Client    *http.Client
 	ErrParser ErrorParser
+
+	// MaxBodySize is the maximum number of bytes read from a response body. If zero,
+	// DefaultMaxResponseBodySize is used.
+	MaxBodySize int64
+
+	// RetryConfig specifies how failed requests are retried. If nil, requests are not retried.
+	RetryConfig *RetryConfig
+
+	// Timeout bounds a call to Do, including any retries, when the context of the call has no
+	// deadline. If zero, calls are only bounded by their context.
+	Timeout time.Duration
+}
+
+// NewHTTPClient creates an http.Client that authorizes requests as specified by opts.
+//
+// If base is not nil, requests are sent through it instead of the default transport, e.g. to
+// route them via a proxy, while still being authorized with the credentials in opts.
+func NewHTTPClient(ctx context.Context, base http.RoundTripper, opts ...option.ClientOption) (*http.Client, error) {
+	if base == nil {
+		hc, _, err := transport.NewHTTPClient(ctx, opts...)
+		return hc, err
+	}
+	rt, err := htransport.NewTransport(ctx, base, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: rt}, nil
+}
+
+// WithGuard returns an http.Client that behaves like hc, but calls guard before sending each
+// request, and fails the request with the error returned by guard, if any. Returns hc itself if
+// guard is nil.
+func WithGuard(hc *http.Client, guard func() error) *http.Client {
+	if guard == nil {
+		return hc
+	}
+	c := *hc
+	c.Transport = &guardTransport{base: hc.Transport, guard: guard}
+	return &c
+}
+
+type guardTransport struct {
+	base  http.RoundTripper
+	guard func() error
+}
+
+func (t *guardTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.guard(); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
 }
 
 // Do executes the given Request, and returns a Response.
+//
+// If the request fails with a network error or a retryable status, it is retried as specified by
+// the RetryConfig of the HTTPClient. Requests that are not idempotent (see Request.Idempotent) are
+// only retried when the server responds with status 429, since the server may have processed them
+// before a network error or a 5xx response. The Response (or error) of the last attempt is
+// returned.
 func (c *HTTPClient) Do(ctx context.Context, r *Request) (*Response, error) {
+	if _, ok := ctx.Deadline(); !ok && c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	for retries := 0; ; retries++ {
+		resp, retry, err := c.attempt(ctx, r)
+		if !retry {
+			return resp, err
+		}
+		var header http.Header
+		if resp != nil {
+			header = resp.Header
+		}
+		delay, ok := c.RetryConfig.delay(retries, header)
+		if !ok || !sleep(ctx, delay) {
+			return resp, err
+		}
+	}
+}
+
+// attempt makes a single request, and returns the resulting Response. The returned bool indicates
+// whether the request failed with a transient error, and may be retried.
+func (c *HTTPClient) attempt(ctx context.Context, r *Request) (*Response, bool, error) {
 	req, err := r.buildHTTPRequest()
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	resp, err := ctxhttp.Do(ctx, c.Client, req)
 	if err != nil {
-		return nil, err
+		return nil, ctx.Err() == nil && r.idempotent(), err
 	}
 	defer resp.Body.Close()
+	if r.Validate != nil && !r.retryableStatus(resp.StatusCode) {
+		if err := r.Validate(resp); err != nil {
+			return nil, r.idempotent(), err
+		}
+	}
 
-	b, err := ioutil.ReadAll(resp.Body)
+	b, err := ReadBody(resp.Body, c.MaxBodySize)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	return &Response{
 		Status:    resp.StatusCode,
 		Body:      b,
 		Header:    resp.Header,
 		errParser: c.ErrParser,
-	}, nil
+	}, r.retryableStatus(resp.StatusCode), nil
+}
+
+// ReadBody reads from r until EOF, and returns the data read.
+//
+// ReadBody reads at most limit bytes, and returns an error if r contains more data than that. This
+// protects the SDK from running out of memory when a server responds with an unexpectedly large
+// body. If limit is zero or negative, DefaultMaxResponseBodySize is used.
+func ReadBody(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		limit = DefaultMaxResponseBodySize
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("response too large: body exceeds the limit of %d bytes", limit)
+	}
+	return b, nil
 }
 
 // Request contains all the parameters required to construct an outgoing HTTP request.
@@ -70,6 +194,32 @@ type Request struct {
 	URL    string
 	Body   HTTPEntity
 	Opts   []HTTPOption
+
+	// Idempotent marks a request that can safely be sent more than once, although its method is not
+	// idempotent (e.g. a POST request that only reads data). Requests with the GET, HEAD, OPTIONS,
+	// PUT and DELETE methods are always considered idempotent.
+	Idempotent bool
+
+	// Validate, if not nil, checks each response that does not have a retryable status. An error
+	// returned by Validate fails the attempt like a network error, so that the request is retried
+	// if it is idempotent.
+	Validate func(*http.Response) error
+}
+
+func (r *Request) idempotent() bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return r.Idempotent
+}
+
+// retryableStatus checks if an attempt of r that failed with the given status may be retried.
+func (r *Request) retryableStatus(status int) bool {
+	if status == http.StatusTooManyRequests {
+		return true
+	}
+	return IsRetryableStatus(status) && r.idempotent()
 }
 
 func (r *Request) buildHTTPRequest() (*http.Request, error) {
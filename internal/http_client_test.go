@@ -15,13 +15,17 @@ package internal
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 
 	"golang.org/x/net/context"
+
+	"google.golang.org/api/option"
 )
 
 var cases = []struct {
@@ -204,6 +208,50 @@ func TestContext(t *testing.T) {
 	}
 }
 
+func TestMaxBodySize(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{\"foo\": \"bar\"}"))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req := &Request{Method: http.MethodGet, URL: server.URL}
+	client := &HTTPClient{Client: http.DefaultClient, MaxBodySize: 14}
+	if _, err := client.Do(context.Background(), req); err != nil {
+		t.Errorf("Do(limit = 14) = %v; want = nil", err)
+	}
+
+	client.MaxBodySize = 13
+	if resp, err := client.Do(context.Background(), req); resp != nil || err == nil {
+		t.Errorf("Do(limit = 13) = (%v, %v); want = (nil, error)", resp, err)
+	}
+}
+
+func TestReadBody(t *testing.T) {
+	cases := []struct {
+		name  string
+		body  string
+		limit int64
+	}{
+		{"Empty", "", 1},
+		{"BelowLimit", "test", 5},
+		{"AtLimit", "test", 4},
+		{"DefaultLimit", "test", 0},
+	}
+	for _, tc := range cases {
+		b, err := ReadBody(strings.NewReader(tc.body), tc.limit)
+		if err != nil || string(b) != tc.body {
+			t.Errorf("ReadBody(%s) = (%q, %v); want = (%q, nil)", tc.name, string(b), err, tc.body)
+		}
+	}
+
+	want := "response too large: body exceeds the limit of 3 bytes"
+	if b, err := ReadBody(strings.NewReader("test"), 3); b != nil || err == nil || err.Error() != want {
+		t.Errorf("ReadBody(AboveLimit) = (%q, %v); want = (nil, %q)", string(b), err, want)
+	}
+}
+
 func TestErrorParser(t *testing.T) {
 	data := map[string]interface{}{
 		"error": "test error",
@@ -293,3 +341,90 @@ func TestUnmarshalError(t *testing.T) {
 		t.Errorf("Unmarshal() = nil; want error")
 	}
 }
+
+type recordingTransport struct {
+	reqs []*http.Request
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.reqs = append(t.reqs, req)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}, nil
+}
+
+func TestNewHTTPClientWithTransport(t *testing.T) {
+	rt := &recordingTransport{}
+	opts := []option.ClientOption{option.WithTokenSource(&MockTokenSource{AccessToken: "test-token"})}
+	hc, err := NewHTTPClient(context.Background(), rt, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := hc.Get("https://example.com/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(rt.reqs) != 1 {
+		t.Fatalf("Requests = %d; want = 1", len(rt.reqs))
+	}
+	if h := rt.reqs[0].Header.Get("Authorization"); h != "Bearer test-token" {
+		t.Errorf("Authorization = %q; want = %q", h, "Bearer test-token")
+	}
+}
+
+func TestWithGuard(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	var guardErr error
+	hc := WithGuard(http.DefaultClient, func() error { return guardErr })
+	resp, err := hc.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	guardErr = errors.New("app deleted")
+	if resp, err := hc.Get(server.URL); err == nil || !strings.Contains(err.Error(), "app deleted") {
+		if err == nil {
+			resp.Body.Close()
+		}
+		t.Errorf("Get() = %v; want = %q", err, "app deleted")
+	}
+	if requests != 1 {
+		t.Errorf("Requests = %d; want = 1", requests)
+	}
+	if got := WithGuard(http.DefaultClient, nil); got != http.DefaultClient {
+		t.Errorf("WithGuard(nil) = %p; want = %p", got, http.DefaultClient)
+	}
+}
+
+func TestNewHTTPClientWithoutTransport(t *testing.T) {
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	opts := []option.ClientOption{option.WithTokenSource(&MockTokenSource{AccessToken: "test-token"})}
+	hc, err := NewHTTPClient(context.Background(), nil, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := hc.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if auth != "Bearer test-token" {
+		t.Errorf("Authorization = %q; want = %q", auth, "Bearer test-token")
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Instrumentation receives events about the HTTP requests made by the services of an App. It has
+// the same method set as firebase.Instrumentation, which documents it.
+type Instrumentation interface {
+	StartRequest(ctx context.Context, service, operation string, req *http.Request) context.Context
+	EndRequest(ctx context.Context, service, operation string, status int, elapsed time.Duration, err error)
+}
+
+type operationKey struct{}
+
+// WithOperation returns a context that makes the requests sent with it report the given operation
+// name to Instrumentation. Without it, the last segment of the request URL path is reported.
+func WithOperation(ctx context.Context, operation string) context.Context {
+	return context.WithValue(ctx, operationKey{}, operation)
+}
+
+// Instrument returns an http.Client that behaves like hc, but reports each request sent through it
+// to inst as made by the given service. Returns hc itself if inst is nil.
+func Instrument(hc *http.Client, inst Instrumentation, service string) *http.Client {
+	if inst == nil {
+		return hc
+	}
+	c := *hc
+	c.Transport = &instrumentedTransport{
+		base:    hc.Transport,
+		inst:    inst,
+		service: service,
+	}
+	return &c
+}
+
+type instrumentedTransport struct {
+	base    http.RoundTripper
+	inst    Instrumentation
+	service string
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	op := operationName(req)
+	ctx := t.inst.StartRequest(req.Context(), t.service, op, req)
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req.WithContext(ctx))
+	var status int
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	t.inst.EndRequest(ctx, t.service, op, status, time.Since(start), err)
+	return resp, err
+}
+
+func operationName(req *http.Request) string {
+	if op, ok := req.Context().Value(operationKey{}).(string); ok {
+		return op
+	}
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	return path[strings.LastIndex(path, "/")+1:]
+}
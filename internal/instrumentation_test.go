@@ -0,0 +1,120 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type ctxKey struct{}
+
+type event struct {
+	service, operation string
+	status             int
+	elapsed            time.Duration
+	err                error
+	started            bool
+}
+
+type mockInstrumentation struct {
+	events []*event
+}
+
+func (m *mockInstrumentation) StartRequest(
+	ctx context.Context, service, operation string, req *http.Request) context.Context {
+	m.events = append(m.events, &event{service: service, operation: operation})
+	return context.WithValue(ctx, ctxKey{}, true)
+}
+
+func (m *mockInstrumentation) EndRequest(
+	ctx context.Context, service, operation string, status int, elapsed time.Duration, err error) {
+	e := m.events[len(m.events)-1]
+	if service != e.service || operation != e.operation {
+		e.operation = "mismatch"
+	}
+	e.status = status
+	e.elapsed = elapsed
+	e.err = err
+	e.started, _ = ctx.Value(ctxKey{}).(bool)
+}
+
+func TestInstrument(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	inst := &mockInstrumentation{}
+	client := Instrument(http.DefaultClient, inst, "test")
+	resp, err := client.Get(server.URL + "/v1/projects/test/accounts:lookup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/keys", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(WithOperation(context.Background(), "RefreshKeys"))
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	want := []string{"accounts:lookup", "RefreshKeys"}
+	if len(inst.events) != len(want) {
+		t.Fatalf("Events = %d; want = %d", len(inst.events), len(want))
+	}
+	for i, e := range inst.events {
+		if e.service != "test" || e.operation != want[i] {
+			t.Errorf("Event[%d] = (%q, %q); want = (%q, %q)", i, e.service, e.operation, "test", want[i])
+		}
+		if e.status != http.StatusNotFound || e.err != nil || e.elapsed <= 0 || !e.started {
+			t.Errorf("Event[%d] = %+v; want = (404, nil, elapsed > 0, started)", i, e)
+		}
+	}
+}
+
+func TestInstrumentError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	inst := &mockInstrumentation{}
+	client := Instrument(http.DefaultClient, inst, "test")
+	if resp, err := client.Get(server.URL + "/path/"); err == nil {
+		resp.Body.Close()
+		t.Fatal("Get() = nil; want = error")
+	}
+	if len(inst.events) != 1 {
+		t.Fatalf("Events = %d; want = 1", len(inst.events))
+	}
+	if e := inst.events[0]; e.operation != "path" || e.status != 0 || e.err == nil {
+		t.Errorf("Event = %+v; want = (path, 0, error)", e)
+	}
+}
+
+func TestInstrumentNoop(t *testing.T) {
+	hc := &http.Client{}
+	if got := Instrument(hc, nil, "test"); got != hc {
+		t.Errorf("Instrument() = %p; want = %p", got, hc)
+	}
+}
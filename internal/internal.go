@@ -17,6 +17,9 @@ package internal // import "firebase.google.com/go/internal"
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -24,6 +27,9 @@ import (
 )
 
 // FirebaseScopes is the set of OAuth2 scopes used by the Admin SDK.
+//
+// These scopes are only used when discovering the credentials of an App. Each service client
+// requests the narrower set of scopes it requires (e.g. MessagingScopes).
 var FirebaseScopes = []string{
 	"https://www.googleapis.com/auth/cloud-platform",
 	"https://www.googleapis.com/auth/datastore",
@@ -33,26 +39,173 @@ var FirebaseScopes = []string{
 	"https://www.googleapis.com/auth/userinfo.email",
 }
 
+// AppCheckScopes is the set of OAuth2 scopes required by the Firebase App Check service.
+var AppCheckScopes = []string{
+	"https://www.googleapis.com/auth/firebase",
+}
+
+// AuthScopes is the set of OAuth2 scopes required by the Firebase Auth service. Besides the
+// Identity Toolkit API, the Auth service calls the admin endpoints of Identity Toolkit v1/v2
+// (tenants, provider configs and batch user operations), which accept the firebase scope.
+var AuthScopes = []string{
+	"https://www.googleapis.com/auth/firebase",
+	"https://www.googleapis.com/auth/identitytoolkit",
+}
+
+// IAMScopes is the set of OAuth2 scopes required by the IAM signBlob API, which the Firebase Auth
+// service calls to sign custom tokens when the SDK is initialized without a service account
+// private key.
+var IAMScopes = []string{
+	"https://www.googleapis.com/auth/cloud-platform",
+}
+
+// DatabaseScopes is the set of OAuth2 scopes required by the Firebase Realtime Database service.
+var DatabaseScopes = []string{
+	"https://www.googleapis.com/auth/firebase.database",
+	"https://www.googleapis.com/auth/userinfo.email",
+}
+
+// FirestoreScopes is the set of OAuth2 scopes required by the Google Cloud Firestore service.
+var FirestoreScopes = []string{
+	"https://www.googleapis.com/auth/datastore",
+}
+
+// DynamicLinksScopes is the set of OAuth2 scopes required by the Firebase Dynamic Links service.
+var DynamicLinksScopes = []string{
+	"https://www.googleapis.com/auth/firebase",
+}
+
+// InstanceIDScopes is the set of OAuth2 scopes required by the Firebase Instance ID service.
+var InstanceIDScopes = []string{
+	"https://www.googleapis.com/auth/firebase",
+}
+
+// MessagingScopes is the set of OAuth2 scopes required by the Firebase Cloud Messaging service.
+var MessagingScopes = []string{
+	"https://www.googleapis.com/auth/firebase.messaging",
+}
+
+// ProjectManagementScopes is the set of OAuth2 scopes required by the Firebase project management
+// service.
+var ProjectManagementScopes = []string{
+	"https://www.googleapis.com/auth/firebase",
+}
+
+// RemoteConfigScopes is the set of OAuth2 scopes required by the Firebase Remote Config service.
+var RemoteConfigScopes = []string{
+	"https://www.googleapis.com/auth/firebase.remoteconfig",
+}
+
+// StorageScopes is the set of OAuth2 scopes required by the Google Cloud Storage service.
+var StorageScopes = []string{
+	"https://www.googleapis.com/auth/devstorage.full_control",
+}
+
 // AuthConfig represents the configuration of Firebase Auth service.
 type AuthConfig struct {
-	Opts      []option.ClientOption
-	Creds     *google.DefaultCredentials
-	ProjectID string
-	Version   string
+	Opts                []option.ClientOption
+	SignerOpts          []option.ClientOption // for calling IAM signBlob; if nil, Opts are used
+	Creds               *google.DefaultCredentials
+	ProjectID           string
+	Version             string
+	MaxResponseBodySize int64
+	MaxRetries          int
+	RequestTimeout      time.Duration
+	Headers             http.Header
+	UserAgentSuffix     string
+	Transport           http.RoundTripper
+	Instrumentation     Instrumentation
+	RequestGuard        func() error
+	VerifyOnly          bool // if set, the Client only verifies tokens, and Creds and Opts are unused
+}
+
+// AppCheckConfig represents the configuration of Firebase App Check service.
+type AppCheckConfig struct {
+	Opts                []option.ClientOption
+	ProjectID           string
+	Version             string
+	MaxResponseBodySize int64
+	MaxRetries          int
+	RequestTimeout      time.Duration
+	Headers             http.Header
+	UserAgentSuffix     string
+	Transport           http.RoundTripper
+	Instrumentation     Instrumentation
+	RequestGuard        func() error
+}
+
+// DynamicLinksConfig represents the configuration of Firebase Dynamic Links service.
+type DynamicLinksConfig struct {
+	Opts                []option.ClientOption
+	Version             string
+	MaxResponseBodySize int64
+	MaxRetries          int
+	RequestTimeout      time.Duration
+	Headers             http.Header
+	UserAgentSuffix     string
+	Transport           http.RoundTripper
+	Instrumentation     Instrumentation
+	RequestGuard        func() error
 }
 
 // InstanceIDConfig represents the configuration of Firebase Instance ID service.
 type InstanceIDConfig struct {
-	Opts      []option.ClientOption
-	ProjectID string
+	Opts                []option.ClientOption
+	ProjectID           string
+	MaxResponseBodySize int64
+	MaxRetries          int
+	RequestTimeout      time.Duration
+	Headers             http.Header
+	UserAgentSuffix     string
+	Transport           http.RoundTripper
+	Instrumentation     Instrumentation
+	RequestGuard        func() error
 }
 
 // DatabaseConfig represents the configuration of Firebase Database service.
 type DatabaseConfig struct {
-	Opts         []option.ClientOption
-	URL          string
-	Version      string
-	AuthOverride map[string]interface{}
+	Opts                []option.ClientOption
+	URL                 string
+	Version             string
+	AuthOverride        map[string]interface{}
+	MaxResponseBodySize int64
+	MaxRetries          int
+	RequestTimeout      time.Duration
+	Headers             http.Header
+	UserAgentSuffix     string
+	Transport           http.RoundTripper
+	Instrumentation     Instrumentation
+	RequestGuard        func() error
+}
+
+// ProjectManagementConfig represents the configuration of Firebase project management service.
+type ProjectManagementConfig struct {
+	Opts                []option.ClientOption
+	ProjectID           string
+	Version             string
+	MaxResponseBodySize int64
+	MaxRetries          int
+	RequestTimeout      time.Duration
+	Headers             http.Header
+	UserAgentSuffix     string
+	Transport           http.RoundTripper
+	Instrumentation     Instrumentation
+	RequestGuard        func() error
+}
+
+// RemoteConfigConfig represents the configuration of Firebase Remote Config service.
+type RemoteConfigConfig struct {
+	Opts                []option.ClientOption
+	ProjectID           string
+	Version             string
+	MaxResponseBodySize int64
+	MaxRetries          int
+	RequestTimeout      time.Duration
+	Headers             http.Header
+	UserAgentSuffix     string
+	Transport           http.RoundTripper
+	Instrumentation     Instrumentation
+	RequestGuard        func() error
 }
 
 // StorageConfig represents the configuration of Google Cloud Storage service.
@@ -63,9 +216,31 @@ type StorageConfig struct {
 
 // MessagingConfig represents the configuration of Firebase Cloud Messaging service.
 type MessagingConfig struct {
-	Opts      []option.ClientOption
-	ProjectID string
-	Version   string
+	Opts                []option.ClientOption
+	ProjectID           string
+	Version             string
+	MaxResponseBodySize int64
+	MaxRetries          int
+	RequestTimeout      time.Duration
+	Headers             http.Header
+	UserAgentSuffix     string
+	Transport           http.RoundTripper
+	Instrumentation     Instrumentation
+	RequestGuard        func() error
+}
+
+// HashConfig represents the configuration of a password hash algorithm used when importing
+// users into Firebase Auth.
+type HashConfig struct {
+	HashAlgorithm    string
+	SignerKey        []byte
+	SaltSeparator    []byte
+	Rounds           int64
+	MemoryCost       int64
+	CPUMemCost       int64
+	BlockSize        int64
+	Parallelization  int64
+	DerivedKeyLength int64
 }
 
 // FirebaseError is an error type containing an error code string.
@@ -79,9 +254,115 @@ func (fe *FirebaseError) Error() string {
 }
 
 // HasErrorCode checks if the given error contain a specific error code.
+//
+// HasErrorCode looks through any errors wrapped by err (see OpError), and reports whether the
+// first FirebaseError found in the chain has the specified code. If err is an AggregateError,
+// HasErrorCode reports whether any of the aggregated errors has the specified code.
 func HasErrorCode(err error, code string) bool {
-	fe, ok := err.(*FirebaseError)
-	return ok && fe.Code == code
+	for err != nil {
+		if fe, ok := err.(*FirebaseError); ok {
+			return fe.Code == code
+		}
+		if mw, ok := err.(multiWrapper); ok {
+			for _, e := range mw.Unwrap() {
+				if HasErrorCode(e, code) {
+					return true
+				}
+			}
+			return false
+		}
+		w, ok := err.(wrapper)
+		if !ok {
+			return false
+		}
+		err = w.Unwrap()
+	}
+	return false
+}
+
+// wrapper is implemented by errors that wrap another error.
+type wrapper interface {
+	Unwrap() error
+}
+
+// multiWrapper is implemented by errors that wrap several other errors.
+type multiWrapper interface {
+	Unwrap() []error
+}
+
+// AggregateError combines the errors of the individual items of a batch operation into one.
+//
+// The combined errors are accessible via the Unwrap() method, which makes AggregateError
+// compatible with errors.Is() and errors.As() in Go 1.20 and higher.
+type AggregateError struct {
+	Errors []error
+}
+
+// NewAggregateError returns an AggregateError combining the non-nil errors in errs, or nil if
+// there are no such errors.
+func NewAggregateError(errs []error) error {
+	var nonNil []error
+	for _, err := range errs {
+		if err != nil {
+			nonNil = append(nonNil, err)
+		}
+	}
+	if len(nonNil) == 0 {
+		return nil
+	}
+	return &AggregateError{Errors: nonNil}
+}
+
+func (e *AggregateError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors occurred: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the combined errors.
+func (e *AggregateError) Unwrap() []error {
+	return e.Errors
+}
+
+// OpError is an error returned by a public operation of the SDK.
+//
+// OpError records the name of the failed operation, and optionally the identifier of the resource
+// involved in it (e.g. a user ID or a database path), while preserving the underlying error. The
+// underlying error is accessible via the Unwrap() method, which makes OpError compatible with
+// errors.Is() and errors.As() in Go 1.13 and higher.
+type OpError struct {
+	Op  string
+	Arg string
+	Err error
+}
+
+func (e *OpError) Error() string {
+	if e.Arg == "" {
+		return fmt.Sprintf("%s: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("%s(%q): %v", e.Op, e.Arg, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// WrapOpError wraps the error pointed to by err in an OpError with the given operation name and
+// argument. It does nothing if err points to a nil error.
+//
+// WrapOpError is meant to be deferred by public functions that have a named error result:
+//
+//	defer internal.WrapOpError(&err, "GetUser", uid)
+func WrapOpError(err *error, op, arg string) {
+	if *err != nil {
+		*err = &OpError{Op: op, Arg: arg, Err: *err}
+	}
 }
 
 // Error creates a new FirebaseError from the specified error code and message.
@@ -0,0 +1,156 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOpError(t *testing.T) {
+	cause := errors.New("test error")
+	cases := []struct {
+		err  *OpError
+		want string
+	}{
+		{&OpError{Op: "GetUser", Arg: "uid1", Err: cause}, `GetUser("uid1"): test error`},
+		{&OpError{Op: "VerifyIDToken", Err: cause}, "VerifyIDToken: test error"},
+	}
+	for _, tc := range cases {
+		if tc.err.Error() != tc.want {
+			t.Errorf("Error() = %q; want = %q", tc.err.Error(), tc.want)
+		}
+		if tc.err.Unwrap() != cause {
+			t.Errorf("Unwrap() = %v; want = %v", tc.err.Unwrap(), cause)
+		}
+	}
+}
+
+func TestWrapOpError(t *testing.T) {
+	cause := errors.New("test error")
+	err := cause
+	WrapOpError(&err, "Delete", "/path")
+	oe, ok := err.(*OpError)
+	if !ok {
+		t.Fatalf("WrapOpError() = %T; want = *OpError", err)
+	}
+	if oe.Op != "Delete" || oe.Arg != "/path" || oe.Err != cause {
+		t.Errorf("WrapOpError() = %#v; want = {Delete, /path, %v}", oe, cause)
+	}
+
+	var nilErr error
+	WrapOpError(&nilErr, "Delete", "/path")
+	if nilErr != nil {
+		t.Errorf("WrapOpError(nil) = %v; want = nil", nilErr)
+	}
+}
+
+func TestHasErrorCode(t *testing.T) {
+	fe := Error("test-code", "test error")
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"FirebaseError", fe, true},
+		{"WrappedFirebaseError", &OpError{Op: "Op", Err: fe}, true},
+		{"DoublyWrappedFirebaseError", &OpError{Op: "Outer", Err: &OpError{Op: "Inner", Err: fe}}, true},
+		{"OtherCode", Error("other-code", "test error"), false},
+		{"WrappedOtherError", &OpError{Op: "Op", Err: errors.New("test error")}, false},
+		{"OtherError", errors.New("test error"), false},
+		{"AggregateError", &AggregateError{Errors: []error{errors.New("test error"), fe}}, true},
+		{"WrappedAggregateError", &OpError{Op: "Op", Err: &AggregateError{Errors: []error{
+			&OpError{Op: "Inner", Err: fe}}}}, true},
+		{"AggregateOtherErrors", &AggregateError{Errors: []error{
+			errors.New("test error"), Error("other-code", "test error")}}, false},
+		{"Nil", nil, false},
+	}
+	for _, tc := range cases {
+		if got := HasErrorCode(tc.err, "test-code"); got != tc.want {
+			t.Errorf("HasErrorCode(%s) = %v; want = %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAggregateError(t *testing.T) {
+	if err := NewAggregateError(nil); err != nil {
+		t.Errorf("NewAggregateError(nil) = %v; want = nil", err)
+	}
+	if err := NewAggregateError([]error{nil, nil}); err != nil {
+		t.Errorf("NewAggregateError(nils) = %v; want = nil", err)
+	}
+
+	e1 := errors.New("error 1")
+	e2 := errors.New("error 2")
+	cases := []struct {
+		errs []error
+		want string
+	}{
+		{[]error{nil, e1}, "error 1"},
+		{[]error{e1, nil, e2}, "2 errors occurred: error 1; error 2"},
+	}
+	for _, tc := range cases {
+		err := NewAggregateError(tc.errs)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("NewAggregateError(%v) = %v; want = %q", tc.errs, err, tc.want)
+			continue
+		}
+		got := err.(*AggregateError).Unwrap()
+		if len(got) != len(tc.errs)-1 || got[len(got)-1] != tc.errs[len(tc.errs)-1] {
+			t.Errorf("Unwrap() = %v; want non-nil errors of %v", got, tc.errs)
+		}
+	}
+}
+
+func TestServiceScopes(t *testing.T) {
+	const (
+		cloudPlatform = "https://www.googleapis.com/auth/cloud-platform"
+		firebase      = "https://www.googleapis.com/auth/firebase"
+	)
+	cases := []struct {
+		name   string
+		scopes []string
+		want   []string
+	}{
+		{"AppCheck", AppCheckScopes, []string{firebase}},
+		{"Auth", AuthScopes, []string{firebase, "https://www.googleapis.com/auth/identitytoolkit"}},
+		{"Database", DatabaseScopes, []string{
+			"https://www.googleapis.com/auth/firebase.database",
+			"https://www.googleapis.com/auth/userinfo.email",
+		}},
+		{"DynamicLinks", DynamicLinksScopes, []string{firebase}},
+		{"Firestore", FirestoreScopes, []string{"https://www.googleapis.com/auth/datastore"}},
+		{"IAM", IAMScopes, []string{cloudPlatform}},
+		{"InstanceID", InstanceIDScopes, []string{firebase}},
+		{"Messaging", MessagingScopes, []string{"https://www.googleapis.com/auth/firebase.messaging"}},
+		{"ProjectManagement", ProjectManagementScopes, []string{firebase}},
+		{"RemoteConfig", RemoteConfigScopes, []string{"https://www.googleapis.com/auth/firebase.remoteconfig"}},
+		{"Storage", StorageScopes, []string{"https://www.googleapis.com/auth/devstorage.full_control"}},
+	}
+	for _, tc := range cases {
+		got := make(map[string]bool)
+		for _, s := range tc.scopes {
+			got[s] = true
+		}
+		for _, s := range tc.want {
+			if !got[s] {
+				t.Errorf("%sScopes = %v; want to contain %q", tc.name, tc.scopes, s)
+			}
+		}
+		if len(tc.scopes) != len(tc.want) {
+			t.Errorf("%sScopes = %v; want = %v", tc.name, tc.scopes, tc.want)
+		}
+	}
+}
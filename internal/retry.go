@@ -0,0 +1,130 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// DefaultRetryMinDelay is the delay before the first retry of a failed request.
+	DefaultRetryMinDelay = 500 * time.Millisecond
+
+	// DefaultRetryMaxDelay is the upper limit on the delay between two attempts of a request.
+	DefaultRetryMaxDelay = 30 * time.Second
+)
+
+// RetryConfig specifies how HTTPClient retries requests that fail with transient errors.
+//
+// A request is retried when it fails with a network error, or when the server responds with a
+// status for which IsRetryableStatus returns true. Retries are delayed with exponential backoff,
+// starting at MinDelay and doubling after each retry up to MaxDelay, with random jitter applied
+// to each delay. If the server responds with a Retry-After header, the delay it specifies is used
+// instead. A request that the server asks to delay for longer than MaxDelay is not retried.
+type RetryConfig struct {
+	MaxRetries int
+	MinDelay   time.Duration
+	MaxDelay   time.Duration
+}
+
+// NewRetryConfig creates a RetryConfig that retries a request up to maxRetries times with the
+// default delays. Returns nil, which disables retries, if maxRetries is not positive.
+func NewRetryConfig(maxRetries int) *RetryConfig {
+	if maxRetries <= 0 {
+		return nil
+	}
+	return &RetryConfig{
+		MaxRetries: maxRetries,
+		MinDelay:   DefaultRetryMinDelay,
+		MaxDelay:   DefaultRetryMaxDelay,
+	}
+}
+
+// IsRetryableStatus checks if an HTTP response with the given status code indicates a transient
+// failure, after which the request may be retried.
+func IsRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// delay returns how long to wait before retrying a request that has already been retried the
+// given number of times. The returned bool is false if the request should not be retried.
+func (rc *RetryConfig) delay(retries int, header http.Header) (time.Duration, bool) {
+	if rc == nil || retries >= rc.MaxRetries {
+		return 0, false
+	}
+	if d, ok := retryAfter(header, time.Now()); ok {
+		return d, d <= rc.MaxDelay
+	}
+
+	d := rc.MinDelay
+	for i := 0; i < retries && d < rc.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > rc.MaxDelay {
+		d = rc.MaxDelay
+	}
+	if d <= 0 {
+		return 0, true
+	}
+	// Pick a random delay in [d/2, d] so that concurrent clients do not retry in lockstep.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1)), true
+}
+
+// retryAfter parses the Retry-After header, which specifies either a number of seconds or an
+// HTTP date after which the request may be retried.
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// sleep waits for the given duration, and returns false if the context is done before that. It
+// returns false immediately if the context deadline is sooner than d.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(d).After(deadline) {
+		return false
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,404 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+var testRetryConfig = &RetryConfig{
+	MaxRetries: 2,
+	MinDelay:   time.Millisecond,
+	MaxDelay:   10 * time.Millisecond,
+}
+
+func TestRetryOnTransientStatus(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusServiceUnavailable} {
+		var bodies []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, string(b))
+			if len(bodies) < 3 {
+				w.WriteHeader(status)
+			}
+			w.Write([]byte("{}"))
+		}))
+		client := &HTTPClient{Client: http.DefaultClient, RetryConfig: testRetryConfig}
+		resp, err := client.Do(context.Background(), &Request{
+			Method:     http.MethodPost,
+			URL:        server.URL,
+			Body:       NewJSONEntity(map[string]string{"foo": "bar"}),
+			Idempotent: true,
+		})
+		server.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Status != http.StatusOK {
+			t.Errorf("[%d] Status = %d; want = %d", status, resp.Status, http.StatusOK)
+		}
+		if len(bodies) != 3 {
+			t.Fatalf("[%d] Attempts = %d; want = 3", status, len(bodies))
+		}
+		for i, b := range bodies {
+			if b != `{"foo":"bar"}` {
+				t.Errorf("[%d] Body[%d] = %q; want = %q", status, i, b, `{"foo":"bar"}`)
+			}
+		}
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("unavailable"))
+	}))
+	defer server.Close()
+
+	client := &HTTPClient{Client: http.DefaultClient, RetryConfig: testRetryConfig}
+	resp, err := client.Do(context.Background(), &Request{Method: http.MethodGet, URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusServiceUnavailable || string(resp.Body) != "unavailable" {
+		t.Errorf("Response = (%d, %q); want = (%d, %q)",
+			resp.Status, string(resp.Body), http.StatusServiceUnavailable, "unavailable")
+	}
+	if attempts != 3 {
+		t.Errorf("Attempts = %d; want = 3", attempts)
+	}
+}
+
+func TestNoRetry(t *testing.T) {
+	cases := []struct {
+		status int
+		rc     *RetryConfig
+	}{
+		{http.StatusServiceUnavailable, nil},
+		{http.StatusBadRequest, testRetryConfig},
+		{http.StatusNotFound, testRetryConfig},
+	}
+	for _, tc := range cases {
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.WriteHeader(tc.status)
+		}))
+		client := &HTTPClient{Client: http.DefaultClient, RetryConfig: tc.rc}
+		resp, err := client.Do(context.Background(), &Request{Method: http.MethodGet, URL: server.URL})
+		server.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Status != tc.status || attempts != 1 {
+			t.Errorf("Do() = (%d, %d attempts); want = (%d, 1 attempt)", resp.Status, attempts, tc.status)
+		}
+	}
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	cases := []struct {
+		method   string
+		status   int
+		attempts int
+	}{
+		{http.MethodPost, http.StatusServiceUnavailable, 1},
+		{http.MethodPost, http.StatusInternalServerError, 1},
+		{http.MethodPatch, http.StatusServiceUnavailable, 1},
+		{http.MethodPost, http.StatusTooManyRequests, 3},
+		{http.MethodPut, http.StatusServiceUnavailable, 3},
+		{http.MethodDelete, http.StatusServiceUnavailable, 3},
+	}
+	for _, tc := range cases {
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.WriteHeader(tc.status)
+		}))
+		client := &HTTPClient{Client: http.DefaultClient, RetryConfig: testRetryConfig}
+		resp, err := client.Do(context.Background(), &Request{Method: tc.method, URL: server.URL})
+		server.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Status != tc.status || attempts != tc.attempts {
+			t.Errorf("Do(%s, %d) = (%d, %d attempts); want = (%d, %d attempts)",
+				tc.method, tc.status, resp.Status, attempts, tc.status, tc.attempts)
+		}
+	}
+}
+
+func TestNoRetryOnNetworkErrorForPost(t *testing.T) {
+	attempts := 0
+	client := &HTTPClient{
+		Client: &http.Client{Transport: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+			attempts++
+			return nil, errors.New("connection reset")
+		})},
+		RetryConfig: testRetryConfig,
+	}
+	resp, err := client.Do(context.Background(), &Request{Method: http.MethodPost, URL: "https://example.com"})
+	if resp != nil || err == nil {
+		t.Errorf("Do() = (%v, %v); want = (nil, error)", resp, err)
+	}
+	if attempts != 1 {
+		t.Errorf("Attempts = %d; want = 1", attempts)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRetryOnNetworkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	client := &HTTPClient{Client: http.DefaultClient, RetryConfig: testRetryConfig}
+	start := time.Now()
+	resp, err := client.Do(context.Background(), &Request{Method: http.MethodGet, URL: url})
+	if resp != nil || err == nil {
+		t.Errorf("Do() = (%v, %v); want = (nil, error)", resp, err)
+	}
+	// Two retries with delays of at least 0.5ms and 1ms.
+	if elapsed := time.Since(start); elapsed < time.Millisecond {
+		t.Errorf("Do() returned after %v; want >= %v", elapsed, time.Millisecond)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	client := &HTTPClient{Client: http.DefaultClient, RetryConfig: testRetryConfig}
+	resp, err := client.Do(context.Background(), &Request{Method: http.MethodGet, URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusOK || attempts != 2 {
+		t.Errorf("Do() = (%d, %d attempts); want = (%d, 2 attempts)", resp.Status, attempts, http.StatusOK)
+	}
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := &HTTPClient{Client: http.DefaultClient, RetryConfig: testRetryConfig}
+	resp, err := client.Do(context.Background(), &Request{Method: http.MethodGet, URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusServiceUnavailable || attempts != 1 {
+		t.Errorf("Do() = (%d, %d attempts); want = (%d, 1 attempt)",
+			resp.Status, attempts, http.StatusServiceUnavailable)
+	}
+}
+
+func TestRetryOnValidationError(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Content-Type", "text/html")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	validate := func(resp *http.Response) error {
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			return errors.New("unexpected content type: " + ct)
+		}
+		return nil
+	}
+	client := &HTTPClient{Client: http.DefaultClient, RetryConfig: testRetryConfig}
+	resp, err := client.Do(context.Background(), &Request{
+		Method:   http.MethodGet,
+		URL:      server.URL,
+		Validate: validate,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusOK || attempts != 2 {
+		t.Errorf("Do() = (%d, %d attempts); want = (%d, 2 attempts)", resp.Status, attempts, http.StatusOK)
+	}
+
+	// Validation errors of non-idempotent requests are not retried.
+	attempts = 0
+	resp, err = client.Do(context.Background(), &Request{
+		Method:   http.MethodPost,
+		URL:      server.URL,
+		Validate: validate,
+	})
+	if resp != nil || err == nil || attempts != 1 {
+		t.Errorf("Do() = (%v, %v) after %d attempts; want = (nil, error) after 1 attempt", resp, err, attempts)
+	}
+}
+
+func TestRetryDeadline(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	rc := &RetryConfig{MaxRetries: 5, MinDelay: time.Hour, MaxDelay: time.Hour}
+	client := &HTTPClient{Client: http.DefaultClient, RetryConfig: rc}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Does not wait for a retry that would start past the deadline of the context.
+	start := time.Now()
+	resp, err := client.Do(ctx, &Request{Method: http.MethodGet, URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusServiceUnavailable || attempts != 1 {
+		t.Errorf("Do() = (%d, %d attempts); want = (%d, 1 attempt)",
+			resp.Status, attempts, http.StatusServiceUnavailable)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Do() returned after %v; want < 10s", elapsed)
+	}
+}
+
+func TestRetryContextDone(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	rc := &RetryConfig{MaxRetries: 5, MinDelay: time.Hour, MaxDelay: time.Hour}
+	client := &HTTPClient{Client: http.DefaultClient, RetryConfig: rc}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	resp, err := client.Do(ctx, &Request{Method: http.MethodGet, URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusServiceUnavailable || attempts != 1 {
+		t.Errorf("Do() = (%d, %d attempts); want = (%d, 1 attempt)",
+			resp.Status, attempts, http.StatusServiceUnavailable)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client := &HTTPClient{Client: http.DefaultClient, Timeout: 10 * time.Millisecond}
+	resp, err := client.Do(context.Background(), &Request{Method: http.MethodGet, URL: server.URL})
+	if resp != nil || err == nil {
+		t.Errorf("Do() = (%v, %v); want = (nil, error)", resp, err)
+	}
+}
+
+func TestRetryConfigDelay(t *testing.T) {
+	rc := &RetryConfig{MaxRetries: 10, MinDelay: time.Second, MaxDelay: 5 * time.Second}
+	cases := []struct {
+		retries  int
+		min, max time.Duration
+	}{
+		{0, 500 * time.Millisecond, time.Second},
+		{1, time.Second, 2 * time.Second},
+		{2, 2 * time.Second, 4 * time.Second},
+		{3, 2500 * time.Millisecond, 5 * time.Second},
+		{9, 2500 * time.Millisecond, 5 * time.Second},
+	}
+	for _, tc := range cases {
+		d, ok := rc.delay(tc.retries, nil)
+		if !ok || d < tc.min || d > tc.max {
+			t.Errorf("delay(%d) = (%v, %v); want = ([%v, %v], true)", tc.retries, d, ok, tc.min, tc.max)
+		}
+	}
+	if d, ok := rc.delay(10, nil); ok {
+		t.Errorf("delay(10) = (%v, %v); want = (_, false)", d, ok)
+	}
+
+	var nilConfig *RetryConfig
+	if d, ok := nilConfig.delay(0, nil); ok {
+		t.Errorf("delay(nil) = (%v, %v); want = (_, false)", d, ok)
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	now := time.Date(2018, 4, 20, 9, 0, 0, 0, time.UTC)
+	cases := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"-1", 0, false},
+		{"not a time", 0, false},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+	}
+	for _, tc := range cases {
+		header := http.Header{}
+		if tc.value != "" {
+			header.Set("Retry-After", tc.value)
+		}
+		d, ok := retryAfter(header, now)
+		if d != tc.want || ok != tc.ok {
+			t.Errorf("retryAfter(%q) = (%v, %v); want = (%v, %v)", tc.value, d, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestNewRetryConfig(t *testing.T) {
+	if rc := NewRetryConfig(0); rc != nil {
+		t.Errorf("NewRetryConfig(0) = %v; want = nil", rc)
+	}
+	rc := NewRetryConfig(3)
+	if rc == nil || rc.MaxRetries != 3 || rc.MinDelay != DefaultRetryMinDelay || rc.MaxDelay != DefaultRetryMaxDelay {
+		t.Errorf("NewRetryConfig(3) = %v; want = {3, %v, %v}", rc, DefaultRetryMinDelay, DefaultRetryMaxDelay)
+	}
+}
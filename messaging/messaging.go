@@ -27,8 +27,6 @@ import (
 
 	"firebase.google.com/go/internal"
 	"golang.org/x/net/context"
-
-	"google.golang.org/api/transport"
 )
 
 const (
@@ -123,19 +121,20 @@ var (
 
 // Client is the interface for the Firebase Cloud Messaging (FCM) service.
 type Client struct {
-	fcmEndpoint string // to enable testing against arbitrary endpoints
-	iidEndpoint string // to enable testing against arbitrary endpoints
-	client      *internal.HTTPClient
-	project     string
-	version     string
+	fcmEndpoint   string // to enable testing against arbitrary endpoints
+	batchEndpoint string // to enable testing against arbitrary endpoints
+	iidEndpoint   string // to enable testing against arbitrary endpoints
+	client        *internal.HTTPClient
+	project       string
+	version       string
 }
 
 // Message to be sent via Firebase Cloud Messaging.
 //
 // Message contains payload data, recipient information and platform-specific configuration
-// options. A Message must specify exactly one of Token, Topic or Condition fields. Apart from
-// that a Message may specify any combination of Data, Notification, Android, Webpush and APNS
-// fields. See https://firebase.google.com/docs/reference/fcm/rest/v1/projects.messages for more
+// options. A Message must specify exactly one of Token, Topic, Condition or DeviceGroup fields.
+// Apart from that a Message may specify any combination of Data, Notification, Android, Webpush and
+// APNS fields. See https://firebase.google.com/docs/reference/fcm/rest/v1/projects.messages for more
 // details on how the backend FCM servers handle different message parameters.
 type Message struct {
 	Data         map[string]string `json:"data,omitempty"`
@@ -146,17 +145,29 @@ type Message struct {
 	Token        string            `json:"token,omitempty"`
 	Topic        string            `json:"-"`
 	Condition    string            `json:"condition,omitempty"`
+
+	// DeviceGroup is the notification key of a device group. FCM delivers the message to all the
+	// devices in the group. Note that FCM does not report the delivery status of the individual
+	// devices in the group when sending via the v1 API.
+	DeviceGroup string `json:"-"`
 }
 
 // MarshalJSON marshals a Message into JSON (for internal use only).
 func (m *Message) MarshalJSON() ([]byte, error) {
 	// Create a new type to prevent infinite recursion.
 	type messageInternal Message
+	// The FCM v1 API accepts device group notification keys in the token field.
+	token := m.Token
+	if m.DeviceGroup != "" {
+		token = m.DeviceGroup
+	}
 	s := &struct {
 		BareTopic string `json:"topic,omitempty"`
+		Token     string `json:"token,omitempty"`
 		*messageInternal
 	}{
 		BareTopic:       strings.TrimPrefix(m.Topic, "/topics/"),
+		Token:           token,
 		messageInternal: (*messageInternal)(m),
 	}
 	return json.Marshal(s)
@@ -383,17 +394,26 @@ func NewClient(ctx context.Context, c *internal.MessagingConfig) (*Client, error
 		return nil, errors.New("project ID is required to access Firebase Cloud Messaging client")
 	}
 
-	hc, _, err := transport.NewHTTPClient(ctx, c.Opts...)
+	hc, err := internal.NewHTTPClient(ctx, c.Transport, c.Opts...)
 	if err != nil {
 		return nil, err
 	}
+	hc = internal.WithHeaders(hc, c.Headers, c.UserAgentSuffix)
+	hc = internal.Instrument(hc, c.Instrumentation, "messaging")
+	hc = internal.WithGuard(hc, c.RequestGuard)
 
 	return &Client{
-		fcmEndpoint: messagingEndpoint,
-		iidEndpoint: iidEndpoint,
-		client:      &internal.HTTPClient{Client: hc},
-		project:     c.ProjectID,
-		version:     "Go/Admin/" + c.Version,
+		fcmEndpoint:   messagingEndpoint,
+		batchEndpoint: batchEndpoint,
+		iidEndpoint:   iidEndpoint,
+		client: &internal.HTTPClient{
+			Client:      hc,
+			MaxBodySize: c.MaxResponseBodySize,
+			RetryConfig: internal.NewRetryConfig(c.MaxRetries),
+			Timeout:     c.RequestTimeout,
+		},
+		project: c.ProjectID,
+		version: "Go/Admin/" + c.Version,
 	}, nil
 }
 
@@ -402,7 +422,8 @@ func NewClient(ctx context.Context, c *internal.MessagingConfig) (*Client, error
 // The Message must specify exactly one of Token, Topic and Condition fields. FCM will
 // customize the message for each target platform based on the arguments specified in the
 // Message.
-func (c *Client) Send(ctx context.Context, message *Message) (string, error) {
+func (c *Client) Send(ctx context.Context, message *Message) (name string, err error) {
+	defer internal.WrapOpError(&err, "Send", "")
 	payload := &fcmRequest{
 		Message: message,
 	}
@@ -413,7 +434,8 @@ func (c *Client) Send(ctx context.Context, message *Message) (string, error) {
 //
 // This function does not actually deliver the message to target devices. Instead, it performs all
 // the SDK-level and backend validations on the message, and emulates the send operation.
-func (c *Client) SendDryRun(ctx context.Context, message *Message) (string, error) {
+func (c *Client) SendDryRun(ctx context.Context, message *Message) (name string, err error) {
+	defer internal.WrapOpError(&err, "SendDryRun", "")
 	payload := &fcmRequest{
 		ValidateOnly: true,
 		Message:      message,
@@ -424,7 +446,10 @@ func (c *Client) SendDryRun(ctx context.Context, message *Message) (string, erro
 // SubscribeToTopic subscribes a list of registration tokens to a topic.
 //
 // The tokens list must not be empty, and have at most 1000 tokens.
-func (c *Client) SubscribeToTopic(ctx context.Context, tokens []string, topic string) (*TopicManagementResponse, error) {
+func (c *Client) SubscribeToTopic(
+	ctx context.Context, tokens []string, topic string) (resp *TopicManagementResponse, err error) {
+
+	defer internal.WrapOpError(&err, "SubscribeToTopic", topic)
 	req := &iidRequest{
 		Topic:  topic,
 		Tokens: tokens,
@@ -436,7 +461,10 @@ func (c *Client) SubscribeToTopic(ctx context.Context, tokens []string, topic st
 // UnsubscribeFromTopic unsubscribes a list of registration tokens from a topic.
 //
 // The tokens list must not be empty, and have at most 1000 tokens.
-func (c *Client) UnsubscribeFromTopic(ctx context.Context, tokens []string, topic string) (*TopicManagementResponse, error) {
+func (c *Client) UnsubscribeFromTopic(
+	ctx context.Context, tokens []string, topic string) (resp *TopicManagementResponse, err error) {
+
+	defer internal.WrapOpError(&err, "UnsubscribeFromTopic", topic)
 	req := &iidRequest{
 		Topic:  topic,
 		Tokens: tokens,
@@ -549,7 +577,12 @@ func (c *Client) makeSendRequest(ctx context.Context, req *fcmRequest) (string,
 		err := json.Unmarshal(resp.Body, &result)
 		return result.Name, err
 	}
+	return "", handleFCMError(resp)
+}
 
+// handleFCMError converts an error response from the FCM v1 API into an error with one of the
+// client error codes.
+func handleFCMError(resp *internal.Response) error {
 	var fe fcmError
 	json.Unmarshal(resp.Body, &fe) // ignore any json parse errors at this level
 	var serverCode string
@@ -574,7 +607,7 @@ func (c *Client) makeSendRequest(ctx context.Context, req *fcmRequest) (string,
 	if fe.Error.Message != "" {
 		msg += "; details: " + fe.Error.Message
 	}
-	return "", internal.Errorf(clientCode, "http error status: %d; reason: %s", resp.Status, msg)
+	return internal.Errorf(clientCode, "http error status: %d; reason: %s", resp.Status, msg)
 }
 
 func (c *Client) makeTopicManagementRequest(ctx context.Context, req *iidRequest) (*TopicManagementResponse, error) {
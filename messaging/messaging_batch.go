@@ -0,0 +1,299 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package messaging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+
+	"firebase.google.com/go/internal"
+	"golang.org/x/net/context"
+)
+
+const (
+	batchEndpoint     = "https://fcm.googleapis.com/batch"
+	maxMessages       = 500
+	multipartBoundary = "__END_OF_PART__"
+)
+
+// MulticastMessage represents a message that can be sent to multiple devices via Firebase Cloud
+// Messaging (FCM).
+//
+// It contains payload information as well as the list of device registration tokens to which the
+// message should be sent. A single MulticastMessage may contain up to 500 registration tokens.
+type MulticastMessage struct {
+	Tokens       []string
+	Data         map[string]string
+	Notification *Notification
+	Android      *AndroidConfig
+	Webpush      *WebpushConfig
+	APNS         *APNSConfig
+}
+
+func (mm *MulticastMessage) toMessages() ([]*Message, error) {
+	if len(mm.Tokens) == 0 {
+		return nil, errors.New("tokens must not be nil or empty")
+	}
+	if len(mm.Tokens) > maxMessages {
+		return nil, fmt.Errorf("tokens must not contain more than %d elements", maxMessages)
+	}
+
+	var messages []*Message
+	for _, token := range mm.Tokens {
+		messages = append(messages, &Message{
+			Token:        token,
+			Data:         mm.Data,
+			Notification: mm.Notification,
+			Android:      mm.Android,
+			Webpush:      mm.Webpush,
+			APNS:         mm.APNS,
+		})
+	}
+	return messages, nil
+}
+
+// SendResponse represents the status of an individual message that was sent as part of a batch
+// request.
+type SendResponse struct {
+	Success   bool
+	MessageID string
+	Error     error
+}
+
+// BatchResponse represents the response from the SendAll() and SendMulticast() APIs.
+//
+// The Responses are in the same order as the messages passed to SendAll(), or the tokens of the
+// MulticastMessage passed to SendMulticast().
+type BatchResponse struct {
+	SuccessCount int
+	FailureCount int
+	Responses    []*SendResponse
+}
+
+// SendAll sends the messages in the given array via Firebase Cloud Messaging.
+//
+// The messages array may contain up to 500 messages. SendAll employs batching to send the entire
+// array of messages as a single RPC call. Compared to the Send() function, this is a significantly
+// more efficient way to send multiple messages. The responses list obtained from the return value
+// corresponds to the order of the input messages. An error from SendAll indicates a total failure
+// -- i.e. none of the messages in the array could be sent. Partial failures are indicated by a
+// BatchResponse return value.
+func (c *Client) SendAll(ctx context.Context, messages []*Message) (br *BatchResponse, err error) {
+	defer internal.WrapOpError(&err, "SendAll", "")
+	return c.sendBatch(ctx, messages, false)
+}
+
+// SendAllDryRun sends the messages in the given array via Firebase Cloud Messaging in the
+// dry run (validation only) mode.
+//
+// This function does not actually deliver any messages to target devices. Instead, it performs all
+// the SDK-level and backend validations on the messages, and emulates the send operation.
+func (c *Client) SendAllDryRun(ctx context.Context, messages []*Message) (br *BatchResponse, err error) {
+	defer internal.WrapOpError(&err, "SendAllDryRun", "")
+	return c.sendBatch(ctx, messages, true)
+}
+
+// SendMulticast sends the given multicast message to all the FCM registration tokens specified.
+//
+// The tokens array in MulticastMessage may contain up to 500 tokens. SendMulticast uses the
+// SendAll() function to send the given message to all the target recipients. The responses list
+// obtained from the return value corresponds to the order of the input tokens. An error from
+// SendMulticast indicates a total failure -- i.e. the message could not be sent to any of the
+// recipients. Partial failures are indicated by a BatchResponse return value.
+func (c *Client) SendMulticast(ctx context.Context, message *MulticastMessage) (br *BatchResponse, err error) {
+	defer internal.WrapOpError(&err, "SendMulticast", "")
+	messages, err := toMessages(message)
+	if err != nil {
+		return nil, err
+	}
+	return c.sendBatch(ctx, messages, false)
+}
+
+// SendMulticastDryRun sends the given multicast message to all the specified FCM registration
+// tokens in the dry run (validation only) mode.
+//
+// This function does not actually deliver any messages to target devices. Instead, it performs all
+// the SDK-level and backend validations on the messages, and emulates the send operation.
+func (c *Client) SendMulticastDryRun(
+	ctx context.Context, message *MulticastMessage) (br *BatchResponse, err error) {
+
+	defer internal.WrapOpError(&err, "SendMulticastDryRun", "")
+	messages, err := toMessages(message)
+	if err != nil {
+		return nil, err
+	}
+	return c.sendBatch(ctx, messages, true)
+}
+
+func toMessages(message *MulticastMessage) ([]*Message, error) {
+	if message == nil {
+		return nil, errors.New("message must not be nil")
+	}
+	return message.toMessages()
+}
+
+func (c *Client) sendBatch(ctx context.Context, messages []*Message, dryRun bool) (*BatchResponse, error) {
+	if len(messages) == 0 {
+		return nil, errors.New("messages must not be nil or empty")
+	}
+	if len(messages) > maxMessages {
+		return nil, fmt.Errorf("messages must not contain more than %d elements", maxMessages)
+	}
+
+	var parts []*fcmRequest
+	for idx, m := range messages {
+		if err := validateMessage(m); err != nil {
+			return nil, fmt.Errorf("invalid message at index %d: %v", idx, err)
+		}
+		parts = append(parts, &fcmRequest{
+			ValidateOnly: dryRun,
+			Message:      m,
+		})
+	}
+
+	request := &internal.Request{
+		Method: http.MethodPost,
+		URL:    c.batchEndpoint,
+		Body: &multipartEntity{
+			url:   fmt.Sprintf("%s/projects/%s/messages:send", c.fcmEndpoint, c.project),
+			parts: parts,
+		},
+	}
+	resp, err := c.client.Do(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != http.StatusOK {
+		return nil, handleFCMError(resp)
+	}
+	return newBatchResponse(resp, len(messages))
+}
+
+// multipartEntity is an HTTPEntity that serializes a list of send requests into a multipart/mixed
+// batch request, where each part is a complete HTTP request.
+type multipartEntity struct {
+	url   string
+	parts []*fcmRequest
+}
+
+func (e *multipartEntity) Mime() string {
+	return fmt.Sprintf("multipart/mixed; boundary=%s", multipartBoundary)
+}
+
+func (e *multipartEntity) Bytes() ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := multipart.NewWriter(&buffer)
+	writer.SetBoundary(multipartBoundary)
+	for idx, part := range e.parts {
+		if err := e.writePart(writer, part, idx); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (e *multipartEntity) writePart(writer *multipart.Writer, part *fcmRequest, idx int) error {
+	b, err := json.Marshal(part)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", "application/http")
+	header.Set("Content-Transfer-Encoding", "binary")
+	header.Set("Content-ID", fmt.Sprintf("%d", idx+1))
+	w, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	return req.Write(w)
+}
+
+func newBatchResponse(resp *internal.Response, count int) (*BatchResponse, error) {
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing content-type header: %v", err)
+	}
+
+	br := &BatchResponse{}
+	reader := multipart.NewReader(bytes.NewBuffer(resp.Body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		sr, err := newSendResponse(part)
+		if err != nil {
+			return nil, err
+		}
+		if sr.Success {
+			br.SuccessCount++
+		} else {
+			br.FailureCount++
+		}
+		br.Responses = append(br.Responses, sr)
+	}
+	if len(br.Responses) != count {
+		return nil, fmt.Errorf("expected %d responses in the batch response; got %d", count, len(br.Responses))
+	}
+	return br, nil
+}
+
+func newSendResponse(part *multipart.Part) (*SendResponse, error) {
+	hr, err := http.ReadResponse(bufio.NewReader(part), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing multipart body: %v", err)
+	}
+	defer hr.Body.Close()
+	b, err := ioutil.ReadAll(hr.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if hr.StatusCode != http.StatusOK {
+		resp := &internal.Response{
+			Status: hr.StatusCode,
+			Header: hr.Header,
+			Body:   b,
+		}
+		return &SendResponse{Success: false, Error: handleFCMError(resp)}, nil
+	}
+
+	var result fcmResponse
+	if err := json.Unmarshal(b, &result); err != nil {
+		return nil, err
+	}
+	return &SendResponse{Success: true, MessageID: result.Name}, nil
+}
@@ -0,0 +1,338 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package messaging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+const testBatchBoundary = "test_boundary"
+
+var testMulticastMessage = &MulticastMessage{
+	Tokens: []string{"token1", "token2"},
+	Data:   map[string]string{"k": "v"},
+}
+
+func TestSendAll(t *testing.T) {
+	success := []string{successPart("message1"), successPart("message2")}
+	client, ts, rec := batchTestServer(t, http.StatusOK, success)
+	defer ts.Close()
+
+	messages := []*Message{{Topic: "topic1"}, {Token: "token1"}}
+	br, err := client.SendAll(context.Background(), messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSuccessfulBatchResponse(t, br, []string{"message1", "message2"})
+	checkMultipartRequest(t, rec, []map[string]interface{}{
+		{"topic": "topic1"},
+		{"token": "token1"},
+	}, false)
+}
+
+func TestSendAllDryRun(t *testing.T) {
+	success := []string{successPart("message1"), successPart("message2")}
+	client, ts, rec := batchTestServer(t, http.StatusOK, success)
+	defer ts.Close()
+
+	messages := []*Message{{Topic: "topic1"}, {Token: "token1"}}
+	br, err := client.SendAllDryRun(context.Background(), messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSuccessfulBatchResponse(t, br, []string{"message1", "message2"})
+	checkMultipartRequest(t, rec, []map[string]interface{}{
+		{"topic": "topic1"},
+		{"token": "token1"},
+	}, true)
+}
+
+func TestSendAllPartialFailure(t *testing.T) {
+	parts := []string{
+		successPart("message1"),
+		errorPart(http.StatusBadRequest, `{"error": {"status": "INVALID_ARGUMENT", "message": "test error"}}`),
+		errorPart(http.StatusNotFound, `{"error": {"status": "NOT_FOUND", "message": "test error"}}`),
+	}
+	client, ts, _ := batchTestServer(t, http.StatusOK, parts)
+	defer ts.Close()
+
+	messages := []*Message{{Topic: "topic1"}, {Token: "token1"}, {Token: "token2"}}
+	br, err := client.SendAll(context.Background(), messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if br.SuccessCount != 1 || br.FailureCount != 2 || len(br.Responses) != 3 {
+		t.Fatalf("SendAll() = %#v; want = {SuccessCount: 1, FailureCount: 2}", br)
+	}
+	if r := br.Responses[0]; !r.Success || r.MessageID != "message1" || r.Error != nil {
+		t.Errorf("Responses[0] = %#v; want = success", r)
+	}
+	if r := br.Responses[1]; r.Success || r.MessageID != "" || !IsInvalidArgument(r.Error) {
+		t.Errorf("Responses[1] = %#v; want = invalid-argument error", r)
+	}
+	if r := br.Responses[2]; r.Success || r.MessageID != "" || !IsRegistrationTokenNotRegistered(r.Error) {
+		t.Errorf("Responses[2] = %#v; want = registration-token-not-registered error", r)
+	}
+}
+
+func TestSendAllTotalFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error": {"status": "INTERNAL", "message": "test error"}}`))
+	}))
+	defer ts.Close()
+	client, err := NewClient(context.Background(), testMessagingConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.batchEndpoint = ts.URL
+
+	br, err := client.SendAll(context.Background(), []*Message{{Topic: "topic1"}})
+	if br != nil || !IsInternal(err) {
+		t.Errorf("SendAll() = (%v, %v); want = (nil, internal-error)", br, err)
+	}
+}
+
+func TestSendAllResponseCountMismatch(t *testing.T) {
+	client, ts, _ := batchTestServer(t, http.StatusOK, []string{successPart("message1")})
+	defer ts.Close()
+
+	br, err := client.SendAll(context.Background(), []*Message{{Topic: "topic1"}, {Token: "token1"}})
+	if br != nil || err == nil {
+		t.Errorf("SendAll() = (%v, %v); want = (nil, error)", br, err)
+	}
+}
+
+func TestSendAllInvalid(t *testing.T) {
+	client, err := NewClient(context.Background(), testMessagingConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tooMany := make([]*Message, maxMessages+1)
+	for i := range tooMany {
+		tooMany[i] = &Message{Topic: "topic"}
+	}
+	cases := []struct {
+		name     string
+		messages []*Message
+		want     string
+	}{
+		{"Nil", nil, "SendAll: messages must not be nil or empty"},
+		{"TooMany", tooMany, "SendAll: messages must not contain more than 500 elements"},
+		{
+			"InvalidMessage",
+			[]*Message{{Topic: "topic"}, {}},
+			"SendAll: invalid message at index 1: " +
+				"exactly one of token, topic, condition or device group must be specified",
+		},
+	}
+	for _, tc := range cases {
+		br, err := client.SendAll(context.Background(), tc.messages)
+		if br != nil || err == nil || err.Error() != tc.want {
+			t.Errorf("SendAll(%s) = (%v, %v); want = (nil, %q)", tc.name, br, err, tc.want)
+		}
+	}
+}
+
+func TestSendMulticast(t *testing.T) {
+	success := []string{successPart("message1"), successPart("message2")}
+	client, ts, rec := batchTestServer(t, http.StatusOK, success)
+	defer ts.Close()
+
+	br, err := client.SendMulticast(context.Background(), testMulticastMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSuccessfulBatchResponse(t, br, []string{"message1", "message2"})
+	checkMultipartRequest(t, rec, []map[string]interface{}{
+		{"token": "token1", "data": map[string]interface{}{"k": "v"}},
+		{"token": "token2", "data": map[string]interface{}{"k": "v"}},
+	}, false)
+}
+
+func TestSendMulticastDryRun(t *testing.T) {
+	success := []string{successPart("message1"), successPart("message2")}
+	client, ts, rec := batchTestServer(t, http.StatusOK, success)
+	defer ts.Close()
+
+	br, err := client.SendMulticastDryRun(context.Background(), testMulticastMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSuccessfulBatchResponse(t, br, []string{"message1", "message2"})
+	checkMultipartRequest(t, rec, []map[string]interface{}{
+		{"token": "token1", "data": map[string]interface{}{"k": "v"}},
+		{"token": "token2", "data": map[string]interface{}{"k": "v"}},
+	}, true)
+}
+
+func TestSendMulticastInvalid(t *testing.T) {
+	client, err := NewClient(context.Background(), testMessagingConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		message *MulticastMessage
+		want    string
+	}{
+		{"Nil", nil, "SendMulticast: message must not be nil"},
+		{"NoTokens", &MulticastMessage{}, "SendMulticast: tokens must not be nil or empty"},
+		{
+			"TooManyTokens",
+			&MulticastMessage{Tokens: strings.Split("a"+strings.Repeat(",a", maxMessages), ",")},
+			"SendMulticast: tokens must not contain more than 500 elements",
+		},
+		{
+			"EmptyToken",
+			&MulticastMessage{Tokens: []string{"token1", ""}},
+			"SendMulticast: invalid message at index 1: " +
+				"exactly one of token, topic, condition or device group must be specified",
+		},
+	}
+	for _, tc := range cases {
+		br, err := client.SendMulticast(context.Background(), tc.message)
+		if br != nil || err == nil || err.Error() != tc.want {
+			t.Errorf("SendMulticast(%s) = (%v, %v); want = (nil, %q)", tc.name, br, err, tc.want)
+		}
+	}
+}
+
+type batchRequestRecorder struct {
+	req  *http.Request
+	body []byte
+}
+
+func batchTestServer(t *testing.T, status int, parts []string) (*Client, *httptest.Server, *batchRequestRecorder) {
+	rec := &batchRequestRecorder{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec.req = r
+		rec.body, _ = ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+testBatchBoundary)
+		w.WriteHeader(status)
+		w.Write([]byte(multipartResponse(parts)))
+	}))
+	client, err := NewClient(context.Background(), testMessagingConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.batchEndpoint = ts.URL
+	return client, ts, rec
+}
+
+func successPart(name string) string {
+	return fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: application/json; charset=UTF-8\r\n\r\n{\"name\": %q}", name)
+}
+
+func errorPart(status int, body string) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s\r\nContent-Type: application/json; charset=UTF-8\r\n\r\n%s",
+		status, http.StatusText(status), body)
+}
+
+func multipartResponse(parts []string) string {
+	var b bytes.Buffer
+	for idx, p := range parts {
+		b.WriteString("--" + testBatchBoundary + "\r\n")
+		b.WriteString("Content-Type: application/http\r\n")
+		b.WriteString(fmt.Sprintf("Content-ID: response-%d\r\n\r\n", idx+1))
+		b.WriteString(p + "\r\n")
+	}
+	b.WriteString("--" + testBatchBoundary + "--\r\n")
+	return b.String()
+}
+
+func checkSuccessfulBatchResponse(t *testing.T, br *BatchResponse, ids []string) {
+	if br.SuccessCount != len(ids) || br.FailureCount != 0 || len(br.Responses) != len(ids) {
+		t.Fatalf("BatchResponse = %#v; want = {SuccessCount: %d, FailureCount: 0}", br, len(ids))
+	}
+	for i, r := range br.Responses {
+		if !r.Success || r.MessageID != ids[i] || r.Error != nil {
+			t.Errorf("Responses[%d] = %#v; want = {Success: true, MessageID: %q}", i, r, ids[i])
+		}
+	}
+}
+
+func checkMultipartRequest(t *testing.T, rec *batchRequestRecorder, want []map[string]interface{}, dryRun bool) {
+	if rec.req.Method != http.MethodPost {
+		t.Errorf("Method = %q; want = %q", rec.req.Method, http.MethodPost)
+	}
+	mediaType, params, err := mime.ParseMediaType(rec.req.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/mixed" || params["boundary"] != multipartBoundary {
+		t.Errorf("Content-Type = %q; want = multipart/mixed; boundary=%s",
+			rec.req.Header.Get("Content-Type"), multipartBoundary)
+	}
+
+	reader := multipart.NewReader(bytes.NewBuffer(rec.body), params["boundary"])
+	count := 0
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if count >= len(want) {
+			t.Fatalf("request contains more than %d parts", len(want))
+		}
+		if ct := part.Header.Get("Content-Type"); ct != "application/http" {
+			t.Errorf("Part[%d] Content-Type = %q; want = application/http", count, ct)
+		}
+		if id := part.Header.Get("Content-ID"); id != fmt.Sprintf("%d", count+1) {
+			t.Errorf("Part[%d] Content-ID = %q; want = %d", count, id, count+1)
+		}
+
+		req, err := http.ReadRequest(bufio.NewReader(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.Method != http.MethodPost || req.URL.Path != "/v1/projects/test-project/messages:send" {
+			t.Errorf("Part[%d] = %s %s; want = POST /v1/projects/test-project/messages:send",
+				count, req.Method, req.URL.Path)
+		}
+		var parsed map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&parsed); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(parsed["message"], want[count]) {
+			t.Errorf("Part[%d] message = %#v; want = %#v", count, parsed["message"], want[count])
+		}
+		if validate, ok := parsed["validate_only"]; dryRun != ok || (ok && validate != true) {
+			t.Errorf("Part[%d] validate_only = %v; want = %v", count, validate, dryRun)
+		}
+		count++
+	}
+	if count != len(want) {
+		t.Errorf("request contains %d parts; want = %d", count, len(want))
+	}
+}
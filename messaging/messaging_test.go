@@ -16,6 +16,7 @@ package messaging
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -73,6 +74,11 @@ var validMessages = []struct {
 		req:  &Message{Condition: "test-condition"},
 		want: map[string]interface{}{"condition": "test-condition"},
 	},
+	{
+		name: "DeviceGroupOnly",
+		req:  &Message{DeviceGroup: "test-notification-key"},
+		want: map[string]interface{}{"token": "test-notification-key"},
+	},
 	{
 		name: "DataMessage",
 		req: &Message{
@@ -371,7 +377,7 @@ var invalidMessages = []struct {
 	{
 		name: "NoTargets",
 		req:  &Message{},
-		want: "exactly one of token, topic or condition must be specified",
+		want: "exactly one of token, topic, condition or device group must be specified",
 	},
 	{
 		name: "MultipleTargets",
@@ -379,7 +385,15 @@ var invalidMessages = []struct {
 			Token: "token",
 			Topic: "topic",
 		},
-		want: "exactly one of token, topic or condition must be specified",
+		want: "exactly one of token, topic, condition or device group must be specified",
+	},
+	{
+		name: "TokenAndDeviceGroup",
+		req: &Message{
+			Token:       "token",
+			DeviceGroup: "notification-key",
+		},
+		want: "exactly one of token, topic, condition or device group must be specified",
 	},
 	{
 		name: "InvalidPrefixedTopicName",
@@ -705,8 +719,8 @@ func TestSendError(t *testing.T) {
 	for _, tc := range cases {
 		resp = tc.resp
 		name, err := client.Send(ctx, &Message{Topic: "topic"})
-		if err == nil || err.Error() != tc.want || !tc.check(err) {
-			t.Errorf("Send() = (%q, %v); want = (%q, %q)", name, err, "", tc.want)
+		if want := "Send: " + tc.want; err == nil || err.Error() != want || !tc.check(err) {
+			t.Errorf("Send() = (%q, %v); want = (%q, %q)", name, err, "", want)
 		}
 	}
 }
@@ -719,8 +733,8 @@ func TestInvalidMessage(t *testing.T) {
 	}
 	for _, tc := range invalidMessages {
 		name, err := client.Send(ctx, tc.req)
-		if err == nil || err.Error() != tc.want {
-			t.Errorf("Send(%s) = (%q, %v); want = (%q, %q)", tc.name, name, err, "", tc.want)
+		if want := "Send: " + tc.want; err == nil || err.Error() != want {
+			t.Errorf("Send(%s) = (%q, %v); want = (%q, %q)", tc.name, name, err, "", want)
 		}
 	}
 }
@@ -759,8 +773,9 @@ func TestInvalidSubscribe(t *testing.T) {
 	}
 	for _, tc := range invalidTopicMgtArgs {
 		name, err := client.SubscribeToTopic(ctx, tc.tokens, tc.topic)
-		if err == nil || err.Error() != tc.want {
-			t.Errorf("SubscribeToTopic(%s) = (%q, %v); want = (%q, %q)", tc.name, name, err, "", tc.want)
+		want := topicMgtError("SubscribeToTopic", tc.topic, tc.want)
+		if err == nil || err.Error() != want {
+			t.Errorf("SubscribeToTopic(%s) = (%q, %v); want = (%q, %q)", tc.name, name, err, "", want)
 		}
 	}
 }
@@ -799,8 +814,9 @@ func TestInvalidUnsubscribe(t *testing.T) {
 	}
 	for _, tc := range invalidTopicMgtArgs {
 		name, err := client.UnsubscribeFromTopic(ctx, tc.tokens, tc.topic)
-		if err == nil || err.Error() != tc.want {
-			t.Errorf("UnsubscribeFromTopic(%s) = (%q, %v); want = (%q, %q)", tc.name, name, err, "", tc.want)
+		want := topicMgtError("UnsubscribeFromTopic", tc.topic, tc.want)
+		if err == nil || err.Error() != want {
+			t.Errorf("UnsubscribeFromTopic(%s) = (%q, %v); want = (%q, %q)", tc.name, name, err, "", want)
 		}
 	}
 }
@@ -849,19 +865,28 @@ func TestTopicManagementError(t *testing.T) {
 	for _, tc := range cases {
 		resp = tc.resp
 		tmr, err := client.SubscribeToTopic(ctx, []string{"id1"}, "topic")
-		if err == nil || err.Error() != tc.want || !tc.check(err) {
-			t.Errorf("SubscribeToTopic() = (%q, %v); want = (%q, %q)", tmr, err, "", tc.want)
+		want := topicMgtError("SubscribeToTopic", "topic", tc.want)
+		if err == nil || err.Error() != want || !tc.check(err) {
+			t.Errorf("SubscribeToTopic() = (%q, %v); want = (%q, %q)", tmr, err, "", want)
 		}
 	}
 	for _, tc := range cases {
 		resp = tc.resp
 		tmr, err := client.UnsubscribeFromTopic(ctx, []string{"id1"}, "topic")
-		if err == nil || err.Error() != tc.want {
-			t.Errorf("UnsubscribeFromTopic() = (%q, %v); want = (%q, %q)", tmr, err, "", tc.want)
+		want := topicMgtError("UnsubscribeFromTopic", "topic", tc.want)
+		if err == nil || err.Error() != want {
+			t.Errorf("UnsubscribeFromTopic() = (%q, %v); want = (%q, %q)", tmr, err, "", want)
 		}
 	}
 }
 
+func topicMgtError(op, topic, msg string) string {
+	if topic == "" {
+		return fmt.Sprintf("%s: %s", op, msg)
+	}
+	return fmt.Sprintf("%s(%q): %s", op, topic, msg)
+}
+
 func checkFCMRequest(t *testing.T, b []byte, tr *http.Request, want map[string]interface{}, dryRun bool) {
 	var parsed map[string]interface{}
 	if err := json.Unmarshal(b, &parsed); err != nil {
@@ -0,0 +1,218 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projectmanagement
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"firebase.google.com/go/internal"
+)
+
+// AndroidAppMetadata contains the metadata of an Android app in a Firebase project.
+type AndroidAppMetadata struct {
+	Name        string `json:"name"`
+	AppID       string `json:"appId"`
+	DisplayName string `json:"displayName"`
+	ProjectID   string `json:"projectId"`
+	PackageName string `json:"packageName"`
+}
+
+// ShaCertificate is a SHA-1 or SHA-256 certificate fingerprint associated with an Android app.
+//
+// Name is the resource name of the certificate, assigned by the server. CertType is either
+// "SHA_1" or "SHA_256".
+type ShaCertificate struct {
+	Name     string `json:"name,omitempty"`
+	Hash     string `json:"shaHash"`
+	CertType string `json:"certType"`
+}
+
+// AndroidApp is a reference to an Android app in a Firebase project.
+type AndroidApp struct {
+	appID  string
+	client *Client
+}
+
+// AndroidApps returns the metadata of all the Android apps in the project.
+func (c *Client) AndroidApps(ctx context.Context) (apps []*AndroidAppMetadata, err error) {
+	defer internal.WrapOpError(&err, "AndroidApps", "")
+	err = c.listApps(ctx, "androidApps", func(b []byte) error {
+		var page []*AndroidAppMetadata
+		if err := json.Unmarshal(b, &page); err != nil {
+			return err
+		}
+		apps = append(apps, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return apps, nil
+}
+
+// AndroidApp returns a reference to the Android app with the given app ID. It does not check
+// whether the app exists.
+func (c *Client) AndroidApp(appID string) *AndroidApp {
+	return &AndroidApp{appID: appID, client: c}
+}
+
+// CreateAndroidApp creates a new Android app with the given package name, and an optional display
+// name, in the project. It waits for the app to be created, and returns its metadata.
+func (c *Client) CreateAndroidApp(
+	ctx context.Context, packageName, displayName string) (app *AndroidAppMetadata, err error) {
+
+	defer internal.WrapOpError(&err, "CreateAndroidApp", packageName)
+	if packageName == "" {
+		return nil, errors.New("package name must not be empty")
+	}
+	req := map[string]string{"packageName": packageName}
+	if displayName != "" {
+		req["displayName"] = displayName
+	}
+	var result AndroidAppMetadata
+	if err := c.createApp(ctx, "androidApps", req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// AppID returns the app ID of the Android app.
+func (a *AndroidApp) AppID() string {
+	return a.appID
+}
+
+// Metadata returns the metadata of the Android app.
+func (a *AndroidApp) Metadata(ctx context.Context) (md *AndroidAppMetadata, err error) {
+	defer internal.WrapOpError(&err, "Metadata", a.appID)
+	if err := validateAppID(a.appID); err != nil {
+		return nil, err
+	}
+	var result AndroidAppMetadata
+	if err := a.client.makeRequest(ctx, http.MethodGet, a.path(""), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetDisplayName updates the display name of the Android app.
+func (a *AndroidApp) SetDisplayName(ctx context.Context, displayName string) (err error) {
+	defer internal.WrapOpError(&err, "SetDisplayName", a.appID)
+	return setDisplayName(ctx, a.client, a.appID, a.path(""), displayName)
+}
+
+// Config returns the contents of the google-services.json configuration file of the Android app.
+func (a *AndroidApp) Config(ctx context.Context) (config []byte, err error) {
+	defer internal.WrapOpError(&err, "Config", a.appID)
+	return getConfig(ctx, a.client, a.appID, a.path("/config"))
+}
+
+// ShaCertificates returns the SHA certificates associated with the Android app.
+func (a *AndroidApp) ShaCertificates(ctx context.Context) (certs []*ShaCertificate, err error) {
+	defer internal.WrapOpError(&err, "ShaCertificates", a.appID)
+	if err := validateAppID(a.appID); err != nil {
+		return nil, err
+	}
+	var result struct {
+		Certificates []*ShaCertificate `json:"certificates"`
+	}
+	if err := a.client.makeRequest(ctx, http.MethodGet, a.path("/sha"), nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Certificates, nil
+}
+
+// AddShaCertificate associates the given SHA-1 or SHA-256 certificate fingerprint with the Android
+// app. The hash must be a hex string of 40 (SHA-1) or 64 (SHA-256) characters. Returns the added
+// certificate, with the resource name assigned by the server.
+func (a *AndroidApp) AddShaCertificate(ctx context.Context, hash string) (cert *ShaCertificate, err error) {
+	defer internal.WrapOpError(&err, "AddShaCertificate", a.appID)
+	if err := validateAppID(a.appID); err != nil {
+		return nil, err
+	}
+	req, err := newShaCertificate(hash)
+	if err != nil {
+		return nil, err
+	}
+	var result ShaCertificate
+	if err := a.client.makeRequest(ctx, http.MethodPost, a.path("/sha"), req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteShaCertificate removes the SHA certificate with the given resource name from the Android
+// app. The name is the Name of a certificate returned by ShaCertificates().
+func (a *AndroidApp) DeleteShaCertificate(ctx context.Context, name string) (err error) {
+	defer internal.WrapOpError(&err, "DeleteShaCertificate", name)
+	if !strings.HasPrefix(name, "projects/") || !strings.Contains(name, "/sha/") {
+		return fmt.Errorf("invalid certificate name: %q", name)
+	}
+	return a.client.makeRequest(ctx, http.MethodDelete, name, nil, nil)
+}
+
+func (a *AndroidApp) path(suffix string) string {
+	return fmt.Sprintf("projects/-/androidApps/%s%s", a.appID, suffix)
+}
+
+func newShaCertificate(hash string) (*ShaCertificate, error) {
+	if _, err := hex.DecodeString(hash); err != nil {
+		return nil, fmt.Errorf("certificate hash must be a hex string: %q", hash)
+	}
+	switch len(hash) {
+	case 40:
+		return &ShaCertificate{Hash: strings.ToLower(hash), CertType: "SHA_1"}, nil
+	case 64:
+		return &ShaCertificate{Hash: strings.ToLower(hash), CertType: "SHA_256"}, nil
+	default:
+		return nil, fmt.Errorf("certificate hash must be a SHA-1 or SHA-256 hash: %q", hash)
+	}
+}
+
+func validateAppID(appID string) error {
+	if appID == "" {
+		return errors.New("app id must not be empty")
+	}
+	return nil
+}
+
+func setDisplayName(ctx context.Context, c *Client, appID, path, displayName string) error {
+	if err := validateAppID(appID); err != nil {
+		return err
+	}
+	if displayName == "" {
+		return errors.New("display name must not be empty")
+	}
+	req := map[string]string{"displayName": displayName}
+	opt := internal.WithQueryParam("updateMask", "display_name")
+	return c.makeRequest(ctx, http.MethodPatch, path, req, nil, opt)
+}
+
+func getConfig(ctx context.Context, c *Client, appID, path string) ([]byte, error) {
+	if err := validateAppID(appID); err != nil {
+		return nil, err
+	}
+	var result appConfig
+	if err := c.makeRequest(ctx, http.MethodGet, path, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.ConfigFileContents, nil
+}
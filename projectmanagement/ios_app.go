@@ -0,0 +1,118 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projectmanagement
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/net/context"
+
+	"firebase.google.com/go/internal"
+)
+
+// IOSAppMetadata contains the metadata of an iOS app in a Firebase project.
+type IOSAppMetadata struct {
+	Name        string `json:"name"`
+	AppID       string `json:"appId"`
+	DisplayName string `json:"displayName"`
+	ProjectID   string `json:"projectId"`
+	BundleID    string `json:"bundleId"`
+}
+
+// IOSApp is a reference to an iOS app in a Firebase project.
+type IOSApp struct {
+	appID  string
+	client *Client
+}
+
+// IOSApps returns the metadata of all the iOS apps in the project.
+func (c *Client) IOSApps(ctx context.Context) (apps []*IOSAppMetadata, err error) {
+	defer internal.WrapOpError(&err, "IOSApps", "")
+	err = c.listApps(ctx, "iosApps", func(b []byte) error {
+		var page []*IOSAppMetadata
+		if err := json.Unmarshal(b, &page); err != nil {
+			return err
+		}
+		apps = append(apps, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return apps, nil
+}
+
+// IOSApp returns a reference to the iOS app with the given app ID. It does not check whether the
+// app exists.
+func (c *Client) IOSApp(appID string) *IOSApp {
+	return &IOSApp{appID: appID, client: c}
+}
+
+// CreateIOSApp creates a new iOS app with the given bundle ID, and an optional display name, in
+// the project. It waits for the app to be created, and returns its metadata.
+func (c *Client) CreateIOSApp(
+	ctx context.Context, bundleID, displayName string) (app *IOSAppMetadata, err error) {
+
+	defer internal.WrapOpError(&err, "CreateIOSApp", bundleID)
+	if bundleID == "" {
+		return nil, errors.New("bundle id must not be empty")
+	}
+	req := map[string]string{"bundleId": bundleID}
+	if displayName != "" {
+		req["displayName"] = displayName
+	}
+	var result IOSAppMetadata
+	if err := c.createApp(ctx, "iosApps", req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// AppID returns the app ID of the iOS app.
+func (a *IOSApp) AppID() string {
+	return a.appID
+}
+
+// Metadata returns the metadata of the iOS app.
+func (a *IOSApp) Metadata(ctx context.Context) (md *IOSAppMetadata, err error) {
+	defer internal.WrapOpError(&err, "Metadata", a.appID)
+	if err := validateAppID(a.appID); err != nil {
+		return nil, err
+	}
+	var result IOSAppMetadata
+	if err := a.client.makeRequest(ctx, http.MethodGet, a.path(""), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetDisplayName updates the display name of the iOS app.
+func (a *IOSApp) SetDisplayName(ctx context.Context, displayName string) (err error) {
+	defer internal.WrapOpError(&err, "SetDisplayName", a.appID)
+	return setDisplayName(ctx, a.client, a.appID, a.path(""), displayName)
+}
+
+// Config returns the contents of the GoogleService-Info.plist configuration file of the iOS app.
+func (a *IOSApp) Config(ctx context.Context) (config []byte, err error) {
+	defer internal.WrapOpError(&err, "Config", a.appID)
+	return getConfig(ctx, a.client, a.appID, a.path("/config"))
+}
+
+func (a *IOSApp) path(suffix string) string {
+	return fmt.Sprintf("projects/-/iosApps/%s%s", a.appID, suffix)
+}
@@ -0,0 +1,272 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package projectmanagement contains functions for managing the Android and iOS apps of a
+// Firebase project.
+package projectmanagement // import "firebase.google.com/go/projectmanagement"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"firebase.google.com/go/internal"
+)
+
+const (
+	projectManagementEndpoint = "https://firebase.googleapis.com/v1beta1"
+	maxListPageSize           = 100
+	maxPollAttempts           = 8
+
+	alreadyExists     = "already-exists"
+	internalError     = "internal-error"
+	invalidArgument   = "invalid-argument"
+	notFound          = "not-found"
+	permissionDenied  = "permission-denied"
+	serverUnavailable = "server-unavailable"
+	unknownError      = "unknown-error"
+)
+
+// pollInterval is the delay before the first poll of a long-running operation. It doubles after
+// each poll. Declared as a variable to enable testing.
+var pollInterval = 500 * time.Millisecond
+
+var errorCodes = map[string]struct{ Code, Msg string }{
+	"ALREADY_EXISTS": {
+		alreadyExists,
+		"the requested app already exists; code: " + alreadyExists,
+	},
+	"INTERNAL": {
+		internalError,
+		"backend servers encountered an unknown internal error; code: " + internalError,
+	},
+	"INVALID_ARGUMENT": {
+		invalidArgument,
+		"request contains an invalid argument; code: " + invalidArgument,
+	},
+	"NOT_FOUND": {
+		notFound,
+		"the requested project or app was not found; code: " + notFound,
+	},
+	"PERMISSION_DENIED": {
+		permissionDenied,
+		"the client does not have sufficient privileges; code: " + permissionDenied,
+	},
+	"UNAVAILABLE": {
+		serverUnavailable,
+		"backend servers are temporarily unavailable; code: " + serverUnavailable,
+	},
+}
+
+// Client is the interface for the Firebase project management service.
+type Client struct {
+	// To enable testing against arbitrary endpoints.
+	endpoint string
+	client   *internal.HTTPClient
+	project  string
+	version  string
+}
+
+// NewClient creates a new instance of the Firebase project management Client.
+//
+// This function can only be invoked from within the SDK. Client applications should access the
+// the project management service through firebase.App.
+func NewClient(ctx context.Context, c *internal.ProjectManagementConfig) (*Client, error) {
+	if c.ProjectID == "" {
+		return nil, errors.New("project id is required to access project management client")
+	}
+
+	hc, err := internal.NewHTTPClient(ctx, c.Transport, c.Opts...)
+	if err != nil {
+		return nil, err
+	}
+	hc = internal.WithHeaders(hc, c.Headers, c.UserAgentSuffix)
+	hc = internal.Instrument(hc, c.Instrumentation, "projectmanagement")
+	hc = internal.WithGuard(hc, c.RequestGuard)
+
+	return &Client{
+		endpoint: projectManagementEndpoint,
+		client: &internal.HTTPClient{
+			Client:      hc,
+			MaxBodySize: c.MaxResponseBodySize,
+			RetryConfig: internal.NewRetryConfig(c.MaxRetries),
+			Timeout:     c.RequestTimeout,
+		},
+		project: c.ProjectID,
+		version: "Go/Admin/" + c.Version,
+	}, nil
+}
+
+// IsAlreadyExists checks if the given error was due to creating an app that already exists.
+func IsAlreadyExists(err error) bool {
+	return internal.HasErrorCode(err, alreadyExists)
+}
+
+// IsInternal checks if the given error was due to an internal server error.
+func IsInternal(err error) bool {
+	return internal.HasErrorCode(err, internalError)
+}
+
+// IsInvalidArgument checks if the given error was due to an invalid argument in the request.
+func IsInvalidArgument(err error) bool {
+	return internal.HasErrorCode(err, invalidArgument)
+}
+
+// IsNotFound checks if the given error was due to a project or app that does not exist.
+func IsNotFound(err error) bool {
+	return internal.HasErrorCode(err, notFound)
+}
+
+// IsPermissionDenied checks if the given error was due to the client not having sufficient
+// privileges.
+func IsPermissionDenied(err error) bool {
+	return internal.HasErrorCode(err, permissionDenied)
+}
+
+// IsServerUnavailable checks if the given error was due to the backend server being temporarily
+// unavailable.
+func IsServerUnavailable(err error) bool {
+	return internal.HasErrorCode(err, serverUnavailable)
+}
+
+// IsUnknown checks if the given error was due to unknown error returned by the backend server.
+func IsUnknown(err error) bool {
+	return internal.HasErrorCode(err, unknownError)
+}
+
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+type operation struct {
+	Name     string          `json:"name"`
+	Done     bool            `json:"done"`
+	Error    *apiError       `json:"error"`
+	Response json.RawMessage `json:"response"`
+}
+
+type appConfig struct {
+	ConfigFilename     string `json:"configFilename"`
+	ConfigFileContents []byte `json:"configFileContents"`
+}
+
+// makeRequest sends a request to the given path, relative to the endpoint of the Client, and
+// unmarshals the response into v, unless v is nil.
+func (c *Client) makeRequest(
+	ctx context.Context, method, path string, body, v interface{}, opts ...internal.HTTPOption) error {
+
+	request := &internal.Request{
+		Method: method,
+		URL:    fmt.Sprintf("%s/%s", c.endpoint, path),
+		Opts:   append(opts, internal.WithHeader("X-Client-Version", c.version)),
+	}
+	if body != nil {
+		request.Body = internal.NewJSONEntity(body)
+	}
+	resp, err := c.client.Do(ctx, request)
+	if err != nil {
+		return err
+	}
+	if resp.Status != http.StatusOK {
+		var e struct {
+			Error apiError `json:"error"`
+		}
+		json.Unmarshal(resp.Body, &e) // ignore any json parse errors at this level
+		return newError(resp.Status, &e.Error, resp.Body)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Body, v)
+}
+
+func newError(status int, e *apiError, body []byte) error {
+	var clientCode, msg string
+	info, ok := errorCodes[e.Status]
+	if ok {
+		clientCode, msg = info.Code, info.Msg
+	} else {
+		clientCode = unknownError
+		msg = fmt.Sprintf("server responded with an unknown error; response: %s", string(body))
+	}
+	if e.Message != "" {
+		msg += "; details: " + e.Message
+	}
+	return internal.Errorf(clientCode, "http error status: %d; reason: %s", status, msg)
+}
+
+// listApps fetches all the pages of the given app resource of the project, and calls fn with the
+// body of each page.
+func (c *Client) listApps(ctx context.Context, resource string, fn func([]byte) error) error {
+	var pageToken string
+	for {
+		params := map[string]string{"pageSize": fmt.Sprintf("%d", maxListPageSize)}
+		if pageToken != "" {
+			params["pageToken"] = pageToken
+		}
+		var page struct {
+			Apps          json.RawMessage `json:"apps"`
+			NextPageToken string          `json:"nextPageToken"`
+		}
+		path := fmt.Sprintf("projects/%s/%s", c.project, resource)
+		if err := c.makeRequest(ctx, http.MethodGet, path, nil, &page, internal.WithQueryParams(params)); err != nil {
+			return err
+		}
+		if len(page.Apps) > 0 {
+			if err := fn(page.Apps); err != nil {
+				return err
+			}
+		}
+		if page.NextPageToken == "" {
+			return nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// createApp creates an app of the given resource type, waits for the resulting long-running
+// operation to complete, and unmarshals the created app into v.
+func (c *Client) createApp(ctx context.Context, resource string, body, v interface{}) error {
+	var op operation
+	path := fmt.Sprintf("projects/%s/%s", c.project, resource)
+	if err := c.makeRequest(ctx, http.MethodPost, path, body, &op); err != nil {
+		return err
+	}
+
+	delay := pollInterval
+	for attempt := 0; !op.Done; attempt++ {
+		if attempt == maxPollAttempts {
+			return fmt.Errorf("operation %q did not complete after %d attempts", op.Name, maxPollAttempts)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if err := c.makeRequest(ctx, http.MethodGet, op.Name, nil, &op); err != nil {
+			return err
+		}
+	}
+	if op.Error != nil {
+		return newError(op.Error.Code, op.Error, nil)
+	}
+	return json.Unmarshal(op.Response, v)
+}
@@ -0,0 +1,454 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projectmanagement
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/api/option"
+
+	"firebase.google.com/go/internal"
+)
+
+var testProjectManagementConfig = &internal.ProjectManagementConfig{
+	ProjectID: "test-project",
+	Opts: []option.ClientOption{
+		option.WithTokenSource(&internal.MockTokenSource{AccessToken: "test-token"}),
+	},
+	Version: "test-version",
+}
+
+var testAndroidApp = &AndroidAppMetadata{
+	Name:        "projects/test-project/androidApps/1:1234:android:abcd",
+	AppID:       "1:1234:android:abcd",
+	DisplayName: "Test App",
+	ProjectID:   "test-project",
+	PackageName: "com.example.test",
+}
+
+var testIOSApp = &IOSAppMetadata{
+	Name:        "projects/test-project/iosApps/1:1234:ios:abcd",
+	AppID:       "1:1234:ios:abcd",
+	DisplayName: "Test App",
+	ProjectID:   "test-project",
+	BundleID:    "com.example.test",
+}
+
+type mockRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Body   string
+}
+
+type mockServer struct {
+	Resp     map[string]string
+	Status   int
+	Requests []*mockRequest
+	Srv      *httptest.Server
+}
+
+// newMockServer starts a server that responds to each request with the body mapped to the
+// request method and path (e.g. "GET /v1beta1/projects/test-project/androidApps").
+func newMockServer(resp map[string]string) *mockServer {
+	s := &mockServer{Resp: resp, Status: http.StatusOK}
+	s.Srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		s.Requests = append(s.Requests, &mockRequest{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.RawQuery,
+			Body:   string(b),
+		})
+		body, ok := s.Resp[r.Method+" "+r.URL.Path]
+		w.Header().Set("Content-Type", "application/json")
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": 404, "status": "NOT_FOUND", "message": "no such resource"}}`))
+			return
+		}
+		w.WriteHeader(s.Status)
+		w.Write([]byte(body))
+	}))
+	return s
+}
+
+func newTestClient(t *testing.T, s *mockServer) *Client {
+	client, err := NewClient(context.Background(), testProjectManagementConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.endpoint = s.Srv.URL + "/v1beta1"
+	return client
+}
+
+func toJSON(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestNoProjectID(t *testing.T) {
+	client, err := NewClient(context.Background(), &internal.ProjectManagementConfig{})
+	if client != nil || err == nil {
+		t.Errorf("NewClient() = (%v, %v); want = (nil, error)", client, err)
+	}
+}
+
+func TestAndroidApps(t *testing.T) {
+	s := &mockServer{}
+	s.Srv = httptest.NewServer(pagedHandler(s,
+		`{"apps": [`+toJSON(t, testAndroidApp)+`], "nextPageToken": "token"}`,
+		`{"apps": [`+toJSON(t, testAndroidApp)+`]}`,
+	))
+	defer s.Srv.Close()
+	client := newTestClient(t, s)
+
+	apps, err := client.AndroidApps(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*AndroidAppMetadata{testAndroidApp, testAndroidApp}
+	if !reflect.DeepEqual(apps, want) {
+		t.Errorf("AndroidApps() = %v; want = %v", apps, want)
+	}
+	if len(s.Requests) != 2 {
+		t.Fatalf("Requests = %d; want = 2", len(s.Requests))
+	}
+	if !strings.Contains(s.Requests[1].Query, "pageToken=token") {
+		t.Errorf("Query = %q; want = pageToken=token", s.Requests[1].Query)
+	}
+}
+
+func TestIOSAppsEmpty(t *testing.T) {
+	s := newMockServer(map[string]string{
+		"GET /v1beta1/projects/test-project/iosApps": `{}`,
+	})
+	defer s.Srv.Close()
+	client := newTestClient(t, s)
+
+	apps, err := client.IOSApps(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 0 {
+		t.Errorf("IOSApps() = %v; want = []", apps)
+	}
+}
+
+// pagedHandler serves the given pages in order, recording each request on s.
+func pagedHandler(s *mockServer, pages ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Requests = append(s.Requests, &mockRequest{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.RawQuery,
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(pages[len(s.Requests)-1]))
+	})
+}
+
+func TestCreateAndroidApp(t *testing.T) {
+	defer setPollInterval(time.Millisecond)()
+	s := newMockServer(map[string]string{
+		"POST /v1beta1/projects/test-project/androidApps": `{"name": "operations/op1"}`,
+		"GET /v1beta1/operations/op1": `{"name": "operations/op1", "done": true, "response": ` +
+			toJSON(t, testAndroidApp) + `}`,
+	})
+	defer s.Srv.Close()
+	client := newTestClient(t, s)
+
+	app, err := client.CreateAndroidApp(context.Background(), "com.example.test", "Test App")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(app, testAndroidApp) {
+		t.Errorf("CreateAndroidApp() = %v; want = %v", app, testAndroidApp)
+	}
+	var body map[string]string
+	if err := json.Unmarshal([]byte(s.Requests[0].Body), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"packageName": "com.example.test", "displayName": "Test App"}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("Body = %v; want = %v", body, want)
+	}
+}
+
+func TestCreateIOSApp(t *testing.T) {
+	defer setPollInterval(time.Millisecond)()
+	s := newMockServer(map[string]string{
+		"POST /v1beta1/projects/test-project/iosApps": `{"name": "operations/op1", "done": true, "response": ` +
+			toJSON(t, testIOSApp) + `}`,
+	})
+	defer s.Srv.Close()
+	client := newTestClient(t, s)
+
+	app, err := client.CreateIOSApp(context.Background(), "com.example.test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(app, testIOSApp) {
+		t.Errorf("CreateIOSApp() = %v; want = %v", app, testIOSApp)
+	}
+	if want := `{"bundleId":"com.example.test"}`; s.Requests[0].Body != want {
+		t.Errorf("Body = %q; want = %q", s.Requests[0].Body, want)
+	}
+}
+
+func TestCreateAppOperationError(t *testing.T) {
+	defer setPollInterval(time.Millisecond)()
+	s := newMockServer(map[string]string{
+		"POST /v1beta1/projects/test-project/androidApps": `{"name": "operations/op1"}`,
+		"GET /v1beta1/operations/op1": `{"name": "operations/op1", "done": true, "error": ` +
+			`{"code": 6, "status": "ALREADY_EXISTS", "message": "app exists"}}`,
+	})
+	defer s.Srv.Close()
+	client := newTestClient(t, s)
+
+	app, err := client.CreateAndroidApp(context.Background(), "com.example.test", "")
+	if app != nil || !IsAlreadyExists(err) {
+		t.Errorf("CreateAndroidApp() = (%v, %v); want = (nil, already-exists error)", app, err)
+	}
+}
+
+func TestCreateAppTimeout(t *testing.T) {
+	defer setPollInterval(time.Microsecond)()
+	s := newMockServer(map[string]string{
+		"POST /v1beta1/projects/test-project/androidApps": `{"name": "operations/op1"}`,
+		"GET /v1beta1/operations/op1":                     `{"name": "operations/op1"}`,
+	})
+	defer s.Srv.Close()
+	client := newTestClient(t, s)
+
+	app, err := client.CreateAndroidApp(context.Background(), "com.example.test", "")
+	if app != nil || err == nil {
+		t.Errorf("CreateAndroidApp() = (%v, %v); want = (nil, error)", app, err)
+	}
+	if len(s.Requests) != maxPollAttempts+1 {
+		t.Errorf("Requests = %d; want = %d", len(s.Requests), maxPollAttempts+1)
+	}
+}
+
+func TestCreateAppInvalidArgs(t *testing.T) {
+	client, err := NewClient(context.Background(), testProjectManagementConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app, err := client.CreateAndroidApp(context.Background(), "", ""); app != nil || err == nil {
+		t.Errorf("CreateAndroidApp('') = (%v, %v); want = (nil, error)", app, err)
+	}
+	if app, err := client.CreateIOSApp(context.Background(), "", ""); app != nil || err == nil {
+		t.Errorf("CreateIOSApp('') = (%v, %v); want = (nil, error)", app, err)
+	}
+}
+
+func TestAppMetadata(t *testing.T) {
+	s := newMockServer(map[string]string{
+		"GET /v1beta1/projects/-/androidApps/1:1234:android:abcd": toJSON(t, testAndroidApp),
+		"GET /v1beta1/projects/-/iosApps/1:1234:ios:abcd":         toJSON(t, testIOSApp),
+	})
+	defer s.Srv.Close()
+	client := newTestClient(t, s)
+
+	android, err := client.AndroidApp(testAndroidApp.AppID).Metadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(android, testAndroidApp) {
+		t.Errorf("Metadata() = %v; want = %v", android, testAndroidApp)
+	}
+
+	ios, err := client.IOSApp(testIOSApp.AppID).Metadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ios, testIOSApp) {
+		t.Errorf("Metadata() = %v; want = %v", ios, testIOSApp)
+	}
+}
+
+func TestAppNotFound(t *testing.T) {
+	s := newMockServer(map[string]string{})
+	defer s.Srv.Close()
+	client := newTestClient(t, s)
+
+	md, err := client.AndroidApp("unknown").Metadata(context.Background())
+	if md != nil || !IsNotFound(err) {
+		t.Errorf("Metadata() = (%v, %v); want = (nil, not-found error)", md, err)
+	}
+	want := "Metadata(\"unknown\"): http error status: 404; reason: the requested project or app " +
+		"was not found; code: not-found; details: no such resource"
+	if err.Error() != want {
+		t.Errorf("Metadata() err = %q; want = %q", err.Error(), want)
+	}
+}
+
+func TestAppUnknownError(t *testing.T) {
+	s := newMockServer(map[string]string{
+		"GET /v1beta1/projects/-/iosApps/1:1234:ios:abcd": `{"error": {"status": "SOMETHING_ELSE"}}`,
+	})
+	s.Status = http.StatusTeapot
+	defer s.Srv.Close()
+	client := newTestClient(t, s)
+
+	md, err := client.IOSApp(testIOSApp.AppID).Metadata(context.Background())
+	if md != nil || !IsUnknown(err) {
+		t.Errorf("Metadata() = (%v, %v); want = (nil, unknown error)", md, err)
+	}
+}
+
+func TestSetDisplayName(t *testing.T) {
+	s := newMockServer(map[string]string{
+		"PATCH /v1beta1/projects/-/androidApps/1:1234:android:abcd": toJSON(t, testAndroidApp),
+	})
+	defer s.Srv.Close()
+	client := newTestClient(t, s)
+
+	if err := client.AndroidApp(testAndroidApp.AppID).SetDisplayName(context.Background(), "New Name"); err != nil {
+		t.Fatal(err)
+	}
+	req := s.Requests[0]
+	if req.Query != "updateMask=display_name" {
+		t.Errorf("Query = %q; want = %q", req.Query, "updateMask=display_name")
+	}
+	if want := `{"displayName":"New Name"}`; req.Body != want {
+		t.Errorf("Body = %q; want = %q", req.Body, want)
+	}
+
+	if err := client.IOSApp(testIOSApp.AppID).SetDisplayName(context.Background(), ""); err == nil {
+		t.Errorf("SetDisplayName('') = nil; want = error")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	s := newMockServer(map[string]string{
+		"GET /v1beta1/projects/-/iosApps/1:1234:ios:abcd/config": `{
+			"configFilename": "GoogleService-Info.plist",
+			"configFileContents": "Y29uZmlnIGZpbGU="
+		}`,
+	})
+	defer s.Srv.Close()
+	client := newTestClient(t, s)
+
+	config, err := client.IOSApp(testIOSApp.AppID).Config(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(config) != "config file" {
+		t.Errorf("Config() = %q; want = %q", string(config), "config file")
+	}
+
+	if config, err := client.AndroidApp("").Config(context.Background()); config != nil || err == nil {
+		t.Errorf("Config() = (%v, %v); want = (nil, error)", config, err)
+	}
+}
+
+func TestShaCertificates(t *testing.T) {
+	cert := &ShaCertificate{
+		Name:     "projects/test-project/androidApps/1:1234:android:abcd/sha/cert1",
+		Hash:     "1111111111111111111111111111111111111111",
+		CertType: "SHA_1",
+	}
+	s := newMockServer(map[string]string{
+		"GET /v1beta1/projects/-/androidApps/1:1234:android:abcd/sha":  `{"certificates": [` + toJSON(t, cert) + `]}`,
+		"POST /v1beta1/projects/-/androidApps/1:1234:android:abcd/sha": toJSON(t, cert),
+		"DELETE /v1beta1/" + cert.Name:                                 `{}`,
+	})
+	defer s.Srv.Close()
+	app := newTestClient(t, s).AndroidApp(testAndroidApp.AppID)
+	ctx := context.Background()
+
+	certs, err := app.ShaCertificates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(certs, []*ShaCertificate{cert}) {
+		t.Errorf("ShaCertificates() = %v; want = %v", certs, []*ShaCertificate{cert})
+	}
+
+	added, err := app.AddShaCertificate(ctx, cert.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(added, cert) {
+		t.Errorf("AddShaCertificate() = %v; want = %v", added, cert)
+	}
+	if want := `{"shaHash":"` + cert.Hash + `","certType":"SHA_1"}`; s.Requests[1].Body != want {
+		t.Errorf("Body = %q; want = %q", s.Requests[1].Body, want)
+	}
+
+	if err := app.DeleteShaCertificate(ctx, cert.Name); err != nil {
+		t.Fatal(err)
+	}
+	if s.Requests[2].Method != http.MethodDelete {
+		t.Errorf("Method = %q; want = %q", s.Requests[2].Method, http.MethodDelete)
+	}
+}
+
+func TestShaCertificateType(t *testing.T) {
+	cases := []struct {
+		hash string
+		want string
+	}{
+		{strings.Repeat("a", 40), "SHA_1"},
+		{strings.Repeat("A", 64), "SHA_256"},
+	}
+	for _, tc := range cases {
+		cert, err := newShaCertificate(tc.hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.CertType != tc.want || cert.Hash != strings.ToLower(tc.hash) {
+			t.Errorf("newShaCertificate(%q) = %v; want = %q", tc.hash, cert, tc.want)
+		}
+	}
+}
+
+func TestInvalidShaCertificate(t *testing.T) {
+	client, err := NewClient(context.Background(), testProjectManagementConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := client.AndroidApp(testAndroidApp.AppID)
+	for _, hash := range []string{"", "abc", strings.Repeat("z", 40), strings.Repeat("a", 50)} {
+		if cert, err := app.AddShaCertificate(context.Background(), hash); cert != nil || err == nil {
+			t.Errorf("AddShaCertificate(%q) = (%v, %v); want = (nil, error)", hash, cert, err)
+		}
+	}
+	if err := app.DeleteShaCertificate(context.Background(), "cert1"); err == nil {
+		t.Errorf("DeleteShaCertificate('cert1') = nil; want = error")
+	}
+}
+
+func setPollInterval(d time.Duration) func() {
+	old := pollInterval
+	pollInterval = d
+	return func() {
+		pollInterval = old
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package firebase
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/api/option"
+)
+
+var (
+	appsMu sync.Mutex
+	apps   = make(map[string]*App)
+)
+
+// InitializeApp creates a new App with the given name from the provided config and client
+// options, and registers it so that it can be retrieved with GetApp.
+//
+// InitializeApp is idempotent: if an App with the same name is already registered, that App is
+// returned, and config and opts are ignored. This makes it safe to call InitializeApp from every
+// code path that needs the App, e.g. in services that talk to several Firebase projects. If several
+// goroutines initialize the same name concurrently, they all get the App registered first. Apart
+// from registering it, InitializeApp creates the App the same way as NewApp.
+func InitializeApp(ctx context.Context, name string, config *Config, opts ...option.ClientOption) (*App, error) {
+	if name == "" {
+		return nil, errors.New("app name must be a non-empty string")
+	}
+	if app, err := GetApp(name); err == nil {
+		return app, nil
+	}
+
+	// The App is created without holding the lock, since discovering its credentials may involve a
+	// round trip to the metadata server.
+	app, err := NewApp(ctx, config, opts...)
+	if err != nil {
+		return nil, err
+	}
+	app.name = name
+
+	appsMu.Lock()
+	defer appsMu.Unlock()
+	if existing, ok := apps[name]; ok {
+		return existing, nil
+	}
+	apps[name] = app
+	return app, nil
+}
+
+// GetApp returns the App registered with the given name by InitializeApp.
+func GetApp(name string) (*App, error) {
+	appsMu.Lock()
+	defer appsMu.Unlock()
+	app, ok := apps[name]
+	if !ok {
+		return nil, fmt.Errorf("app %q does not exist; call InitializeApp() first", name)
+	}
+	return app, nil
+}
+
+// DeleteApp unregisters the App with the given name, and tears it down.
+//
+// Afterwards the App can no longer be used to create service clients, and InitializeApp can be
+// called again with the same name to create a new App. The service clients created from the App
+// are torn down as well: the Firestore and Storage clients are closed, and the requests of the
+// other service clients fail with an error stating that the App has been deleted.
+func DeleteApp(name string) error {
+	appsMu.Lock()
+	app, ok := apps[name]
+	if !ok {
+		appsMu.Unlock()
+		return fmt.Errorf("app %q does not exist", name)
+	}
+	delete(apps, name)
+	appsMu.Unlock()
+
+	app.mu.Lock()
+	app.deleted = true
+	closers := app.closers
+	app.closers = nil
+	app.mu.Unlock()
+
+	// Clients that have already been closed by their owners fail to close again, which is ignored.
+	for _, c := range closers {
+		c.Close()
+	}
+	return nil
+}
+
+// Name returns the name the App was registered with by InitializeApp, or an empty string if the
+// App was created with NewApp.
+func (a *App) Name() string {
+	return a.name
+}
+
+// addCloser registers a client to be closed when the App is deleted. Clients of Apps created with
+// NewApp cannot be deleted, and are not registered.
+func (a *App) addCloser(c io.Closer) {
+	if a.name == "" {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.deleted {
+		c.Close()
+		return
+	}
+	a.closers = append(a.closers, c)
+}
+
+// checkNotDeleted returns an error if the App has been deleted with DeleteApp.
+func (a *App) checkNotDeleted() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.deleted {
+		return fmt.Errorf("app %q has been deleted", a.name)
+	}
+	return nil
+}
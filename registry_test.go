@@ -0,0 +1,194 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package firebase
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/api/option"
+)
+
+func TestInitializeApp(t *testing.T) {
+	ctx := context.Background()
+	opt := option.WithCredentialsFile("testdata/service_account.json")
+	app, err := InitializeApp(ctx, "test-app", &Config{ProjectID: "project-1"}, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteApp("test-app")
+
+	if app.Name() != "test-app" {
+		t.Errorf("Name() = %q; want = %q", app.Name(), "test-app")
+	}
+	again, err := InitializeApp(ctx, "test-app", &Config{ProjectID: "project-2"}, opt)
+	if again != app || err != nil {
+		t.Errorf("InitializeApp(again) = (%p, %v); want = (%p, nil)", again, err, app)
+	}
+	if again.ProjectID() != "project-1" {
+		t.Errorf("ProjectID() = %q; want = %q", again.ProjectID(), "project-1")
+	}
+	got, err := GetApp("test-app")
+	if got != app || err != nil {
+		t.Errorf("GetApp() = (%p, %v); want = (%p, nil)", got, err, app)
+	}
+}
+
+func TestInitializeAppConcurrently(t *testing.T) {
+	ctx := context.Background()
+	opt := option.WithCredentialsFile("testdata/service_account.json")
+	defer DeleteApp("concurrent-app")
+
+	var wg sync.WaitGroup
+	results := make([]*App, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			app, err := InitializeApp(ctx, "concurrent-app", &Config{}, opt)
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = app
+		}(i)
+	}
+	wg.Wait()
+	for i, app := range results {
+		if app != results[0] {
+			t.Errorf("InitializeApp()[%d] = %p; want = %p", i, app, results[0])
+		}
+	}
+}
+
+func TestMultipleApps(t *testing.T) {
+	ctx := context.Background()
+	opt := option.WithCredentialsFile("testdata/service_account.json")
+	for i := 1; i <= 2; i++ {
+		name := fmt.Sprintf("app-%d", i)
+		if _, err := InitializeApp(ctx, name, &Config{ProjectID: "project-" + name}, opt); err != nil {
+			t.Fatal(err)
+		}
+		defer DeleteApp(name)
+	}
+	for i := 1; i <= 2; i++ {
+		name := fmt.Sprintf("app-%d", i)
+		app, err := GetApp(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if app.ProjectID() != "project-"+name {
+			t.Errorf("GetApp(%q).ProjectID() = %q; want = %q", name, app.ProjectID(), "project-"+name)
+		}
+	}
+}
+
+func TestInitializeAppInvalid(t *testing.T) {
+	ctx := context.Background()
+	if app, err := InitializeApp(ctx, "", nil); app != nil || err == nil {
+		t.Errorf("InitializeApp('') = (%v, %v); want = (nil, error)", app, err)
+	}
+	opt := option.WithCredentialsFile("non_existing.json")
+	if app, err := InitializeApp(ctx, "invalid-app", nil, opt); app != nil || err == nil {
+		t.Errorf("InitializeApp(invalid) = (%v, %v); want = (nil, error)", app, err)
+	}
+	if app, err := GetApp("invalid-app"); app != nil || err == nil {
+		t.Errorf("GetApp(invalid) = (%v, %v); want = (nil, error)", app, err)
+	}
+}
+
+func TestGetAppNotFound(t *testing.T) {
+	if app, err := GetApp("non-existing"); app != nil || err == nil {
+		t.Errorf("GetApp() = (%v, %v); want = (nil, error)", app, err)
+	}
+	if err := DeleteApp("non-existing"); err == nil {
+		t.Errorf("DeleteApp() = nil; want = error")
+	}
+}
+
+func TestDeleteApp(t *testing.T) {
+	ctx := context.Background()
+	opt := option.WithCredentialsFile("testdata/service_account.json")
+	app, err := InitializeApp(ctx, "deleted-app", &Config{}, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := app.Auth(ctx); c == nil || err != nil {
+		t.Fatalf("Auth() = (%v, %v); want = (auth, nil)", c, err)
+	}
+
+	if err := DeleteApp("deleted-app"); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := app.Auth(ctx); c != nil || err == nil {
+		t.Errorf("Auth() = (%v, %v); want = (nil, error)", c, err)
+	}
+	if c, err := app.Messaging(ctx); c != nil || err == nil {
+		t.Errorf("Messaging() = (%v, %v); want = (nil, error)", c, err)
+	}
+	if got, err := GetApp("deleted-app"); got != nil || err == nil {
+		t.Errorf("GetApp() = (%v, %v); want = (nil, error)", got, err)
+	}
+
+	fresh, err := InitializeApp(ctx, "deleted-app", &Config{}, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteApp("deleted-app")
+	if fresh == app {
+		t.Errorf("InitializeApp() = deleted app; want = new app")
+	}
+	if c, err := fresh.Auth(ctx); c == nil || err != nil {
+		t.Errorf("Auth() = (%v, %v); want = (auth, nil)", c, err)
+	}
+}
+
+func TestDeleteAppTearsDownClients(t *testing.T) {
+	ctx := context.Background()
+	rt := &recordingTransport{}
+	conf := &Config{ProjectID: "mock-project-id", Transport: rt}
+	app, err := InitializeApp(ctx, "teardown-app", conf, option.WithTokenSource(&testTokenSource{AccessToken: "mock-token"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iid, err := app.InstanceID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := app.Firestore(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := iid.DeleteInstanceID(ctx, "test-iid"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteApp("teardown-app"); err != nil {
+		t.Fatal(err)
+	}
+	err = iid.DeleteInstanceID(ctx, "test-iid")
+	if err == nil || !strings.Contains(err.Error(), `app "teardown-app" has been deleted`) {
+		t.Errorf("DeleteInstanceID() = %v; want = app deleted error", err)
+	}
+	if len(rt.reqs) != 1 {
+		t.Errorf("Requests = %d; want = 1", len(rt.reqs))
+	}
+	if err := fs.Close(); err == nil {
+		t.Errorf("Firestore Close() = nil; want = error for an already closed client")
+	}
+}
@@ -0,0 +1,362 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remoteconfig contains functions for managing the Firebase Remote Config template of a
+// project.
+package remoteconfig // import "firebase.google.com/go/remoteconfig"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/net/context"
+
+	"firebase.google.com/go/internal"
+)
+
+const (
+	remoteConfigEndpoint = "https://firebaseremoteconfig.googleapis.com/v1"
+
+	internalError   = "internal-error"
+	invalidArgument = "invalid-argument"
+	notFound        = "not-found"
+	unknownError    = "unknown-error"
+	versionMismatch = "version-mismatch"
+)
+
+var errorCodes = map[string]struct{ Code, Msg string }{
+	"ABORTED": {
+		versionMismatch,
+		"template has been modified since it was retrieved; code: " + versionMismatch,
+	},
+	"FAILED_PRECONDITION": {
+		versionMismatch,
+		"template has been modified since it was retrieved; code: " + versionMismatch,
+	},
+	"INTERNAL": {
+		internalError,
+		"backend servers encountered an unknown internal error; code: " + internalError,
+	},
+	"INVALID_ARGUMENT": {
+		invalidArgument,
+		"request contains an invalid argument; code: " + invalidArgument,
+	},
+	"NOT_FOUND": {
+		notFound,
+		"template or project not found; code: " + notFound,
+	},
+}
+
+// Client is the interface for the Firebase Remote Config service.
+type Client struct {
+	// To enable testing against arbitrary endpoints.
+	endpoint string
+	client   *internal.HTTPClient
+	project  string
+	version  string
+}
+
+// Template represents the Remote Config template of a project.
+//
+// ETag identifies the version of the template. It is populated by GetTemplate(), and must be left
+// unchanged when a modified template is passed to ValidateTemplate() or PublishTemplate(). This
+// ensures that the template is not published over concurrent changes made by someone else.
+type Template struct {
+	Conditions      []*Condition               `json:"conditions,omitempty"`
+	Parameters      map[string]*Parameter      `json:"parameters,omitempty"`
+	ParameterGroups map[string]*ParameterGroup `json:"parameterGroups,omitempty"`
+	Version         *Version                   `json:"version,omitempty"`
+	ETag            string                     `json:"-"`
+}
+
+// Condition targets a specific group of users. A list of these conditions make up part of a
+// Remote Config template.
+type Condition struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+	TagColor   string `json:"tagColor,omitempty"`
+}
+
+// Parameter is a Remote Config parameter, with a default value and optional values that apply
+// when the named conditions are met.
+type Parameter struct {
+	DefaultValue      *ParameterValue            `json:"defaultValue,omitempty"`
+	ConditionalValues map[string]*ParameterValue `json:"conditionalValues,omitempty"`
+	Description       string                     `json:"description,omitempty"`
+	ValueType         string                     `json:"valueType,omitempty"`
+}
+
+// ParameterValue is the value of a Parameter. If UseInAppDefault is true, the parameter is
+// omitted from the config fetched by the clients, which then use their in-app default value.
+// Otherwise Value is the value of the parameter.
+type ParameterValue struct {
+	Value           string
+	UseInAppDefault bool
+}
+
+// MarshalJSON marshals a ParameterValue into JSON (for internal use only).
+func (v *ParameterValue) MarshalJSON() ([]byte, error) {
+	if v.UseInAppDefault {
+		return json.Marshal(map[string]bool{"useInAppDefault": true})
+	}
+	return json.Marshal(map[string]string{"value": v.Value})
+}
+
+// UnmarshalJSON unmarshals a JSON string into a ParameterValue (for internal use only).
+func (v *ParameterValue) UnmarshalJSON(b []byte) error {
+	var temp struct {
+		Value           string `json:"value"`
+		UseInAppDefault bool   `json:"useInAppDefault"`
+	}
+	if err := json.Unmarshal(b, &temp); err != nil {
+		return err
+	}
+	v.Value, v.UseInAppDefault = temp.Value, temp.UseInAppDefault
+	return nil
+}
+
+// ParameterGroup is a named group of parameters, used to organize parameters in the Firebase
+// console. A parameter must not be both in a group and in the top level Parameters of a Template.
+type ParameterGroup struct {
+	Description string                `json:"description,omitempty"`
+	Parameters  map[string]*Parameter `json:"parameters,omitempty"`
+}
+
+// Version describes a published version of a Remote Config template. Only the Description is
+// sent when publishing a template; all the other fields are populated by the server.
+type Version struct {
+	VersionNumber  string `json:"versionNumber,omitempty"`
+	UpdateTime     string `json:"updateTime,omitempty"`
+	UpdateOrigin   string `json:"updateOrigin,omitempty"`
+	UpdateType     string `json:"updateType,omitempty"`
+	UpdateUser     *User  `json:"updateUser,omitempty"`
+	Description    string `json:"description,omitempty"`
+	RollbackSource string `json:"rollbackSource,omitempty"`
+	IsLegacy       bool   `json:"isLegacy,omitempty"`
+}
+
+// User is the user that published a version of a Remote Config template.
+type User struct {
+	Email    string `json:"email,omitempty"`
+	Name     string `json:"name,omitempty"`
+	ImageURL string `json:"imageUrl,omitempty"`
+}
+
+// NewClient creates a new instance of the Firebase Remote Config Client.
+//
+// This function can only be invoked from within the SDK. Client applications should access the
+// the Remote Config service through firebase.App.
+func NewClient(ctx context.Context, c *internal.RemoteConfigConfig) (*Client, error) {
+	if c.ProjectID == "" {
+		return nil, errors.New("project id is required to access remote config client")
+	}
+
+	hc, err := internal.NewHTTPClient(ctx, c.Transport, c.Opts...)
+	if err != nil {
+		return nil, err
+	}
+	hc = internal.WithHeaders(hc, c.Headers, c.UserAgentSuffix)
+	hc = internal.Instrument(hc, c.Instrumentation, "remoteconfig")
+	hc = internal.WithGuard(hc, c.RequestGuard)
+
+	return &Client{
+		endpoint: remoteConfigEndpoint,
+		client: &internal.HTTPClient{
+			Client:      hc,
+			MaxBodySize: c.MaxResponseBodySize,
+			RetryConfig: internal.NewRetryConfig(c.MaxRetries),
+			Timeout:     c.RequestTimeout,
+		},
+		project: c.ProjectID,
+		version: "Go/Admin/" + c.Version,
+	}, nil
+}
+
+// GetTemplate returns the current active version of the Remote Config template of the project.
+func (c *Client) GetTemplate(ctx context.Context) (t *Template, err error) {
+	defer internal.WrapOpError(&err, "GetTemplate", "")
+	return c.makeRequest(ctx, http.MethodGet, nil, "", false)
+}
+
+// ValidateTemplate validates the given template on the server, without publishing it.
+//
+// Returns the validated template if it is valid, and an error otherwise. The ETag of the template
+// must be the one returned by GetTemplate().
+func (c *Client) ValidateTemplate(ctx context.Context, t *Template) (vt *Template, err error) {
+	defer internal.WrapOpError(&err, "ValidateTemplate", "")
+	if err := validateTemplate(t); err != nil {
+		return nil, err
+	}
+	vt, err = c.makeRequest(ctx, http.MethodPut, t, t.ETag, true)
+	if err != nil {
+		return nil, err
+	}
+	// The server returns a modified ETag for validated templates. Keep the original so that the
+	// validated template can be published as is.
+	vt.ETag = t.ETag
+	return vt, nil
+}
+
+// PublishTemplate publishes the given template as the new active version of the Remote Config
+// template of the project.
+//
+// The ETag of the template must be the one returned by GetTemplate(). If the template has been
+// modified on the server since then, the publish fails with an error for which IsVersionMismatch()
+// returns true. Returns the published template, with its new version and ETag.
+func (c *Client) PublishTemplate(ctx context.Context, t *Template) (pt *Template, err error) {
+	defer internal.WrapOpError(&err, "PublishTemplate", "")
+	if err := validateTemplate(t); err != nil {
+		return nil, err
+	}
+	return c.makeRequest(ctx, http.MethodPut, t, t.ETag, false)
+}
+
+// ForcePublishTemplate publishes the given template as the new active version of the Remote
+// Config template of the project, even if the template has been modified on the server since it
+// was retrieved.
+//
+// Concurrent changes made to the template are overwritten. Use PublishTemplate() instead, unless
+// overwriting is intended.
+func (c *Client) ForcePublishTemplate(ctx context.Context, t *Template) (pt *Template, err error) {
+	defer internal.WrapOpError(&err, "ForcePublishTemplate", "")
+	if t == nil {
+		return nil, errors.New("template must not be nil")
+	}
+	return c.makeRequest(ctx, http.MethodPut, t, "*", false)
+}
+
+// IsInternal checks if the given error was due to an internal server error.
+func IsInternal(err error) bool {
+	return internal.HasErrorCode(err, internalError)
+}
+
+// IsInvalidArgument checks if the given error was due to an invalid template or argument.
+func IsInvalidArgument(err error) bool {
+	return internal.HasErrorCode(err, invalidArgument)
+}
+
+// IsNotFound checks if the given error was due to a template or project that does not exist.
+func IsNotFound(err error) bool {
+	return internal.HasErrorCode(err, notFound)
+}
+
+// IsUnknown checks if the given error was due to unknown error returned by the backend server.
+func IsUnknown(err error) bool {
+	return internal.HasErrorCode(err, unknownError)
+}
+
+// IsVersionMismatch checks if the given error was due to the template being modified on the
+// server since it was retrieved.
+func IsVersionMismatch(err error) bool {
+	return internal.HasErrorCode(err, versionMismatch)
+}
+
+func validateTemplate(t *Template) error {
+	if t == nil {
+		return errors.New("template must not be nil")
+	}
+	if t.ETag == "" {
+		return errors.New("template etag must not be empty")
+	}
+	return nil
+}
+
+// templateRequest is the template payload sent to the server. It excludes the output-only
+// version fields.
+type templateRequest struct {
+	Conditions      []*Condition               `json:"conditions"`
+	Parameters      map[string]*Parameter      `json:"parameters"`
+	ParameterGroups map[string]*ParameterGroup `json:"parameterGroups"`
+	Version         *Version                   `json:"version,omitempty"`
+}
+
+type remoteConfigError struct {
+	Error struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (c *Client) makeRequest(
+	ctx context.Context, method string, t *Template, etag string, validateOnly bool) (*Template, error) {
+
+	opts := []internal.HTTPOption{internal.WithHeader("X-Firebase-Client", c.version)}
+	request := &internal.Request{
+		Method: method,
+		URL:    fmt.Sprintf("%s/projects/%s/remoteConfig", c.endpoint, c.project),
+	}
+	if t != nil {
+		body := &templateRequest{
+			Conditions:      t.Conditions,
+			Parameters:      t.Parameters,
+			ParameterGroups: t.ParameterGroups,
+		}
+		if body.Conditions == nil {
+			body.Conditions = []*Condition{}
+		}
+		if body.Parameters == nil {
+			body.Parameters = map[string]*Parameter{}
+		}
+		if body.ParameterGroups == nil {
+			body.ParameterGroups = map[string]*ParameterGroup{}
+		}
+		if t.Version != nil && t.Version.Description != "" {
+			body.Version = &Version{Description: t.Version.Description}
+		}
+		request.Body = internal.NewJSONEntity(body)
+		opts = append(opts, internal.WithHeader("If-Match", etag))
+	}
+	if validateOnly {
+		opts = append(opts, internal.WithQueryParam("validateOnly", "true"))
+	}
+	request.Opts = opts
+
+	resp, err := c.client.Do(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != http.StatusOK {
+		return nil, handleRemoteConfigError(resp)
+	}
+
+	var result Template
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		return nil, err
+	}
+	result.ETag = resp.Header.Get("ETag")
+	if result.ETag == "" {
+		return nil, errors.New("etag not present in the server response")
+	}
+	return &result, nil
+}
+
+func handleRemoteConfigError(resp *internal.Response) error {
+	var re remoteConfigError
+	json.Unmarshal(resp.Body, &re) // ignore any json parse errors at this level
+
+	var clientCode, msg string
+	info, ok := errorCodes[re.Error.Status]
+	if ok {
+		clientCode, msg = info.Code, info.Msg
+	} else {
+		clientCode = unknownError
+		msg = fmt.Sprintf("server responded with an unknown error; response: %s", string(resp.Body))
+	}
+	if re.Error.Message != "" {
+		msg += "; details: " + re.Error.Message
+	}
+	return internal.Errorf(clientCode, "http error status: %d; reason: %s", resp.Status, msg)
+}
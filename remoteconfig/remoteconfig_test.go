@@ -0,0 +1,346 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remoteconfig
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/api/option"
+
+	"firebase.google.com/go/internal"
+)
+
+const testETag = "etag-123456789012-1"
+
+var testRemoteConfigConfig = &internal.RemoteConfigConfig{
+	ProjectID: "test-project",
+	Opts: []option.ClientOption{
+		option.WithTokenSource(&internal.MockTokenSource{AccessToken: "test-token"}),
+	},
+	Version: "test-version",
+}
+
+const testTemplateJSON = `{
+	"conditions": [
+		{"name": "ios", "expression": "device.os == 'ios'", "tagColor": "BLUE"}
+	],
+	"parameters": {
+		"welcome_message": {
+			"defaultValue": {"value": "Welcome"},
+			"conditionalValues": {"ios": {"useInAppDefault": true}},
+			"description": "Welcome message",
+			"valueType": "STRING"
+		}
+	},
+	"parameterGroups": {
+		"new_users": {
+			"description": "New user settings",
+			"parameters": {
+				"tutorial": {"defaultValue": {"value": ""}}
+			}
+		}
+	},
+	"version": {
+		"versionNumber": "17",
+		"updateTime": "2018-04-20T09:00:00.000Z",
+		"updateOrigin": "ADMIN_SDK_NODE",
+		"updateType": "INCREMENTAL_UPDATE",
+		"updateUser": {"email": "user@example.com"},
+		"description": "previous version"
+	}
+}`
+
+var testTemplate = &Template{
+	Conditions: []*Condition{
+		{Name: "ios", Expression: "device.os == 'ios'", TagColor: "BLUE"},
+	},
+	Parameters: map[string]*Parameter{
+		"welcome_message": {
+			DefaultValue: &ParameterValue{Value: "Welcome"},
+			ConditionalValues: map[string]*ParameterValue{
+				"ios": {UseInAppDefault: true},
+			},
+			Description: "Welcome message",
+			ValueType:   "STRING",
+		},
+	},
+	ParameterGroups: map[string]*ParameterGroup{
+		"new_users": {
+			Description: "New user settings",
+			Parameters: map[string]*Parameter{
+				"tutorial": {DefaultValue: &ParameterValue{Value: ""}},
+			},
+		},
+	},
+	Version: &Version{
+		VersionNumber: "17",
+		UpdateTime:    "2018-04-20T09:00:00.000Z",
+		UpdateOrigin:  "ADMIN_SDK_NODE",
+		UpdateType:    "INCREMENTAL_UPDATE",
+		UpdateUser:    &User{Email: "user@example.com"},
+		Description:   "previous version",
+	},
+	ETag: testETag,
+}
+
+type mockServer struct {
+	status int
+	etag   string
+	resp   string
+
+	req  *http.Request
+	body []byte
+}
+
+func (s *mockServer) start(t *testing.T) (*Client, *httptest.Server) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.req = r
+		s.body, _ = ioutil.ReadAll(r.Body)
+		if s.etag != "" {
+			w.Header().Set("ETag", s.etag)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if s.status != 0 {
+			w.WriteHeader(s.status)
+		}
+		w.Write([]byte(s.resp))
+	}))
+	client, err := NewClient(context.Background(), testRemoteConfigConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.endpoint = ts.URL
+	return client, ts
+}
+
+func TestNoProjectID(t *testing.T) {
+	client, err := NewClient(context.Background(), &internal.RemoteConfigConfig{})
+	if client != nil || err == nil {
+		t.Errorf("NewClient() = (%v, %v); want = (nil, error)", client, err)
+	}
+}
+
+func TestGetTemplate(t *testing.T) {
+	s := &mockServer{etag: testETag, resp: testTemplateJSON}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	got, err := client.GetTemplate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, testTemplate) {
+		t.Errorf("GetTemplate() = %#v; want = %#v", got, testTemplate)
+	}
+	checkRequest(t, s, http.MethodGet, "", "")
+}
+
+func TestGetTemplateNoETag(t *testing.T) {
+	s := &mockServer{resp: testTemplateJSON}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	if got, err := client.GetTemplate(context.Background()); got != nil || err == nil {
+		t.Errorf("GetTemplate() = (%v, %v); want = (nil, error)", got, err)
+	}
+}
+
+func TestPublishTemplate(t *testing.T) {
+	s := &mockServer{etag: "etag-123456789012-2", resp: testTemplateJSON}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	got, err := client.PublishTemplate(context.Background(), testTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ETag != "etag-123456789012-2" {
+		t.Errorf("ETag = %q; want = %q", got.ETag, "etag-123456789012-2")
+	}
+	checkRequest(t, s, http.MethodPut, testETag, "")
+	checkTemplateBody(t, s.body)
+}
+
+func TestForcePublishTemplate(t *testing.T) {
+	s := &mockServer{etag: "etag-123456789012-2", resp: testTemplateJSON}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	tmpl := *testTemplate
+	tmpl.ETag = ""
+	if _, err := client.ForcePublishTemplate(context.Background(), &tmpl); err != nil {
+		t.Fatal(err)
+	}
+	checkRequest(t, s, http.MethodPut, "*", "")
+	checkTemplateBody(t, s.body)
+}
+
+func TestValidateTemplate(t *testing.T) {
+	s := &mockServer{etag: "etag-123456789012-0", resp: testTemplateJSON}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	got, err := client.ValidateTemplate(context.Background(), testTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ETag != testETag {
+		t.Errorf("ETag = %q; want = %q", got.ETag, testETag)
+	}
+	checkRequest(t, s, http.MethodPut, testETag, "true")
+	checkTemplateBody(t, s.body)
+}
+
+func TestEmptyTemplate(t *testing.T) {
+	s := &mockServer{etag: testETag, resp: "{}"}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	if _, err := client.PublishTemplate(context.Background(), &Template{ETag: testETag}); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(s.body, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"conditions":      []interface{}{},
+		"parameters":      map[string]interface{}{},
+		"parameterGroups": map[string]interface{}{},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Body = %v; want = %v", got, want)
+	}
+}
+
+func TestInvalidTemplate(t *testing.T) {
+	client, err := NewClient(context.Background(), testRemoteConfigConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	noETag := &Template{}
+	if got, err := client.ValidateTemplate(ctx, nil); got != nil || err == nil {
+		t.Errorf("ValidateTemplate(nil) = (%v, %v); want = (nil, error)", got, err)
+	}
+	if got, err := client.ValidateTemplate(ctx, noETag); got != nil || err == nil {
+		t.Errorf("ValidateTemplate(noETag) = (%v, %v); want = (nil, error)", got, err)
+	}
+	if got, err := client.PublishTemplate(ctx, nil); got != nil || err == nil {
+		t.Errorf("PublishTemplate(nil) = (%v, %v); want = (nil, error)", got, err)
+	}
+	if got, err := client.PublishTemplate(ctx, noETag); got != nil || err == nil {
+		t.Errorf("PublishTemplate(noETag) = (%v, %v); want = (nil, error)", got, err)
+	}
+	if got, err := client.ForcePublishTemplate(ctx, nil); got != nil || err == nil {
+		t.Errorf("ForcePublishTemplate(nil) = (%v, %v); want = (nil, error)", got, err)
+	}
+}
+
+func TestTemplateError(t *testing.T) {
+	cases := []struct {
+		status int
+		resp   string
+		want   string
+		check  func(error) bool
+	}{
+		{
+			status: http.StatusConflict,
+			resp:   `{"error": {"status": "ABORTED", "message": "etag mismatch"}}`,
+			want: "PublishTemplate: http error status: 409; reason: template has been modified since it was " +
+				"retrieved; code: version-mismatch; details: etag mismatch",
+			check: IsVersionMismatch,
+		},
+		{
+			status: http.StatusBadRequest,
+			resp:   `{"error": {"status": "INVALID_ARGUMENT", "message": "bad condition"}}`,
+			want: "PublishTemplate: http error status: 400; reason: request contains an invalid argument; " +
+				"code: invalid-argument; details: bad condition",
+			check: IsInvalidArgument,
+		},
+		{
+			status: http.StatusNotFound,
+			resp:   `{"error": {"status": "NOT_FOUND", "message": "no project"}}`,
+			want: "PublishTemplate: http error status: 404; reason: template or project not found; " +
+				"code: not-found; details: no project",
+			check: IsNotFound,
+		},
+		{
+			status: http.StatusInternalServerError,
+			resp:   `{"error": {"status": "INTERNAL", "message": "test error"}}`,
+			want: "PublishTemplate: http error status: 500; reason: backend servers encountered an unknown " +
+				"internal error; code: internal-error; details: test error",
+			check: IsInternal,
+		},
+		{
+			status: http.StatusInternalServerError,
+			resp:   "{}",
+			want:   "PublishTemplate: http error status: 500; reason: server responded with an unknown error; response: {}",
+			check:  IsUnknown,
+		},
+	}
+	for _, tc := range cases {
+		s := &mockServer{status: tc.status, resp: tc.resp}
+		client, ts := s.start(t)
+		got, err := client.PublishTemplate(context.Background(), testTemplate)
+		ts.Close()
+		if got != nil || err == nil || err.Error() != tc.want || !tc.check(err) {
+			t.Errorf("PublishTemplate() = (%v, %v); want = (nil, %q)", got, err, tc.want)
+		}
+	}
+}
+
+func checkRequest(t *testing.T, s *mockServer, method, ifMatch, validateOnly string) {
+	if s.req.Method != method || s.req.URL.Path != "/projects/test-project/remoteConfig" {
+		t.Errorf("Request = %s %s; want = %s /projects/test-project/remoteConfig",
+			s.req.Method, s.req.URL.Path, method)
+	}
+	if h := s.req.Header.Get("If-Match"); h != ifMatch {
+		t.Errorf("If-Match = %q; want = %q", h, ifMatch)
+	}
+	if v := s.req.URL.Query().Get("validateOnly"); v != validateOnly {
+		t.Errorf("validateOnly = %q; want = %q", v, validateOnly)
+	}
+	if h := s.req.Header.Get("Authorization"); h != "Bearer test-token" {
+		t.Errorf("Authorization = %q; want = %q", h, "Bearer test-token")
+	}
+	if h := s.req.Header.Get("X-Firebase-Client"); h != "Go/Admin/test-version" {
+		t.Errorf("X-Firebase-Client = %q; want = %q", h, "Go/Admin/test-version")
+	}
+}
+
+func checkTemplateBody(t *testing.T, b []byte) {
+	var got map[string]interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	var want map[string]interface{}
+	if err := json.Unmarshal([]byte(testTemplateJSON), &want); err != nil {
+		t.Fatal(err)
+	}
+	// Only the description of the version is sent to the server.
+	want["version"] = map[string]interface{}{"description": "previous version"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Body = %v; want = %v", got, want)
+	}
+}
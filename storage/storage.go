@@ -42,6 +42,11 @@ func NewClient(ctx context.Context, c *internal.StorageConfig) (*Client, error)
 	return &Client{client: client, bucket: c.Bucket}, nil
 }
 
+// Close closes the connections of the Client to Cloud Storage.
+func (c *Client) Close() error {
+	return c.client.Close()
+}
+
 // DefaultBucket returns a handle to the default Cloud Storage bucket.
 //
 // To use this method, the default bucket name must be specified via firebase.Config when